@@ -0,0 +1,98 @@
+package wemo
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	faultCodeRE        = regexp.MustCompile(`<errorCode>(\d+)</errorCode>`)
+	faultDescriptionRE = regexp.MustCompile(`<errorDescription>([^<]*)</errorDescription>`)
+)
+
+// ActionError is returned when a device answers a SOAP action with anything
+// but 200 OK. Code and Description carry the UPnP fault, when there is one.
+type ActionError struct {
+	Action      string
+	StatusCode  int
+	Code        int
+	Description string
+}
+
+func (e *ActionError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("%s failed => UPnP error %d: %s", e.Action, e.Code, e.Description)
+	}
+	return fmt.Sprintf("%s returned status code => %d", e.Action, e.StatusCode)
+}
+
+func newActionError(action string, statusCode int, body []byte) *ActionError {
+	e := &ActionError{Action: action, StatusCode: statusCode}
+	if matches := faultCodeRE.FindSubmatch(body); len(matches) == 2 {
+		e.Code, _ = strconv.Atoi(string(matches[1]))
+	}
+	if matches := faultDescriptionRE.FindSubmatch(body); len(matches) == 2 {
+		e.Description = html.UnescapeString(string(matches[1]))
+	}
+	return e
+}
+
+// action invokes a SOAP action on one of the device services and returns the
+// raw response body.
+func (d *Device) action(ctx context.Context, service, action string, args ...actionArgument) (data []byte, err error) {
+	ctx, span := startSpan(ctx, "wemo "+service+"#"+action, trace.SpanKindClient,
+		AttrDevice.String(d.Host), AttrService.String(service), AttrAction.String(action))
+	start := time.Now()
+	message := newActionMessage(service, action, args...)
+	var statusCode int
+	var body []byte
+	defer func() {
+		endSpan(span, err)
+		metrics().Request(service, action, time.Since(start), err)
+		if hook := actionHook(); hook != nil {
+			hook(ActionExchange{Host: d.Host, Service: service, Action: action, Request: []byte(message),
+				StatusCode: statusCode, Response: body, Duration: time.Since(start), Err: err})
+		}
+	}()
+
+	response, err := postContext(ctx, d.Host, service, action, message)
+	if err != nil {
+		return nil, fmt.Errorf("unable to %s on %s => %w", action, d.Host, err)
+	}
+	defer response.Body.Close()
+	statusCode = response.StatusCode
+	span.SetAttributes(AttrStatusCode.Int(response.StatusCode))
+
+	body, err = ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s response => %s", action, err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, newActionError(action, response.StatusCode, body)
+	}
+
+	return body, nil
+}
+
+// responseValue extracts the text of the named element from a SOAP response.
+func responseValue(data []byte, name string) (string, error) {
+	re, err := regexp.Compile(`<` + regexp.QuoteMeta(name) + `>([^<]*)</` + regexp.QuoteMeta(name) + `>`)
+	if err != nil {
+		return "", err
+	}
+
+	matches := re.FindSubmatch(data)
+	if len(matches) != 2 {
+		return "", fmt.Errorf("unable to find %s in response => %s", name, string(data))
+	}
+	return html.UnescapeString(string(matches[1])), nil
+}
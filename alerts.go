@@ -0,0 +1,125 @@
+package wemo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// AlertCondition is the comparison an AlertRule applies to the current power.
+type AlertCondition int
+
+// Alert conditions
+const (
+	PowerAbove AlertCondition = iota
+	PowerBelow
+)
+
+// AlertRule fires when the power of a device has been above or below Power
+// (in W) for at least For, e.g. a freezer drawing less than 1 W for ten
+// minutes. OnAlert is called once when the rule fires and OnClear, if set, once
+// the condition no longer holds.
+type AlertRule struct {
+	Name      string
+	Condition AlertCondition
+	Power     float64
+	For       time.Duration
+	OnAlert   func(Alert)
+	OnClear   func(Alert)
+}
+
+func (r *AlertRule) matches(reading InsightReading) bool {
+	power := reading.Params.PowerW()
+	if r.Condition == PowerBelow {
+		return power < r.Power
+	}
+	return power > r.Power
+}
+
+// Alert describes a rule firing (or clearing) for a device.
+type Alert struct {
+	Rule    *AlertRule
+	Host    string
+	Since   time.Time // when the condition started to hold
+	Reading InsightReading
+}
+
+type alertKey struct {
+	rule *AlertRule
+	host string
+}
+
+type alertState struct {
+	since  time.Time
+	firing bool
+}
+
+// AlertEvaluator evaluates a set of rules against the readings of one or more
+// devices. It is safe for concurrent use.
+type AlertEvaluator struct {
+	rules []*AlertRule
+
+	mu    sync.Mutex
+	state map[alertKey]*alertState
+}
+
+// NewAlertEvaluator returns an evaluator for rules.
+func NewAlertEvaluator(rules ...*AlertRule) *AlertEvaluator {
+	return &AlertEvaluator{rules: rules, state: make(map[alertKey]*alertState)}
+}
+
+// Evaluate feeds a reading to every rule, invoking callbacks as rules fire and
+// clear. Callbacks run synchronously on the calling goroutine.
+func (e *AlertEvaluator) Evaluate(reading InsightReading) {
+	var pending []func()
+
+	e.mu.Lock()
+	for _, rule := range e.rules {
+		key := alertKey{rule, reading.Host}
+		state, tracked := e.state[key]
+
+		if !rule.matches(reading) {
+			if tracked {
+				delete(e.state, key)
+				if state.firing && rule.OnClear != nil {
+					alert := Alert{rule, reading.Host, state.since, reading}
+					pending = append(pending, func() { rule.OnClear(alert) })
+				}
+			}
+			continue
+		}
+
+		if !tracked {
+			state = &alertState{since: reading.Time}
+			e.state[key] = state
+		}
+		if !state.firing && reading.Time.Sub(state.since) >= rule.For {
+			state.firing = true
+			if rule.OnAlert != nil {
+				alert := Alert{rule, reading.Host, state.since, reading}
+				pending = append(pending, func() { rule.OnAlert(alert) })
+			}
+		}
+	}
+	e.mu.Unlock()
+
+	for _, callback := range pending {
+		callback()
+	}
+}
+
+// Run evaluates readings until the channel is closed or ctx is done, e.g. with
+// the stream returned by Device.PollInsight.
+func (e *AlertEvaluator) Run(ctx context.Context, readings <-chan InsightReading) {
+	for {
+		select {
+		case reading, ok := <-readings:
+			if !ok {
+				return
+			}
+			e.Evaluate(reading)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
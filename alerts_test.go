@@ -0,0 +1,37 @@
+package wemo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlertEvaluator(t *testing.T) {
+	var fired, cleared []Alert
+	rule := &AlertRule{
+		Name:      "freezer off",
+		Condition: PowerBelow,
+		Power:     1,
+		For:       10 * time.Minute,
+		OnAlert:   func(a Alert) { fired = append(fired, a) },
+		OnClear:   func(a Alert) { cleared = append(cleared, a) },
+	}
+	e := NewAlertEvaluator(rule)
+
+	start := time.Date(2020, 6, 1, 8, 0, 0, 0, time.UTC)
+	powers := []float64{90000, 0, 0, 0, 0, 90000}
+	for i, mW := range powers {
+		r := reading(start.Add(time.Duration(i)*5*time.Minute), mW)
+		r.Host = "10.0.0.2:49153"
+		e.Evaluate(r)
+	}
+
+	if len(fired) != 1 {
+		t.Fatalf("Expected: 1 alert, got: %d", len(fired))
+	}
+	if !fired[0].Since.Equal(start.Add(5*time.Minute)) || !fired[0].Reading.Time.Equal(start.Add(15*time.Minute)) {
+		t.Errorf("Expected: alert at 08:15 since 08:05, got: %+v", fired[0])
+	}
+	if len(cleared) != 1 || !cleared[0].Reading.Time.Equal(start.Add(25*time.Minute)) {
+		t.Errorf("Expected: clear at 08:25, got: %+v", cleared)
+	}
+}
@@ -0,0 +1,51 @@
+package wemo
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultParallelism is the number of devices Apply commands at once when
+// Manager.Parallelism is not set.
+const DefaultParallelism = 4
+
+// Apply runs the command on every device matching the selector, on up to
+// Parallelism devices at once. It returns the result per device key, nil for
+// the devices the command succeeded on, so callers can retry just the
+// failures. A failing device doesn't stop the others. Devices that can't run
+// the command, e.g. bulb commands on a plain switch, get an *UnsupportedError
+// without being contacted.
+func (m *Manager) Apply(ctx context.Context, selector Selector, command Command) (map[string]error, error) {
+	if err := command.Validate(); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]error)
+	m.forEach(selector, func(entry ManagedDevice) {
+		var err error
+		switch needs := commandCapability(command); {
+		case !entry.Capabilities().Has(needs):
+			err = &UnsupportedError{Device: entry.Name, Needs: needs}
+		case command.Action == CommandOn, command.Action == CommandOff:
+			err = m.setBinaryState(ctx, entry.Key, command.Action == CommandOn)
+		default:
+			err = m.serialize(ctx, entry.Key, func(device *Device) error { return command.Run(ctx, device) })
+			if err == nil && command.Action == CommandToggle {
+				m.Invalidate(entry.Key)
+			}
+		}
+
+		mu.Lock()
+		results[entry.Key] = err
+		mu.Unlock()
+	})
+	return results, nil
+}
+
+func commandCapability(command Command) Capability {
+	if command.Action == CommandBulb {
+		return CapBulbs
+	}
+	return CapSwitch
+}
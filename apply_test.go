@@ -0,0 +1,44 @@
+package wemo
+
+import (
+	"context"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	kettle := newFakeDevice(t, "uuid:Socket-1_0-A", "Kettle", "A")
+	defer kettle.Close()
+	toaster := newFakeDevice(t, "uuid:Socket-1_0-B", "Toaster", "B")
+	defer toaster.Close()
+	porch := newFakeDevice(t, "uuid:Socket-1_0-C", "Porch", "C")
+	defer porch.Close()
+
+	m := NewManager()
+	m.Parallelism = 2
+	for _, f := range []*fakeDevice{kettle, toaster, porch} {
+		m.Put(ManagedDevice{Name: f.name, Host: f.host(), UDN: f.udn})
+	}
+	m.Put(ManagedDevice{Name: "Gone", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-D"})
+	for _, key := range []string{kettle.udn, toaster.udn, "uuid:Socket-1_0-D"} {
+		m.SetLabel(key, "room", "kitchen")
+	}
+
+	selector, _ := ParseSelector("room=kitchen")
+	results, err := m.Apply(context.Background(), selector, Command{Action: CommandOn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[kettle.udn] != nil || results[toaster.udn] != nil || results["uuid:Socket-1_0-D"] == nil {
+		t.Errorf("Expected: Gone to fail, got: %v", results)
+	}
+	if kettle.state != "1" || toaster.state != "1" || porch.state != "0" {
+		t.Errorf("Expected: the kitchen on, got: %s, %s, %s", kettle.state, toaster.state, porch.state)
+	}
+	if state, _ := m.BinaryState(context.Background(), kettle.udn); state != 1 || kettle.calls["GetBinaryState"] != 0 {
+		t.Errorf("Expected: the new state to be cached, got: %d", state)
+	}
+
+	if _, err := m.Apply(context.Background(), selector, Command{Action: "explode"}); err == nil {
+		t.Errorf("Expected: an invalid command")
+	}
+}
@@ -0,0 +1,53 @@
+package wemo
+
+import (
+	"context"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBridgeGroups(t *testing.T) {
+	requests := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- html.UnescapeString(string(body))
+		if strings.Contains(r.Header.Get("SOAPACTION"), "GetEndDevices") {
+			list := `<DeviceLists><DeviceList><DeviceListType>Paired</DeviceListType><DeviceInfos><DeviceInfo><DeviceID>C</DeviceID></DeviceInfo></DeviceInfos>` +
+				`<GroupInfos><GroupInfo><GroupID>1500000000</GroupID><GroupName>Living Room</GroupName><DeviceInfos><DeviceInfo><DeviceID>A</DeviceID></DeviceInfo><DeviceInfo><DeviceID>B</DeviceID></DeviceInfo></DeviceInfos></GroupInfo></GroupInfos></DeviceList></DeviceLists>`
+			w.Write([]byte(testMessageHeader + `<u:GetEndDevicesResponse xmlns:u="urn:Belkin:service:bridge:1"><DeviceLists>` + html.EscapeString(list) + `</DeviceLists></u:GetEndDevicesResponse>` + testMessageFooter))
+			return
+		}
+		w.Write([]byte(testMessageHeader + `<u:CreateGroupResponse xmlns:u="urn:Belkin:service:bridge:1"></u:CreateGroupResponse>` + testMessageFooter))
+	}))
+	defer server.Close()
+	device := &Device{Host: strings.TrimPrefix(server.URL, "http://")}
+
+	groups, err := device.FetchBridgeGroups(context.Background(), "uuid:Bridge-1_0-X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []BridgeGroup{{ID: "1500000000", Name: "Living Room", Bulbs: []string{"A", "B"}}}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Expected: %+v, got: %+v", expected, groups)
+	}
+	if request := <-requests; !strings.Contains(request, "<DevUDN>uuid:Bridge-1_0-X</DevUDN>") {
+		t.Errorf("Expected: the UDN of the bridge, got: %s", request)
+	}
+
+	group, err := device.CreateBridgeGroup(context.Background(), "Kitchen & Hall", []string{"C", "D"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := <-requests
+	if !strings.Contains(request, "<GroupID>"+group.ID+"</GroupID>") || !strings.Contains(request, "<DeviceIDList>C,D</DeviceIDList>") {
+		t.Errorf("Unexpected CreateGroup request: %s", request)
+	}
+	if _, err := device.CreateBridgeGroup(context.Background(), "Empty", nil); err == nil {
+		t.Error("Expected: an error for a group without bulbs, got: nil")
+	}
+}
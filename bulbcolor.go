@@ -0,0 +1,90 @@
+package wemo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Capabilities of bridge end devices beyond on, off and dim.
+const (
+	capColorXY          = "10300" // x:y:transition, x and y scaled to 65535
+	capColorTemperature = "30301" // mireds:transition
+)
+
+// Bounds of the color temperatures SetBulbColorTemperature takes, in kelvin.
+const (
+	MinColorTemperature = 1000
+	MaxColorTemperature = 10000
+)
+
+// transitionValue returns transition in the tenths of a second the bridge
+// expects.
+func transitionValue(transition time.Duration) string {
+	return strconv.Itoa(int(transition / (100 * time.Millisecond)))
+}
+
+// SetBulbColorTemperature sets the white of a bulb, or a group with group, to
+// kelvin, fading to it over transition. Bulbs clamp it to what they can show,
+// e.g. 2700 to 6500 K.
+func (d *Device) SetBulbColorTemperature(ctx context.Context, id string, kelvin int, transition time.Duration, group bool) error {
+	if id == "" {
+		return errors.New("No ID provided")
+	}
+	if kelvin < MinColorTemperature || kelvin > MaxColorTemperature {
+		return fmt.Errorf("color temperature %d K is out of bounds %d-%d", kelvin, MinColorTemperature, MaxColorTemperature)
+	}
+	mireds := int(math.Round(1e6 / float64(kelvin)))
+	return d.setDeviceStatus(ctx, id, capColorTemperature, fmt.Sprintf("%d:%s", mireds, transitionValue(transition)), group)
+}
+
+// SetBulbColor sets the color of a bulb, or a group with group, fading to it
+// over transition. Bulbs show the closest color they can.
+func (d *Device) SetBulbColor(ctx context.Context, id string, c color.Color, transition time.Duration, group bool) error {
+	if id == "" {
+		return errors.New("No ID provided")
+	}
+	x, y := colorXY(c)
+	value := fmt.Sprintf("%d:%d:%s", int(math.Round(x*65535)), int(math.Round(y*65535)), transitionValue(transition))
+	return d.setDeviceStatus(ctx, id, capColorXY, value, group)
+}
+
+// colorXY returns the CIE 1931 chromaticity of an sRGB color. Black has none
+// and is taken to be the D65 white point.
+func colorXY(c color.Color) (x, y float64) {
+	r, g, b, _ := c.RGBA()
+	linear := func(v uint32) float64 {
+		f := float64(v) / 0xffff
+		if f <= 0.04045 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	rl, gl, bl := linear(r), linear(g), linear(b)
+
+	X := 0.4124*rl + 0.3576*gl + 0.1805*bl
+	Y := 0.2126*rl + 0.7152*gl + 0.0722*bl
+	Z := 0.0193*rl + 0.1192*gl + 0.9505*bl
+	if sum := X + Y + Z; sum > 0 {
+		return X / sum, Y / sum
+	}
+	return 0.3127, 0.3290
+}
+
+// ParseColor parses a color written as #rrggbb or #rgb, the # being optional.
+func ParseColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return color.RGBA{}, fmt.Errorf("unable to parse color %q, expected e.g. #ff8800", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
@@ -0,0 +1,71 @@
+package wemo
+
+import (
+	"context"
+	"html"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetBulbColor(t *testing.T) {
+	statuses := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		status := html.UnescapeString(string(body))
+		capability, _ := responseValue([]byte(status), "CapabilityID")
+		value, _ := responseValue([]byte(status), "CapabilityValue")
+		statuses <- capability + "=" + value
+		w.Write([]byte(testMessageHeader + `<u:SetDeviceStatusResponse xmlns:u="urn:Belkin:service:bridge:1"><ErrorDeviceIDs></ErrorDeviceIDs></u:SetDeviceStatusResponse>` + testMessageFooter))
+	}))
+	defer server.Close()
+	device := &Device{Host: strings.TrimPrefix(server.URL, "http://")}
+
+	if err := device.SetBulbColorTemperature(context.Background(), "94103EF6BF42867F", 2700, 2*time.Second, false); err != nil {
+		t.Fatal(err)
+	}
+	if status := <-statuses; status != "30301=370:20" {
+		t.Errorf("Expected: 30301=370:20, got: %s", status)
+	}
+	if err := device.SetBulbColorTemperature(context.Background(), "94103EF6BF42867F", 500, 0, false); err == nil {
+		t.Error("Expected: an error for 500 K, got: nil")
+	}
+
+	red, _ := ParseColor("#f00")
+	if err := device.SetBulbColor(context.Background(), "94103EF6BF42867F", red, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	// sRGB red is at x 0.64, y 0.33.
+	if status := <-statuses; status != "10300=41947:21625:0" {
+		t.Errorf("Expected: 10300=41947:21625:0, got: %s", status)
+	}
+}
+
+func TestColorXY(t *testing.T) {
+	for _, test := range []struct {
+		color color.Color
+		x, y  float64
+	}{
+		{color.RGBA{0xff, 0xff, 0xff, 0xff}, 0.3127, 0.3290},
+		{color.RGBA{0, 0xff, 0, 0xff}, 0.30, 0.60},
+		{color.RGBA{0, 0, 0xff, 0xff}, 0.15, 0.06},
+		{color.Black, 0.3127, 0.3290},
+	} {
+		x, y := colorXY(test.color)
+		if math.Abs(x-test.x) > 0.001 || math.Abs(y-test.y) > 0.001 {
+			t.Errorf("Expected: %v at %.4f, %.4f, got: %.4f, %.4f", test.color, test.x, test.y, x, y)
+		}
+	}
+
+	if c, err := ParseColor("ff8800"); err != nil || c != (color.RGBA{0xff, 0x88, 0, 0xff}) {
+		t.Errorf("Expected: #ff8800, got: %v (%v)", c, err)
+	}
+	if _, err := ParseColor("#ff88"); err == nil {
+		t.Error("Expected: an error for #ff88, got: nil")
+	}
+}
@@ -0,0 +1,86 @@
+package wemo
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Capability is a set of things a device type can do.
+type Capability int
+
+// Capabilities
+const (
+	CapSwitch  Capability = 1 << iota // on and off
+	CapDim                            // brightness, see SetBrightness
+	CapInsight                        // power readings
+	CapBulbs                          // bridge end devices
+	CapSensor                         // reports motion, can't be switched
+)
+
+var capabilityNames = []string{"switch", "dim", "insight", "bulbs", "sensor"}
+
+// Has reports whether all of other are in c.
+func (c Capability) Has(other Capability) bool {
+	return c&other == other
+}
+
+func (c Capability) String() string {
+	var names []string
+	for i, name := range capabilityNames {
+		if c&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+var (
+	capabilitiesMu sync.RWMutex
+	capabilities   = map[string]Capability{
+		Controllee:  CapSwitch,
+		LightSwitch: CapSwitch,
+		Dimmer:      CapSwitch | CapDim,
+		Insight:     CapSwitch | CapInsight,
+		Bridge:      CapBulbs,
+		Sensor:      CapSensor,
+	}
+)
+
+// RegisterCapabilities declares what devices of a type can do, e.g. for device
+// types this package doesn't know.
+func RegisterCapabilities(deviceType string, c Capability) {
+	capabilitiesMu.Lock()
+	defer capabilitiesMu.Unlock()
+	capabilities[deviceType] = c
+}
+
+// CapabilitiesOf returns what devices of a type can do. Unknown types are
+// assumed to be switches.
+func CapabilitiesOf(deviceType string) Capability {
+	capabilitiesMu.RLock()
+	defer capabilitiesMu.RUnlock()
+	if c, ok := capabilities[deviceType]; ok {
+		return c
+	}
+	return CapSwitch
+}
+
+// Capabilities returns what the device can do, by its device type.
+func (m *ManagedDevice) Capabilities() Capability {
+	return CapabilitiesOf(m.DeviceType)
+}
+
+// UnsupportedError is returned instead of sending a device an action it
+// doesn't support.
+type UnsupportedError struct {
+	Device string
+	Needs  Capability
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("device %s doesn't support %s", e.Device, e.Needs)
+}
@@ -0,0 +1,44 @@
+package wemo
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCapabilityRouting(t *testing.T) {
+	plug := newFakeDevice(t, "uuid:Socket-1_0-A", "Plug", "A")
+	defer plug.Close()
+	motion := newFakeDevice(t, "uuid:Sensor-1_0-B", "Motion", "B")
+	defer motion.Close()
+
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Plug", Host: plug.host(), UDN: plug.udn, DeviceType: Controllee})
+	m.Put(ManagedDevice{Name: "Motion", Host: motion.host(), UDN: motion.udn, DeviceType: Sensor})
+	m.SetGroup(Group{Name: "hall", Members: []GroupMember{{Device: plug.udn}, {Device: motion.udn}, {Device: plug.udn, Bulb: "94103EA2B27751AB"}}})
+
+	// the plug degrades to on, the sensor and the bulb on a plug are skipped
+	err := m.GroupSetLevel(context.Background(), "hall", 30)
+	var gerr *GroupError
+	if !errors.As(err, &gerr) || len(gerr.Failed) != 2 {
+		t.Fatalf("Expected: the sensor and the bulb to fail, got: %v", err)
+	}
+	var uerr *UnsupportedError
+	if !errors.As(gerr.Failed[motion.udn], &uerr) || uerr.Needs != CapSwitch {
+		t.Errorf("Expected: the sensor not to be switchable, got: %v", gerr.Failed[motion.udn])
+	}
+	if plug.state != "1" || plug.brightness != "" || len(plug.bulbs) != 0 || len(motion.calls) != 0 {
+		t.Errorf("Expected: only a plain state set, got: %s, %q, %v, %v", plug.state, plug.brightness, plug.bulbs, motion.calls)
+	}
+
+	results, _ := m.Apply(context.Background(), nil, Command{Action: CommandBulb, BulbID: "94103EA2B27751AB", BulbCmd: "on"})
+	if !errors.As(results[plug.udn], &uerr) || uerr.Needs != CapBulbs {
+		t.Errorf("Expected: bulb commands to be refused, got: %v", results)
+	}
+
+	RegisterCapabilities("urn:Belkin:device:fancy:1", CapSwitch|CapDim)
+	defer RegisterCapabilities("urn:Belkin:device:fancy:1", CapSwitch)
+	if c := CapabilitiesOf("urn:Belkin:device:fancy:1"); c.String() != "switch,dim" {
+		t.Errorf("Expected: switch,dim, got: %s", c)
+	}
+}
@@ -17,6 +17,7 @@ package wemo
 import (
 	"net"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -41,3 +42,28 @@ func newTimeoutClient(connectTimeout time.Duration, readWriteTimeout time.Durati
 		},
 	}
 }
+
+var (
+	transportMu     sync.RWMutex
+	activeTransport http.RoundTripper
+)
+
+// SetTransport makes the context aware methods of devices send their HTTP
+// requests through rt instead of the network, e.g. to record or replay them in
+// tests, see package wemotest; nil restores the network.
+func SetTransport(rt http.RoundTripper) {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	activeTransport = rt
+}
+
+// httpClient returns the client to send requests with, fallback unless a
+// transport is set.
+func httpClient(fallback *http.Client) *http.Client {
+	transportMu.RLock()
+	defer transportMu.RUnlock()
+	if activeTransport != nil {
+		return &http.Client{Transport: activeTransport}
+	}
+	return fallback
+}
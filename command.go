@@ -0,0 +1,79 @@
+package wemo
+
+import (
+	"context"
+	"fmt"
+)
+
+// CommandAction names what a Command does.
+type CommandAction string
+
+// Command actions
+const (
+	CommandOn     CommandAction = "on"
+	CommandOff    CommandAction = "off"
+	CommandToggle CommandAction = "toggle"
+	CommandBulb   CommandAction = "bulb"
+)
+
+// Command is a device action that can be stored and replayed, e.g. by the
+// Scheduler. Bulb commands address a bridge end device by BulbID and carry the
+// bulb command ("on", "off" or "dim") in BulbCmd and its Value.
+type Command struct {
+	Action  CommandAction `json:"action"`
+	BulbID  string        `json:"bulb_id,omitempty"`
+	BulbCmd string        `json:"bulb_cmd,omitempty"`
+	Value   string        `json:"value,omitempty"`
+	Group   bool          `json:"group,omitempty"`
+}
+
+// Validate checks that the command is complete.
+func (c Command) Validate() error {
+	switch c.Action {
+	case CommandOn, CommandOff, CommandToggle:
+		return nil
+	case CommandBulb:
+		if c.BulbID == "" {
+			return fmt.Errorf("bulb command without a bulb id")
+		}
+		switch c.BulbCmd {
+		case "on", "off":
+			return nil
+		case "dim":
+			if c.Value == "" {
+				return fmt.Errorf("dim command without a value")
+			}
+			return nil
+		}
+		return fmt.Errorf("unknown bulb command %q", c.BulbCmd)
+	}
+	return fmt.Errorf("unknown command %q", c.Action)
+}
+
+func (c Command) String() string {
+	if c.Action == CommandBulb {
+		return fmt.Sprintf("bulb %s %s %s", c.BulbID, c.BulbCmd, c.Value)
+	}
+	return string(c.Action)
+}
+
+// Run sends the command to the device.
+func (c Command) Run(ctx context.Context, d *Device) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	switch c.Action {
+	case CommandOn:
+		return d.SetBinaryState(ctx, true)
+	case CommandOff:
+		return d.SetBinaryState(ctx, false)
+	case CommandToggle:
+		state, err := d.FetchBinaryState(ctx)
+		if err != nil {
+			return err
+		}
+		return d.SetBinaryState(ctx, state == 0)
+	}
+	return d.SetBulb(ctx, c.BulbID, c.BulbCmd, c.Value, c.Group)
+}
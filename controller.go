@@ -0,0 +1,38 @@
+package wemo
+
+import "context"
+
+// Controller is what most applications do with a device: read it and switch
+// it. *Device implements it; accept a Controller instead to substitute a stub
+// in tests, or a device of package wemotest.
+type Controller interface {
+	FetchDeviceInfo(ctx context.Context) (*DeviceInfo, error)
+	FetchBinaryState(ctx context.Context) (int, error)
+	SetBinaryState(ctx context.Context, on bool) error
+}
+
+// DimmerController is a Controller of a Dimmer.
+type DimmerController interface {
+	Controller
+	FetchBrightness(ctx context.Context) (int, error)
+	SetBrightness(ctx context.Context, level int) error
+}
+
+// InsightController is a Controller of an Insight.
+type InsightController interface {
+	Controller
+	FetchInsightParams(ctx context.Context) (*InsightParams, error)
+}
+
+// BridgeController is a Controller of a Bridge and its bulbs.
+type BridgeController interface {
+	Controller
+	FetchBulbStatus(ctx context.Context, ids string) (map[string]string, error)
+	SetBulb(ctx context.Context, id, cmd, value string, group bool) error
+}
+
+var (
+	_ DimmerController  = (*Device)(nil)
+	_ InsightController = (*Device)(nil)
+	_ BridgeController  = (*Device)(nil)
+)
@@ -0,0 +1,114 @@
+package wemo
+
+import (
+	"sync"
+	"time"
+)
+
+// monotonic turns a gauge that drops back to zero on reset into a counter
+// that only ever grows.
+type monotonic struct {
+	offset float64
+	last   float64
+	seen   bool
+}
+
+func (m *monotonic) update(v float64) (reset bool) {
+	if m.seen && v < m.last {
+		m.offset += m.last
+		reset = true
+	}
+	m.last = v
+	m.seen = true
+	return reset
+}
+
+func (m *monotonic) value() float64 {
+	return m.offset + m.last
+}
+
+// CounterSnapshot holds the monotonic totals of a single device.
+type CounterSnapshot struct {
+	EnergyKWh float64
+	OnTime    time.Duration
+	Resets    int
+	LastReset time.Time
+	Updated   time.Time
+}
+
+type deviceCounters struct {
+	energy    monotonic
+	onTime    monotonic
+	resets    int
+	lastReset time.Time
+	updated   time.Time
+}
+
+// InsightCounters exposes the totals reported by Insight devices as
+// monotonic counters. Insight devices zero their totals when they reboot;
+// InsightCounters detects the drop and keeps counting from the previous
+// value, so metric systems computing rates don't see a sawtooth. It is safe
+// for concurrent use.
+type InsightCounters struct {
+	mu      sync.Mutex
+	devices map[string]*deviceCounters
+}
+
+// NewInsightCounters returns an empty set of counters.
+func NewInsightCounters() *InsightCounters {
+	return &InsightCounters{devices: make(map[string]*deviceCounters)}
+}
+
+// Update folds a reading into the counters of its host and reports whether a
+// reset was detected.
+func (c *InsightCounters) Update(reading InsightReading) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dc, ok := c.devices[reading.Host]
+	if !ok {
+		dc = &deviceCounters{}
+		c.devices[reading.Host] = dc
+	}
+
+	energyReset := dc.energy.update(reading.Params.TotalKWh())
+	onTimeReset := dc.onTime.update(float64(reading.Params.OnTotal))
+	reset := energyReset || onTimeReset
+	if reset {
+		dc.resets++
+		dc.lastReset = reading.Time
+	}
+	dc.updated = reading.Time
+
+	return reset
+}
+
+// Snapshot returns the current counters of host.
+func (c *InsightCounters) Snapshot(host string) (CounterSnapshot, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dc, ok := c.devices[host]
+	if !ok {
+		return CounterSnapshot{}, false
+	}
+	return CounterSnapshot{
+		EnergyKWh: dc.energy.value(),
+		OnTime:    time.Duration(dc.onTime.value()) * time.Second,
+		Resets:    dc.resets,
+		LastReset: dc.lastReset,
+		Updated:   dc.updated,
+	}, true
+}
+
+// Hosts returns the hosts with counters.
+func (c *InsightCounters) Hosts() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hosts := make([]string, 0, len(c.devices))
+	for host := range c.devices {
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
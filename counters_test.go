@@ -0,0 +1,39 @@
+package wemo
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestInsightCountersReset(t *testing.T) {
+	c := NewInsightCounters()
+	start := time.Date(2020, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	totals := []float64{60e6, 120e6, 6e6, 12e6}
+	for i, total := range totals {
+		r := InsightReading{Host: "plug", Time: start.Add(time.Duration(i) * time.Minute)}
+		r.Params.TotalPower = total
+		r.Params.OnTotal = 100 * (i%2 + 1)
+
+		reset := c.Update(r)
+		if reset != (i == 2) {
+			t.Errorf("Expected: reset only on reading 2, got: %v on %d", reset, i)
+		}
+	}
+
+	s, ok := c.Snapshot("plug")
+	if !ok {
+		t.Fatal("Expected: a snapshot for plug")
+	}
+	// 2 kWh before the reboot plus 0.2 kWh after it
+	if math.Abs(s.EnergyKWh-2.2) > 1e-9 {
+		t.Errorf("Expected: 2.2 kWh, got: %v", s.EnergyKWh)
+	}
+	if s.Resets != 1 || !s.LastReset.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("Expected: 1 reset at 08:02, got: %d at %v", s.Resets, s.LastReset)
+	}
+	if s.OnTime != 400*time.Second {
+		t.Errorf("Expected: 400s, got: %v", s.OnTime)
+	}
+}
@@ -15,6 +15,7 @@
 package wemo
 
 import (
+	"bytes"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -22,9 +23,11 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"context"
 
@@ -35,6 +38,10 @@ import (
 type Device struct {
 	Host   string
 	Logger func(string, ...interface{}) (int, error)
+
+	// KeepRawInsight retains the unparsed InsightParams value in
+	// InsightParams.Raw, for diagnosing parsing differences across firmware.
+	KeepRawInsight bool
 }
 
 // DeviceInfo struct
@@ -77,7 +84,7 @@ func unmarshalDeviceInfo(data []byte) (*DeviceInfo, error) {
 // FetchDeviceInfo from device
 func (d *Device) FetchDeviceInfo(ctx context.Context) (*DeviceInfo, error) {
 	uri := fmt.Sprintf("http://%s/setup.xml", d.Host)
-	resp, err := ctxhttp.Get(ctx, nil, uri)
+	resp, err := ctxhttp.Get(ctx, httpClient(client), uri)
 	if err != nil {
 		return nil, err
 	}
@@ -180,6 +187,126 @@ func (d *Device) changeState(newState bool) error {
 	return nil
 }
 
+// FetchBinaryState is the context aware counterpart of GetBinaryState. Unlike
+// GetBinaryState it reports failures as errors instead of -1.
+func (d *Device) FetchBinaryState(ctx context.Context) (int, error) {
+	data, err := d.action(ctx, "basicevent", "GetBinaryState")
+	if err != nil {
+		return -1, err
+	}
+
+	value, err := responseValue(data, "BinaryState")
+	if err != nil {
+		return -1, err
+	}
+
+	// dimmers and Insights append more fields, e.g. 8|1471416661|...
+	state, err := strconv.Atoi(strings.SplitN(value, "|", 2)[0])
+	if err != nil {
+		return -1, fmt.Errorf("Failed to parse BinaryState %q:\n\t%s", value, err)
+	}
+	return state, nil
+}
+
+// SetBinaryState is the context aware counterpart of SetState.
+func (d *Device) SetBinaryState(ctx context.Context, on bool) error {
+	value := "0"
+	if on {
+		value = "1"
+	}
+	_, err := d.action(ctx, "basicevent", "SetBinaryState", actionArgument{"BinaryState", value})
+	return err
+}
+
+// SetBrightness switches a Dimmer on at level percent, or off at level 0.
+func (d *Device) SetBrightness(ctx context.Context, level int) error {
+	if level < 0 || level > 100 {
+		return fmt.Errorf("brightness %d is out of bounds 0-100", level)
+	}
+	state := "1"
+	if level == 0 {
+		state = "0"
+	}
+	_, err := d.action(ctx, "basicevent", "SetBinaryState",
+		actionArgument{"BinaryState", state},
+		actionArgument{"brightness", strconv.Itoa(level)},
+	)
+	return err
+}
+
+// FetchBrightness returns the brightness of a Dimmer in percent.
+func (d *Device) FetchBrightness(ctx context.Context) (int, error) {
+	data, err := d.action(ctx, "basicevent", "GetBinaryState")
+	if err != nil {
+		return -1, err
+	}
+
+	value, err := responseValue(data, "brightness")
+	if err != nil {
+		return -1, err
+	}
+	level, err := strconv.Atoi(value)
+	if err != nil {
+		return -1, fmt.Errorf("Failed to parse brightness %q:\n\t%s", value, err)
+	}
+	return level, nil
+}
+
+// ChangeFriendlyName renames the device.
+func (d *Device) ChangeFriendlyName(ctx context.Context, name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("friendly name must not be empty")
+	}
+	_, err := d.action(ctx, "basicevent", "ChangeFriendlyName", actionArgument{"FriendlyName", name})
+	return err
+}
+
+// ChangeBulbName renames a bulb paired with the bridge, given by its end
+// device id.
+func (d *Device) ChangeBulbName(ctx context.Context, id, name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("friendly name must not be empty")
+	}
+	_, err := d.action(ctx, "bridge", "SetDeviceName", actionArgument{"DeviceID", id}, actionArgument{"FriendlyName", name})
+	return err
+}
+
+// TurnOnFor switches the device on and back off after duration. The switch
+// back happens in this process, so it is lost when the process exits; use
+// SetCountdown for timers that should survive. Cancelling ctx cancels the
+// switch back and leaves the device on. The returned channel receives the
+// result of switching back, or ctx.Err() when it was cancelled.
+func (d *Device) TurnOnFor(ctx context.Context, duration time.Duration) (<-chan error, error) {
+	return d.switchFor(ctx, true, duration)
+}
+
+// TurnOffFor switches the device off and back on after duration, like
+// TurnOnFor.
+func (d *Device) TurnOffFor(ctx context.Context, duration time.Duration) (<-chan error, error) {
+	return d.switchFor(ctx, false, duration)
+}
+
+func (d *Device) switchFor(ctx context.Context, on bool, duration time.Duration) (<-chan error, error) {
+	if err := d.SetBinaryState(ctx, on); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer close(done)
+
+		timer := time.NewTimer(duration)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			done <- ctx.Err()
+		case <-timer.C:
+			done <- d.SetBinaryState(ctx, !on)
+		}
+	}()
+	return done, nil
+}
+
 // InsightParams ...
 type InsightParams struct {
 	OnFor          int     // seconds
@@ -190,6 +317,23 @@ type InsightParams struct {
 	TodayPower     float64 // mW
 	TotalPower     float64 // mW
 	PowerThreshold float64 // mW
+	Raw            string  // unparsed value, see Device.KeepRawInsight
+}
+
+// PowerW returns CurrentPower in watts.
+func (p InsightParams) PowerW() float64 {
+	return p.CurrentPower / 1000
+}
+
+// TodayKWh returns TodayPower, which the device reports in milliwatt-minutes,
+// in kilowatt-hours.
+func (p InsightParams) TodayKWh() float64 {
+	return p.TodayPower / 60 / 1e6
+}
+
+// TotalKWh returns TotalPower in kilowatt-hours, see TodayKWh.
+func (p InsightParams) TotalKWh() float64 {
+	return p.TotalPower / 60 / 1e6
 }
 
 func (d *Device) GetInsightParams() (insightParams *InsightParams, err error) {
@@ -209,13 +353,26 @@ func (d *Device) GetInsightParams() (insightParams *InsightParams, err error) {
 		return nil, fmt.Errorf("Unable to read Insight Data:\n\t%s", err)
 	}
 
+	return parseInsightParams(string(rawData), d.KeepRawInsight)
+}
+
+// FetchInsightParams is the context aware counterpart of GetInsightParams.
+func (d *Device) FetchInsightParams(ctx context.Context) (*InsightParams, error) {
+	data, err := d.action(ctx, "insight", "GetInsightParams")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch Insight Data from %s:\n\t%v", d.Host, err)
+	}
+
+	return parseInsightParams(string(data), d.KeepRawInsight)
+}
+
+func parseInsightParams(data string, keepRaw bool) (*InsightParams, error) {
 	// <s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>
 	// <u:GetInsightParamsResponse xmlns:u="urn:Belkin:service:metainfo:1">
 	// <InsightParams>8|1471416661|8|3244|3182|15377|19|7300|1011115|1011115.000000|8000</InsightParams>
 	// </u:GetInsightParamsResponse>
 
 	re := regexp.MustCompile(`.*<InsightParams>(.+)</InsightParams>.*`)
-	data := string(rawData)
 	matches := re.FindStringSubmatch(data)
 	if len(matches) != 2 {
 		return nil, fmt.Errorf("Unable to find InsightParams response in message:\n\t%s", data)
@@ -231,7 +388,7 @@ func (d *Device) GetInsightParams() (insightParams *InsightParams, err error) {
 		return nil, fmt.Errorf("Failed to parse OnFor in InsightParams:\n\t%s", err)
 	}
 
-	onToday, err := strconv.Atoi(split[4])
+	onToday, err := strconv.Atoi(split[3])
 	if err != nil {
 		return nil, fmt.Errorf("Failed to parse OnToday in InsightParams:\n\t%s", err)
 	}
@@ -266,7 +423,7 @@ func (d *Device) GetInsightParams() (insightParams *InsightParams, err error) {
 		return nil, fmt.Errorf("Failed to parse Power Threshold in InsightParams:\n\t%s", err)
 	}
 
-	return &InsightParams{
+	params := &InsightParams{
 		OnFor:          onFor,
 		OnToday:        onToday,
 		OnTotal:        onTotal,
@@ -275,7 +432,12 @@ func (d *Device) GetInsightParams() (insightParams *InsightParams, err error) {
 		TodayPower:     todayPower,
 		TotalPower:     totalPower,
 		PowerThreshold: powerThreshold,
-	}, nil
+	}
+	if keepRaw {
+		params.Raw = matches[1]
+	}
+
+	return params, nil
 }
 
 // EndDevices ...
@@ -305,6 +467,7 @@ func (d *Device) GetBridgeEndDevices(uuid string) *EndDevices {
 	response, err := post(d.Host, "bridge", "GetEndDevices", b)
 	if err != nil {
 		d.printf("unable to fetch bridge end devices => %s\n", err)
+		return &EndDevices{}
 	}
 	defer response.Body.Close()
 
@@ -317,23 +480,90 @@ func (d *Device) GetBridgeEndDevices(uuid string) *EndDevices {
 		d.printf("unable to read data => %s\n", err)
 	}
 
+	resp, err := parseEndDevices(data)
+	if err != nil {
+		d.printf("Unmarshal Error: %s\n", err)
+	}
+
+	return resp
+}
+
+// parseEndDevices parses a GetEndDevices response, whose lists are an XML
+// document escaped as text.
+func parseEndDevices(data []byte) (*EndDevices, error) {
 	resp := EndDevices{}
+	err := unmarshalEmbedded(data, &resp)
+	return &resp, err
+}
 
+// unmarshalEmbedded unmarshals a response carrying an XML document escaped
+// as text, as the bridge answers, into v. Bridges escape the names in the
+// document once more, but some leave ampersands escaped once, which don't
+// survive unescaping the document, so those are read as they are.
+func unmarshalEmbedded(data []byte, v interface{}) error {
 	data = []byte(html.UnescapeString(string(data)))
-
-	err = xml.Unmarshal(data, &resp)
-	if err != nil {
-		d.printf("Unmarshal Error: %s\n", err)
+	err := xml.Unmarshal(data, v)
+	if err == nil {
+		return nil
 	}
 
-	return &resp
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	retry := reflect.New(reflect.TypeOf(v).Elem())
+	if decoder.Decode(retry.Interface()) != nil {
+		return err
+	}
+	reflect.ValueOf(v).Elem().Set(retry.Elem())
+	return nil
 }
 
 //Bulb ...
 func (d *Device) Bulb(id, cmd, value string, group bool) error {
 
+	capability, value, err := bulbCapability(id, cmd, value)
+	if err != nil {
+		return err
+	}
+
+	message := newSetBulbStatus(id, capability, value, group)
+
+	response, err := post(d.Host, "bridge", "SetDeviceStatus", message)
+	if err != nil {
+		return errors.New("unable to SetDeviceStatus")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("SetDeviceStatus returned status code => %d", response.StatusCode)
+	}
+	return nil
+}
+
+// SetBulb is the context aware counterpart of Bulb.
+func (d *Device) SetBulb(ctx context.Context, id, cmd, value string, group bool) error {
+	capability, value, err := bulbCapability(id, cmd, value)
+	if err != nil {
+		return err
+	}
+	return d.setDeviceStatus(ctx, id, capability, value, group)
+}
+
+// setDeviceStatus sets a capability of a bulb, or of a group with group.
+func (d *Device) setDeviceStatus(ctx context.Context, id, capability, value string, group bool) error {
+	isGroup := "NO"
+	if group {
+		isGroup = "YES"
+	}
+	status := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?><DeviceStatus><IsGroupAction>%s</IsGroupAction><DeviceID available="YES">%s</DeviceID><CapabilityID>%s</CapabilityID><CapabilityValue>%s</CapabilityValue></DeviceStatus>`,
+		isGroup, html.EscapeString(id), capability, value)
+	_, err := d.action(ctx, "bridge", "SetDeviceStatus", actionArgument{"DeviceStatusList", status})
+	return err
+}
+
+// bulbCapability returns the capability and value a bulb command sets.
+func bulbCapability(id, cmd, value string) (string, string, error) {
 	if id == "" {
-		return errors.New("No ID provided")
+		return "", "", errors.New("No ID provided")
 	}
 
 	capability := "10006"
@@ -342,11 +572,11 @@ func (d *Device) Bulb(id, cmd, value string, group bool) error {
 
 		s, err := strconv.ParseInt(value, 10, 32)
 		if err != nil {
-			return err
+			return "", "", err
 		}
 
 		if s > 255 || s < 0 {
-			return errors.New("Dim value is out of bounds 0-255")
+			return "", "", errors.New("Dim value is out of bounds 0-255")
 		}
 	}
 
@@ -355,19 +585,31 @@ func (d *Device) Bulb(id, cmd, value string, group bool) error {
 	} else if cmd == "off" {
 		value = "0"
 	}
+	return capability, value, nil
+}
 
-	message := newSetBulbStatus(id, capability, value, group)
-
-	response, err := post(d.Host, "bridge", "SetDeviceStatus", message)
+// FetchBulbStatus is the context aware counterpart of GetBulbStatus.
+func (d *Device) FetchBulbStatus(ctx context.Context, ids string) (map[string]string, error) {
+	data, err := d.action(ctx, "bridge", "GetDeviceStatus", actionArgument{"DeviceIDs", ids})
 	if err != nil {
-		return errors.New("unable to SetDeviceStatus")
+		return nil, err
 	}
-	defer response.Body.Close()
+	return parseBulbStatusList(data)
+}
 
-	if response.StatusCode != http.StatusOK {
-		return errors.New(string(response.StatusCode))
+// parseBulbStatusList parses a GetDeviceStatus response into the capability
+// values by device id.
+func parseBulbStatusList(data []byte) (map[string]string, error) {
+	statusInfo := BulbStatusList{}
+	if err := unmarshalEmbedded(data, &statusInfo); err != nil {
+		return nil, fmt.Errorf("Failed to parse bulb status => %s", err)
 	}
-	return nil
+
+	result := make(map[string]string)
+	for _, status := range statusInfo.DeviceStatus {
+		result[status.DeviceID] = status.CapabilityValue
+	}
+	return result, nil
 }
 
 //BulbStatusList ...
@@ -401,10 +643,8 @@ func (d *Device) GetBulbStatus(ids string) (map[string]string, error) {
 		return nil, fmt.Errorf("unable to read data => %s\n", err)
 	}
 
-	data = []byte(html.UnescapeString(string(data)))
-
 	statusInfo := BulbStatusList{}
-	err = xml.Unmarshal(data, &statusInfo)
+	err = unmarshalEmbedded(data, &statusInfo)
 	if err != nil {
 		return nil, fmt.Errorf("Unmarshal Error: %s\n", err)
 	}
@@ -14,8 +14,15 @@
 package wemo
 
 import (
+	"context"
 	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -189,3 +196,92 @@ func TestParseResponseJSON(t *testing.T) {
 		})
 	})
 }
+
+func TestTurnOnFor(t *testing.T) {
+	states := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		value, _ := responseValue(body, "BinaryState")
+		states <- value
+		w.Write([]byte(testMessageHeader + `<u:SetBinaryStateResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>` + value + `</BinaryState></u:SetBinaryStateResponse>` + testMessageFooter))
+	}))
+	defer server.Close()
+	device := &Device{Host: strings.TrimPrefix(server.URL, "http://")}
+
+	done, err := device.TurnOnFor(context.Background(), 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if on, off := <-states, <-states; on != "1" || off != "0" {
+		t.Errorf("Expected: on then off, got: %s then %s", on, off)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err = device.TurnOffFor(ctx, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected: %s, got: %v", context.Canceled, err)
+	}
+	if off := <-states; off != "0" || len(states) != 0 {
+		t.Errorf("Expected: only off, got: %s and %d more", off, len(states))
+	}
+}
+
+func TestChangeBulbName(t *testing.T) {
+	requests := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- r.Header.Get("SOAPACTION") + " " + string(body)
+		w.Write([]byte(testMessageHeader + `<u:SetDeviceNameResponse xmlns:u="urn:Belkin:service:bridge:1"></u:SetDeviceNameResponse>` + testMessageFooter))
+	}))
+	defer server.Close()
+	device := &Device{Host: strings.TrimPrefix(server.URL, "http://")}
+
+	if err := device.ChangeBulbName(context.Background(), "94103EF6BF42867F", "Desk & Lamp"); err != nil {
+		t.Fatal(err)
+	}
+	request := <-requests
+	if !strings.HasPrefix(request, `"urn:Belkin:service:bridge:1#SetDeviceName"`) ||
+		!strings.Contains(request, "<DeviceID>94103EF6BF42867F</DeviceID><FriendlyName>Desk &amp; Lamp</FriendlyName>") {
+		t.Errorf("Unexpected SetDeviceName request: %s", request)
+	}
+	if err := device.ChangeBulbName(context.Background(), "94103EF6BF42867F", " "); err == nil {
+		t.Error("Expected: an error for an empty name, got: nil")
+	}
+}
+
+func TestParseEndDevicesEscapedOnce(t *testing.T) {
+	// names of the embedded document escaped once, like the document itself
+	data := testMessageHeader + `<u:GetEndDevicesResponse xmlns:u="urn:Belkin:service:bridge:1"><DeviceLists>` +
+		`&lt;DeviceLists&gt;&lt;DeviceList&gt;&lt;DeviceInfos&gt;&lt;DeviceInfo&gt;&lt;DeviceID&gt;A&lt;/DeviceID&gt;` +
+		`&lt;FriendlyName&gt;Kitchen &amp; Hall&lt;/FriendlyName&gt;&lt;/DeviceInfo&gt;&lt;/DeviceInfos&gt;&lt;/DeviceList&gt;&lt;/DeviceLists&gt;` +
+		`</DeviceLists></u:GetEndDevicesResponse>` + testMessageFooter
+
+	devices, err := parseEndDevices([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices.EndDeviceInfo) != 1 || devices.EndDeviceInfo[0].FriendlyName != "Kitchen & Hall" {
+		t.Errorf("Expected: Kitchen & Hall, got: %+v", devices.EndDeviceInfo)
+	}
+}
+
+func TestGetBridgeEndDevicesUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := listener.Addr().String()
+	listener.Close()
+
+	device := &Device{Host: host}
+	if devices := device.GetBridgeEndDevices("uuid:Bridge-1_0-X"); len(devices.EndDeviceInfo) != 0 {
+		t.Errorf("Expected: no end devices, got: %+v", devices)
+	}
+}
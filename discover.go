@@ -22,14 +22,15 @@ import (
 
 //Constants for URNS
 const (
-	Basic      = "urn:Belkin:service:basicevent:1"
-	Bridge     = "urn:Belkin:device:bridge:1"
-	Controllee = "urn:Belkin:device:controllee:1"
-	Dimmer     = "urn:Belkin:device:dimmer:1"
-	Light      = "urn:Belkin:device:light:1"
-	Sensor     = "urn:Belkin:device:sensor:1"
-	NetCam     = "urn:Belkin:device:netcam:1"
-	Insight    = "urn:Belkin:device:insight:1"
+	Basic       = "urn:Belkin:service:basicevent:1"
+	Bridge      = "urn:Belkin:device:bridge:1"
+	Controllee  = "urn:Belkin:device:controllee:1"
+	Dimmer      = "urn:Belkin:device:dimmer:1"
+	Light       = "urn:Belkin:device:light:1"
+	LightSwitch = "urn:Belkin:device:lightswitch:1"
+	Sensor      = "urn:Belkin:device:sensor:1"
+	NetCam      = "urn:Belkin:device:netcam:1"
+	Insight     = "urn:Belkin:device:insight:1"
 )
 
 var (
@@ -41,6 +42,7 @@ var (
 type Wemo struct {
 	ipAddr     string
 	sourcePort uint16
+	searchAddr string
 	Debug      bool
 }
 
@@ -58,9 +60,38 @@ func (w *Wemo) DiscoverAll(timeout time.Duration) ([]*Device, error) {
 	return all, nil
 }
 
+// deviceTypes are the types DiscoverTypes searches for by default.
+var deviceTypes = []string{Basic, Bridge, Controllee, Dimmer, Light, LightSwitch, Sensor, NetCam, Insight}
+
+// DiscoverTypes discovers the devices of the given types, e.g. Insight, or of
+// all types when none are given. Devices answering for several types are
+// returned once.
+func (w *Wemo) DiscoverTypes(timeout time.Duration, urns ...string) ([]*Device, error) {
+	if len(urns) == 0 {
+		urns = deviceTypes
+	}
+	seen := map[string]bool{}
+	var all []*Device
+	for _, urn := range urns {
+		devices, err := w.Discover(urn, timeout)
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range devices {
+			if !seen[device.Host] {
+				seen[device.Host] = true
+				all = append(all, device)
+			}
+		}
+	}
+	return all, nil
+}
+
 // Discover ...
 func (w *Wemo) Discover(urn string, timeout time.Duration) ([]*Device, error) {
+	start := time.Now()
 	locations, err := w.scan(urn, timeout)
+	metrics().DiscoveryScan(urn, len(locations), time.Since(start), err)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,245 @@
+package wemo
+
+import (
+	"sort"
+	"time"
+)
+
+// maxReadingGap is the longest interval between two consecutive readings that
+// is still integrated. Longer gaps (a poller that was stopped, a device that
+// was unreachable) are treated as missing data rather than guessed at.
+const maxReadingGap = 15 * time.Minute
+
+// InsightReading is a single timestamped sample taken from an Insight device.
+type InsightReading struct {
+	Host   string
+	Time   time.Time
+	Params InsightParams
+}
+
+// RollupPeriod selects the bucket size used when aggregating readings.
+type RollupPeriod int
+
+// Rollup periods
+const (
+	Hourly RollupPeriod = iota
+	Daily
+	Weekly
+)
+
+func (p RollupPeriod) String() string {
+	switch p {
+	case Hourly:
+		return "hourly"
+	case Daily:
+		return "daily"
+	case Weekly:
+		return "weekly"
+	}
+	return "unknown"
+}
+
+// start returns the beginning of the period containing t, in loc. Weeks start
+// on Monday.
+func (p RollupPeriod) start(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch p {
+	case Daily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	case Weekly:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, loc)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+}
+
+// next returns the beginning of the period following the one starting at start.
+func (p RollupPeriod) next(start time.Time) time.Time {
+	switch p {
+	case Daily:
+		return start.AddDate(0, 0, 1)
+	case Weekly:
+		return start.AddDate(0, 0, 7)
+	}
+	return start.Add(time.Hour)
+}
+
+// EnergySummary aggregates the readings of a single period.
+type EnergySummary struct {
+	Start        time.Time
+	End          time.Time
+	Samples      int
+	Covered      time.Duration // time within the period backed by readings
+	KWh          float64
+	AveragePower float64 // W
+	DutyCycle    float64 // fraction of Covered spent above the power threshold
+	PeakPower    float64 // W
+	PeakTime     time.Time
+}
+
+// EnergyRollup incrementally aggregates a stream of readings into period
+// summaries. Readings must be added in chronological order; older readings are
+// ignored.
+type EnergyRollup struct {
+	period  RollupPeriod
+	loc     *time.Location
+	buckets []energyBucket
+	last    *InsightReading
+}
+
+// energyBucket carries the running totals behind a summary.
+type energyBucket struct {
+	EnergySummary
+	active time.Duration
+}
+
+// NewEnergyRollup returns a rollup bucketing readings by period in loc. A nil
+// loc uses time.Local.
+func NewEnergyRollup(period RollupPeriod, loc *time.Location) *EnergyRollup {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &EnergyRollup{period: period, loc: loc}
+}
+
+// Add feeds a reading into the rollup.
+func (r *EnergyRollup) Add(reading InsightReading) {
+	if r.last != nil && !reading.Time.After(r.last.Time) {
+		return
+	}
+
+	if r.last != nil && reading.Time.Sub(r.last.Time) <= maxReadingGap {
+		r.integrate(*r.last, reading)
+	}
+
+	s := r.bucket(reading.Time)
+	s.Samples++
+	if power := reading.Params.PowerW(); s.Samples == 1 || power > s.PeakPower {
+		s.PeakPower = power
+		s.PeakTime = reading.Time
+	}
+
+	r.last = &reading
+}
+
+// integrate spreads the interval between two readings over the buckets it
+// covers, interpolating power linearly across bucket boundaries.
+func (r *EnergyRollup) integrate(from, to InsightReading) {
+	above := from.Params.CurrentPower > from.Params.PowerThreshold
+
+	t := from.Time
+	for t.Before(to.Time) {
+		s := r.bucket(t)
+		end := s.End
+		if end.After(to.Time) {
+			end = to.Time
+		}
+
+		d := end.Sub(t)
+		s.KWh += energyBetween(from, to, t, end)
+		s.Covered += d
+		if above {
+			s.active += d
+		}
+		t = end
+	}
+}
+
+// energyBetween returns the energy in kWh drawn between a and b, which must lie
+// within the interval spanned by the readings from and to. Power is
+// interpolated linearly between the two readings.
+func energyBetween(from, to InsightReading, a, b time.Time) float64 {
+	total := float64(to.Time.Sub(from.Time))
+	powerAt := func(t time.Time) float64 {
+		f := float64(t.Sub(from.Time)) / total
+		return from.Params.CurrentPower + f*(to.Params.CurrentPower-from.Params.CurrentPower)
+	}
+	return (powerAt(a) + powerAt(b)) / 2 * b.Sub(a).Hours() / 1e6
+}
+
+// bucket returns the bucket for the period containing t, creating it when t
+// starts a new period.
+func (r *EnergyRollup) bucket(t time.Time) *energyBucket {
+	start := r.period.start(t, r.loc)
+	if n := len(r.buckets); n > 0 && r.buckets[n-1].Start.Equal(start) {
+		return &r.buckets[n-1]
+	}
+
+	r.buckets = append(r.buckets, energyBucket{EnergySummary: EnergySummary{Start: start, End: r.period.next(start)}})
+	return &r.buckets[len(r.buckets)-1]
+}
+
+// Summaries returns the summaries aggregated so far, oldest first.
+func (r *EnergyRollup) Summaries() []EnergySummary {
+	result := make([]EnergySummary, len(r.buckets))
+	for i, b := range r.buckets {
+		s := b.EnergySummary
+		if s.Covered > 0 {
+			s.AveragePower = s.KWh * 1000 / s.Covered.Hours()
+			s.DutyCycle = float64(b.active) / float64(s.Covered)
+		}
+		result[i] = s
+	}
+	return result
+}
+
+// RollupEnergy aggregates stored readings into hourly, daily or weekly
+// summaries in loc. Readings need not be sorted.
+func RollupEnergy(readings []InsightReading, period RollupPeriod, loc *time.Location) []EnergySummary {
+	sorted := sortReadings(readings)
+	rollup := NewEnergyRollup(period, loc)
+	for _, reading := range sorted {
+		rollup.Add(reading)
+	}
+	return rollup.Summaries()
+}
+
+// sortReadings returns a chronologically sorted copy of readings.
+func sortReadings(readings []InsightReading) []InsightReading {
+	sorted := make([]InsightReading, len(readings))
+	copy(sorted, readings)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+	return sorted
+}
+
+// PowerPeak is a contiguous run of readings above a power level.
+type PowerPeak struct {
+	Start     time.Time
+	End       time.Time
+	PeakPower float64 // W
+	PeakTime  time.Time
+}
+
+// DetectPeaks returns the runs of readings whose power exceeds threshold
+// (in W), with the highest value seen during each run.
+func DetectPeaks(readings []InsightReading, threshold float64) []PowerPeak {
+	sorted := sortReadings(readings)
+
+	var peaks []PowerPeak
+	var current *PowerPeak
+	for _, reading := range sorted {
+		power := reading.Params.PowerW()
+		if power <= threshold {
+			if current != nil {
+				current.End = reading.Time
+				peaks = append(peaks, *current)
+				current = nil
+			}
+			continue
+		}
+
+		if current == nil {
+			current = &PowerPeak{Start: reading.Time}
+		}
+		current.End = reading.Time
+		if power > current.PeakPower {
+			current.PeakPower = power
+			current.PeakTime = reading.Time
+		}
+	}
+
+	if current != nil {
+		peaks = append(peaks, *current)
+	}
+	return peaks
+}
@@ -0,0 +1,112 @@
+package wemo
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func reading(t time.Time, mW float64) InsightReading {
+	return InsightReading{Time: t, Params: InsightParams{CurrentPower: mW, PowerThreshold: 8000}}
+}
+
+func TestRollupEnergyHourly(t *testing.T) {
+	start := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	var readings []InsightReading
+	// 100 W for the first hour, off for the second, sampled every minute.
+	for i := 0; i <= 120; i++ {
+		mW := 100000.0
+		if i > 60 {
+			mW = 0
+		}
+		readings = append(readings, reading(start.Add(time.Duration(i)*time.Minute), mW))
+	}
+
+	summaries := RollupEnergy(readings, Hourly, time.UTC)
+	if len(summaries) != 3 {
+		t.Fatalf("Expected: 3 summaries, got: %d", len(summaries))
+	}
+
+	first := summaries[0]
+	if math.Abs(first.KWh-0.1) > 1e-9 {
+		t.Errorf("Expected: 0.1 kWh, got: %v", first.KWh)
+	}
+	if math.Abs(first.AveragePower-100) > 1e-9 {
+		t.Errorf("Expected: 100 W, got: %v", first.AveragePower)
+	}
+	if first.DutyCycle != 1 {
+		t.Errorf("Expected: duty cycle 1, got: %v", first.DutyCycle)
+	}
+	if first.PeakPower != 100 {
+		t.Errorf("Expected: peak 100 W, got: %v", first.PeakPower)
+	}
+
+	// only the first minute of the second hour, ramping from 100 W to 0 W,
+	// draws any power
+	second := summaries[1]
+	if math.Abs(second.DutyCycle-1.0/60) > 1e-9 {
+		t.Errorf("Expected: duty cycle 1/60, got: %v", second.DutyCycle)
+	}
+	if math.Abs(second.KWh-0.05/60) > 1e-9 {
+		t.Errorf("Expected: %v kWh, got: %v", 0.05/60, second.KWh)
+	}
+}
+
+func TestRollupEnergySplitsBoundaries(t *testing.T) {
+	start := time.Date(2020, 6, 1, 23, 45, 0, 0, time.UTC)
+	readings := []InsightReading{
+		reading(start.Add(10*time.Minute), 60000),
+		reading(start, 60000),
+	}
+
+	summaries := RollupEnergy(readings, Daily, time.UTC)
+	if len(summaries) != 1 {
+		t.Fatalf("Expected: 1 summary, got: %d", len(summaries))
+	}
+	if math.Abs(summaries[0].KWh-0.01) > 1e-9 {
+		t.Errorf("Expected: 0.01 kWh, got: %v", summaries[0].KWh)
+	}
+
+	readings = append(readings, reading(start.Add(20*time.Minute), 60000))
+	summaries = RollupEnergy(readings, Daily, time.UTC)
+	if len(summaries) != 2 {
+		t.Fatalf("Expected: 2 summaries, got: %d", len(summaries))
+	}
+	if math.Abs(summaries[0].KWh-0.015) > 1e-9 || math.Abs(summaries[1].KWh-0.005) > 1e-9 {
+		t.Errorf("Expected: 0.015/0.005 kWh, got: %v/%v", summaries[0].KWh, summaries[1].KWh)
+	}
+}
+
+func TestRollupEnergySkipsGaps(t *testing.T) {
+	start := time.Date(2020, 6, 1, 8, 0, 0, 0, time.UTC)
+	readings := []InsightReading{
+		reading(start, 60000),
+		reading(start.Add(5*time.Hour), 60000),
+	}
+
+	for _, s := range RollupEnergy(readings, Weekly, time.UTC) {
+		if s.KWh != 0 || s.Covered != 0 {
+			t.Errorf("Expected: gap to be ignored, got: %+v", s)
+		}
+	}
+}
+
+func TestDetectPeaks(t *testing.T) {
+	start := time.Date(2020, 6, 1, 8, 0, 0, 0, time.UTC)
+	powers := []float64{5000, 1500000, 2000000, 900000, 4000, 1200000}
+	var readings []InsightReading
+	for i, mW := range powers {
+		readings = append(readings, reading(start.Add(time.Duration(i)*time.Minute), mW))
+	}
+
+	peaks := DetectPeaks(readings, 1000)
+	if len(peaks) != 2 {
+		t.Fatalf("Expected: 2 peaks, got: %d", len(peaks))
+	}
+	if peaks[0].PeakPower != 2000 || !peaks[0].PeakTime.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("Expected: 2000 W at 08:02, got: %+v", peaks[0])
+	}
+	if !peaks[0].End.Equal(start.Add(3 * time.Minute)) {
+		t.Errorf("Expected: peak to end at 08:03, got: %v", peaks[0].End)
+	}
+}
@@ -0,0 +1,175 @@
+package wemo
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StateSource tells how the Manager learned about a state.
+type StateSource string
+
+// State sources
+const (
+	SourceEvent   StateSource = "event"   // a GENA event from the device
+	SourcePoll    StateSource = "poll"    // a state read from the device
+	SourceCommand StateSource = "command" // a command sent through the manager
+)
+
+// StateChanged is published by the Manager when the binary state of a device
+// changes. Events are numbered in the order they were published, which is
+// the same for every subscriber. Previous is -1 when the state wasn't known.
+type StateChanged struct {
+	Seq      uint64      `json:"seq"`
+	Key      string      `json:"key"`
+	Name     string      `json:"name"`
+	State    int         `json:"state"`
+	Previous int         `json:"previous"`
+	Source   StateSource `json:"source"`
+	Time     time.Time   `json:"time"`
+
+	// Dropped is the number of events this subscriber missed before this one
+	// because it didn't keep up.
+	Dropped int `json:"dropped,omitempty"`
+}
+
+type stateSubscriber struct {
+	ch      chan StateChanged
+	dropped int
+}
+
+// eventHistory is the number of events kept for EventsSince.
+const eventHistory = 256
+
+// eventBus fans StateChanged events out to subscribers.
+type eventBus struct {
+	mu          sync.Mutex
+	seq         uint64
+	subscribers map[*stateSubscriber]bool
+	history     []StateChanged // the last events, oldest first
+}
+
+// publish must not block: a subscriber whose buffer is full misses the event,
+// which is reported with its next one.
+func (b *eventBus) publish(event StateChanged) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	event.Seq = b.seq
+	if len(b.history) == eventHistory {
+		b.history = append(b.history[:0], b.history[1:]...)
+	}
+	b.history = append(b.history, event)
+	for sub := range b.subscribers {
+		e := event
+		e.Dropped = sub.dropped
+		select {
+		case sub.ch <- e:
+			sub.dropped = 0
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the state changes of all devices.
+// Up to buffer events are queued for a slow subscriber; further events are
+// dropped and counted in StateChanged.Dropped. Call cancel to unsubscribe,
+// which closes the channel.
+func (m *Manager) Subscribe(buffer int) (events <-chan StateChanged, cancel func()) {
+	sub := &stateSubscriber{ch: make(chan StateChanged, buffer)}
+	b := &m.bus
+	b.mu.Lock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[*stateSubscriber]bool)
+	}
+	b.subscribers[sub] = true
+	b.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, sub)
+			b.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+}
+
+// EventsSince returns the events published after the one numbered seq, e.g.
+// to resume a stream of events. Only the last 256 events are kept; complete
+// is false when some of the events after seq are gone.
+func (m *Manager) EventsSince(seq uint64) (events []StateChanged, complete bool) {
+	b := &m.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, event := range b.history {
+		if event.Seq > seq {
+			events = append(events, event)
+		}
+	}
+	complete = seq >= b.seq || (len(b.history) > 0 && b.history[0].Seq <= seq+1)
+	return events, complete
+}
+
+// recordBinaryState caches the state and publishes a StateChanged event when it
+// differs from the known one.
+func (m *Manager) recordBinaryState(key string, state int, source StateSource) {
+	now := time.Now()
+	m.mu.Lock()
+	entry, ok := m.devices[key]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	cached := m.cachedState(key)
+	previous := -1
+	if !cached.binaryAt.IsZero() {
+		previous = cached.binary
+	}
+	cached.binary, cached.binaryAt = state, now
+	event := StateChanged{Key: key, Name: entry.Name, State: state, Previous: previous, Source: source, Time: now}
+
+	// publishing under m.mu keeps the events of a device in order
+	if previous != state {
+		m.bus.publish(event)
+	}
+	m.mu.Unlock()
+}
+
+// HandleEvent feeds an event received from the device at host, e.g. by
+// Listener, to the manager.
+func (m *Manager) HandleEvent(host string, event Deviceevent) {
+	if event.BinaryState == "" {
+		return
+	}
+	state, err := strconv.Atoi(strings.SplitN(event.BinaryState, "|", 2)[0])
+	if err != nil {
+		return
+	}
+
+	m.mu.RLock()
+	key := ""
+	for _, entry := range m.devices {
+		if entry.Host == host {
+			key = entry.Key
+			break
+		}
+	}
+	m.mu.RUnlock()
+	if key != "" {
+		m.recordBinaryState(key, state, SourceEvent)
+	}
+}
+
+// SetBinaryState switches a device and records the new state. Redundant
+// calls for a device that is busy are coalesced, see the Manager.
+func (m *Manager) SetBinaryState(ctx context.Context, key string, on bool) error {
+	if _, err := m.device(key); err != nil {
+		return err
+	}
+	return m.setBinaryState(ctx, key, on)
+}
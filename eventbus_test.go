@@ -0,0 +1,74 @@
+package wemo
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStateChangedEvents(t *testing.T) {
+	porch := newFakeDevice(t, "uuid:Socket-1_0-A", "Porch", "A")
+	defer porch.Close()
+
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Porch", Host: porch.host(), UDN: porch.udn})
+
+	events, cancel := m.Subscribe(10)
+	slow, cancelSlow := m.Subscribe(1)
+	defer cancelSlow()
+
+	ctx := context.Background()
+	m.BinaryState(ctx, porch.udn)                                    // poll: unknown => 0
+	m.SetBinaryState(ctx, porch.udn, true)                           // command: 0 => 1
+	m.HandleEvent(porch.host(), Deviceevent{BinaryState: "1"})       // no change
+	m.HandleEvent(porch.host(), Deviceevent{BinaryState: "0|12345"}) // event: 1 => 0
+	m.HandleEvent("10.0.0.1:49153", Deviceevent{BinaryState: "1"})   // unknown device
+	cancel()
+
+	expected := []StateChanged{
+		{Seq: 1, State: 0, Previous: -1, Source: SourcePoll},
+		{Seq: 2, State: 1, Previous: 0, Source: SourceCommand},
+		{Seq: 3, State: 0, Previous: 1, Source: SourceEvent},
+	}
+	var got []StateChanged
+	for event := range events {
+		got = append(got, event)
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected: %d events, got: %v", len(expected), got)
+	}
+	for i, e := range expected {
+		g := got[i]
+		if g.Seq != e.Seq || g.State != e.State || g.Previous != e.Previous || g.Source != e.Source || g.Name != "Porch" {
+			t.Errorf("Expected: %+v, got: %+v", e, g)
+		}
+	}
+
+	// the slow subscriber got the first event and missed the others
+	if event := <-slow; event.Seq != 1 {
+		t.Errorf("Expected: the first event, got: %+v", event)
+	}
+	m.SetBinaryState(ctx, porch.udn, true)
+	if event := <-slow; event.Seq != 4 || event.Dropped != 2 {
+		t.Errorf("Expected: event 4 after 2 dropped, got: %+v", event)
+	}
+}
+
+func TestEventsSince(t *testing.T) {
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Plug", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-A"})
+	for i := 0; i < eventHistory+10; i++ {
+		m.UpdateBinaryState("uuid:Socket-1_0-A", i%2)
+	}
+
+	last := uint64(eventHistory + 10)
+	events, complete := m.EventsSince(last - 2)
+	if len(events) != 2 || events[0].Seq != last-1 || !complete {
+		t.Errorf("Expected: the last 2 events, got: %d from %d, complete %v", len(events), events[0].Seq, complete)
+	}
+	if events, complete := m.EventsSince(last); len(events) != 0 || !complete {
+		t.Errorf("Expected: no events, got: %d, complete %v", len(events), complete)
+	}
+	if events, complete := m.EventsSince(1); len(events) != eventHistory || complete {
+		t.Errorf("Expected: an incomplete history, got: %d, complete %v", len(events), complete)
+	}
+}
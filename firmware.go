@@ -0,0 +1,291 @@
+package wemo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// FirmwareVersion is a parsed firmware version such as
+// "WeMo_WW_2.00.11057.PVT-OWRT-SNS": region WW, version 2.00 build 11057 of
+// the PVT-OWRT-SNS line. Only versions of the same line can replace each
+// other.
+type FirmwareVersion struct {
+	Region  string
+	Major   int
+	Minor   int
+	Build   int
+	Variant string
+}
+
+// ParseFirmwareVersion parses the FirmwareVersion of a DeviceInfo.
+func ParseFirmwareVersion(s string) (FirmwareVersion, error) {
+	var v FirmwareVersion
+	parts := strings.SplitN(s, "_", 3)
+	if len(parts) != 3 || parts[0] != "WeMo" {
+		return v, fmt.Errorf("Failed to parse firmware version %q", s)
+	}
+	v.Region = parts[1]
+
+	fields := strings.SplitN(parts[2], ".", 4)
+	if len(fields) < 3 {
+		return v, fmt.Errorf("Failed to parse firmware version %q", s)
+	}
+	var err error
+	for i, n := range []*int{&v.Major, &v.Minor, &v.Build} {
+		if *n, err = strconv.Atoi(fields[i]); err != nil {
+			return v, fmt.Errorf("Failed to parse firmware version %q:\n\t%s", s, err)
+		}
+	}
+	if len(fields) == 4 {
+		v.Variant = fields[3]
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 when v is older than, the same as or newer than
+// other. Region and variant are not compared.
+func (v FirmwareVersion) Compare(other FirmwareVersion) int {
+	a := []int{v.Major, v.Minor, v.Build}
+	b := []int{other.Major, other.Minor, other.Build}
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+func (v FirmwareVersion) String() string {
+	s := fmt.Sprintf("WeMo_%s_%d.%02d.%d", v.Region, v.Major, v.Minor, v.Build)
+	if v.Variant != "" {
+		s += "." + v.Variant
+	}
+	return s
+}
+
+// FirmwareRelease is a firmware image listed in a FirmwareManifest.
+type FirmwareRelease struct {
+	DeviceType string `json:"device-type"` // e.g. Insight
+	Version    string `json:"version"`
+	URL        string `json:"url"`
+	Signed     bool   `json:"signed,omitempty"`
+	Signature  string `json:"signature,omitempty"`
+	Notes      string `json:"notes,omitempty"`
+}
+
+// FirmwareManifest lists the latest firmware per device type and line. Belkin
+// published such a list for its app; since the Belkin cloud is gone a manifest
+// is typically maintained by hand or mirrored, and read with
+// LoadFirmwareManifest.
+type FirmwareManifest struct {
+	Releases []FirmwareRelease `json:"releases"`
+}
+
+// LoadFirmwareManifest reads a JSON manifest from an http(s) URL or a file.
+func LoadFirmwareManifest(ctx context.Context, location string) (*FirmwareManifest, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		data, err = fetchURL(ctx, location)
+	} else {
+		data, err = ioutil.ReadFile(location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read firmware manifest => %s", err)
+	}
+
+	m := &FirmwareManifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("Failed to parse firmware manifest %s => %s", location, err)
+	}
+	return m, nil
+}
+
+func fetchURL(ctx context.Context, uri string) ([]byte, error) {
+	resp, err := ctxhttp.Get(ctx, httpClient(client), uri)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status code => %d", uri, resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Latest returns the newest release for the device type and the line of the
+// given version.
+func (m *FirmwareManifest) Latest(deviceType string, current FirmwareVersion) (*FirmwareRelease, FirmwareVersion, bool) {
+	var best *FirmwareRelease
+	var bestVersion FirmwareVersion
+	for i := range m.Releases {
+		release := &m.Releases[i]
+		if release.DeviceType != deviceType {
+			continue
+		}
+		v, err := ParseFirmwareVersion(release.Version)
+		if err != nil || v.Variant != current.Variant {
+			continue
+		}
+		if best == nil || v.Compare(bestVersion) > 0 {
+			best, bestVersion = release, v
+		}
+	}
+	return best, bestVersion, best != nil
+}
+
+// FirmwareCheck is the result of CheckFirmware.
+type FirmwareCheck struct {
+	Current   string
+	Latest    string
+	Available bool             // Latest is newer than Current
+	Release   *FirmwareRelease // nil when the manifest knows no release
+}
+
+// CheckFirmware compares the firmware of the device with the manifest.
+func (d *Device) CheckFirmware(ctx context.Context, manifest *FirmwareManifest) (*FirmwareCheck, error) {
+	info, err := d.FetchDeviceInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := ParseFirmwareVersion(info.FirmwareVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &FirmwareCheck{Current: info.FirmwareVersion}
+	release, latest, ok := manifest.Latest(info.DeviceType, current)
+	if !ok {
+		return check, nil
+	}
+	check.Latest = release.Version
+	check.Release = release
+	check.Available = latest.Compare(current) > 0
+	return check, nil
+}
+
+// ErrNotConfirmed is returned by operations that need an explicit
+// confirmation when they didn't get it.
+var ErrNotConfirmed = errors.New("operation not confirmed")
+
+// FirmwareStatus is the state of a firmware update on the device.
+type FirmwareStatus int
+
+// Firmware update states
+const (
+	FirmwareDownloading    FirmwareStatus = 0
+	FirmwareDownloaded     FirmwareStatus = 1
+	FirmwareDownloadFailed FirmwareStatus = 2
+	FirmwareUpdateStarting FirmwareStatus = 3
+	FirmwareIdle           FirmwareStatus = 4
+)
+
+func (s FirmwareStatus) String() string {
+	switch s {
+	case FirmwareDownloading:
+		return "downloading"
+	case FirmwareDownloaded:
+		return "downloaded"
+	case FirmwareDownloadFailed:
+		return "download failed"
+	case FirmwareUpdateStarting:
+		return "updating"
+	case FirmwareIdle:
+		return "idle"
+	}
+	return "status(" + strconv.Itoa(int(s)) + ")"
+}
+
+// FirmwareStatus returns the state of the firmware update.
+func (d *Device) FirmwareStatus(ctx context.Context) (FirmwareStatus, error) {
+	response, err := d.action(ctx, "firmwareupdate", "GetFirmwareStatus")
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := responseValue(response, "FirmwareStatus")
+	if err != nil {
+		return 0, err
+	}
+	status, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse FirmwareStatus %q:\n\t%s", value, err)
+	}
+	return FirmwareStatus(status), nil
+}
+
+// UpdateFirmware asks the device to download and install the release. An
+// update can't be undone, so confirm is called with the device and the
+// release and must return true; without it ErrNotConfirmed is returned and
+// nothing is sent. Unsigned releases are installed with the firmware's
+// WithUnsignedImage flag. Use WaitFirmwareUpdate to follow the update.
+func (d *Device) UpdateFirmware(ctx context.Context, release *FirmwareRelease, confirm func(*DeviceInfo, *FirmwareRelease) bool) error {
+	info, err := d.FetchDeviceInfo(ctx)
+	if err != nil {
+		return err
+	}
+	if release.DeviceType != "" && release.DeviceType != info.DeviceType {
+		return fmt.Errorf("firmware %s is for %s, not %s", release.Version, release.DeviceType, info.DeviceType)
+	}
+	if confirm == nil || !confirm(info, release) {
+		return ErrNotConfirmed
+	}
+
+	unsigned := "0"
+	if !release.Signed {
+		unsigned = "1"
+	}
+	_, err = d.action(ctx, "firmwareupdate", "UpdateFirmware",
+		actionArgument{"NewFirmwareVersion", release.Version},
+		actionArgument{"ReleaseDate", ""},
+		actionArgument{"URL", release.URL},
+		actionArgument{"Signature", release.Signature},
+		actionArgument{"DownloadStartTime", "0"},
+		actionArgument{"WithUnsignedImage", unsigned},
+	)
+	return err
+}
+
+// WaitFirmwareUpdate polls FirmwareStatus every interval until the device
+// starts installing the update, the download failed or ctx is done. Every
+// poll is reported to progress, if set. The device reboots after installing,
+// which takes a few minutes.
+func (d *Device) WaitFirmwareUpdate(ctx context.Context, interval time.Duration, progress func(FirmwareStatus, error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status, err := d.FirmwareStatus(ctx)
+		if progress != nil {
+			progress(status, err)
+		}
+		if err == nil {
+			switch status {
+			case FirmwareUpdateStarting:
+				return nil
+			case FirmwareDownloadFailed:
+				return errors.New("firmware download failed")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
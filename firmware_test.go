@@ -0,0 +1,138 @@
+package wemo
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFirmwareManifest = `{"releases": [
+	{"device-type": "urn:Belkin:device:controllee:1", "version": "WeMo_WW_2.00.11057.PVT-OWRT-SNS", "url": "http://example.com/a.bin", "signed": true},
+	{"device-type": "urn:Belkin:device:controllee:1", "version": "WeMo_WW_2.00.11420.PVT-OWRT-SNS", "url": "http://example.com/b.bin", "signed": true},
+	{"device-type": "urn:Belkin:device:controllee:1", "version": "WeMo_WW_2.00.20110.PVT-RTOS-SNSV4", "url": "http://example.com/c.bin"},
+	{"device-type": "urn:Belkin:device:insight:1", "version": "WeMo_WW_2.00.11483.PVT-OWRT-Insight", "url": "http://example.com/d.bin"}
+]}`
+
+func TestParseFirmwareVersion(t *testing.T) {
+	v, err := ParseFirmwareVersion("WeMo_WW_2.00.11057.PVT-OWRT-SNS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := FirmwareVersion{Region: "WW", Major: 2, Minor: 0, Build: 11057, Variant: "PVT-OWRT-SNS"}
+	if v != expected {
+		t.Errorf("Expected: %+v, got: %+v", expected, v)
+	}
+	if v.String() != "WeMo_WW_2.00.11057.PVT-OWRT-SNS" {
+		t.Errorf("Expected: the original version, got: %s", v)
+	}
+
+	older, _ := ParseFirmwareVersion("WeMo_US_2.00.2769.PVT")
+	if older.Compare(v) != -1 || v.Compare(older) != 1 || v.Compare(v) != 0 {
+		t.Errorf("Expected: %s to be older than %s", older, v)
+	}
+
+	if _, err := ParseFirmwareVersion("1.2.3"); err == nil {
+		t.Error("Expected: an error parsing 1.2.3")
+	}
+}
+
+func TestCheckFirmware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	if err := ioutil.WriteFile(path, []byte(testFirmwareManifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := LoadFirmwareManifest(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firmware := "WeMo_WW_2.00.11057.PVT-OWRT-SNS"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<root><device><deviceType>%s</deviceType><firmwareVersion>%s</firmwareVersion></device></root>`, Controllee, firmware)
+	}))
+	defer server.Close()
+	device := &Device{Host: strings.TrimPrefix(server.URL, "http://")}
+
+	check, err := device.CheckFirmware(context.Background(), manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !check.Available || check.Latest != "WeMo_WW_2.00.11420.PVT-OWRT-SNS" || check.Release.URL != "http://example.com/b.bin" {
+		t.Errorf("Expected: 11420 to be available, got: %+v", check)
+	}
+
+	firmware = "WeMo_WW_2.00.11420.PVT-OWRT-SNS"
+	if check, err = device.CheckFirmware(context.Background(), manifest); err != nil || check.Available {
+		t.Errorf("Expected: no update, got: %+v, %v", check, err)
+	}
+
+	firmware = "WeMo_WW_2.00.10062.PVT-OWRT-LS"
+	if check, err = device.CheckFirmware(context.Background(), manifest); err != nil || check.Available || check.Release != nil {
+		t.Errorf("Expected: no release for another line, got: %+v, %v", check, err)
+	}
+}
+
+func TestUpdateFirmware(t *testing.T) {
+	var update map[string]string
+	statuses := []string{"0", "0", "1", "3"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/setup.xml":
+			fmt.Fprintf(w, `<root><device><deviceType>%s</deviceType><firmwareVersion>WeMo_WW_2.00.11057.PVT-OWRT-SNS</firmwareVersion></device></root>`, Controllee)
+		case strings.Contains(string(body), "<u:UpdateFirmware "):
+			update = make(map[string]string)
+			for _, name := range []string{"NewFirmwareVersion", "URL", "WithUnsignedImage"} {
+				update[name], _ = responseValue(body, name)
+			}
+			fmt.Fprint(w, testMessageHeader+`<u:UpdateFirmwareResponse xmlns:u="urn:Belkin:service:firmwareupdate:1"></u:UpdateFirmwareResponse>`+testMessageFooter)
+		case strings.Contains(string(body), "<u:GetFirmwareStatus "):
+			status := statuses[0]
+			statuses = statuses[1:]
+			fmt.Fprint(w, testMessageHeader+`<u:GetFirmwareStatusResponse xmlns:u="urn:Belkin:service:firmwareupdate:1"><FirmwareStatus>`+status+`</FirmwareStatus></u:GetFirmwareStatusResponse>`+testMessageFooter)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	device := &Device{Host: strings.TrimPrefix(server.URL, "http://")}
+
+	ctx := context.Background()
+	release := &FirmwareRelease{DeviceType: Controllee, Version: "WeMo_WW_2.00.11420.PVT-OWRT-SNS", URL: "http://example.com/b.bin"}
+	if err := device.UpdateFirmware(ctx, release, nil); err != ErrNotConfirmed {
+		t.Errorf("Expected: %s, got: %v", ErrNotConfirmed, err)
+	}
+	if err := device.UpdateFirmware(ctx, &FirmwareRelease{DeviceType: Insight}, func(*DeviceInfo, *FirmwareRelease) bool { return true }); err == nil {
+		t.Error("Expected: an error updating with firmware for another device type")
+	}
+	if update != nil {
+		t.Fatalf("Expected: no update to be sent, got: %v", update)
+	}
+
+	err := device.UpdateFirmware(ctx, release, func(info *DeviceInfo, r *FirmwareRelease) bool {
+		return info.FirmwareVersion != r.Version
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update["NewFirmwareVersion"] != release.Version || update["URL"] != release.URL || update["WithUnsignedImage"] != "1" {
+		t.Errorf("Expected: an unsigned update to %s, got: %v", release.Version, update)
+	}
+
+	var seen []string
+	err = device.WaitFirmwareUpdate(ctx, time.Millisecond, func(status FirmwareStatus, err error) {
+		seen = append(seen, status.String())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(seen, ",") != "downloading,downloading,downloaded,updating" {
+		t.Errorf("Expected: every poll reported, got: %v", seen)
+	}
+}
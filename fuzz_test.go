@@ -0,0 +1,87 @@
+package wemo
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// addGolden adds the responses of testdata/golden/kind to the corpus of f.
+func addGolden(f *testing.F, kind string) {
+	files, _ := filepath.Glob(filepath.Join("testdata", "golden", kind, "*.xml"))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+}
+
+func FuzzUnmarshalDeviceInfo(f *testing.F) {
+	addGolden(f, "setup")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		unmarshalDeviceInfo(data)
+	})
+}
+
+func FuzzParseInsightParams(f *testing.F) {
+	addGolden(f, "insightparams")
+	f.Add([]byte("<InsightParams>8|1|2</InsightParams>"))
+	f.Add([]byte("<InsightParams>|||||||||||</InsightParams>"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		params, err := parseInsightParams(string(data), true)
+		if err == nil && params.Raw == "" {
+			t.Errorf("Expected: the raw value kept, got: %+v", params)
+		}
+	})
+}
+
+func FuzzParseEndDevices(f *testing.F) {
+	addGolden(f, "enddevices")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parseEndDevices(data)
+	})
+}
+
+func FuzzParseBulbStatusList(f *testing.F) {
+	addGolden(f, "devicestatus")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		status, err := parseBulbStatusList(data)
+		if err != nil {
+			return
+		}
+		for _, value := range status {
+			parseBulbStatus(value)
+		}
+	})
+}
+
+// FuzzBulbName checks names of bulbs come back as a bridge lists them, escaped
+// in a document escaped once more.
+func FuzzBulbName(f *testing.F) {
+	for _, name := range []string{"Lamp", "Kitchen & Hall", "<b>", "&amp;", `"quoted" 'name'`, "Küche"} {
+		f.Add(name)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		if !utf8.ValidString(name) || strings.ContainsFunc(name, func(r rune) bool { return r < 0x20 || r == 0xFFFD }) {
+			t.Skip("not a name a bridge can keep")
+		}
+		list := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?><DeviceLists><DeviceList><DeviceListType>Paired</DeviceListType><DeviceInfos><DeviceInfo><DeviceID>A</DeviceID><FriendlyName>%s</FriendlyName></DeviceInfo></DeviceInfos></DeviceList></DeviceLists>`,
+			html.EscapeString(name))
+		data := []byte(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:GetEndDevicesResponse xmlns:u="urn:Belkin:service:bridge:1"><DeviceLists>` +
+			html.EscapeString(list) + `</DeviceLists></u:GetEndDevicesResponse></s:Body></s:Envelope>`)
+
+		devices, err := parseEndDevices(data)
+		if err != nil {
+			t.Fatalf("Failed to parse the list of %q => %s", name, err)
+		}
+		if len(devices.EndDeviceInfo) != 1 || devices.EndDeviceInfo[0].FriendlyName != name {
+			t.Errorf("Expected: %q, got: %+v", name, devices.EndDeviceInfo)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package wemo
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "write the parse results of testdata/golden as the expected ones")
+
+// TestGolden parses every response of testdata/golden, captured from devices
+// of several models and firmware versions, and compares the result with the
+// .json next to it. See testdata/golden/README.md to add captures.
+func TestGolden(t *testing.T) {
+	parsers := map[string]func([]byte) (interface{}, error){
+		"setup": func(data []byte) (interface{}, error) {
+			return unmarshalDeviceInfo(data)
+		},
+		"insightparams": func(data []byte) (interface{}, error) {
+			return parseInsightParams(string(data), false)
+		},
+		"enddevices": func(data []byte) (interface{}, error) {
+			return parseEndDevices(data)
+		},
+		"devicestatus": func(data []byte) (interface{}, error) {
+			return parseBulbStatusList(data)
+		},
+	}
+
+	for kind, parse := range parsers {
+		files, err := filepath.Glob(filepath.Join("testdata", "golden", kind, "*.xml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == 0 {
+			t.Errorf("Expected: captures in testdata/golden/%s, got: none", kind)
+		}
+		for _, file := range files {
+			parse, file := parse, file
+			t.Run(kind+"/"+filepath.Base(file), func(t *testing.T) {
+				data, err := ioutil.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result, err := parse(data)
+				if err != nil {
+					t.Fatalf("Failed to parse => %s", err)
+				}
+				actual, err := json.MarshalIndent(result, "", "  ")
+				if err != nil {
+					t.Fatal(err)
+				}
+				actual = append(actual, '\n')
+
+				golden := strings.TrimSuffix(file, ".xml") + ".json"
+				if *updateGolden {
+					if err := ioutil.WriteFile(golden, actual, 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				expected, err := ioutil.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("%s => %s, run go test -run TestGolden -update to write it", golden, err)
+				}
+				if !bytes.Equal(actual, expected) {
+					t.Errorf("Expected: %s, got: %s", expected, actual)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package wemo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GroupMember is a device in a Group, by its Manager key, or one of the bulbs
+// of a bridge when Bulb is set to its end device id.
+type GroupMember struct {
+	Device string `json:"device"`
+	Bulb   string `json:"bulb,omitempty"`
+}
+
+func (g GroupMember) String() string {
+	if g.Bulb != "" {
+		return g.Device + "/" + g.Bulb
+	}
+	return g.Device
+}
+
+// Group is a named set of switches, dimmers and bulbs switched together.
+type Group struct {
+	Name    string        `json:"name"`
+	Members []GroupMember `json:"members"`
+}
+
+// GroupError reports the members of a group a command failed for; the other
+// members were switched.
+type GroupError struct {
+	Group  string
+	Failed map[string]error // by member
+}
+
+func (e *GroupError) Error() string {
+	members := make([]string, 0, len(e.Failed))
+	for member := range e.Failed {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	for i, member := range members {
+		members[i] = fmt.Sprintf("%s: %s", member, e.Failed[member])
+	}
+	return fmt.Sprintf("group %s failed for %d members => %s", e.Group, len(members), strings.Join(members, "; "))
+}
+
+// SetGroup adds or replaces a group. Members must be known to the manager.
+func (m *Manager) SetGroup(group Group) error {
+	if group.Name == "" {
+		return errors.New("group has no name")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, member := range group.Members {
+		if _, ok := m.devices[member.Device]; !ok {
+			return fmt.Errorf("group %s: unknown device %s", group.Name, member.Device)
+		}
+	}
+	if m.groups == nil {
+		m.groups = make(map[string]Group)
+	}
+	m.groups[group.Name] = group
+	return nil
+}
+
+// RemoveGroup deletes a group, reporting whether it existed.
+func (m *Manager) RemoveGroup(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.groups[name]
+	delete(m.groups, name)
+	return ok
+}
+
+// Groups returns all groups ordered by name.
+func (m *Manager) Groups() []Group {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	groups := make([]Group, 0, len(m.groups))
+	for _, group := range m.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// GroupOn switches all members of the group on.
+func (m *Manager) GroupOn(ctx context.Context, name string) error {
+	return m.GroupSetLevel(ctx, name, 100)
+}
+
+// GroupOff switches all members of the group off.
+func (m *Manager) GroupOff(ctx context.Context, name string) error {
+	return m.GroupSetLevel(ctx, name, 0)
+}
+
+// GroupSetLevel sets all members of the group to level percent: dimmers are
+// dimmed, bulbs are dimmed and switched on, and switches are switched on for
+// any level above 0. What a member is follows from its Capabilities; members
+// that can't be switched, such as sensors, fail with an *UnsupportedError.
+// Members are switched concurrently; when some of them fail the error is a
+// *GroupError.
+func (m *Manager) GroupSetLevel(ctx context.Context, name string, level int) error {
+	if level < 0 || level > 100 {
+		return fmt.Errorf("level %d is out of bounds 0-100", level)
+	}
+
+	m.mu.RLock()
+	group, ok := m.groups[name]
+	entries := make([]ManagedDevice, len(group.Members))
+	for i, member := range group.Members {
+		if entry, found := m.devices[member.Device]; found {
+			entries[i] = *entry
+		}
+	}
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown group %s", name)
+	}
+
+	var mu sync.Mutex
+	failed := make(map[string]error)
+	var wg sync.WaitGroup
+	for i, member := range group.Members {
+		wg.Add(1)
+		go func(member GroupMember, entry ManagedDevice) {
+			defer wg.Done()
+			if err := m.setMemberLevel(ctx, member, entry, level); err != nil {
+				mu.Lock()
+				failed[member.String()] = err
+				mu.Unlock()
+			}
+		}(member, entries[i])
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return &GroupError{Group: name, Failed: failed}
+	}
+	return nil
+}
+
+// SetLevel sets a single device to level percent, the way GroupSetLevel sets
+// its members: switches go on for any level above 0.
+func (m *Manager) SetLevel(ctx context.Context, key string, level int) error {
+	if level < 0 || level > 100 {
+		return fmt.Errorf("level %d is out of bounds 0-100", level)
+	}
+	entry, ok := m.Get(key)
+	if !ok {
+		return fmt.Errorf("unknown device %s", key)
+	}
+	return m.setMemberLevel(ctx, GroupMember{Device: key}, entry, level)
+}
+
+// SetBulbLevel sets a bulb of a bridge to level percent, 0 switches it off.
+func (m *Manager) SetBulbLevel(ctx context.Context, key, bulb string, level int) error {
+	if level < 0 || level > 100 {
+		return fmt.Errorf("level %d is out of bounds 0-100", level)
+	}
+	entry, ok := m.Get(key)
+	if !ok {
+		return fmt.Errorf("unknown device %s", key)
+	}
+	return m.setMemberLevel(ctx, GroupMember{Device: key, Bulb: bulb}, entry, level)
+}
+
+func (m *Manager) setMemberLevel(ctx context.Context, member GroupMember, entry ManagedDevice, level int) error {
+	if entry.Key == "" {
+		return fmt.Errorf("unknown device %s", member.Device)
+	}
+
+	capabilities := entry.Capabilities()
+	switch {
+	case member.Bulb != "":
+		if !capabilities.Has(CapBulbs) {
+			return &UnsupportedError{Device: entry.Name, Needs: CapBulbs}
+		}
+		return m.serialize(ctx, entry.Key, func(device *Device) error {
+			if level == 0 {
+				return device.SetBulb(ctx, member.Bulb, "off", "", false)
+			}
+			if err := device.SetBulb(ctx, member.Bulb, "on", "", false); err != nil {
+				return err
+			}
+			return device.SetBulb(ctx, member.Bulb, "dim", strconv.Itoa(level*255/100), false)
+		})
+	case capabilities.Has(CapDim):
+		err := m.serialize(ctx, entry.Key, func(device *Device) error { return device.SetBrightness(ctx, level) })
+		if err == nil {
+			m.recordBinaryState(entry.Key, levelState(level), SourceCommand)
+		}
+		return err
+	case !capabilities.Has(CapSwitch):
+		return &UnsupportedError{Device: entry.Name, Needs: CapSwitch}
+	}
+	return m.setBinaryState(ctx, entry.Key, level > 0)
+}
+
+func levelState(level int) int {
+	if level > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+package wemo
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestGroupSetLevel(t *testing.T) {
+	plug := newFakeDevice(t, "uuid:Socket-1_0-A", "Plug", "A")
+	defer plug.Close()
+	dimmer := newFakeDevice(t, "uuid:Dimmer-1_0-B", "Dimmer", "B")
+	dimmer.deviceType = Dimmer
+	defer dimmer.Close()
+	bridge := newFakeDevice(t, "uuid:Bridge-1_0-C", "Bridge", "C")
+	bridge.deviceType = Bridge
+	defer bridge.Close()
+
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Plug", Host: plug.host(), UDN: plug.udn, DeviceType: Controllee})
+	m.Put(ManagedDevice{Name: "Dimmer", Host: dimmer.host(), UDN: dimmer.udn, DeviceType: Dimmer})
+	m.Put(ManagedDevice{Name: "Bridge", Host: bridge.host(), UDN: bridge.udn, DeviceType: Bridge})
+	m.Put(ManagedDevice{Name: "Gone", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-D"})
+
+	err := m.SetGroup(Group{Name: "living", Members: []GroupMember{
+		{Device: plug.udn},
+		{Device: dimmer.udn},
+		{Device: bridge.udn, Bulb: "94103EA2B27751AB"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetGroup(Group{Name: "bad", Members: []GroupMember{{Device: "uuid:nowhere"}}}); err == nil {
+		t.Errorf("Expected: unknown members to be rejected")
+	}
+
+	ctx := context.Background()
+	if err := m.GroupSetLevel(ctx, "living", 40); err != nil {
+		t.Fatal(err)
+	}
+	if plug.state != "1" || dimmer.brightness != "40" || bridge.bulbs["94103EA2B27751AB"] != "102" {
+		t.Errorf("Expected: plug on, dimmer at 40, bulb at 102, got: %s, %s, %v", plug.state, dimmer.brightness, bridge.bulbs)
+	}
+
+	if err := m.GroupOff(ctx, "living"); err != nil {
+		t.Fatal(err)
+	}
+	if plug.state != "0" || dimmer.state != "0" || bridge.bulbs["94103EA2B27751AB"] != "0" {
+		t.Errorf("Expected: everything off, got: %s, %s, %v", plug.state, dimmer.state, bridge.bulbs)
+	}
+
+	m.SetGroup(Group{Name: "porch", Members: []GroupMember{{Device: plug.udn}, {Device: "uuid:Socket-1_0-D"}}})
+	err = m.GroupOn(ctx, "porch")
+	var gerr *GroupError
+	if !errors.As(err, &gerr) || len(gerr.Failed) != 1 || gerr.Failed["uuid:Socket-1_0-D"] == nil {
+		t.Fatalf("Expected: Gone to fail, got: %v", err)
+	}
+	if plug.state != "1" {
+		t.Errorf("Expected: the plug to be switched on anyway")
+	}
+
+	if groups := m.Groups(); len(groups) != 2 || groups[0].Name != "living" {
+		t.Errorf("Expected: living and porch, got: %v", groups)
+	}
+}
@@ -0,0 +1,166 @@
+package wemo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// HealthStatus tells whether a device answered its last health check.
+type HealthStatus int
+
+// Health states
+const (
+	HealthUnknown HealthStatus = iota // not checked yet
+	HealthUp
+	HealthDown
+)
+
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthUp:
+		return "up"
+	case HealthDown:
+		return "down"
+	}
+	return "unknown"
+}
+
+// Ping checks that the device answers, with a HEAD request for its setup.xml,
+// which is cheaper for the device than a SOAP action.
+func (d *Device) Ping(ctx context.Context) error {
+	resp, err := ctxhttp.Head(ctx, httpClient(client), fmt.Sprintf("http://%s/setup.xml", d.Host))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status code => %d", d.Host, resp.StatusCode)
+	}
+	return nil
+}
+
+// HealthChange is a device going up or down.
+type HealthChange struct {
+	Device ManagedDevice
+	From   HealthStatus
+	To     HealthStatus
+	Err    error // why the check failed when To is HealthDown
+}
+
+// healthBus fans HealthChanges out to subscribers.
+type healthBus struct {
+	mu          sync.Mutex
+	subscribers map[chan HealthChange]bool
+}
+
+// publish must not block: a subscriber whose buffer is full misses the change.
+func (b *healthBus) publish(change HealthChange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
+
+// SubscribeHealth returns a channel receiving the devices going up or down
+// found by CheckHealth, so one MonitorHealth loop can feed several consumers.
+// Up to buffer changes are queued for a slow subscriber; further changes are
+// dropped. Call cancel to unsubscribe, which closes the channel.
+func (m *Manager) SubscribeHealth(buffer int) (changes <-chan HealthChange, cancel func()) {
+	ch := make(chan HealthChange, buffer)
+	b := &m.health
+	b.mu.Lock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan HealthChange]bool)
+	}
+	b.subscribers[ch] = true
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// CheckHealth pings all devices concurrently, records their status and
+// LastSeen, and returns the devices whose status changed. The changes are
+// also published to SubscribeHealth. Nothing is recorded when ctx is done
+// before the pings are, since they then fail whether the devices are up or
+// not.
+func (m *Manager) CheckHealth(ctx context.Context) []HealthChange {
+	devices := m.List()
+	errs := make([]error, len(devices))
+	var wg sync.WaitGroup
+	for i := range devices {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = devices[i].Device().Ping(ctx)
+		}(i)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	now := time.Now()
+	var changes []HealthChange
+	m.mu.Lock()
+	for i, checked := range devices {
+		entry, ok := m.devices[checked.Key]
+		if !ok {
+			continue
+		}
+		status := HealthUp
+		if errs[i] != nil {
+			status = HealthDown
+		} else {
+			entry.LastSeen = now
+		}
+		if entry.Health != status {
+			changes = append(changes, HealthChange{From: entry.Health, To: status, Err: errs[i]})
+			entry.Health = status
+			changes[len(changes)-1].Device = *entry
+		}
+	}
+	m.mu.Unlock()
+
+	for _, change := range changes {
+		m.health.publish(change)
+	}
+	return changes
+}
+
+// MonitorHealth checks the health of all devices every interval until ctx is
+// done, calling onChange, if set, for every device going up or down.
+func (m *Manager) MonitorHealth(ctx context.Context, interval time.Duration, onChange func(HealthChange)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, change := range m.CheckHealth(ctx) {
+			if onChange != nil && ctx.Err() == nil {
+				onChange(change)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
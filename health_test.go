@@ -0,0 +1,74 @@
+package wemo
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMonitorHealth(t *testing.T) {
+	porch := newFakeDevice(t, "uuid:Socket-1_0-A", "Porch", "A")
+	defer porch.Close()
+
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Porch", Host: porch.host(), UDN: porch.udn})
+
+	subscribed, unsubscribe := m.SubscribeHealth(10)
+	defer unsubscribe()
+	changes := make(chan HealthChange, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.MonitorHealth(ctx, 10*time.Millisecond, func(change HealthChange) { changes <- change })
+
+	change := <-changes
+	if change.From != HealthUnknown || change.To != HealthUp || change.Device.LastSeen.IsZero() {
+		t.Errorf("Expected: Porch to come up, got: %+v", change)
+	}
+
+	porch.Close()
+	change = <-changes
+	if change.From != HealthUp || change.To != HealthDown || change.Err == nil {
+		t.Errorf("Expected: Porch to go down, got: %+v", change)
+	}
+	for _, want := range []HealthStatus{HealthUp, HealthDown} {
+		if change := <-subscribed; change.To != want || change.Device.Name != "Porch" {
+			t.Errorf("Expected: Porch going %s to be published, got: %+v", want, change)
+		}
+	}
+	if entry, _ := m.Get(porch.udn); entry.Health != HealthDown {
+		t.Errorf("Expected: down, got: %s", entry.Health)
+	}
+
+	select {
+	case change := <-changes:
+		t.Errorf("Expected: no further changes, got: %+v", change)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestCheckHealthCancelled(t *testing.T) {
+	porch := newFakeDevice(t, "uuid:Socket-1_0-A", "Porch", "A")
+	defer porch.Close()
+
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Porch", Host: porch.host(), UDN: porch.udn})
+	if changes := m.CheckHealth(context.Background()); len(changes) != 1 || changes[0].To != HealthUp {
+		t.Fatalf("Expected: Porch to come up, got: %+v", changes)
+	}
+
+	subscribed, unsubscribe := m.SubscribeHealth(10)
+	defer unsubscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if changes := m.CheckHealth(ctx); len(changes) != 0 {
+		t.Errorf("Expected: no changes once cancelled, got: %+v", changes)
+	}
+	if entry, _ := m.Get(porch.udn); entry.Health != HealthUp {
+		t.Errorf("Expected: Porch to stay up, got: %s", entry.Health)
+	}
+	select {
+	case change := <-subscribed:
+		t.Errorf("Expected: nothing published, got: %+v", change)
+	default:
+	}
+}
@@ -0,0 +1,82 @@
+package wemo
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// InsightHistory keeps Insight readings in the named file, one InsightDoc as
+// JSON per line, for exports and rollups over more than the counters a device
+// keeps itself.
+type InsightHistory string
+
+// Append adds docs to the end of the history, creating the file when missing.
+func (h InsightHistory) Append(docs ...InsightDoc) error {
+	f, err := os.OpenFile(string(h), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+	for _, doc := range docs {
+		if err := encoder.Encode(doc); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read returns the readings of the device with key, or of all devices when key
+// is empty, taken from from up to but excluding to. A zero from or to leaves
+// that end open.
+func (h InsightHistory) Read(key string, from, to time.Time) ([]InsightDoc, error) {
+	f, err := os.Open(string(h))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var docs []InsightDoc
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var doc InsightDoc
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			return nil, fmt.Errorf("unable to parse line %d of %s => %s", line, string(h), err)
+		}
+		if (key != "" && doc.Key != key) || (!from.IsZero() && doc.Time.Before(from)) || (!to.IsZero() && !doc.Time.Before(to)) {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, scanner.Err()
+}
+
+// Reading returns the reading doc was made from, e.g. for RollupEnergy. The
+// key of the device takes the place of its host.
+func (doc InsightDoc) Reading() InsightReading {
+	return InsightReading{
+		Host: doc.Key,
+		Time: doc.Time,
+		Params: InsightParams{
+			OnFor:          doc.OnFor,
+			OnToday:        doc.OnToday,
+			OnTotal:        doc.OnTotal,
+			WifiStrength:   doc.Signal,
+			CurrentPower:   doc.PowerW * 1000,
+			TodayPower:     doc.TodayKWh * 60 * 1e6,
+			TotalPower:     doc.TotalKWh * 60 * 1e6,
+			PowerThreshold: doc.ThresholdW * 1000,
+		},
+	}
+}
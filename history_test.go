@@ -0,0 +1,35 @@
+package wemo
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInsightHistory(t *testing.T) {
+	history := InsightHistory(filepath.Join(t.TempDir(), "insight.jsonl"))
+	start := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		reading := InsightReading{Time: start.Add(time.Duration(i) * time.Hour), Params: InsightParams{CurrentPower: 60000, TodayPower: 3.6e6}}
+		if err := history.Append(NewInsightDoc("A", reading), NewInsightDoc("B", reading)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	docs, err := history.Read("A", start.Add(time.Hour), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 || docs[0].Key != "A" || !docs[0].Time.Equal(start.Add(time.Hour)) {
+		t.Fatalf("Unexpected readings: %+v", docs)
+	}
+	if docs, _ := history.Read("", start, start.Add(time.Hour)); len(docs) != 2 {
+		t.Errorf("Expected: 2 readings, got: %d", len(docs))
+	}
+
+	reading := docs[0].Reading()
+	if reading.Host != "A" || reading.Params.CurrentPower != 60000 || math.Abs(reading.Params.TodayPower-3.6e6) > 1e-6 {
+		t.Errorf("Unexpected reading: %+v", reading)
+	}
+}
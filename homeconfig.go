@@ -0,0 +1,110 @@
+package wemo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HomeConfigVersion is the version of the HomeConfig document written by
+// Export.
+const HomeConfigVersion = 1
+
+// HomeConfig is the configuration of a Manager: its devices with their
+// aliases and labels, its groups and its scenes. It is written as JSON or
+// YAML, see MarshalYAML and ParseHomeConfig, to reproduce a setup or move it
+// to another host.
+type HomeConfig struct {
+	Version int                  `json:"version"`
+	Devices []ManagedDevice      `json:"devices"`
+	Groups  []Group              `json:"groups,omitempty"`
+	Scenes  map[string]*Snapshot `json:"scenes,omitempty"`
+}
+
+// Export returns the configuration of the manager.
+func (m *Manager) Export() *HomeConfig {
+	config := &HomeConfig{
+		Version: HomeConfigVersion,
+		Devices: m.List(),
+		Groups:  m.Groups(),
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.scenes) > 0 {
+		config.Scenes = make(map[string]*Snapshot, len(m.scenes))
+		for name, scene := range m.scenes {
+			config.Scenes[name] = scene
+		}
+	}
+	return config
+}
+
+// Import adds the devices, groups and scenes of config to the manager,
+// replacing those with the same keys and names.
+func (m *Manager) Import(config *HomeConfig) error {
+	if config.Version < 1 || config.Version > HomeConfigVersion {
+		return fmt.Errorf("unsupported home configuration version %d", config.Version)
+	}
+	for _, entry := range config.Devices {
+		if _, err := m.Put(entry); err != nil {
+			return fmt.Errorf("device %s: %s", entry.Name, err)
+		}
+	}
+	for _, group := range config.Groups {
+		if err := m.SetGroup(group); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(config.Scenes))
+	for name := range config.Scenes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := m.SetScene(name, config.Scenes[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalYAML writes the configuration as YAML, with the same field names as
+// its JSON.
+func (c *HomeConfig) MarshalYAML() (interface{}, error) {
+	data, err := json.Marshal((*homeConfigJSON)(c))
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// homeConfigJSON marshals a HomeConfig without MarshalYAML.
+type homeConfigJSON HomeConfig
+
+// ParseHomeConfig reads a configuration written as JSON or YAML.
+func ParseHomeConfig(data []byte) (*HomeConfig, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var generic interface{}
+		if err := yaml.Unmarshal(data, &generic); err != nil {
+			return nil, fmt.Errorf("Failed to parse home configuration => %s", err)
+		}
+		var err error
+		if data, err = json.Marshal(generic); err != nil {
+			return nil, fmt.Errorf("Failed to parse home configuration => %s", err)
+		}
+	}
+
+	config := &HomeConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("Failed to parse home configuration => %s", err)
+	}
+	return config, nil
+}
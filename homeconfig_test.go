@@ -0,0 +1,58 @@
+package wemo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExportImport(t *testing.T) {
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Kettle", Host: "10.0.0.5:49153", UDN: "uuid:Socket-1_0-A", DeviceType: Controllee})
+	m.Put(ManagedDevice{Name: "Lamp", Host: "10.0.0.6:49153", UDN: "uuid:Dimmer-1_0-B", DeviceType: Dimmer})
+	m.SetAlias("uuid:Socket-1_0-A", "kettle")
+	m.SetLabel("uuid:Socket-1_0-A", "critical", "true")
+	m.SetGroup(Group{Name: "kitchen", Members: []GroupMember{{Device: "uuid:Socket-1_0-A"}, {Device: "uuid:Dimmer-1_0-B"}}})
+	m.SetScene("evening", &Snapshot{Devices: map[string]DeviceSnapshot{"uuid:Dimmer-1_0-B": {State: 1, Brightness: 30}}})
+
+	data, err := yaml.Marshal(m.Export())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "device-type: urn:Belkin:device:dimmer:1") {
+		t.Errorf("Expected: the JSON field names, got:\n%s", data)
+	}
+
+	jsonData, _ := json.Marshal(m.Export())
+	for _, data := range [][]byte{data, jsonData} {
+		config, err := ParseHomeConfig(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		imported := NewManager()
+		if err := imported.Import(config); err != nil {
+			t.Fatal(err)
+		}
+
+		device, err := imported.Lookup("kettle")
+		if err != nil || device.Host != "10.0.0.5:49153" {
+			t.Errorf("Expected: the kettle by its alias, got: %v, %v", device, err)
+		}
+		selector, _ := ParseSelector("critical=true")
+		if selected := imported.Select(selector); len(selected) != 1 {
+			t.Errorf("Expected: the labels, got: %v", selected)
+		}
+		if groups := imported.Groups(); len(groups) != 1 || len(groups[0].Members) != 2 {
+			t.Errorf("Expected: the kitchen group, got: %v", groups)
+		}
+		if scene, ok := imported.Scene("evening"); !ok || scene.Devices["uuid:Dimmer-1_0-B"].Brightness != 30 {
+			t.Errorf("Expected: the evening scene, got: %+v", scene)
+		}
+	}
+
+	if err := NewManager().Import(&HomeConfig{Version: HomeConfigVersion + 1}); err == nil {
+		t.Errorf("Expected: a newer version to be refused")
+	}
+}
@@ -0,0 +1,50 @@
+package wemo
+
+import (
+	"regexp"
+	"sync"
+	"time"
+)
+
+// ActionExchange is a SOAP action sent to a device and the device's answer,
+// as passed to the hook installed with SetActionHook.
+type ActionExchange struct {
+	Host       string
+	Service    string
+	Action     string
+	Request    []byte // the envelope sent
+	StatusCode int    // 0 when no response arrived
+	Response   []byte // the raw response body
+	Duration   time.Duration
+	Err        error
+}
+
+var (
+	hookMu     sync.RWMutex
+	activeHook func(ActionExchange)
+)
+
+// SetActionHook installs a function called after every SOAP action with the
+// payloads exchanged, e.g. to dump them for debugging; nil removes it. The
+// payloads may carry secrets such as WiFi passwords, see RedactSecrets. The
+// hook is called on the goroutine of the action and must be safe for
+// concurrent use.
+func SetActionHook(hook func(ActionExchange)) {
+	hookMu.Lock()
+	defer hookMu.Unlock()
+	activeHook = hook
+}
+
+func actionHook() func(ActionExchange) {
+	hookMu.RLock()
+	defer hookMu.RUnlock()
+	return activeHook
+}
+
+var secretRE = regexp.MustCompile(`(?i)<(password|pluginprivateKey|smartprivateKey|smartUniqueId|HomeId)>[^<]+</`)
+
+// RedactSecrets replaces the WiFi passwords and remote access keys in a SOAP
+// payload with REDACTED.
+func RedactSecrets(payload []byte) []byte {
+	return secretRE.ReplaceAll(payload, []byte("<${1}>REDACTED</"))
+}
@@ -0,0 +1,51 @@
+package wemo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestActionHook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testMessageHeader + `<u:GetHomeIdResponse xmlns:u="urn:Belkin:service:basicevent:1"><HomeId>123456</HomeId></u:GetHomeIdResponse>` + testMessageFooter))
+	}))
+	defer server.Close()
+	device := &Device{Host: strings.TrimPrefix(server.URL, "http://")}
+
+	exchanges := make(chan ActionExchange, 1)
+	SetActionHook(func(exchange ActionExchange) { exchanges <- exchange })
+	defer SetActionHook(nil)
+
+	if _, err := device.action(context.Background(), "basicevent", "SetHomeId", actionArgument{"HomeId", "123456"}); err != nil {
+		t.Fatal(err)
+	}
+	exchange := <-exchanges
+	if exchange.Action != "SetHomeId" || exchange.StatusCode != http.StatusOK || exchange.Err != nil {
+		t.Errorf("Unexpected exchange: %+v", exchange)
+	}
+	if !strings.Contains(string(exchange.Request), "<HomeId>123456</HomeId>") || !strings.Contains(string(exchange.Response), "<HomeId>123456</HomeId>") {
+		t.Errorf("Expected: the raw payloads, got: %s and %s", exchange.Request, exchange.Response)
+	}
+
+	// the legacy actions not taking a context are reported too
+	if state := device.GetBinaryState(); state != -1 {
+		t.Errorf("Expected: the HomeId answer to be rejected, got: %d", state)
+	}
+	exchange = <-exchanges
+	if exchange.Action != "GetBinaryState" || exchange.StatusCode != http.StatusOK || !strings.Contains(string(exchange.Response), "<HomeId>123456</HomeId>") {
+		t.Errorf("Unexpected exchange: %+v", exchange)
+	}
+
+	for payload, expected := range map[string]string{
+		"<ssid>home</ssid><password>s3cret</password>": "<ssid>home</ssid><password>REDACTED</password>",
+		"<HomeId>123456</HomeId><HomeId></HomeId>":     "<HomeId>REDACTED</HomeId><HomeId></HomeId>",
+		"<smartprivateKey>abc</smartprivateKey>":       "<smartprivateKey>REDACTED</smartprivateKey>",
+	} {
+		if actual := string(RedactSecrets([]byte(payload))); actual != expected {
+			t.Errorf("Expected: %s, got: %s", expected, actual)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package wemo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// insightValue invokes a single value getter of the insight service and
+// returns the content of the named response element.
+func (d *Device) insightValue(ctx context.Context, action, element string) (string, error) {
+	data, err := d.action(ctx, "insight", action)
+	if err != nil {
+		return "", err
+	}
+	return responseValue(data, element)
+}
+
+func (d *Device) insightFloat(ctx context.Context, action, element string) (float64, error) {
+	value, err := d.insightValue(ctx, action, element)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse %s in %s response:\n\t%s", element, action, err)
+	}
+	return f, nil
+}
+
+func (d *Device) insightSeconds(ctx context.Context, action, element string) (time.Duration, error) {
+	value, err := d.insightValue(ctx, action, element)
+	if err != nil {
+		return 0, err
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse %s in %s response:\n\t%s", element, action, err)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// GetPower returns the instantaneous power draw in mW.
+func (d *Device) GetPower(ctx context.Context) (float64, error) {
+	return d.insightFloat(ctx, "GetPower", "InstantPower")
+}
+
+// GetAvgPower returns the average power draw in W, as computed by the device.
+func (d *Device) GetAvgPower(ctx context.Context) (float64, error) {
+	return d.insightFloat(ctx, "GetAvgPower", "AvgPower")
+}
+
+// GetTodayKWH returns the energy drawn today, as reported by the device.
+func (d *Device) GetTodayKWH(ctx context.Context) (float64, error) {
+	return d.insightFloat(ctx, "GetTodayKWH", "TodayKWH")
+}
+
+// GetPowerThreshold returns the standby threshold in mW.
+func (d *Device) GetPowerThreshold(ctx context.Context) (float64, error) {
+	return d.insightFloat(ctx, "GetPowerThreshold", "PowerThreshold")
+}
+
+// GetONFor returns how long the device has been on since it last switched.
+func (d *Device) GetONFor(ctx context.Context) (time.Duration, error) {
+	return d.insightSeconds(ctx, "GetONFor", "ONFor")
+}
+
+// GetTodayONTime returns how long the device has been on today.
+func (d *Device) GetTodayONTime(ctx context.Context) (time.Duration, error) {
+	return d.insightSeconds(ctx, "GetTodayONTime", "TodayONTime")
+}
+
+// DevicePower is the reading of a single device in a PowerSummary.
+type DevicePower struct {
+	Device *Device
+	Params *InsightParams
+}
+
+// DeviceError pairs a device with the error it returned.
+type DeviceError struct {
+	Device *Device
+	Err    error
+}
+
+func (e DeviceError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Device.Host, e.Err)
+}
+
+// PowerSummary combines the readings of several Insight devices.
+type PowerSummary struct {
+	Time         time.Time
+	CurrentPower float64 // mW, summed over the devices that answered
+	TodayPower   float64 // mW·min as reported, summed likewise
+	TodayKWh     float64 // TodayPower in kWh
+	Devices      []DevicePower
+	Failures     []DeviceError
+}
+
+// SummarizePower queries the Insight parameters of all devices concurrently.
+// Devices that fail to answer are listed in Failures and left out of the
+// totals. Both lists are sorted by host.
+func SummarizePower(ctx context.Context, devices []*Device) *PowerSummary {
+	summary := &PowerSummary{Time: time.Now()}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, device := range devices {
+		wg.Add(1)
+		go func(device *Device) {
+			defer wg.Done()
+			params, err := device.FetchInsightParams(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				summary.Failures = append(summary.Failures, DeviceError{device, err})
+				return
+			}
+			summary.Devices = append(summary.Devices, DevicePower{device, params})
+			summary.CurrentPower += params.CurrentPower
+			summary.TodayPower += params.TodayPower
+			summary.TodayKWh += params.TodayKWh()
+		}(device)
+	}
+	wg.Wait()
+
+	sort.Slice(summary.Devices, func(i, j int) bool { return summary.Devices[i].Device.Host < summary.Devices[j].Device.Host })
+	sort.Slice(summary.Failures, func(i, j int) bool { return summary.Failures[i].Device.Host < summary.Failures[j].Device.Host })
+
+	return summary
+}
+
+// PollInsight samples the Insight parameters every interval until ctx is done,
+// sending each reading on the returned channel, which is closed on return.
+// Failed samples are reported through the device Logger and skipped.
+func (d *Device) PollInsight(ctx context.Context, interval time.Duration) <-chan InsightReading {
+	readings := make(chan InsightReading)
+	go func() {
+		defer close(readings)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			params, err := d.FetchInsightParams(ctx)
+			if err != nil {
+				d.printf("unable to poll insight params => %s\n", err)
+			} else {
+				select {
+				case readings <- InsightReading{Host: d.Host, Time: time.Now(), Params: *params}:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return readings
+}
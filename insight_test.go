@@ -0,0 +1,119 @@
+package wemo
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newInsightServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path != "/upnp/control/insight1" {
+			t.Errorf("Expected: /upnp/control/insight1, got: %s", r.URL.Path)
+		}
+
+		switch {
+		case strings.Contains(string(body), "<u:GetPower "):
+			w.Write([]byte(testMessageHeader + `<u:GetPowerResponse xmlns:u="urn:Belkin:service:insight:1"><InstantPower>7300</InstantPower></u:GetPowerResponse>` + testMessageFooter))
+		case strings.Contains(string(body), "<u:GetONFor "):
+			w.Write([]byte(testMessageHeader + `<u:GetONForResponse xmlns:u="urn:Belkin:service:insight:1"><ONFor>3244</ONFor></u:GetONForResponse>` + testMessageFooter))
+		case strings.Contains(string(body), "<u:GetInsightParams "):
+			w.Write([]byte(testMessageHeader + `<u:GetInsightParamsResponse xmlns:u="urn:Belkin:service:insight:1"><InsightParams>8|1471416661|8|3244|3182|15377|19|7300|1011115|1011115.000000|8000</InsightParams></u:GetInsightParamsResponse>` + testMessageFooter))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(testMessageHeader + `<s:Fault><detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>401</errorCode><errorDescription>Invalid Action</errorDescription></UPnPError></detail></s:Fault>` + testMessageFooter))
+		}
+	}))
+}
+
+func TestInsightValues(t *testing.T) {
+	server := newInsightServer(t)
+	defer server.Close()
+
+	device := &Device{Host: strings.TrimPrefix(server.URL, "http://")}
+	ctx := context.Background()
+
+	power, err := device.GetPower(ctx)
+	if err != nil || power != 7300 {
+		t.Errorf("Expected: 7300, got: %v (%v)", power, err)
+	}
+
+	onFor, err := device.GetONFor(ctx)
+	if err != nil || onFor != 3244*time.Second {
+		t.Errorf("Expected: 54m4s, got: %v (%v)", onFor, err)
+	}
+
+	_, err = device.GetTodayKWH(ctx)
+	actionErr, ok := err.(*ActionError)
+	if !ok {
+		t.Fatalf("Expected: *ActionError, got: %T (%v)", err, err)
+	}
+	if actionErr.Code != 401 || actionErr.Description != "Invalid Action" {
+		t.Errorf("Expected: UPnP error 401, got: %+v", actionErr)
+	}
+}
+
+func TestSummarizePower(t *testing.T) {
+	server := newInsightServer(t)
+	defer server.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	devices := []*Device{
+		{Host: strings.TrimPrefix(server.URL, "http://")},
+		{Host: strings.TrimPrefix(closed.URL, "http://")},
+		{Host: strings.TrimPrefix(server.URL, "http://")},
+	}
+
+	summary := SummarizePower(context.Background(), devices)
+	if len(summary.Devices) != 2 || len(summary.Failures) != 1 {
+		t.Fatalf("Expected: 2 devices and 1 failure, got: %d and %d", len(summary.Devices), len(summary.Failures))
+	}
+	if summary.CurrentPower != 14600 {
+		t.Errorf("Expected: 14600 mW, got: %v", summary.CurrentPower)
+	}
+	if math.Abs(summary.TodayKWh-summary.TodayPower/60/1e6) > 1e-12 || summary.TodayKWh == 0 {
+		t.Errorf("Expected: %v mW·min in kWh, got: %v", summary.TodayPower, summary.TodayKWh)
+	}
+	if summary.Failures[0].Device != devices[1] {
+		t.Errorf("Expected: %s to fail, got: %s", devices[1].Host, summary.Failures[0].Device.Host)
+	}
+}
+
+func TestKeepRawInsight(t *testing.T) {
+	server := newInsightServer(t)
+	defer server.Close()
+
+	device := &Device{Host: strings.TrimPrefix(server.URL, "http://")}
+	params, err := device.FetchInsightParams(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Raw != "" {
+		t.Errorf("Expected: no raw value by default, got: %s", params.Raw)
+	}
+
+	device.KeepRawInsight = true
+	params, err = device.FetchInsightParams(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "8|1471416661|8|3244|3182|15377|19|7300|1011115|1011115.000000|8000"
+	if params.Raw != expected {
+		t.Errorf("Expected: %s, got: %s", expected, params.Raw)
+	}
+}
+
+func TestInsightParamsUnits(t *testing.T) {
+	params := InsightParams{CurrentPower: 61250, TodayPower: 120e6, TotalPower: 3.6e9}
+	if params.PowerW() != 61.25 || params.TodayKWh() != 2 || params.TotalKWh() != 60 {
+		t.Errorf("Expected: 61.25 W, 2 kWh and 60 kWh, got: %v W, %v kWh and %v kWh", params.PowerW(), params.TodayKWh(), params.TotalKWh())
+	}
+}
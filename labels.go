@@ -0,0 +1,141 @@
+package wemo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetLabel sets a key/value label, such as room=kitchen, on a device.
+func (m *Manager) SetLabel(key, name, value string) error {
+	if !validLabel(name) {
+		return fmt.Errorf("invalid label name %q", name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.devices[key]
+	if !ok {
+		return fmt.Errorf("unknown device %s", key)
+	}
+	entry.Labels = copyLabels(entry.Labels)
+	entry.Labels[name] = value
+	return nil
+}
+
+// RemoveLabel removes a label from a device.
+func (m *Manager) RemoveLabel(key, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if entry, ok := m.devices[key]; ok {
+		entry.Labels = copyLabels(entry.Labels)
+		delete(entry.Labels, name)
+	}
+}
+
+// copyLabels copies labels before they are changed, since the entries handed
+// out by the manager share them.
+func copyLabels(labels map[string]string) map[string]string {
+	c := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
+
+func validLabel(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "=!, ")
+}
+
+// Selector selects devices by their labels, see ParseSelector.
+type Selector []requirement
+
+type requirement struct {
+	name  string
+	value string
+	op    string // "=", "!=", "exists" or "!exists"
+}
+
+// ParseSelector parses a comma separated list of requirements, all of which
+// a device must meet: "room=kitchen" and "room!=kitchen" compare a label,
+// "critical" requires a label to be set and "!critical" requires it not to be.
+// The empty selector selects all devices.
+func ParseSelector(s string) (Selector, error) {
+	var selector Selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var r requirement
+		switch {
+		case strings.Contains(part, "!="):
+			kv := strings.SplitN(part, "!=", 2)
+			r = requirement{name: strings.TrimSpace(kv[0]), value: strings.TrimSpace(kv[1]), op: "!="}
+		case strings.Contains(part, "="):
+			kv := strings.SplitN(part, "=", 2)
+			r = requirement{name: strings.TrimSpace(kv[0]), value: strings.TrimSpace(kv[1]), op: "="}
+		case strings.HasPrefix(part, "!"):
+			r = requirement{name: strings.TrimSpace(part[1:]), op: "!exists"}
+		default:
+			r = requirement{name: part, op: "exists"}
+		}
+		if !validLabel(r.name) {
+			return nil, fmt.Errorf("invalid selector %q", part)
+		}
+		selector = append(selector, r)
+	}
+	return selector, nil
+}
+
+// Matches reports whether labels meet all requirements.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		value, ok := labels[r.name]
+		switch r.op {
+		case "=":
+			if !ok || value != r.value {
+				return false
+			}
+		case "!=":
+			if ok && value == r.value {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		switch r.op {
+		case "exists":
+			parts[i] = r.name
+		case "!exists":
+			parts[i] = "!" + r.name
+		default:
+			parts[i] = r.name + r.op + r.value
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Select returns the devices matching the selector, ordered by name.
+func (m *Manager) Select(selector Selector) []ManagedDevice {
+	var selected []ManagedDevice
+	for _, entry := range m.List() {
+		if selector.Matches(entry.Labels) {
+			selected = append(selected, entry)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,60 @@
+package wemo
+
+import "testing"
+
+func TestSelectByLabels(t *testing.T) {
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Freezer", UDN: "uuid:Insight-1_0-A"})
+	m.Put(ManagedDevice{Name: "Kettle", UDN: "uuid:Socket-1_0-B"})
+	m.Put(ManagedDevice{Name: "Porch", UDN: "uuid:Socket-1_0-C"})
+	m.SetLabel("uuid:Insight-1_0-A", "room", "kitchen")
+	m.SetLabel("uuid:Insight-1_0-A", "critical", "true")
+	m.SetLabel("uuid:Socket-1_0-B", "room", "kitchen")
+	m.SetLabel("uuid:Socket-1_0-C", "room", "outside")
+	if err := m.SetLabel("uuid:Socket-1_0-C", "a=b", "c"); err == nil {
+		t.Errorf("Expected: an invalid label name")
+	}
+
+	// labels survive the entry being refreshed
+	m.Put(ManagedDevice{Name: "Porch", UDN: "uuid:Socket-1_0-C", Host: "10.0.0.9:49153"})
+
+	tests := []struct {
+		selector string
+		expected []string
+	}{
+		{"", []string{"Freezer", "Kettle", "Porch"}},
+		{"room=kitchen", []string{"Freezer", "Kettle"}},
+		{"room=kitchen, !critical", []string{"Kettle"}},
+		{"critical", []string{"Freezer"}},
+		{"room!=kitchen", []string{"Porch"}},
+		{"room=garage", nil},
+	}
+	for _, test := range tests {
+		selector, err := ParseSelector(test.selector)
+		if err != nil {
+			t.Errorf("%s: %s", test.selector, err)
+			continue
+		}
+		var names []string
+		for _, entry := range m.Select(selector) {
+			names = append(names, entry.Name)
+		}
+		if len(names) != len(test.expected) {
+			t.Errorf("%s: Expected: %v, got: %v", test.selector, test.expected, names)
+			continue
+		}
+		for i := range names {
+			if names[i] != test.expected[i] {
+				t.Errorf("%s: Expected: %v, got: %v", test.selector, test.expected, names)
+				break
+			}
+		}
+	}
+
+	if _, err := ParseSelector("=kitchen"); err == nil {
+		t.Errorf("Expected: an invalid selector")
+	}
+	if s, _ := ParseSelector("room = kitchen,!critical"); s.String() != "room=kitchen,!critical" {
+		t.Errorf("Expected: room=kitchen,!critical, got: %s", s)
+	}
+}
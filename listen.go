@@ -0,0 +1,166 @@
+package wemo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EventListener subscribes to the events of the devices of a Manager and
+// feeds them to HandleEvent, so subscribers of the Manager see state changes
+// when they happen rather than when a device is next read. Serve it on
+// /listener at Callback.
+type EventListener struct {
+	Manager *Manager
+
+	// Callback is the host:port the devices send their events to.
+	Callback string
+
+	// Timeout is the subscription timeout in seconds, defaults to 300.
+	// Subscriptions are renewed 30 seconds before they time out.
+	Timeout int
+
+	// Logger, if set, receives failed subscriptions, e.g. log.Printf.
+	Logger func(format string, args ...interface{})
+
+	mu     sync.Mutex
+	hosts  map[string]string    // sid => host
+	sids   map[string]string    // key => sid
+	renews map[string]time.Time // key => time to renew
+}
+
+// ServeHTTP takes the NOTIFY requests of the devices.
+func (l *EventListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if r.Method != "NOTIFY" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	events := make(chan SubscriptionEvent, 1)
+	if err := emitEvent(r, events); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	event := <-events
+
+	l.mu.Lock()
+	host, ok := l.hosts[event.Sid]
+	l.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown subscription", http.StatusPreconditionFailed)
+		return
+	}
+	l.Manager.HandleEvent(host, event.Deviceevent)
+}
+
+// Subscribed returns the number of devices with a subscription.
+func (l *EventListener) Subscribed() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.sids)
+}
+
+// Run subscribes to the devices of the manager, including devices added
+// later, and renews the subscriptions until ctx is done. Failed subscriptions
+// are retried every 30 seconds.
+func (l *EventListener) Run(ctx context.Context) error {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		l.renew()
+		select {
+		case <-ctx.Done():
+			l.unsubscribe()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *EventListener) timeout() int {
+	if l.Timeout <= 0 {
+		return 300
+	}
+	return l.Timeout
+}
+
+func (l *EventListener) renew() {
+	l.mu.Lock()
+	if l.hosts == nil {
+		l.hosts = make(map[string]string)
+		l.sids = make(map[string]string)
+		l.renews = make(map[string]time.Time)
+	}
+	l.mu.Unlock()
+
+	now := time.Now()
+	for _, entry := range l.Manager.List() {
+		l.mu.Lock()
+		sid, renewAt := l.sids[entry.Key], l.renews[entry.Key]
+		l.mu.Unlock()
+		if sid != "" && now.Before(renewAt) {
+			continue
+		}
+
+		d := entry.Device()
+		address, path := eventAddress(entry)
+		var status int
+		if sid != "" {
+			sid, status = d.ReSubscribe(sid, address, l.timeout())
+			var err error
+			if status != http.StatusOK {
+				err = fmt.Errorf("%s", statusMessage("Resubscription", d.Host, status))
+			}
+			metrics().SubscriptionRenewed(d.Host, err)
+		}
+		if status != http.StatusOK {
+			sid, status = d.Subscribe(l.Callback, address, path, l.timeout())
+		}
+
+		l.mu.Lock()
+		for s, host := range l.hosts {
+			if host == d.Host {
+				delete(l.hosts, s)
+			}
+		}
+		if status == http.StatusOK && sid != "" {
+			l.hosts[sid] = d.Host
+			l.sids[entry.Key] = sid
+			l.renews[entry.Key] = now.Add(time.Duration(l.timeout()-30) * time.Second)
+		} else {
+			delete(l.sids, entry.Key)
+		}
+		l.mu.Unlock()
+
+		if status != http.StatusOK && l.Logger != nil {
+			l.Logger("unable to subscribe to %s => %s", entry.Name, statusMessage("Subscription", d.Host, status))
+		}
+	}
+}
+
+func (l *EventListener) unsubscribe() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, sid := range l.sids {
+		if entry, ok := l.Manager.Get(key); ok {
+			address, _ := eventAddress(entry)
+			entry.Device().UnSubscribe(sid, address)
+		}
+	}
+	l.hosts = nil
+	l.sids = nil
+	l.renews = nil
+}
+
+// eventAddress returns the event URL and path of a device.
+func eventAddress(entry ManagedDevice) (address, path string) {
+	path = "/upnp/event/basicevent1"
+	if entry.DeviceType == Bridge {
+		path = "/upnp/event/bridge1"
+	}
+	return "http://" + entry.Host + path, path
+}
@@ -0,0 +1,61 @@
+package wemo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventListener(t *testing.T) {
+	plug := newFakeDevice(t, "uuid:Socket-1_0-A", "Plug", "A")
+	defer plug.Close()
+
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Plug", Host: plug.host(), UDN: plug.udn, DeviceType: Controllee})
+	l := &EventListener{Manager: m, Callback: "127.0.0.1:1"}
+	server := httptest.NewServer(l)
+	defer server.Close()
+
+	l.renew()
+	if n := l.Subscribed(); n != 1 {
+		t.Fatalf("Expected: 1 subscription, got: %d", n)
+	}
+
+	events, cancel := m.Subscribe(1)
+	defer cancel()
+	notify := func(sid string) int {
+		req, _ := http.NewRequest("NOTIFY", server.URL+"/listener", strings.NewReader(`<e:propertyset xmlns:e="urn:schemas-upnp-org:event-1-0"><e:property><BinaryState>1</BinaryState></e:property></e:propertyset>`))
+		req.Header.Set("SID", sid)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := notify("uuid:unknown"); code != http.StatusPreconditionFailed {
+		t.Errorf("Expected: %d, got: %d", http.StatusPreconditionFailed, code)
+	}
+	if code := notify("uuid:subscription-A"); code != http.StatusOK {
+		t.Fatalf("Expected: %d, got: %d", http.StatusOK, code)
+	}
+	select {
+	case event := <-events:
+		if event.Key != plug.udn || event.State != 1 || event.Source != SourceEvent {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected: a state change")
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	stop()
+	l.Run(ctx)
+	if n := l.Subscribed(); n != 0 {
+		t.Errorf("Expected: no subscriptions after Run returned, got: %d", n)
+	}
+}
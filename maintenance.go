@@ -0,0 +1,75 @@
+package wemo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ResetMode selects what ReSetup clears.
+type ResetMode int
+
+// Reset modes
+const (
+	ResetData ResetMode = 1 // name, icon and rules
+	ResetAll  ResetMode = 2 // everything, the device comes up in setup mode
+	ResetWiFi ResetMode = 5 // network settings only
+)
+
+// Reset clears the device as selected by mode. Since this can't be undone, the
+// serial number of the device must be given as confirmation; when it doesn't
+// match, ErrNotConfirmed is returned and nothing is reset.
+func (d *Device) Reset(ctx context.Context, mode ResetMode, serial string) error {
+	info, err := d.FetchDeviceInfo(ctx)
+	if err != nil {
+		return err
+	}
+	if serial == "" || serial != info.SerialNumber {
+		return fmt.Errorf("%s has serial number %s => %w", d.Host, info.SerialNumber, ErrNotConfirmed)
+	}
+
+	response, err := d.action(ctx, "basicevent", "ReSetup", actionArgument{"Reset", strconv.Itoa(int(mode))})
+	if err != nil {
+		return err
+	}
+	if result, err := responseValue(response, "Reset"); err == nil && result != "success" && result != "reset_remote" {
+		return fmt.Errorf("ReSetup failed => %s", result)
+	}
+	return nil
+}
+
+// FactoryReset wipes the device, e.g. before it is decommissioned. serial must
+// be the serial number of the device, see Reset.
+func (d *Device) FactoryReset(ctx context.Context, serial string) error {
+	return d.Reset(ctx, ResetAll, serial)
+}
+
+// Reboot restarts the device, the usual remedy for one that stopped
+// responding properly. It returns once the device stopped answering, so the
+// caller can wait for it to come back, which takes about a minute.
+func (d *Device) Reboot(ctx context.Context) error {
+	_, err := d.action(ctx, "basicevent", "ReBoot")
+	if _, ok := err.(*ActionError); ok {
+		return err
+	}
+	// other errors mean the device dropped the connection before answering,
+	// which is fine
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		probe, cancel := context.WithTimeout(ctx, 2*time.Second)
+		_, err := d.FetchDeviceInfo(probe)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s is still up => %s", d.Host, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package wemo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFactoryReset(t *testing.T) {
+	reset := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/setup.xml":
+			fmt.Fprintf(w, `<root><device><deviceType>%s</deviceType><serialNumber>221248K0102C92</serialNumber></device></root>`, Controllee)
+		case strings.Contains(string(body), "<u:ReSetup "):
+			reset, _ = responseValue(body, "Reset")
+			fmt.Fprint(w, testMessageHeader+`<u:ReSetupResponse xmlns:u="urn:Belkin:service:basicevent:1"><Reset>success</Reset></u:ReSetupResponse>`+testMessageFooter)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	device := &Device{Host: strings.TrimPrefix(server.URL, "http://")}
+
+	ctx := context.Background()
+	for _, serial := range []string{"", "221248K0100001"} {
+		if err := device.FactoryReset(ctx, serial); !errors.Is(err, ErrNotConfirmed) {
+			t.Errorf("Expected: %s for serial %q, got: %v", ErrNotConfirmed, serial, err)
+		}
+	}
+	if reset != "" {
+		t.Fatalf("Expected: no reset, got: %s", reset)
+	}
+
+	if err := device.FactoryReset(ctx, "221248K0102C92"); err != nil {
+		t.Fatal(err)
+	}
+	if reset != "2" {
+		t.Errorf("Expected: reset 2, got: %s", reset)
+	}
+}
+
+func TestReboot(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/setup.xml":
+			fmt.Fprintf(w, `<root><device><deviceType>%s</deviceType></device></root>`, Controllee)
+		case strings.Contains(string(body), "<u:ReBoot "):
+			// drop the connection without answering, then go down
+			hj, _ := w.(http.Hijacker)
+			conn, _, _ := hj.Hijack()
+			conn.Close()
+			go server.Close()
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	device := &Device{Host: strings.TrimPrefix(server.URL, "http://")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := device.Reboot(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
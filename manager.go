@@ -0,0 +1,480 @@
+package wemo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ManagedDevice is a device known to a Manager.
+type ManagedDevice struct {
+	Key        string            `json:"key"` // UDN, or the serial number if the device reports no UDN
+	Name       string            `json:"name"`
+	Host       string            `json:"host"`
+	UDN        string            `json:"udn,omitempty"`
+	Serial     string            `json:"serial,omitempty"`
+	DeviceType string            `json:"device-type,omitempty"`
+	LastSeen   time.Time         `json:"last-seen"`
+	Aliases    []string          `json:"aliases,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+
+	Health HealthStatus `json:"-"` // see Manager.CheckHealth
+
+	Info *DeviceInfo `json:"-"` // as last fetched, nil for devices not yet contacted
+}
+
+// Device returns the device at its current address.
+func (m *ManagedDevice) Device() *Device {
+	return &Device{Host: m.Host}
+}
+
+// Manager keeps the inventory of known devices, keyed by UDN so a device keeps
+// its entry when its address changes. Discovery adds devices to it, and it
+// resolves the targets of commands, e.g. as Scheduler.Lookup. A Manager is
+// safe for concurrent use; the entries it returns are copies. Calls the
+// manager makes to a device are serialized, and redundant state sets waiting
+// for a busy device are coalesced.
+type Manager struct {
+	// Discover finds devices for Scan, defaults to SSDP discovery of all
+	// device types.
+	Discover DiscoverFunc
+
+	// Store, if set, keeps the inventory across restarts, see Save and Load.
+	Store DeviceStore
+
+	// Parallelism is the number of devices Apply commands at once, defaults
+	// to DefaultParallelism.
+	Parallelism int
+
+	// StateTTL is how long states read through the manager are served from
+	// its cache, defaults to DefaultStateTTL.
+	StateTTL time.Duration
+
+	mu      sync.RWMutex
+	devices map[string]*ManagedDevice
+	groups  map[string]Group
+	scenes  map[string]*Snapshot
+	states  map[string]*cachedState
+	queues  map[string]*deviceQueue
+	bus     eventBus
+	health  healthBus
+}
+
+// DeviceStore persists the inventory of a Manager.
+type DeviceStore interface {
+	Load() ([]ManagedDevice, error)
+	Save([]ManagedDevice) error
+}
+
+// FileDeviceStore stores the inventory as JSON in the named file.
+type FileDeviceStore string
+
+// Load reads the inventory, returning none when the file doesn't exist yet.
+func (f FileDeviceStore) Load() ([]ManagedDevice, error) {
+	data, err := ioutil.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []ManagedDevice
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, fmt.Errorf("unable to parse devices in %s => %s", string(f), err)
+	}
+	return devices, nil
+}
+
+// Save replaces the stored inventory.
+func (f FileDeviceStore) Save(devices []ManagedDevice) error {
+	data, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(string(f), data)
+}
+
+// NewManager returns an empty manager.
+func NewManager() *Manager {
+	return &Manager{devices: make(map[string]*ManagedDevice)}
+}
+
+// Add fetches the device info of device and adds or updates its entry.
+func (m *Manager) Add(ctx context.Context, device *Device) (ManagedDevice, error) {
+	info, err := device.FetchDeviceInfo(ctx)
+	if err != nil {
+		return ManagedDevice{}, fmt.Errorf("unable to add device %s => %s", device.Host, err)
+	}
+	return m.Put(ManagedDevice{
+		Name:       info.FriendlyName,
+		Host:       device.Host,
+		UDN:        info.UDN,
+		Serial:     info.SerialNumber,
+		DeviceType: info.DeviceType,
+		LastSeen:   time.Now(),
+		Info:       info,
+	})
+}
+
+// Put adds or replaces an entry without contacting the device. The entry is
+// keyed by its UDN, or by its serial number when it has no UDN. Aliases of
+// the replaced entry are kept when entry has none, and so are its labels and
+// its health.
+func (m *Manager) Put(entry ManagedDevice) (ManagedDevice, error) {
+	entry.Key = entry.UDN
+	if entry.Key == "" {
+		entry.Key = entry.Serial
+	}
+	if entry.Key == "" {
+		return ManagedDevice{}, errors.New("device has neither a UDN nor a serial number")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if old, ok := m.devices[entry.Key]; ok {
+		if entry.Aliases == nil {
+			entry.Aliases = old.Aliases
+		}
+		if entry.Labels == nil {
+			entry.Labels = old.Labels
+		}
+		if entry.Health == HealthUnknown {
+			entry.Health = old.Health
+		}
+	}
+	m.devices[entry.Key] = &entry
+	return entry, nil
+}
+
+// Remove forgets a device, reporting whether it was known.
+func (m *Manager) Remove(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.devices[key]
+	delete(m.devices, key)
+	delete(m.states, key)
+	return ok
+}
+
+// Get returns the entry with the given key.
+func (m *Manager) Get(key string) (ManagedDevice, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entry, ok := m.devices[key]
+	if !ok {
+		return ManagedDevice{}, false
+	}
+	return *entry, true
+}
+
+// List returns all entries ordered by name.
+func (m *Manager) List() []ManagedDevice {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := make([]ManagedDevice, 0, len(m.devices))
+	for _, entry := range m.devices {
+		list = append(list, *entry)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name == list[j].Name {
+			return list[i].Key < list[j].Key
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// SetAlias gives the device with the given key an additional name, such as
+// "porch" or "tv-plug". Aliases are case-insensitive and unique.
+func (m *Manager) SetAlias(key, alias string) error {
+	alias = strings.TrimSpace(alias)
+	if alias == "" {
+		return errors.New("alias must not be empty")
+	}
+	if strings.ContainsAny(alias, "*?[") {
+		return fmt.Errorf("alias %q must not contain glob characters", alias)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.devices[key]
+	if !ok {
+		return fmt.Errorf("unknown device %s", key)
+	}
+	for _, other := range m.devices {
+		for _, a := range other.Aliases {
+			if strings.EqualFold(a, alias) {
+				if other == entry {
+					return nil
+				}
+				return fmt.Errorf("alias %s is already used by %s", alias, other.Name)
+			}
+		}
+	}
+	entry.Aliases = append(entry.Aliases, alias)
+	return nil
+}
+
+// RemoveAlias removes an alias from whichever device has it.
+func (m *Manager) RemoveAlias(alias string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, entry := range m.devices {
+		for i, a := range entry.Aliases {
+			if strings.EqualFold(a, alias) {
+				entry.Aliases = append(entry.Aliases[:i:i], entry.Aliases[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Resolve returns the devices whose key, serial number, host, friendly name or
+// alias matches pattern, ordered by name. Names and aliases are compared
+// case-insensitively, and pattern may use the wildcards of path.Match, e.g.
+// "kitchen*".
+func (m *Manager) Resolve(pattern string) ([]ManagedDevice, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q => %s", pattern, err)
+	}
+
+	var matches []ManagedDevice
+	for _, entry := range m.List() {
+		if entry.matches(pattern) {
+			matches = append(matches, entry)
+		}
+	}
+	return matches, nil
+}
+
+func (m *ManagedDevice) matches(pattern string) bool {
+	if m.Key == pattern || m.Host == pattern || (m.Serial != "" && m.Serial == pattern) {
+		return true
+	}
+	pattern = strings.ToLower(pattern)
+	for _, name := range append([]string{m.Name}, m.Aliases...) {
+		if ok, _ := path.Match(pattern, strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup resolves target to a single device, see Resolve. It fits
+// Scheduler.Lookup.
+func (m *Manager) Lookup(target string) (*Device, error) {
+	matches, err := m.Resolve(target)
+	if err != nil {
+		return nil, err
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("unknown device %s", target)
+	case 1:
+		return matches[0].Device(), nil
+	}
+	names := make([]string, len(matches))
+	for i, match := range matches {
+		names[i] = match.Name
+	}
+	return nil, fmt.Errorf("%s matches more than one device: %s", target, strings.Join(names, ", "))
+}
+
+// ErrUnknownDevice is returned by Find when no single device has the name.
+var ErrUnknownDevice = errors.New("unknown device")
+
+// Find returns the device a request names by its key or, e.g., an alias. Any
+// name Resolve matches is accepted as long as it matches a single device;
+// patterns are rejected, since a request must not switch devices it didn't
+// name. An error wrapping ErrUnknownDevice is returned when no device matches.
+func (m *Manager) Find(name string) (ManagedDevice, error) {
+	if entry, ok := m.Get(name); ok {
+		return entry, nil
+	}
+	if name == "" || strings.ContainsAny(name, "*?[") {
+		return ManagedDevice{}, fmt.Errorf("invalid device %q, patterns are not supported", name)
+	}
+	entries, _ := m.Resolve(name)
+	if len(entries) != 1 {
+		return ManagedDevice{}, fmt.Errorf("%w %s", ErrUnknownDevice, name)
+	}
+	return entries[0], nil
+}
+
+// HostChange is a device that reappeared at a new address.
+type HostChange struct {
+	Device  ManagedDevice
+	OldHost string
+}
+
+// Rediscover scans for devices every interval until ctx is done, so devices
+// that got a new address, e.g. from DHCP, are found again. Their entries are
+// updated in place, and calls the manager retries afterwards use the new
+// address. Moves are reported to onMoved, if set.
+func (m *Manager) Rediscover(ctx context.Context, interval time.Duration, onMoved func(HostChange)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		hosts := make(map[string]string)
+		for _, entry := range m.List() {
+			hosts[entry.Key] = entry.Host
+		}
+		found, _ := m.Scan(ctx)
+		for _, entry := range found {
+			if old, ok := hosts[entry.Key]; ok && old != entry.Host && onMoved != nil && ctx.Err() == nil {
+				onMoved(HostChange{Device: entry, OldHost: old})
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// InfoChange is a change in the device info of a device noticed by Refresh,
+// e.g. after it was renamed in the app or updated its firmware. Old is nil the
+// first time the info is fetched.
+type InfoChange struct {
+	Device ManagedDevice
+	Old    *DeviceInfo
+	New    *DeviceInfo
+}
+
+// Refresh fetches the device info of all devices and updates their entries.
+// It returns the devices whose name, firmware or end devices changed, and the
+// errors of devices that couldn't be reached, keyed by device key.
+func (m *Manager) Refresh(ctx context.Context) ([]InfoChange, map[string]error) {
+	var changes []InfoChange
+	errs := make(map[string]error)
+	for _, entry := range m.List() {
+		info, err := entry.Device().FetchDeviceInfo(ctx)
+		if err != nil {
+			errs[entry.Key] = err
+			continue
+		}
+
+		m.mu.Lock()
+		current, ok := m.devices[entry.Key]
+		if ok {
+			old := current.Info
+			current.Name = info.FriendlyName
+			current.Serial = info.SerialNumber
+			current.DeviceType = info.DeviceType
+			current.Info = info
+			current.LastSeen = time.Now()
+			if infoChanged(old, info) {
+				changes = append(changes, InfoChange{Device: *current, Old: old, New: info})
+			}
+		}
+		m.mu.Unlock()
+	}
+	return changes, errs
+}
+
+// RefreshEvery calls Refresh every interval until ctx is done, reporting the
+// changes to onChange, if set.
+func (m *Manager) RefreshEvery(ctx context.Context, interval time.Duration, onChange func(InfoChange)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		changes, _ := m.Refresh(ctx)
+		for _, change := range changes {
+			if onChange != nil && ctx.Err() == nil {
+				onChange(change)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func infoChanged(old, info *DeviceInfo) bool {
+	if old == nil {
+		return true
+	}
+	if old.FriendlyName != info.FriendlyName || old.FirmwareVersion != info.FirmwareVersion {
+		return true
+	}
+	a, b := old.EndDevices.EndDeviceInfo, info.EndDevices.EndDeviceInfo
+	if len(a) != len(b) {
+		return true
+	}
+	for i := range a {
+		if a[i].DeviceID != b[i].DeviceID || a[i].FriendlyName != b[i].FriendlyName || a[i].FirmwareVersion != b[i].FirmwareVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// Load adds the devices kept in the store, so a restarted service knows its
+// devices without scanning the network. Their info is fetched again on Add.
+func (m *Manager) Load() error {
+	if m.Store == nil {
+		return nil
+	}
+	devices, err := m.Store.Load()
+	if err != nil {
+		return err
+	}
+	for _, entry := range devices {
+		if _, err := m.Put(entry); err != nil {
+			return fmt.Errorf("device %s: %s", entry.Name, err)
+		}
+	}
+	return nil
+}
+
+// Save writes the inventory to the store.
+func (m *Manager) Save() error {
+	if m.Store == nil {
+		return nil
+	}
+	return m.Store.Save(m.List())
+}
+
+// Scan discovers devices with m.Discover and adds them, returning the entries
+// of the devices found. Devices that don't answer are skipped.
+func (m *Manager) Scan(ctx context.Context) (found []ManagedDevice, err error) {
+	ctx, span := startSpan(ctx, "wemo Scan", trace.SpanKindInternal)
+	defer func() {
+		span.SetAttributes(AttrFound.Int(len(found)))
+		endSpan(span, err)
+	}()
+
+	discover := m.Discover
+	if discover == nil {
+		discover = discoverAll
+	}
+	devices, err := discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, device := range devices {
+		if entry, err := m.Add(ctx, device); err == nil {
+			found = append(found, entry)
+		}
+	}
+	return found, nil
+}
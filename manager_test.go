@@ -0,0 +1,302 @@
+package wemo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var bulbIDRE = regexp.MustCompile(`<DeviceID[^>]*>([^<]*)</DeviceID>`)
+
+// fakeDevice is a switch answering setup.xml and the binary state actions.
+// Set deviceType to make it a dimmer or a bridge with bulbs.
+type fakeDevice struct {
+	*httptest.Server
+	udn, name, serial string
+
+	mu         sync.Mutex
+	deviceType string
+	state      string
+	brightness string
+	bulbs      map[string]string // bulb => last capability value
+	bulbLevels map[string]string // bulb => last dim level
+	calls      map[string]int    // by action
+}
+
+func newFakeDevice(t *testing.T, udn, name, serial string) *fakeDevice {
+	f := &fakeDevice{udn: udn, name: name, serial: serial, deviceType: Controllee, state: "0", bulbs: make(map[string]string), bulbLevels: make(map[string]string), calls: make(map[string]int)}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if action := r.Header.Get("SOAPACTION"); action != "" {
+			f.calls[strings.Trim(action[strings.Index(action, "#")+1:], `"`)]++
+		}
+		switch {
+		case r.Method == "SUBSCRIBE":
+			w.Header().Set("SID", "uuid:subscription-"+f.serial)
+		case r.Method == "UNSUBSCRIBE":
+		case r.URL.Path == "/setup.xml":
+			fmt.Fprintf(w, `<root><device><deviceType>%s</deviceType><friendlyName>%s</friendlyName><serialNumber>%s</serialNumber><UDN>%s</UDN></device></root>`, f.deviceType, f.name, f.serial, f.udn)
+		case strings.Contains(string(body), "<u:SetBinaryState "):
+			f.state, _ = responseValue(body, "BinaryState")
+			f.brightness, _ = responseValue(body, "brightness")
+			fmt.Fprint(w, testMessageHeader+`<u:SetBinaryStateResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>`+f.state+`</BinaryState></u:SetBinaryStateResponse>`+testMessageFooter)
+		case strings.Contains(string(body), "<u:GetBinaryState "):
+			fmt.Fprint(w, testMessageHeader+`<u:GetBinaryStateResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>`+f.state+`</BinaryState><brightness>`+f.brightness+`</brightness></u:GetBinaryStateResponse>`+testMessageFooter)
+		case strings.Contains(string(body), "<u:SetDeviceStatus "):
+			status := html.UnescapeString(string(body))
+			value, _ := responseValue([]byte(status), "CapabilityValue")
+			if matches := bulbIDRE.FindStringSubmatch(status); len(matches) == 2 {
+				f.bulbs[matches[1]] = value
+				if strings.Contains(status, "<CapabilityID>10008<") {
+					f.bulbLevels[matches[1]] = value
+				}
+			}
+			fmt.Fprint(w, testMessageHeader+`<u:SetDeviceStatusResponse xmlns:u="urn:Belkin:service:bridge:1"></u:SetDeviceStatusResponse>`+testMessageFooter)
+		case strings.Contains(string(body), "<u:GetDeviceStatus "):
+			ids, _ := responseValue(body, "DeviceIDs")
+			var list strings.Builder
+			for _, id := range strings.Split(ids, ",") {
+				on := "1"
+				if f.bulbs[id] == "0" {
+					on = "0"
+				}
+				fmt.Fprintf(&list, "<DeviceStatus><DeviceID>%s</DeviceID><CapabilityValue>%s,%s:0,,</CapabilityValue></DeviceStatus>", id, on, f.bulbLevels[id])
+			}
+			fmt.Fprint(w, testMessageHeader+`<u:GetDeviceStatusResponse xmlns:u="urn:Belkin:service:bridge:1"><DeviceStatusList>`+html.EscapeString(`<?xml version="1.0" encoding="utf-8"?><DeviceStatusList>`+list.String()+`</DeviceStatusList>`)+`</DeviceStatusList></u:GetDeviceStatusResponse>`+testMessageFooter)
+		default:
+			http.Error(w, "unknown action", http.StatusInternalServerError)
+		}
+	}))
+	return f
+}
+
+func (f *fakeDevice) host() string {
+	return strings.TrimPrefix(f.URL, "http://")
+}
+
+func TestManager(t *testing.T) {
+	porch := newFakeDevice(t, "uuid:Socket-1_0-A", "Porch", "A")
+	defer porch.Close()
+	kitchen := newFakeDevice(t, "uuid:Socket-1_0-B", "Kitchen", "B")
+	defer kitchen.Close()
+
+	m := NewManager()
+	m.Discover = func(context.Context) ([]*Device, error) {
+		return []*Device{{Host: porch.host()}, {Host: kitchen.host()}, {Host: "127.0.0.1:1"}}, nil
+	}
+
+	ctx := context.Background()
+	found, err := m.Scan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Errorf("Expected: 2 devices, got: %v", found)
+	}
+
+	list := m.List()
+	if len(list) != 2 || list[0].Name != "Kitchen" || list[1].Name != "Porch" {
+		t.Fatalf("Expected: Kitchen and Porch, got: %v", list)
+	}
+
+	entry, ok := m.Get("uuid:Socket-1_0-A")
+	if !ok || entry.Host != porch.host() || entry.Serial != "A" {
+		t.Errorf("Expected: Porch at %s, got: %+v", porch.host(), entry)
+	}
+
+	for _, target := range []string{"uuid:Socket-1_0-B", "B", kitchen.host()} {
+		device, err := m.Lookup(target)
+		if err != nil || device.Host != kitchen.host() {
+			t.Errorf("%s: Expected: %s, got: %v, %v", target, kitchen.host(), device, err)
+		}
+	}
+	if _, err := m.Lookup("nowhere"); err == nil {
+		t.Errorf("Expected: an unknown device")
+	}
+
+	if !m.Remove("uuid:Socket-1_0-A") || m.Remove("uuid:Socket-1_0-A") {
+		t.Errorf("Expected: Porch to be removed once")
+	}
+	if len(m.List()) != 1 {
+		t.Errorf("Expected: 1 device, got: %v", m.List())
+	}
+}
+
+func TestManagerStore(t *testing.T) {
+	store := FileDeviceStore(filepath.Join(t.TempDir(), "devices.json"))
+
+	m := NewManager()
+	m.Store = store
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	m.Put(ManagedDevice{Name: "Porch", Host: "10.0.0.5:49153", UDN: "uuid:Socket-1_0-A", Serial: "A"})
+	m.Put(ManagedDevice{Name: "Old", Host: "10.0.0.6:49153", Serial: "C"})
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewManager()
+	restarted.Store = store
+	if err := restarted.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := restarted.Get("uuid:Socket-1_0-A"); !ok || entry.Host != "10.0.0.5:49153" {
+		t.Errorf("Expected: Porch at 10.0.0.5:49153, got: %+v", entry)
+	}
+	if entry, ok := restarted.Get("C"); !ok || entry.Name != "Old" {
+		t.Errorf("Expected: an entry keyed by serial, got: %+v", entry)
+	}
+}
+
+func TestManagerAliases(t *testing.T) {
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Kitchen Counter", Host: "10.0.0.5:49153", UDN: "uuid:Socket-1_0-A"})
+	m.Put(ManagedDevice{Name: "Kitchen Window", Host: "10.0.0.6:49153", UDN: "uuid:Socket-1_0-B"})
+	m.Put(ManagedDevice{Name: "Living Room TV", Host: "10.0.0.7:49153", UDN: "uuid:Socket-1_0-C"})
+
+	if err := m.SetAlias("uuid:Socket-1_0-C", "tv-plug"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetAlias("uuid:Socket-1_0-A", "TV-Plug"); err == nil {
+		t.Errorf("Expected: the alias to be taken")
+	}
+	if err := m.SetAlias("uuid:Socket-1_0-A", "counter*"); err == nil {
+		t.Errorf("Expected: globs to be rejected")
+	}
+
+	// aliases survive the entry being refreshed
+	m.Put(ManagedDevice{Name: "Living Room TV", Host: "10.0.0.8:49153", UDN: "uuid:Socket-1_0-C"})
+
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{"TV-PLUG", "10.0.0.8:49153"},
+		{"kitchen counter", "10.0.0.5:49153"},
+		{"*window", "10.0.0.6:49153"},
+		{"uuid:Socket-1_0-B", "10.0.0.6:49153"},
+		{"10.0.0.5:49153", "10.0.0.5:49153"},
+	}
+	for _, test := range tests {
+		device, err := m.Lookup(test.target)
+		if err != nil || device.Host != test.expected {
+			t.Errorf("%s: Expected: %s, got: %v, %v", test.target, test.expected, device, err)
+		}
+	}
+
+	if _, err := m.Lookup("kitchen*"); err == nil || !strings.Contains(err.Error(), "Kitchen Counter, Kitchen Window") {
+		t.Errorf("Expected: an ambiguous target, got: %v", err)
+	}
+	if matches, _ := m.Resolve("kitchen*"); len(matches) != 2 {
+		t.Errorf("Expected: 2 kitchen devices, got: %v", matches)
+	}
+
+	if entry, err := m.Find("tv-plug"); err != nil || entry.Key != "uuid:Socket-1_0-C" {
+		t.Errorf("Expected: the TV by its alias, got: %v, %v", entry, err)
+	}
+	if _, err := m.Find("*window"); err == nil || errors.Is(err, ErrUnknownDevice) {
+		t.Errorf("Expected: the pattern to be rejected, got: %v", err)
+	}
+	if _, err := m.Find("garage"); !errors.Is(err, ErrUnknownDevice) {
+		t.Errorf("Expected: %s, got: %v", ErrUnknownDevice, err)
+	}
+
+	m.RemoveAlias("tv-plug")
+	if _, err := m.Lookup("tv-plug"); err == nil {
+		t.Errorf("Expected: the alias to be removed")
+	}
+}
+
+func TestManagerRefresh(t *testing.T) {
+	porch := newFakeDevice(t, "uuid:Socket-1_0-A", "Porch", "A")
+	defer porch.Close()
+
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Porch", Host: porch.host(), UDN: porch.udn})
+	m.Put(ManagedDevice{Name: "Gone", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-B"})
+
+	ctx := context.Background()
+	changes, errs := m.Refresh(ctx)
+	if len(changes) != 1 || changes[0].Old != nil || errs["uuid:Socket-1_0-B"] == nil {
+		t.Fatalf("Expected: Porch fetched and Gone failing, got: %v, %v", changes, errs)
+	}
+	if changes, _ := m.Refresh(ctx); len(changes) != 0 {
+		t.Errorf("Expected: no changes, got: %v", changes)
+	}
+
+	// renamed in the app
+	porch.mu.Lock()
+	porch.name = "Front Porch"
+	porch.mu.Unlock()
+	changes, _ = m.Refresh(ctx)
+	if len(changes) != 1 || changes[0].Old.FriendlyName != "Porch" || changes[0].Device.Name != "Front Porch" {
+		t.Errorf("Expected: the rename, got: %v", changes)
+	}
+	if _, err := m.Lookup("front porch"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRediscover(t *testing.T) {
+	old := newFakeDevice(t, "uuid:Socket-1_0-A", "Porch", "A")
+	oldHost := old.host()
+	old.Close()
+	porch := newFakeDevice(t, "uuid:Socket-1_0-A", "Porch", "A")
+	defer porch.Close()
+
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Porch", Host: oldHost, UDN: porch.udn})
+	m.Discover = func(context.Context) ([]*Device, error) {
+		return []*Device{{Host: porch.host()}}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	moved := make(chan HostChange, 1)
+	go m.Rediscover(ctx, time.Hour, func(change HostChange) { moved <- change })
+
+	change := <-moved
+	if change.OldHost != oldHost || change.Device.Host != porch.host() {
+		t.Errorf("Expected: a move from %s to %s, got: %+v", oldHost, porch.host(), change)
+	}
+	if err := m.SetBinaryState(ctx, porch.udn, true); err != nil || porch.state != "1" {
+		t.Errorf("Expected: the device switched at its new address, got: %v", err)
+	}
+}
+
+func TestRetryAtNewHost(t *testing.T) {
+	old := newFakeDevice(t, "uuid:Socket-1_0-A", "Porch", "A")
+	oldHost := old.host()
+	old.Close()
+	porch := newFakeDevice(t, "uuid:Socket-1_0-A", "Porch", "A")
+	defer porch.Close()
+
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Porch", Host: oldHost, UDN: porch.udn})
+
+	var hosts []string
+	err := m.serialize(context.Background(), porch.udn, func(device *Device) error {
+		hosts = append(hosts, device.Host)
+		if len(hosts) == 1 {
+			// rediscovery finds the device elsewhere while the call fails
+			m.Put(ManagedDevice{Name: "Porch", Host: porch.host(), UDN: porch.udn})
+		}
+		return device.SetBinaryState(context.Background(), true)
+	})
+	if err != nil || len(hosts) != 2 || hosts[1] != porch.host() {
+		t.Errorf("Expected: a retry at %s, got: %v, %v", porch.host(), hosts, err)
+	}
+}
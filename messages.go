@@ -17,10 +17,15 @@ package wemo
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
+
+	"golang.org/x/net/context/ctxhttp"
 )
 
 const (
@@ -28,14 +33,25 @@ const (
 	messageFooter = `</s:Body></s:Envelope>`
 )
 
-func post(hostAndPort, service, action, body string) (*http.Response, error) {
+func post(hostAndPort, service, action, body string) (response *http.Response, err error) {
+	start := time.Now()
+	var statusCode int
+	var responseBody []byte
+	hook := actionHook()
+	if hook != nil {
+		defer func() {
+			hook(ActionExchange{Host: hostAndPort, Service: service, Action: action, Request: []byte(body),
+				StatusCode: statusCode, Response: responseBody, Duration: time.Since(start), Err: err})
+		}()
+	}
+
 	tcpConn, err := timeoutDialer(5*time.Second, 5*time.Second)("tcp", hostAndPort)
 	if err != nil {
 		return nil, err
 	}
 	defer tcpConn.Close()
 
-	preamble := fmt.Sprintf("POST /upnp/control/%s1 HTTP/1.1\r\nContent-type: text/xml; charset=\"utf-8\"\r\nSOAPACTION: \"urn:Belkin:service:%s:1#%s\"\r\nContent-Length: %v\r\n\r\n", service, service, action, len(body))
+	preamble := fmt.Sprintf("POST /upnp/control/%s1 HTTP/1.1\r\nHost: %s\r\nConnection: close\r\nContent-type: text/xml; charset=\"utf-8\"\r\nSOAPACTION: \"urn:Belkin:service:%s:1#%s\"\r\nContent-Length: %v\r\n\r\n", service, hostAndPort, service, action, len(body))
 	tcpConn.Write([]byte(preamble + body))
 
 	data, err := ioutil.ReadAll(tcpConn)
@@ -43,7 +59,55 @@ func post(hostAndPort, service, action, body string) (*http.Response, error) {
 		return nil, err
 	}
 
-	return http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	response, err = http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	if err != nil || hook == nil {
+		return response, err
+	}
+
+	// the hook gets a copy of the body, the caller reads it as usual
+	statusCode = response.StatusCode
+	responseBody, err = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+	return response, nil
+}
+
+// postContext is the context aware counterpart of post. It goes through the
+// package http client, so it honours cancellation and deadlines set on ctx.
+func postContext(ctx context.Context, hostAndPort, service, action, body string) (*http.Response, error) {
+	uri := fmt.Sprintf("http://%s/upnp/control/%s1", hostAndPort, service)
+	req, err := http.NewRequest("POST", uri, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPACTION", fmt.Sprintf(`"urn:Belkin:service:%s:1#%s"`, service, action))
+
+	return ctxhttp.Do(ctx, httpClient(client), req)
+}
+
+// actionArgument is a single named argument of a SOAP action.
+type actionArgument struct {
+	Name  string
+	Value string
+}
+
+// newActionMessage builds the envelope for an arbitrary action; argument
+// values are XML escaped.
+func newActionMessage(service, action string, args ...actionArgument) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<u:%s xmlns:u="urn:Belkin:service:%s:1">`, action, service)
+	for _, arg := range args {
+		fmt.Fprintf(&b, "<%s>", arg.Name)
+		xml.EscapeText(&b, []byte(arg.Value))
+		fmt.Fprintf(&b, "</%s>", arg.Name)
+	}
+	fmt.Fprintf(&b, "</u:%s>", action)
+
+	return messageHeader + b.String() + messageFooter
 }
 
 func newGetBinaryStateMessage() string {
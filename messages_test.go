@@ -111,3 +111,13 @@ func TestNewGetBulbStatus(t *testing.T) {
 		t.Errorf("Expected: %s, got: %s", expected, actual)
 	}
 }
+
+func TestNewActionMessage(t *testing.T) {
+	msg := `<u:ChangeFriendlyName xmlns:u="urn:Belkin:service:basicevent:1"><FriendlyName>Tom &amp; Jerry</FriendlyName></u:ChangeFriendlyName>`
+	expected := testMessageHeader + msg + testMessageFooter
+
+	actual := newActionMessage("basicevent", "ChangeFriendlyName", actionArgument{"FriendlyName", "Tom & Jerry"})
+	if actual != expected {
+		t.Errorf("Expected: %s, got: %s", expected, actual)
+	}
+}
@@ -0,0 +1,109 @@
+package wemo
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// Metrics receives counts of what the package does internally, independent of
+// the readings of the devices. Implementations must be safe for concurrent
+// use and should not block. Set one with SetMetrics.
+type Metrics interface {
+	// Request is called after every SOAP action.
+	Request(service, action string, duration time.Duration, err error)
+
+	// Retry is called when a Manager retries a call at the new address of a
+	// device.
+	Retry(key string)
+
+	// SubscriptionRenewed is called after every renewal of an event
+	// subscription.
+	SubscriptionRenewed(host string, err error)
+
+	// DiscoveryScan is called after every SSDP scan for a device type.
+	DiscoveryScan(urn string, found int, duration time.Duration, err error)
+}
+
+// NopMetrics discards all metrics. It is the default.
+type NopMetrics struct{}
+
+func (NopMetrics) Request(string, string, time.Duration, error)    {}
+func (NopMetrics) Retry(string)                                    {}
+func (NopMetrics) SubscriptionRenewed(string, error)               {}
+func (NopMetrics) DiscoveryScan(string, int, time.Duration, error) {}
+
+var (
+	metricsMu     sync.RWMutex
+	activeMetrics Metrics = NopMetrics{}
+)
+
+// SetMetrics installs the Metrics of the package, nil restores NopMetrics.
+func SetMetrics(m Metrics) {
+	if m == nil {
+		m = NopMetrics{}
+	}
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	activeMetrics = m
+}
+
+func metrics() Metrics {
+	metricsMu.RLock()
+	defer metricsMu.RUnlock()
+	return activeMetrics
+}
+
+// ExpvarMetrics publishes the metrics as expvar maps under the given name,
+// served on /debug/vars by expvar's handler: request counts and errors by
+// action, retries by device, subscription renewals and discovery scans.
+type ExpvarMetrics struct {
+	requests, requestErrors, retries, renewals, scans *expvar.Map
+}
+
+// NewExpvarMetrics publishes the maps of the metrics under name. Like
+// expvar.Publish it panics when name is already taken.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	m := &ExpvarMetrics{
+		requests:      new(expvar.Map).Init(),
+		requestErrors: new(expvar.Map).Init(),
+		retries:       new(expvar.Map).Init(),
+		renewals:      new(expvar.Map).Init(),
+		scans:         new(expvar.Map).Init(),
+	}
+	root := new(expvar.Map).Init()
+	root.Set("requests", m.requests)
+	root.Set("request_errors", m.requestErrors)
+	root.Set("retries", m.retries)
+	root.Set("subscription_renewals", m.renewals)
+	root.Set("discovery_scans", m.scans)
+	expvar.Publish(name, root)
+	return m
+}
+
+// Request implements Metrics.
+func (m *ExpvarMetrics) Request(service, action string, duration time.Duration, err error) {
+	m.requests.Add(service+"#"+action, 1)
+	if err != nil {
+		m.requestErrors.Add(service+"#"+action, 1)
+	}
+}
+
+// Retry implements Metrics.
+func (m *ExpvarMetrics) Retry(key string) {
+	m.retries.Add(key, 1)
+}
+
+// SubscriptionRenewed implements Metrics.
+func (m *ExpvarMetrics) SubscriptionRenewed(host string, err error) {
+	if err != nil {
+		m.renewals.Add("failed", 1)
+		return
+	}
+	m.renewals.Add("ok", 1)
+}
+
+// DiscoveryScan implements Metrics.
+func (m *ExpvarMetrics) DiscoveryScan(urn string, found int, duration time.Duration, err error) {
+	m.scans.Add(urn, 1)
+}
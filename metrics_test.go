@@ -0,0 +1,48 @@
+package wemo
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedMetrics struct {
+	NopMetrics
+	mu       sync.Mutex
+	requests []string
+	errors   int
+}
+
+func (m *recordedMetrics) Request(service, action string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, service+"#"+action)
+	if err != nil {
+		m.errors++
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	recorded := &recordedMetrics{}
+	SetMetrics(recorded)
+	defer SetMetrics(nil)
+
+	plug := newFakeDevice(t, "uuid:Socket-1_0-A", "Plug", "A")
+	defer plug.Close()
+
+	ctx := context.Background()
+	(&Device{Host: plug.host()}).FetchBinaryState(ctx)
+	(&Device{Host: "127.0.0.1:1"}).FetchBinaryState(ctx)
+
+	if len(recorded.requests) != 2 || recorded.requests[0] != "basicevent#GetBinaryState" || recorded.errors != 1 {
+		t.Errorf("Unexpected metrics: %v, %d errors", recorded.requests, recorded.errors)
+	}
+	if _, ok := metrics().(NopMetrics); ok {
+		t.Error("Expected: the recorded metrics to be installed")
+	}
+	SetMetrics(nil)
+	if _, ok := metrics().(NopMetrics); !ok {
+		t.Error("Expected: NopMetrics after SetMetrics(nil)")
+	}
+}
@@ -0,0 +1,59 @@
+package wemo
+
+import "context"
+
+// RuleNotification is a push alert the device sends through the Belkin cloud
+// when a rule fires, e.g. for a "Notify Me" rule. Sensor notifications (from
+// motion sensors and Insight rules) are sent once the condition has held for
+// Duration seconds; the others at most every Frequency seconds.
+type RuleNotification struct {
+	RuleID       int    `json:"rule-id"`        // the rule the alert belongs to
+	NotifyRuleID int    `json:"notify-rule-id"` // the alert's id in the cloud
+	Message      string `json:"message"`
+	Frequency    int    `json:"frequency,omitempty"`
+	Duration     int    `json:"duration,omitempty"`
+	Sensor       bool   `json:"sensor,omitempty"`
+}
+
+// NotificationsFor returns the notifications of the rule with the given id.
+func (db *RulesDB) NotificationsFor(ruleID int) []RuleNotification {
+	var result []RuleNotification
+	for _, n := range db.Notifications {
+		if n.RuleID == ruleID {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// SetNotification adds a notification, replacing the one of the same kind the
+// rule already has.
+func (db *RulesDB) SetNotification(n RuleNotification) {
+	for i := range db.Notifications {
+		if db.Notifications[i].RuleID == n.RuleID && db.Notifications[i].Sensor == n.Sensor {
+			db.Notifications[i] = n
+			return
+		}
+	}
+	db.Notifications = append(db.Notifications, n)
+}
+
+// RemoveNotifications drops the notifications of the rule with the given id.
+func (db *RulesDB) RemoveNotifications(ruleID int) {
+	kept := db.Notifications[:0]
+	for _, n := range db.Notifications {
+		if n.RuleID != ruleID {
+			kept = append(kept, n)
+		}
+	}
+	db.Notifications = kept
+}
+
+// Notifications returns the alerts the device is configured to send.
+func (d *Device) Notifications(ctx context.Context) ([]RuleNotification, error) {
+	db, err := d.FetchRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.Notifications, nil
+}
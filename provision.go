@@ -0,0 +1,208 @@
+package wemo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ProvisionStep is a step of onboarding a device with a Provisioner.
+type ProvisionStep string
+
+// Provisioning steps, in the order they run
+const (
+	StepIdentify ProvisionStep = "identify" // read MAC and serial over the setup access point
+	StepTime     ProvisionStep = "time"     // set clock and time zone
+	StepConnect  ProvisionStep = "connect"  // send the home network credentials
+	StepJoin     ProvisionStep = "join"     // wait for the device to join
+	StepClose    ProvisionStep = "close"    // end setup mode
+	StepLocate   ProvisionStep = "locate"   // find the device on the home network
+	StepVerify   ProvisionStep = "verify"   // check the device found is the one set up
+	StepName     ProvisionStep = "name"     // set the friendly name
+	StepRemote   ProvisionStep = "remote"   // opt in or out of remote access
+)
+
+var provisionSteps = []ProvisionStep{StepIdentify, StepTime, StepConnect, StepJoin, StepClose, StepLocate, StepVerify, StepName, StepRemote}
+
+// ProvisionError reports the step provisioning failed at.
+type ProvisionError struct {
+	Step ProvisionStep
+	Err  error
+}
+
+func (e *ProvisionError) Error() string {
+	return fmt.Sprintf("provisioning failed at step %s => %s", e.Step, e.Err)
+}
+
+func (e *ProvisionError) Unwrap() error {
+	return e.Err
+}
+
+// ProvisionState is the progress of a Provisioner. It can be saved as JSON and
+// restored to resume provisioning in another run.
+type ProvisionState struct {
+	Done   []ProvisionStep `json:"done"`
+	MAC    string          `json:"mac,omitempty"`
+	Serial string          `json:"serial,omitempty"`
+	Host   string          `json:"host,omitempty"` // address on the home network
+
+	RemoteAccess *RemoteAccessState `json:"remote-access,omitempty"`
+}
+
+func (s *ProvisionState) done(step ProvisionStep) bool {
+	for _, d := range s.Done {
+		if d == step {
+			return true
+		}
+	}
+	return false
+}
+
+// Provisioner onboards a new device: it talks to the device over its setup
+// access point at SetupHost, sets its clock, hands it the home network
+// credentials, waits for it to join, and then finds and names it on the home
+// network. The machine running it has to switch from the device's access point
+// to the home network once the device joined; on a machine with a single WiFi
+// interface that happens by itself when the access point goes away.
+//
+// Run can be called again after a failure and continues with the failed step,
+// also in another process when State is carried over.
+type Provisioner struct {
+	Network  HomeNetwork
+	Name     string         // friendly name, optional
+	Location *time.Location // time zone, defaults to local time
+
+	// RemoteAccess, if set, enables or disables remote access through the
+	// Belkin cloud once the device is on the home network. The result is
+	// recorded in State.
+	RemoteAccess *bool
+
+	SetupHost     string        // defaults to SetupHost
+	Discover      DiscoverFunc  // finds devices on the home network
+	JoinTimeout   time.Duration // defaults to 2 minutes
+	LocateTimeout time.Duration // defaults to 2 minutes
+	PollInterval  time.Duration // defaults to 2 seconds
+
+	// OnStep, if set, is called before each step runs.
+	OnStep func(ProvisionStep)
+
+	State ProvisionState
+}
+
+// Run performs the remaining steps and returns the device at its address on
+// the home network, once it was verified to have the serial and MAC address
+// read over the setup access point. Errors are *ProvisionError.
+func (p *Provisioner) Run(ctx context.Context) (*Device, error) {
+	if p.Network.SSID == "" {
+		return nil, errors.New("no network to provision the device for")
+	}
+
+	for _, step := range provisionSteps {
+		if p.State.done(step) {
+			continue
+		}
+		if p.OnStep != nil {
+			p.OnStep(step)
+		}
+		if err := p.run(ctx, step); err != nil {
+			return nil, &ProvisionError{Step: step, Err: err}
+		}
+		p.State.Done = append(p.State.Done, step)
+	}
+
+	return &Device{Host: p.State.Host}, nil
+}
+
+func (p *Provisioner) run(ctx context.Context, step ProvisionStep) error {
+	setupHost := p.SetupHost
+	if setupHost == "" {
+		setupHost = SetupHost
+	}
+	setup := NewWiFiSetup(setupHost)
+
+	switch step {
+	case StepIdentify:
+		info, err := setup.MetaInfo(ctx)
+		if err != nil {
+			return err
+		}
+		p.State.MAC, p.State.Serial = info.MAC, info.Serial
+		return nil
+
+	case StepTime:
+		return setup.Device.SyncTime(ctx, time.Now(), p.Location)
+
+	case StepConnect:
+		return setup.ConnectHomeNetwork(ctx, p.Network)
+
+	case StepJoin:
+		ctx, cancel := context.WithTimeout(ctx, durationOr(p.JoinTimeout, 2*time.Minute))
+		defer cancel()
+		_, err := setup.WaitForNetwork(ctx, p.pollInterval(), nil)
+		return err
+
+	case StepClose:
+		return setup.CloseSetup(ctx)
+
+	case StepLocate:
+		ctx, cancel := context.WithTimeout(ctx, durationOr(p.LocateTimeout, 2*time.Minute))
+		defer cancel()
+		device, err := WaitForDevice(ctx, p.State.Serial, p.pollInterval(), p.Discover)
+		if err != nil {
+			return err
+		}
+		p.State.Host = device.Host
+		return nil
+
+	case StepVerify:
+		err := (&Device{Host: p.State.Host}).VerifyIdentity(ctx, p.State.Serial, p.State.MAC)
+		var ierr *IdentityError
+		if errors.As(err, &ierr) {
+			// look for the device again on the next run
+			p.State.Host = ""
+			p.State.Done = removeStep(p.State.Done, StepLocate)
+		}
+		return err
+
+	case StepName:
+		if p.Name == "" {
+			return nil
+		}
+		return (&Device{Host: p.State.Host}).ChangeFriendlyName(ctx, p.Name)
+
+	case StepRemote:
+		if p.RemoteAccess == nil {
+			return nil
+		}
+		state, err := (&Device{Host: p.State.Host}).SetRemoteAccess(ctx, *p.RemoteAccess)
+		if err != nil {
+			return err
+		}
+		p.State.RemoteAccess = state
+		return nil
+	}
+
+	return fmt.Errorf("unknown step %s", step)
+}
+
+func removeStep(steps []ProvisionStep, step ProvisionStep) []ProvisionStep {
+	var kept []ProvisionStep
+	for _, s := range steps {
+		if s != step {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+func (p *Provisioner) pollInterval() time.Duration {
+	return durationOr(p.PollInterval, 2*time.Second)
+}
+
+func durationOr(d, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return fallback
+}
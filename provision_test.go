@@ -0,0 +1,117 @@
+package wemo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProvisioner(t *testing.T) {
+	setup := newSetupServer(t)
+	defer setup.Close()
+	setup.statuses = []string{"0", "1"}
+
+	name := ""
+	lan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(body), "<u:ChangeFriendlyName ") {
+			name, _ = responseValue(body, "FriendlyName")
+			fmt.Fprint(w, testMessageHeader+`<u:ChangeFriendlyNameResponse xmlns:u="urn:Belkin:service:basicevent:1"></u:ChangeFriendlyNameResponse>`+testMessageFooter)
+			return
+		}
+		if strings.Contains(string(body), "<u:SetHomeId ") {
+			fmt.Fprint(w, testMessageHeader+`<u:SetHomeIdResponse xmlns:u="urn:Belkin:service:basicevent:1"></u:SetHomeIdResponse>`+testMessageFooter)
+			return
+		}
+		if strings.Contains(string(body), "<u:GetHomeId ") {
+			fmt.Fprint(w, testMessageHeader+`<u:GetHomeIdResponse xmlns:u="urn:Belkin:service:basicevent:1"><HomeId></HomeId></u:GetHomeIdResponse>`+testMessageFooter)
+			return
+		}
+		fmt.Fprintf(w, `<root><device><deviceType>%s</deviceType><serialNumber>221248K0102C92</serialNumber><macAddress>ec:1a:59:74:b1:ec</macAddress></device></root>`, Controllee)
+	}))
+	defer lan.Close()
+
+	local := false
+
+	online := false
+	var steps []string
+	p := &Provisioner{
+		Network:       HomeNetwork{SSID: "Home", Password: "secret12", Auth: AuthWPA2PSK, Encrypt: EncryptAES, Channel: 6},
+		Name:          "Porch",
+		RemoteAccess:  &local,
+		SetupHost:     strings.TrimPrefix(setup.URL, "http://"),
+		LocateTimeout: 50 * time.Millisecond,
+		PollInterval:  time.Millisecond,
+		Discover: func(context.Context) ([]*Device, error) {
+			if !online {
+				return nil, nil
+			}
+			return []*Device{{Host: strings.TrimPrefix(lan.URL, "http://")}}, nil
+		},
+		OnStep: func(step ProvisionStep) { steps = append(steps, string(step)) },
+	}
+
+	ctx := context.Background()
+	_, err := p.Run(ctx)
+	var perr *ProvisionError
+	if !errors.As(err, &perr) || perr.Step != StepLocate {
+		t.Fatalf("Expected: to fail locating the device, got: %v", err)
+	}
+	if p.State.Serial != "221248K0102C92" || setup.connected["password"] != "/rZyLPqtD5Fre6TNyThIJA==1808" {
+		t.Errorf("Expected: the device identified and connected, got: %+v, %v", p.State, setup.connected)
+	}
+
+	// the device shows up later; resuming doesn't repeat the setup steps
+	online = true
+	device, err := p.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.Host != strings.TrimPrefix(lan.URL, "http://") || name != "Porch" {
+		t.Errorf("Expected: the named device at %s, got: %s named %q", lan.URL, device.Host, name)
+	}
+	if setup.calls["GetMetaInfo"] != 2 || setup.calls["TimeSync"] != 1 || setup.calls["CloseSetup"] != 1 {
+		t.Errorf("Expected: each setup step once, got: %v", setup.calls)
+	}
+	if strings.Join(steps, ",") != "identify,time,connect,join,close,locate,locate,verify,name,remote" {
+		t.Errorf("Expected: locate to be retried, got: %v", steps)
+	}
+	if p.State.RemoteAccess == nil || p.State.RemoteAccess.Enabled {
+		t.Errorf("Expected: remote access disabled, got: %+v", p.State.RemoteAccess)
+	}
+}
+
+func TestProvisionerVerify(t *testing.T) {
+	// another new device with the same serial, e.g. a cloned setup
+	impostor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<root><device><deviceType>%s</deviceType><serialNumber>221248K0102C92</serialNumber><macAddress>EC1A5974B1ED</macAddress></device></root>`, Controllee)
+	}))
+	defer impostor.Close()
+
+	p := &Provisioner{
+		Network: HomeNetwork{SSID: "Home"},
+		Discover: func(context.Context) ([]*Device, error) {
+			return []*Device{{Host: strings.TrimPrefix(impostor.URL, "http://")}}, nil
+		},
+		State: ProvisionState{
+			Done:   []ProvisionStep{StepIdentify, StepTime, StepConnect, StepJoin, StepClose},
+			MAC:    "EC1A5974B1EC",
+			Serial: "221248K0102C92",
+		},
+	}
+
+	_, err := p.Run(context.Background())
+	var ierr *IdentityError
+	if !errors.As(err, &ierr) || ierr.Field != "MAC" {
+		t.Fatalf("Expected: a MAC mismatch, got: %v", err)
+	}
+	if p.State.Host != "" || p.State.done(StepLocate) {
+		t.Errorf("Expected: the device to be located again, got: %+v", p.State)
+	}
+}
@@ -0,0 +1,121 @@
+package wemo
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// deviceQueue serializes the SOAP calls the Manager makes to a device, since
+// the firmware misbehaves when it gets several at once. Calls to different
+// devices still run in parallel.
+type deviceQueue struct {
+	slot chan struct{}
+
+	mu      sync.Mutex
+	waiting *queuedState // state set waiting for the slot, if any
+}
+
+// queuedState is a binary state set shared by all callers that asked for one
+// while it was waiting; only the last value asked for is sent.
+type queuedState struct {
+	on   bool
+	done chan struct{}
+	err  error
+}
+
+func (m *Manager) queue(key string) *deviceQueue {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.queues == nil {
+		m.queues = make(map[string]*deviceQueue)
+	}
+	q, ok := m.queues[key]
+	if !ok {
+		q = &deviceQueue{slot: make(chan struct{}, 1)}
+		m.queues[key] = q
+	}
+	return q
+}
+
+// serialize calls fn with the device once no other call to it is in flight,
+// see also withDevice.
+func (m *Manager) serialize(ctx context.Context, key string, fn func(*Device) error) error {
+	q := m.queue(key)
+	select {
+	case q.slot <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-q.slot }()
+	return m.withDevice(ctx, key, fn)
+}
+
+// withDevice calls fn with the device at its current address. When the device
+// can't be reached and has moved in the meantime, fn is retried once at the
+// new address.
+func (m *Manager) withDevice(ctx context.Context, key string, fn func(*Device) error) error {
+	device, err := m.device(key)
+	if err != nil {
+		return err
+	}
+	err = fn(device)
+	var aerr *ActionError
+	if err == nil || errors.As(err, &aerr) || ctx.Err() != nil {
+		return err
+	}
+
+	moved, lookupErr := m.device(key)
+	if lookupErr != nil || moved.Host == device.Host {
+		return err
+	}
+	metrics().Retry(key)
+	return fn(moved)
+}
+
+// setBinaryState queues a state set for the device. When another state set is
+// already waiting, the two are coalesced: the waiting one sends this value and
+// both callers get its result. The wait is bound to the context of the caller
+// that queued the set first. The state sent is recorded.
+func (m *Manager) setBinaryState(ctx context.Context, key string, on bool) error {
+	q := m.queue(key)
+	q.mu.Lock()
+	if s := q.waiting; s != nil {
+		s.on = on
+		q.mu.Unlock()
+		select {
+		case <-s.done:
+			return s.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s := &queuedState{on: on, done: make(chan struct{})}
+	q.waiting = s
+	q.mu.Unlock()
+
+	s.err = m.serialize(ctx, key, func(device *Device) error {
+		q.mu.Lock()
+		q.waiting = nil
+		on := s.on
+		q.mu.Unlock()
+		if err := device.SetBinaryState(ctx, on); err != nil {
+			return err
+		}
+		state := 0
+		if on {
+			state = 1
+		}
+		m.recordBinaryState(key, state, SourceCommand)
+		return nil
+	})
+	if s.err != nil {
+		q.mu.Lock()
+		if q.waiting == s {
+			q.waiting = nil
+		}
+		q.mu.Unlock()
+	}
+	close(s.done)
+	return s.err
+}
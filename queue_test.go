@@ -0,0 +1,85 @@
+package wemo
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCommandQueue(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var sets []string
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		value, _ := responseValue(body, "BinaryState")
+		mu.Lock()
+		sets = append(sets, value)
+		first := len(sets) == 1
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		if first {
+			<-release
+		}
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		fmt.Fprint(w, testMessageHeader+`<u:SetBinaryStateResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>`+value+`</BinaryState></u:SetBinaryStateResponse>`+testMessageFooter)
+	}))
+	defer server.Close()
+
+	m := NewManager()
+	key := "uuid:Socket-1_0-A"
+	m.Put(ManagedDevice{Name: "Porch", Host: strings.TrimPrefix(server.URL, "http://"), UDN: key})
+
+	ctx := context.Background()
+	errs := make(chan error, 3)
+	go func() { errs <- m.SetBinaryState(ctx, key, true) }()
+	waitFor(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(sets) == 1 })
+
+	// the device is busy: these two wait and are coalesced into one set
+	go func() { errs <- m.SetBinaryState(ctx, key, false) }()
+	waitFor(t, func() bool { q := m.queue(key); q.mu.Lock(); defer q.mu.Unlock(); return q.waiting != nil })
+	go func() { errs <- m.SetBinaryState(ctx, key, true) }()
+	waitFor(t, func() bool {
+		q := m.queue(key)
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.waiting != nil && q.waiting.on
+	})
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(sets, ",") != "1,1" || maxInFlight != 1 {
+		t.Errorf("Expected: two serialized sets, got: %v with %d at once", sets, maxInFlight)
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
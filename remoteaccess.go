@@ -0,0 +1,58 @@
+package wemo
+
+import (
+	"context"
+	"strings"
+)
+
+// RemoteAccessState tells whether a device is registered with the Belkin cloud
+// for remote access.
+type RemoteAccessState struct {
+	Enabled bool   `json:"enabled"`
+	HomeID  string `json:"home-id,omitempty"` // cloud home the device belongs to
+}
+
+// RemoteAccess returns whether remote access is enabled.
+func (d *Device) RemoteAccess(ctx context.Context) (*RemoteAccessState, error) {
+	response, err := d.action(ctx, "basicevent", "GetHomeId")
+	if err != nil {
+		return nil, err
+	}
+
+	homeID, err := responseValue(response, "HomeId")
+	if err != nil {
+		return nil, err
+	}
+	homeID = strings.TrimSpace(homeID)
+	return &RemoteAccessState{Enabled: homeID != "", HomeID: homeID}, nil
+}
+
+// SetRemoteAccess registers the device for remote access or removes its
+// registration, so it is only controlled on the local network, and returns the
+// resulting state. Local control works either way.
+func (d *Device) SetRemoteAccess(ctx context.Context, enable bool) (*RemoteAccessState, error) {
+	var err error
+	if enable {
+		var info *DeviceInfo
+		if info, err = d.FetchDeviceInfo(ctx); err != nil {
+			return nil, err
+		}
+		_, err = d.action(ctx, "remoteaccess", "RemoteAccess",
+			actionArgument{"DeviceId", info.MacAddress},
+			actionArgument{"dst", "0"},
+			actionArgument{"HomeId", ""},
+			actionArgument{"DeviceName", info.FriendlyName},
+			actionArgument{"MacAddr", info.MacAddress},
+			actionArgument{"pluginprivateKey", ""},
+			actionArgument{"smartprivateKey", ""},
+			actionArgument{"smartUniqueId", ""},
+			actionArgument{"numSmartDev", ""},
+		)
+	} else {
+		_, err = d.action(ctx, "basicevent", "SetHomeId", actionArgument{"HomeId", ""})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.RemoteAccess(ctx)
+}
@@ -0,0 +1,377 @@
+package wemo
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Rule types as stored by the Belkin app
+const (
+	RuleTimeInterval = "Time Interval"
+	RuleSimpleSwitch = "Simple Switch"
+	RuleCountdown    = "Countdown Rule"
+	RuleLongPress    = "Long Press"
+	RuleAwayMode     = "Away Mode"
+	RuleMotion       = "Motion Controlled"
+	RuleInsight      = "Insight Rule"
+	RuleNotify       = "Notify Me"
+)
+
+// The app stores these placeholder dates for rules that don't expire.
+const (
+	ruleDefaultStartDate = "12201982"
+	ruleDefaultEndDate   = "07301982"
+)
+
+// RuleDay is the DayID of a rule device entry.
+type RuleDay int
+
+// Rule days
+const (
+	DayAll       RuleDay = -1
+	DayDaily     RuleDay = 0
+	DayMonday    RuleDay = 1
+	DayTuesday   RuleDay = 2
+	DayWednesday RuleDay = 3
+	DayThursday  RuleDay = 4
+	DayFriday    RuleDay = 5
+	DaySaturday  RuleDay = 6
+	DaySunday    RuleDay = 7
+	DayWeekdays  RuleDay = 8
+	DayWeekends  RuleDay = 9
+)
+
+var ruleDayNames = map[RuleDay]string{
+	DayAll:       "every day",
+	DayDaily:     "daily",
+	DayMonday:    "monday",
+	DayTuesday:   "tuesday",
+	DayWednesday: "wednesday",
+	DayThursday:  "thursday",
+	DayFriday:    "friday",
+	DaySaturday:  "saturday",
+	DaySunday:    "sunday",
+	DayWeekdays:  "weekdays",
+	DayWeekends:  "weekends",
+}
+
+func (d RuleDay) String() string {
+	if name, ok := ruleDayNames[d]; ok {
+		return name
+	}
+	return "day(" + strconv.Itoa(int(d)) + ")"
+}
+
+// RuleAction is the StartAction/EndAction of a rule device entry.
+type RuleAction float64
+
+// Rule actions
+const (
+	RuleActionNone   RuleAction = -1
+	RuleActionOff    RuleAction = 0
+	RuleActionOn     RuleAction = 1
+	RuleActionToggle RuleAction = 2
+)
+
+func (a RuleAction) String() string {
+	switch a {
+	case RuleActionNone:
+		return "none"
+	case RuleActionOff:
+		return "off"
+	case RuleActionOn:
+		return "on"
+	case RuleActionToggle:
+		return "toggle"
+	}
+	return strconv.FormatFloat(float64(a), 'f', -1, 64)
+}
+
+// RuleDevice is a RULEDEVICES entry: when and how a rule acts on a device.
+type RuleDevice struct {
+	DeviceID       string
+	GroupID        int
+	Day            RuleDay
+	Start          time.Duration // since midnight
+	Duration       time.Duration
+	StartAction    RuleAction
+	EndAction      RuleAction
+	SensorDuration int
+	Type           int
+	Value          int
+	Level          int
+	OnModeOffset   int
+	OffModeOffset  int
+	CountdownTime  int
+	End            time.Duration // since midnight
+}
+
+// Rule is an entry of the RULES table together with the devices it acts on.
+type Rule struct {
+	ID        int          `json:"id,omitempty"`
+	Name      string       `json:"name"`
+	Type      string       `json:"type"`
+	Order     int          `json:"order,omitempty"`
+	StartDate string       `json:"start-date,omitempty"`
+	EndDate   string       `json:"end-date,omitempty"`
+	Enabled   bool         `json:"enabled"`
+	Sync      int          `json:"sync,omitempty"`
+	Devices   []RuleDevice `json:"devices"`
+	Targets   []string     `json:"targets,omitempty"` // UDNs of other devices the rule controls
+}
+
+// RuleLocation is the place a device uses to compute sunrise and sunset.
+type RuleLocation struct {
+	City        string  `json:"city,omitempty"`
+	Country     string  `json:"country,omitempty"`
+	CountryCode string  `json:"country-code,omitempty"`
+	Region      string  `json:"region,omitempty"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+}
+
+// RulesDB is the rules database of a device.
+type RulesDB struct {
+	Version       int                `json:"version"`
+	Rules         []Rule             `json:"rules"`
+	Notifications []RuleNotification `json:"notifications,omitempty"`
+	Location      *RuleLocation      `json:"location,omitempty"`
+
+	// raw is the SQLite file the rules were read from
+	raw []byte
+}
+
+// Rule returns the rule with the given id.
+func (db *RulesDB) Rule(id int) (*Rule, bool) {
+	for i := range db.Rules {
+		if db.Rules[i].ID == id {
+			return &db.Rules[i], true
+		}
+	}
+	return nil, false
+}
+
+// FetchRules downloads the rules database of the device and parses it.
+func (d *Device) FetchRules(ctx context.Context) (*RulesDB, error) {
+	version, data, err := d.fetchRulesArchive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if data == nil {
+		return &RulesDB{Version: version}, nil
+	}
+
+	db, err := parseRulesArchive(data)
+	if err != nil {
+		return nil, err
+	}
+	db.Version = version
+
+	return db, nil
+}
+
+// fetchRulesArchive returns the version and the zipped rules database. A device
+// without rules reports no database path, in which case data is nil.
+func (d *Device) fetchRulesArchive(ctx context.Context) (int, []byte, error) {
+	response, err := d.action(ctx, "rules", "FetchRules")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	value, err := responseValue(response, "ruleDbVersion")
+	if err != nil {
+		return 0, nil, err
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, nil, fmt.Errorf("Failed to parse ruleDbVersion in FetchRules response:\n\t%s", err)
+	}
+
+	path, err := responseValue(response, "ruleDbPath")
+	if err != nil || path == "" {
+		return version, nil, nil
+	}
+
+	resp, err := ctxhttp.Get(ctx, httpClient(client), path)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to download rules from %s => %s", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil, fmt.Errorf("rules download returned status code => %d", resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to read rules => %s", err)
+	}
+
+	return version, data, nil
+}
+
+// AddRule appends a rule, assigning it the next free ID and order when they
+// are unset, and returns the stored copy.
+func (db *RulesDB) AddRule(rule Rule) *Rule {
+	maxID, maxOrder := 0, -1
+	for _, r := range db.Rules {
+		if r.ID > maxID {
+			maxID = r.ID
+		}
+		if r.Order > maxOrder {
+			maxOrder = r.Order
+		}
+	}
+	if rule.ID == 0 {
+		rule.ID = maxID + 1
+	}
+	if rule.Order == 0 {
+		rule.Order = maxOrder + 1
+	}
+	if rule.StartDate == "" {
+		rule.StartDate = ruleDefaultStartDate
+	}
+	if rule.EndDate == "" {
+		rule.EndDate = ruleDefaultEndDate
+	}
+
+	db.Rules = append(db.Rules, rule)
+	return &db.Rules[len(db.Rules)-1]
+}
+
+// RulesConflictError is returned by StoreRules when the rules on the device
+// changed since they were fetched, e.g. because they were edited in the
+// Belkin app. Storing anyway would discard those changes.
+type RulesConflictError struct {
+	Host     string
+	Expected int
+	Actual   int
+}
+
+func (e *RulesConflictError) Error() string {
+	return fmt.Sprintf("rules on %s changed since they were fetched (version %d, now %d)", e.Host, e.Expected, e.Actual)
+}
+
+// RulesDBVersion returns the version of the rules database on the device. The
+// version is increased every time the rules are stored, by this package or by
+// the Belkin app.
+func (d *Device) RulesDBVersion(ctx context.Context) (int, error) {
+	response, err := d.action(ctx, "rules", "GetRulesDBVersion")
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := responseValue(response, "RulesDBVersion")
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse RulesDBVersion in GetRulesDBVersion response:\n\t%s", err)
+	}
+	return version, nil
+}
+
+// StoreRules uploads the rules database to the device under the next version
+// number, replacing the rules stored on it. A database the device cannot read
+// is rejected with a *RulesValidationError; use Validate and Warnings for the
+// stricter checks. The rules must be based on the version currently on the
+// device: when db.Version is out of date a *RulesConflictError is returned and
+// nothing is stored. UpdateRules handles conflicts by refetching.
+func (d *Device) StoreRules(ctx context.Context, db *RulesDB) error {
+	if err := db.checkStructure(); err != nil {
+		return err
+	}
+
+	current, err := d.RulesDBVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if current != db.Version {
+		return &RulesConflictError{Host: d.Host, Expected: db.Version, Actual: current}
+	}
+
+	data, err := db.archive()
+	if err != nil {
+		return err
+	}
+
+	version := db.Version + 1
+	if err := d.storeRulesArchive(ctx, version, data); err != nil {
+		return err
+	}
+
+	db.Version = version
+	return nil
+}
+
+// storeRulesArchive uploads a zipped rules database under the given version.
+func (d *Device) storeRulesArchive(ctx context.Context, version int, data []byte) error {
+	_, err := d.action(ctx, "rules", "StoreRules",
+		actionArgument{"ruleDbVersion", strconv.Itoa(version)},
+		actionArgument{"processDb", "1"},
+		actionArgument{"ruleDbBody", "<![CDATA[" + base64.StdEncoding.EncodeToString(data) + "]]>"},
+	)
+	return err
+}
+
+// rulesUpdateAttempts bounds how often UpdateRules retries after a conflict.
+const rulesUpdateAttempts = 3
+
+// UpdateRules fetches the rules of the device, applies edit and stores the
+// result. When the rules change on the device in the meantime, the edit is
+// reapplied to the new rules, so concurrent changes made in the Belkin app are
+// kept. edit may be called more than once and must not have other effects.
+func (d *Device) UpdateRules(ctx context.Context, edit func(*RulesDB) error) error {
+	var err error
+	for attempt := 0; attempt < rulesUpdateAttempts; attempt++ {
+		var db *RulesDB
+		if db, err = d.FetchRules(ctx); err != nil {
+			return err
+		}
+		if err = edit(db); err != nil {
+			return err
+		}
+
+		err = d.StoreRules(ctx, db)
+		if _, conflict := err.(*RulesConflictError); !conflict {
+			return err
+		}
+	}
+	return err
+}
+
+// RemoveRule deletes the rule with the given id from the device.
+func (d *Device) RemoveRule(ctx context.Context, id int) error {
+	return d.editRule(ctx, id, func(db *RulesDB, _ *Rule) {
+		db.RemoveRules(func(r *Rule) bool { return r.ID == id })
+	})
+}
+
+// EnableRule enables or disables the rule with the given id on the device,
+// leaving the other rules untouched.
+func (d *Device) EnableRule(ctx context.Context, id int, enabled bool) error {
+	return d.editRule(ctx, id, func(_ *RulesDB, rule *Rule) {
+		rule.Enabled = enabled
+	})
+}
+
+// editRule applies edit to the rule with the given id and uploads the result.
+func (d *Device) editRule(ctx context.Context, id int, edit func(*RulesDB, *Rule)) error {
+	return d.UpdateRules(ctx, func(db *RulesDB) error {
+		rule, ok := db.Rule(id)
+		if !ok {
+			return fmt.Errorf("no rule with id %d on %s", id, d.Host)
+		}
+		edit(db, rule)
+		return nil
+	})
+}
@@ -0,0 +1,620 @@
+package wemo
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestRulesArchive builds a zipped rules database the way the Belkin app
+// stores it.
+func newTestRulesArchive(t *testing.T) []byte {
+	raw, err := editSQLite(nil, func(conn *sql.DB) error {
+		statements := []string{
+			rulesSchema,
+			`INSERT INTO RULES VALUES(2, 'Porch', 'Time Interval', 0, '12201982', '07301982', '1', 0)`,
+			`INSERT INTO RULEDEVICES(RuleID, DeviceID, GroupID, DayID, StartTime, RuleDuration, StartAction, EndAction) VALUES(2, 'uuid:Lightswitch-1_0-221450K1200F2F', -1, 8, 68400, 14400, 1.0, 0.0)`,
+			`INSERT INTO RULES VALUES(5, 'Hall', 'Long Press', 1, '12201982', '07301982', '0', 0)`,
+			`INSERT INTO TARGETDEVICES(RuleID, DeviceID, DeviceIndex) VALUES(5, 'uuid:Socket-1_0-221248K0102C92', 0)`,
+			`INSERT INTO RULESNOTIFYMESSAGE(RuleID, NotifyRuleID, Message, Frequency) VALUES(2, 7431, 'Porch light is on', 3600)`,
+		}
+		for _, statement := range statements {
+			if _, err := conn.Exec(statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, _ := w.Create("temppluginRules.db")
+	f.Write(raw)
+	w.Close()
+
+	return buf.Bytes()
+}
+
+func TestParseRulesArchive(t *testing.T) {
+	db, err := parseRulesArchive(newTestRulesArchive(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(db.Rules) != 2 {
+		t.Fatalf("Expected: 2 rules, got: %d", len(db.Rules))
+	}
+
+	porch, ok := db.Rule(2)
+	if !ok {
+		t.Fatal("Expected: rule 2 to exist")
+	}
+	if porch.Name != "Porch" || porch.Type != RuleTimeInterval || !porch.Enabled {
+		t.Errorf("Expected: enabled Time Interval rule Porch, got: %+v", porch)
+	}
+	if len(porch.Devices) != 1 {
+		t.Fatalf("Expected: 1 rule device, got: %d", len(porch.Devices))
+	}
+	rd := porch.Devices[0]
+	if rd.Day != DayWeekdays || rd.Start != 19*time.Hour || rd.Duration != 4*time.Hour {
+		t.Errorf("Expected: weekdays 19:00 for 4h, got: %s %v for %v", rd.Day, rd.Start, rd.Duration)
+	}
+	if rd.StartAction != RuleActionOn || rd.EndAction != RuleActionOff {
+		t.Errorf("Expected: on/off, got: %s/%s", rd.StartAction, rd.EndAction)
+	}
+
+	hall, _ := db.Rule(5)
+	if hall.Enabled || len(hall.Targets) != 1 || hall.Targets[0] != "uuid:Socket-1_0-221248K0102C92" {
+		t.Errorf("Expected: disabled rule targeting the socket, got: %+v", hall)
+	}
+}
+
+func TestRulesArchiveRoundTrip(t *testing.T) {
+	db := &RulesDB{}
+	db.AddRule(Rule{
+		Name:    "Evening",
+		Type:    RuleTimeInterval,
+		Enabled: true,
+		Devices: []RuleDevice{{
+			DeviceID:    "uuid:Socket-1_0-221248K0102C92",
+			Day:         DayDaily,
+			Start:       18 * time.Hour,
+			Duration:    5 * time.Hour,
+			StartAction: RuleActionOn,
+			EndAction:   RuleActionOff,
+			End:         23 * time.Hour,
+		}},
+	})
+
+	data, err := db.archive()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := parseRulesArchive(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Rules) != 1 {
+		t.Fatalf("Expected: 1 rule, got: %d", len(parsed.Rules))
+	}
+	rule := parsed.Rules[0]
+	if rule.ID != 1 || rule.Name != "Evening" || !rule.Enabled || rule.StartDate != ruleDefaultStartDate {
+		t.Errorf("Expected: rule 1 Evening, got: %+v", rule)
+	}
+	if len(rule.Devices) != 1 || rule.Devices[0] != db.Rules[0].Devices[0] {
+		t.Errorf("Expected: %+v, got: %+v", db.Rules[0].Devices, rule.Devices)
+	}
+}
+
+func TestRulesJSON(t *testing.T) {
+	db, err := parseRulesArchive(newTestRulesArchive(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.AddRule(SunSchedule{Name: "Dusk", Event: Sunset, Offset: -30 * time.Minute, Action: RuleActionOn, Devices: []string{"uuid:Socket-1"}, Enabled: true}.Rule())
+
+	data, err := json.Marshal(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"day":"weekdays"`, `"start":"19:00"`, `"duration":"4h0m0s"`, `"start-action":"on"`, `"start":"sunset"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected: %s in %s", want, data)
+		}
+	}
+
+	parsed, err := ParseRulesJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameRules(parsed.Rules, db.Rules) {
+		t.Errorf("Expected: %+v, got: %+v", db.Rules, parsed.Rules)
+	}
+
+	// notifications survive, and follow a rule that gets its id on parsing
+	if len(db.Notifications) == 0 || !reflect.DeepEqual(parsed.Notifications, db.Notifications) {
+		t.Errorf("Expected: %+v, got: %+v", db.Notifications, parsed.Notifications)
+	}
+	parsed, err = ParseRulesJSON([]byte(`{"rules":[{"name":"x","type":"Time Interval","devices":[{"day":"daily","start":"07:00","start-action":"on","end-action":"off"}]}],"notifications":[{"rule-id":0,"message":"x ran"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Notifications) != 1 || parsed.Notifications[0].RuleID != parsed.Rules[0].ID || parsed.Rules[0].ID == 0 {
+		t.Errorf("Expected: the notification of rule %d, got: %+v", parsed.Rules[0].ID, parsed.Notifications)
+	}
+
+	for _, invalid := range []string{
+		`{"rules":[{"name":"x","type":"Sometimes","devices":[]}]}`,
+		`{"rules":[{"name":"x","type":"Time Interval","devices":[{"day":"daily","start":"25:00","start-action":"on","end-action":"off"}]}]}`,
+		`{"rules":[{"name":"x","type":"Time Interval","devices":[{"day":"daily","start":"07:61","start-action":"on","end-action":"off"}]}]}`,
+		`{"rules":[{"name":"x","type":"Time Interval","devices":[{"day":"someday","start":"07:00","start-action":"on","end-action":"off"}]}]}`,
+		`{"rules":[{"name":"x","type":"Time Interval","devices":[{"day":"daily","start":"07:00","start-action":"dance","end-action":"off"}]}]}`,
+	} {
+		if _, err := ParseRulesJSON([]byte(invalid)); err == nil {
+			t.Errorf("Expected: an error parsing %s", invalid)
+		}
+	}
+}
+
+func TestRulesArchiveKeepsUnknownTables(t *testing.T) {
+	db, err := parseRulesArchive(newTestRulesArchive(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.raw, err = editSQLite(db.raw, func(conn *sql.DB) error {
+		_, err := conn.Exec(`INSERT INTO LOCATIONINFO(cityName, latitude, longitude) VALUES('Berlin', '52.52', '13.40')`)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Rules = db.Rules[:1]
+	data, err := db.archive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := unzipRulesDB(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var city string
+	var rules int
+	err = withSQLite(raw, func(conn *sql.DB) error {
+		if err := conn.QueryRow(`SELECT cityName FROM LOCATIONINFO`).Scan(&city); err != nil {
+			return err
+		}
+		return conn.QueryRow(`SELECT count(*) FROM RULES`).Scan(&rules)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if city != "Berlin" || rules != 1 {
+		t.Errorf("Expected: Berlin and 1 rule, got: %q and %d", city, rules)
+	}
+}
+
+// rulesServer fakes the setup and rules endpoints of a device.
+type rulesServer struct {
+	*httptest.Server
+	deviceType string
+	version    int
+	archive    []byte
+}
+
+func newRulesServer(t *testing.T, deviceType string, archive []byte) *rulesServer {
+	s := &rulesServer{deviceType: deviceType, version: 1, archive: archive}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/setup.xml":
+			fmt.Fprintf(w, `<root><device><deviceType>%s</deviceType><friendlyName>Hall</friendlyName><UDN>uuid:Dimmer-1_0-231603K1200123</UDN></device></root>`, s.deviceType)
+		case r.URL.Path == "/rules.db":
+			w.Write(s.archive)
+		case strings.Contains(string(body), "<u:FetchRules "):
+			path := ""
+			if s.archive != nil {
+				path = s.URL + "/rules.db"
+			}
+			fmt.Fprintf(w, testMessageHeader+`<u:FetchRulesResponse xmlns:u="urn:Belkin:service:rules:1"><ruleDbVersion>%d</ruleDbVersion><ruleDbPath>%s</ruleDbPath></u:FetchRulesResponse>`+testMessageFooter, s.version, path)
+		case strings.Contains(string(body), "<u:GetRulesDBVersion "):
+			fmt.Fprintf(w, testMessageHeader+`<u:GetRulesDBVersionResponse xmlns:u="urn:Belkin:service:rules:1"><RulesDBVersion>%d</RulesDBVersion></u:GetRulesDBVersionResponse>`+testMessageFooter, s.version)
+		case strings.Contains(string(body), "<u:StoreRules "):
+			version, _ := responseValue(body, "ruleDbVersion")
+			s.version, _ = strconv.Atoi(version)
+			encoded, _ := responseValue(body, "ruleDbBody")
+			s.archive, _ = base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(encoded, "<![CDATA["), "]]>"))
+			w.Write([]byte(testMessageHeader + `<u:StoreRulesResponse xmlns:u="urn:Belkin:service:rules:1"><errorInfo>Successfull</errorInfo></u:StoreRulesResponse>` + testMessageFooter))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	return s
+}
+
+func (s *rulesServer) device() *Device {
+	return &Device{Host: strings.TrimPrefix(s.URL, "http://")}
+}
+
+func TestSetLongPress(t *testing.T) {
+	server := newRulesServer(t, Dimmer, newTestRulesArchive(t))
+	defer server.Close()
+
+	ctx := context.Background()
+	device := server.device()
+	target := "uuid:Socket-1_0-221248K0102C92"
+	if err := device.SetLongPress(ctx, RuleActionToggle, target); err != nil {
+		t.Fatal(err)
+	}
+	if server.version != 2 {
+		t.Errorf("Expected: version 2, got: %d", server.version)
+	}
+
+	rule, err := device.LongPressRule(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule == nil || len(rule.Targets) != 1 || rule.Targets[0] != target || rule.Devices[0].StartAction != RuleActionToggle {
+		t.Errorf("Expected: long press toggling %s, got: %+v", target, rule)
+	}
+
+	server.deviceType = Controllee
+	if err := device.SetLongPress(ctx, RuleActionToggle, target); err == nil {
+		t.Error("Expected: an error for a device without a button")
+	}
+}
+
+func TestAwayModeRoundTrip(t *testing.T) {
+	away := AwayMode{
+		Name:    "Vacation",
+		Days:    []RuleDay{DayFriday, DaySaturday},
+		Start:   20 * time.Hour,
+		End:     time.Hour,
+		Devices: []string{"uuid:Lightswitch-1_0-1", "uuid:Socket-1_0-2"},
+		Enabled: true,
+	}
+
+	rule := away.Rule()
+	if len(rule.Devices) != 4 || rule.Devices[0].Duration != 5*time.Hour {
+		t.Fatalf("Expected: 4 entries of 5h, got: %+v", rule.Devices)
+	}
+
+	parsed, ok := AwayModeFromRule(rule)
+	if !ok {
+		t.Fatal("Expected: an away mode rule")
+	}
+	if parsed.Start != away.Start || parsed.End != away.End || len(parsed.Days) != 2 || len(parsed.Devices) != 2 {
+		t.Errorf("Expected: %+v, got: %+v", away, parsed)
+	}
+}
+
+func TestSunSchedule(t *testing.T) {
+	server := newRulesServer(t, Controllee, nil)
+	defer server.Close()
+
+	ctx := context.Background()
+	device := server.device()
+	if err := device.SetLocation(ctx, RuleLocation{City: "Berlin", Latitude: 52.52, Longitude: 13.405}); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := device.FetchRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Location == nil || db.Location.City != "Berlin" || db.Location.Latitude != 52.52 {
+		t.Fatalf("Expected: Berlin at 52.52, got: %+v", db.Location)
+	}
+
+	porch := SunSchedule{Name: "Porch", Event: Sunset, Offset: -30 * time.Minute, Action: RuleActionOn, Devices: []string{"uuid:Socket-1_0-2"}, Enabled: true}
+	db.AddRule(porch.Rule())
+	if err := device.StoreRules(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = device.FetchRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, ok := SunScheduleFromRule(db.Rules[0])
+	if !ok || parsed.Event != Sunset || parsed.Offset != -30*time.Minute || parsed.Action != RuleActionOn {
+		t.Errorf("Expected: %+v, got: %+v", porch, parsed)
+	}
+	if db.Location == nil {
+		t.Error("Expected: location to be kept")
+	}
+}
+
+func TestEnableAndRemoveRule(t *testing.T) {
+	server := newRulesServer(t, Controllee, newTestRulesArchive(t))
+	defer server.Close()
+
+	ctx := context.Background()
+	device := server.device()
+	if err := device.EnableRule(ctx, 5, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := device.RemoveRule(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := device.RemoveRule(ctx, 2); err == nil {
+		t.Error("Expected: an error removing a missing rule")
+	}
+
+	db, err := device.FetchRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Rules) != 1 || db.Rules[0].ID != 5 || !db.Rules[0].Enabled || len(db.Rules[0].Targets) != 1 {
+		t.Errorf("Expected: only rule 5, enabled, got: %+v", db.Rules)
+	}
+}
+
+func TestSyncRules(t *testing.T) {
+	first := newRulesServer(t, Controllee, newTestRulesArchive(t))
+	defer first.Close()
+	second := newRulesServer(t, Controllee, nil)
+	defer second.Close()
+
+	canonical := []Rule{{
+		Name:    "Evening",
+		Type:    RuleTimeInterval,
+		Enabled: true,
+		Devices: []RuleDevice{{Day: DayDaily, Start: 18 * time.Hour, Duration: 5 * time.Hour, StartAction: RuleActionOn, EndAction: RuleActionOff}},
+	}}
+
+	ctx := context.Background()
+	results := SyncRules(ctx, canonical, first.device(), second.device())
+	for _, result := range results {
+		if result.Err != nil || !result.Changed {
+			t.Errorf("Expected: %s to change, got: %+v", result.Device.Host, result)
+		}
+	}
+
+	db, err := first.device().FetchRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Rules) != 1 || db.Rules[0].Devices[0].DeviceID != "uuid:Dimmer-1_0-231603K1200123" {
+		t.Errorf("Expected: the rule bound to the device, got: %+v", db.Rules)
+	}
+
+	results = SyncRules(ctx, canonical, first.device(), second.device())
+	for _, result := range results {
+		if result.Err != nil || result.Changed {
+			t.Errorf("Expected: %s to be in sync, got: %+v", result.Device.Host, result)
+		}
+	}
+	if first.version != 2 || second.version != 2 {
+		t.Errorf("Expected: a single upload each, got: versions %d and %d", first.version, second.version)
+	}
+}
+
+func TestStoreRulesConflict(t *testing.T) {
+	server := newRulesServer(t, Controllee, newTestRulesArchive(t))
+	defer server.Close()
+
+	ctx := context.Background()
+	device := server.device()
+	db, err := device.FetchRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the app stores its own changes in the meantime
+	server.version = 7
+
+	db.RemoveRules(func(r *Rule) bool { return r.ID == 2 })
+	err = device.StoreRules(ctx, db)
+	conflict, ok := err.(*RulesConflictError)
+	if !ok || conflict.Expected != 1 || conflict.Actual != 7 {
+		t.Fatalf("Expected: a conflict between versions 1 and 7, got: %v", err)
+	}
+
+	err = device.UpdateRules(ctx, func(db *RulesDB) error {
+		db.RemoveRules(func(r *Rule) bool { return r.ID == 2 })
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.version != 8 {
+		t.Errorf("Expected: version 8, got: %d", server.version)
+	}
+}
+
+func TestStoreRulesAllowsOverlaps(t *testing.T) {
+	server := newRulesServer(t, Controllee, newTestRulesArchive(t))
+	defer server.Close()
+
+	ctx := context.Background()
+	device := server.device()
+	err := device.UpdateRules(ctx, func(db *RulesDB) error {
+		for _, name := range []string{"Evening", "Late"} {
+			db.AddRule(Rule{
+				Name:    name,
+				Type:    RuleTimeInterval,
+				Enabled: true,
+				Devices: []RuleDevice{{DeviceID: "uuid:Socket-1_0-221248K0102C92", Day: DayDaily, Start: 20 * time.Hour, Duration: 2 * time.Hour, StartAction: RuleActionOn, EndAction: RuleActionOff}},
+			})
+		}
+		db.AddRule(Rule{Name: "Unbound", Type: RuleTimeInterval, Devices: []RuleDevice{{Day: DayDaily, Start: time.Hour}}})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected: overlapping rules to be stored, got: %s", err)
+	}
+
+	err = device.UpdateRules(ctx, func(db *RulesDB) error {
+		db.RemoveRules(func(r *Rule) bool { return r.ID == 2 })
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Expected: later edits to be stored, got: %s", err)
+	}
+}
+
+func TestValidateRulesDB(t *testing.T) {
+	db, err := parseRulesArchive(newTestRulesArchive(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Validate(); err != nil {
+		t.Fatalf("Expected: a valid database, got: %s", err)
+	}
+
+	lightswitch := "uuid:Lightswitch-1_0-221450K1200F2F"
+	db.AddRule(Rule{
+		Name:    "Late",
+		Type:    RuleTimeInterval,
+		Enabled: true,
+		Devices: []RuleDevice{{DeviceID: lightswitch, Day: DaySaturday, Start: 22 * time.Hour, Duration: time.Hour, StartAction: RuleActionOn, EndAction: RuleActionOff}},
+	})
+	db.AddRule(Rule{
+		Name:    "Night",
+		Type:    RuleTimeInterval,
+		Enabled: true,
+		Devices: []RuleDevice{{DeviceID: lightswitch, Day: DayMonday, Start: 23 * time.Hour, Duration: 2 * time.Hour, StartAction: RuleActionOn, EndAction: RuleActionOff}},
+	})
+	if err := db.Validate(lightswitch, "uuid:Socket-1_0-221248K0102C92"); err != nil {
+		t.Fatalf("Expected: a valid database, got: %s", err)
+	}
+
+	// Porch runs 19:00-23:00 on weekdays
+	db.Rules[2].Devices[0].Day = DayFriday
+	db.Rules[3].Devices[0].Start = 22 * time.Hour
+	db.Rules[3].ID = 2
+	err = db.Validate(lightswitch)
+	verr, ok := err.(*RulesValidationError)
+	if !ok {
+		t.Fatalf("Expected: a validation error, got: %v", err)
+	}
+	for _, want := range []string{`share id 2`, `target uuid:Socket-1_0-221248K0102C92 is unknown`} {
+		if !strings.Contains(verr.Error(), want) {
+			t.Errorf("Expected: %s in %s", want, verr)
+		}
+	}
+	if len(verr.Problems) != 2 {
+		t.Errorf("Expected: 2 problems, got: %q", verr.Problems)
+	}
+	warnings := strings.Join(db.Warnings(), "; ")
+	for _, want := range []string{`"Porch" and "Late" overlap`, `"Porch" and "Night" overlap`} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("Expected: %s in %s", want, warnings)
+		}
+	}
+
+	db.raw, err = editSQLite(db.raw, func(conn *sql.DB) error {
+		_, err := conn.Exec(`DROP TABLE TARGETDEVICES`)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Validate(); err == nil || !strings.Contains(err.Error(), "table TARGETDEVICES is missing") {
+		t.Errorf("Expected: the missing table to be reported, got: %v", err)
+	}
+}
+
+func TestBackupAndRestoreRules(t *testing.T) {
+	server := newRulesServer(t, Controllee, newTestRulesArchive(t))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "wemo-rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rules.zip")
+
+	ctx := context.Background()
+	device := server.device()
+	if err := device.BackupRules(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := device.RemoveRule(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := device.RestoreRules(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := device.FetchRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Rules) != 2 || db.Version != 3 {
+		t.Errorf("Expected: 2 rules at version 3, got: %d rules at version %d", len(db.Rules), db.Version)
+	}
+
+	ioutil.WriteFile(path, []byte("not a backup"), 0600)
+	if err := device.RestoreRules(ctx, path); err == nil {
+		t.Error("Expected: an error restoring a broken backup")
+	}
+}
+
+func TestRuleNotifications(t *testing.T) {
+	server := newRulesServer(t, Controllee, newTestRulesArchive(t))
+	defer server.Close()
+
+	ctx := context.Background()
+	device := server.device()
+	notifications, err := device.Notifications(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := RuleNotification{RuleID: 2, NotifyRuleID: 7431, Message: "Porch light is on", Frequency: 3600}
+	if len(notifications) != 1 || notifications[0] != expected {
+		t.Fatalf("Expected: %+v, got: %+v", expected, notifications)
+	}
+
+	err = device.UpdateRules(ctx, func(db *RulesDB) error {
+		db.SetNotification(RuleNotification{RuleID: 2, NotifyRuleID: 7431, Message: "Porch light is still on", Frequency: 1800})
+		db.SetNotification(RuleNotification{RuleID: 5, NotifyRuleID: 7432, Message: "Hall pressed", Duration: 60, Sensor: true})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := device.FetchRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := db.NotificationsFor(2); len(n) != 1 || n[0].Message != "Porch light is still on" || n[0].Frequency != 1800 {
+		t.Errorf("Expected: the updated message, got: %+v", n)
+	}
+	if n := db.NotificationsFor(5); len(n) != 1 || !n[0].Sensor || n[0].Duration != 60 {
+		t.Errorf("Expected: a sensor notification, got: %+v", n)
+	}
+
+	if err := device.RemoveRule(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if notifications, _ := device.Notifications(ctx); len(notifications) != 1 || notifications[0].RuleID != 5 {
+		t.Errorf("Expected: only the notification of rule 5, got: %+v", notifications)
+	}
+
+	db.Notifications = append(db.Notifications, RuleNotification{RuleID: 9, Message: "orphan"})
+	if err := db.Validate(); err == nil || !strings.Contains(err.Error(), "missing rule 9") {
+		t.Errorf("Expected: the orphaned notification to be reported, got: %v", err)
+	}
+}
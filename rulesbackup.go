@@ -0,0 +1,54 @@
+package wemo
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+)
+
+// BackupRules saves the rules database of the device to the named file, e.g.
+// before a firmware update or a factory reset. The file is the zipped SQLite
+// database exactly as the device serves it, so it includes tables this package
+// doesn't model.
+func (d *Device) BackupRules(ctx context.Context, path string) error {
+	_, data, err := d.fetchRulesArchive(ctx)
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		// the device has no rules; back up an empty database so restoring
+		// clears rules added since
+		if data, err = (&RulesDB{}).archive(); err != nil {
+			return err
+		}
+	}
+
+	return writeFileAtomic(path, data)
+}
+
+// RestoreRules uploads a rules database saved with BackupRules, replacing the
+// rules on the device whatever their version. The backup may come from another
+// device of the same type, but rules keep referring to the UDNs they were
+// created for.
+func (d *Device) RestoreRules(ctx context.Context, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	db, err := parseRulesArchive(data)
+	if err != nil {
+		return fmt.Errorf("%s is not a rules backup => %s", path, err)
+	}
+	if err := db.checkStructure(); err != nil {
+		return err
+	}
+
+	version, err := d.RulesDBVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	return d.storeRulesArchive(ctx, version+1, data)
+}
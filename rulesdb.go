@@ -0,0 +1,452 @@
+package wemo
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	// rules are stored in an SQLite database
+	_ "modernc.org/sqlite"
+)
+
+// rulesSchema is the layout of the rules database as created by the Belkin
+// app.
+const rulesSchema = `
+CREATE TABLE RULES(RuleID PRIMARY KEY ON CONFLICT REPLACE, Name TEXT NOT NULL, Type TEXT NOT NULL, RuleOrder INTEGER, StartDate TEXT, EndDate TEXT, State TEXT, Sync INTEGER);
+CREATE TABLE RULEDEVICES(RuleDevicePK INTEGER PRIMARY KEY AUTOINCREMENT, RuleID INTEGER, DeviceID TEXT, GroupID INTEGER, DayID INTEGER, StartTime INTEGER, RuleDuration INTEGER, StartAction REAL, EndAction REAL, SensorDuration INTEGER, Type INTEGER, Value INTEGER, Level INTEGER, ZBCapabilityStart TEXT, ZBCapabilityEnd TEXT, OnModeOffset INTEGER, OffModeOffset INTEGER, CountdownTime INTEGER, EndTime INTEGER);
+CREATE TABLE DEVICECOMBINATION(DeviceCombinationPK INTEGER PRIMARY KEY AUTOINCREMENT, RuleID INTEGER, SensorID TEXT, SensorGroupID INTEGER, DeviceID TEXT, DeviceGroupID INTEGER);
+CREATE TABLE GROUPDEVICES(GroupDevicePK INTEGER PRIMARY KEY AUTOINCREMENT, GroupID INTEGER, DeviceID TEXT);
+CREATE TABLE LOCATIONINFO(LocationPk INTEGER PRIMARY KEY AUTOINCREMENT, cityName TEXT, countryName TEXT, latitude TEXT, longitude TEXT, countryCode TEXT, region TEXT);
+CREATE TABLE BLOCKEDRULES(Primarykey INTEGER PRIMARY KEY AUTOINCREMENT, ruleId TEXT);
+CREATE TABLE RULESNOTIFYMESSAGE(RuleID INTEGER PRIMARY KEY AUTOINCREMENT, NotifyRuleID INTEGER NOT NULL, Message TEXT, Frequency INTEGER);
+CREATE TABLE SENSORNOTIFICATION(SensorNotificationPK INTEGER PRIMARY KEY AUTOINCREMENT, RuleID INTEGER, NotifyRuleID INTEGER NOT NULL, NotificationMessage TEXT, NotificationDuration INTEGER);
+CREATE TABLE TARGETDEVICES(TargetDevicesPK INTEGER PRIMARY KEY AUTOINCREMENT, RuleID INTEGER, DeviceID TEXT, DeviceIndex INTEGER);
+`
+
+// parseRulesArchive unzips the rules database downloaded from a device and
+// reads the rules it contains.
+func parseRulesArchive(data []byte) (*RulesDB, error) {
+	raw, err := unzipRulesDB(data)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &RulesDB{raw: raw}
+	err = withSQLite(raw, func(conn *sql.DB) error {
+		rules, err := readRules(conn)
+		if err != nil {
+			return err
+		}
+		db.Rules = rules
+
+		if db.Notifications, err = readNotifications(conn); err != nil {
+			return err
+		}
+
+		db.Location, err = readLocation(conn)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// unzipRulesDB returns the single database file of a rules archive.
+func unzipRulesDB(data []byte) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to unzip rules => %s", err)
+	}
+	if len(archive.File) == 0 {
+		return nil, fmt.Errorf("rules archive is empty")
+	}
+
+	f, err := archive.File[0].Open()
+	if err != nil {
+		return nil, fmt.Errorf("unable to unzip rules => %s", err)
+	}
+	defer f.Close()
+
+	return ioutil.ReadAll(f)
+}
+
+// withSQLite opens the SQLite database image raw in a temporary file and calls
+// fn with it.
+func withSQLite(raw []byte, fn func(*sql.DB) error) error {
+	_, err := editSQLite(raw, fn)
+	return err
+}
+
+// editSQLite is withSQLite returning the database image after fn ran.
+func editSQLite(raw []byte, fn func(*sql.DB) error) ([]byte, error) {
+	f, err := ioutil.TempFile("", "wemo-rules-*.db")
+	if err != nil {
+		return nil, err
+	}
+	name := f.Name()
+	defer os.Remove(name)
+
+	_, err = f.Write(raw)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("sqlite", name)
+	if err != nil {
+		return nil, err
+	}
+	err = fn(conn)
+	if cerr := conn.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(name)
+}
+
+// row is a database row keyed by lower-cased column name, so that readers
+// tolerate the column variations between firmware releases.
+type row map[string]interface{}
+
+func (r row) string(column string) string {
+	switch v := r[strings.ToLower(column)].(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (r row) float(column string) float64 {
+	switch v := r[strings.ToLower(column)].(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	case nil:
+		return 0
+	default:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(r.string(column)), 64)
+		return f
+	}
+}
+
+func (r row) int(column string) int {
+	return int(r.float(column))
+}
+
+func (r row) seconds(column string) time.Duration {
+	return time.Duration(r.int(column)) * time.Second
+}
+
+func tableExists(conn *sql.DB, table string) (bool, error) {
+	var n int
+	err := conn.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?`, table).Scan(&n)
+	return n > 0, err
+}
+
+// queryRows returns all rows of a table, or none when the table doesn't exist.
+func queryRows(conn *sql.DB, table, order string) ([]row, error) {
+	exists, err := tableExists(conn, table)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	query := "SELECT * FROM " + table
+	if order != "" {
+		query += " ORDER BY " + order
+	}
+	rows, err := conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []row
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		r := make(row, len(columns))
+		for i, column := range columns {
+			r[strings.ToLower(column)] = values[i]
+		}
+		result = append(result, r)
+	}
+
+	return result, rows.Err()
+}
+
+func readRules(conn *sql.DB) ([]Rule, error) {
+	ruleRows, err := queryRows(conn, "RULES", "RuleOrder, RuleID")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read RULES => %s", err)
+	}
+
+	var rules []Rule
+	index := make(map[int]int)
+	for _, r := range ruleRows {
+		rule := Rule{
+			ID:        r.int("RuleID"),
+			Name:      r.string("Name"),
+			Type:      r.string("Type"),
+			Order:     r.int("RuleOrder"),
+			StartDate: r.string("StartDate"),
+			EndDate:   r.string("EndDate"),
+			Enabled:   r.string("State") == "1",
+			Sync:      r.int("Sync"),
+		}
+		index[rule.ID] = len(rules)
+		rules = append(rules, rule)
+	}
+
+	deviceRows, err := queryRows(conn, "RULEDEVICES", "rowid")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read RULEDEVICES => %s", err)
+	}
+	for _, r := range deviceRows {
+		i, ok := index[r.int("RuleID")]
+		if !ok {
+			continue
+		}
+		rules[i].Devices = append(rules[i].Devices, RuleDevice{
+			DeviceID:       r.string("DeviceID"),
+			GroupID:        r.int("GroupID"),
+			Day:            RuleDay(r.int("DayID")),
+			Start:          r.seconds("StartTime"),
+			Duration:       r.seconds("RuleDuration"),
+			StartAction:    RuleAction(r.float("StartAction")),
+			EndAction:      RuleAction(r.float("EndAction")),
+			SensorDuration: r.int("SensorDuration"),
+			Type:           r.int("Type"),
+			Value:          r.int("Value"),
+			Level:          r.int("Level"),
+			OnModeOffset:   r.int("OnModeOffset"),
+			OffModeOffset:  r.int("OffModeOffset"),
+			CountdownTime:  r.int("CountdownTime"),
+			End:            r.seconds("EndTime"),
+		})
+	}
+
+	targetRows, err := queryRows(conn, "TARGETDEVICES", "rowid")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read TARGETDEVICES => %s", err)
+	}
+	for _, r := range targetRows {
+		if i, ok := index[r.int("RuleID")]; ok {
+			rules[i].Targets = append(rules[i].Targets, r.string("DeviceID"))
+		}
+	}
+
+	return rules, nil
+}
+
+// archive writes the rules into the database image, creating it when the rules
+// weren't read from a device, and returns it zipped the way devices expect.
+func (db *RulesDB) archive() ([]byte, error) {
+	create := db.raw == nil
+	raw, err := editSQLite(db.raw, func(conn *sql.DB) error {
+		if create {
+			if _, err := conn.Exec(rulesSchema); err != nil {
+				return err
+			}
+		}
+		if err := writeRules(conn, db.Rules); err != nil {
+			return err
+		}
+		if err := writeNotifications(conn, db.Notifications); err != nil {
+			return err
+		}
+		if db.Location != nil {
+			return writeLocation(conn, db.Location)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to write rules => %s", err)
+	}
+	db.raw = raw
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("temppluginRules.db")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeRules replaces the rules in the database. Tables the package doesn't
+// model are left untouched.
+func writeRules(conn *sql.DB, rules []Rule) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"RULES", "RULEDEVICES", "TARGETDEVICES"} {
+		if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+			return err
+		}
+	}
+
+	for _, rule := range rules {
+		state := "0"
+		if rule.Enabled {
+			state = "1"
+		}
+		_, err := tx.Exec(`INSERT INTO RULES(RuleID, Name, Type, RuleOrder, StartDate, EndDate, State, Sync) VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
+			rule.ID, rule.Name, rule.Type, rule.Order, rule.StartDate, rule.EndDate, state, rule.Sync)
+		if err != nil {
+			return err
+		}
+
+		for _, rd := range rule.Devices {
+			_, err := tx.Exec(`INSERT INTO RULEDEVICES(RuleID, DeviceID, GroupID, DayID, StartTime, RuleDuration, StartAction, EndAction, SensorDuration, Type, Value, Level, ZBCapabilityStart, ZBCapabilityEnd, OnModeOffset, OffModeOffset, CountdownTime, EndTime) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, '', '', ?, ?, ?, ?)`,
+				rule.ID, rd.DeviceID, rd.GroupID, int(rd.Day), int(rd.Start/time.Second), int(rd.Duration/time.Second),
+				float64(rd.StartAction), float64(rd.EndAction), rd.SensorDuration, rd.Type, rd.Value, rd.Level,
+				rd.OnModeOffset, rd.OffModeOffset, rd.CountdownTime, int(rd.End/time.Second))
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, target := range rule.Targets {
+			_, err := tx.Exec(`INSERT INTO TARGETDEVICES(RuleID, DeviceID, DeviceIndex) VALUES(?, ?, ?)`, rule.ID, target, i)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func readLocation(conn *sql.DB) (*RuleLocation, error) {
+	rows, err := queryRows(conn, "LOCATIONINFO", "rowid")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read LOCATIONINFO => %s", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	r := rows[len(rows)-1]
+	return &RuleLocation{
+		City:        r.string("cityName"),
+		Country:     r.string("countryName"),
+		CountryCode: r.string("countryCode"),
+		Region:      r.string("region"),
+		Latitude:    r.float("latitude"),
+		Longitude:   r.float("longitude"),
+	}, nil
+}
+
+func writeLocation(conn *sql.DB, l *RuleLocation) error {
+	if _, err := conn.Exec(`DELETE FROM LOCATIONINFO`); err != nil {
+		return err
+	}
+	_, err := conn.Exec(`INSERT INTO LOCATIONINFO(cityName, countryName, latitude, longitude, countryCode, region) VALUES(?, ?, ?, ?, ?, ?)`,
+		l.City, l.Country, strconv.FormatFloat(l.Latitude, 'f', 6, 64), strconv.FormatFloat(l.Longitude, 'f', 6, 64), l.CountryCode, l.Region)
+	return err
+}
+
+func readNotifications(conn *sql.DB) ([]RuleNotification, error) {
+	rows, err := queryRows(conn, "RULESNOTIFYMESSAGE", "RuleID")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read RULESNOTIFYMESSAGE => %s", err)
+	}
+	var notifications []RuleNotification
+	for _, r := range rows {
+		notifications = append(notifications, RuleNotification{
+			RuleID:       r.int("RuleID"),
+			NotifyRuleID: r.int("NotifyRuleID"),
+			Message:      r.string("Message"),
+			Frequency:    r.int("Frequency"),
+		})
+	}
+
+	rows, err = queryRows(conn, "SENSORNOTIFICATION", "rowid")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read SENSORNOTIFICATION => %s", err)
+	}
+	for _, r := range rows {
+		notifications = append(notifications, RuleNotification{
+			RuleID:       r.int("RuleID"),
+			NotifyRuleID: r.int("NotifyRuleID"),
+			Message:      r.string("NotificationMessage"),
+			Duration:     r.int("NotificationDuration"),
+			Sensor:       true,
+		})
+	}
+
+	return notifications, nil
+}
+
+// writeNotifications replaces the notifications in the database. Firmware
+// without notification tables is left alone when there is nothing to write.
+func writeNotifications(conn *sql.DB, notifications []RuleNotification) error {
+	for _, table := range []string{"RULESNOTIFYMESSAGE", "SENSORNOTIFICATION"} {
+		exists, err := tableExists(conn, table)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if _, err := conn.Exec("DELETE FROM " + table); err != nil {
+			return err
+		}
+	}
+
+	for _, n := range notifications {
+		var err error
+		if n.Sensor {
+			_, err = conn.Exec(`INSERT INTO SENSORNOTIFICATION(RuleID, NotifyRuleID, NotificationMessage, NotificationDuration) VALUES(?, ?, ?, ?)`,
+				n.RuleID, n.NotifyRuleID, n.Message, n.Duration)
+		} else {
+			_, err = conn.Exec(`INSERT INTO RULESNOTIFYMESSAGE(RuleID, NotifyRuleID, Message, Frequency) VALUES(?, ?, ?, ?)`,
+				n.RuleID, n.NotifyRuleID, n.Message, n.Frequency)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
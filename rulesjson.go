@@ -0,0 +1,267 @@
+package wemo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ruleTypes = map[string]bool{
+	RuleTimeInterval: true,
+	RuleSimpleSwitch: true,
+	RuleCountdown:    true,
+	RuleLongPress:    true,
+	RuleAwayMode:     true,
+	RuleMotion:       true,
+	RuleInsight:      true,
+	RuleNotify:       true,
+}
+
+// MarshalText encodes the day by name, e.g. "weekdays".
+func (d RuleDay) MarshalText() ([]byte, error) {
+	if name, ok := ruleDayNames[d]; ok {
+		return []byte(name), nil
+	}
+	return nil, fmt.Errorf("unknown rule day %d", int(d))
+}
+
+// UnmarshalText accepts day names as well as DayID numbers.
+func (d *RuleDay) UnmarshalText(text []byte) error {
+	s := strings.ToLower(strings.TrimSpace(string(text)))
+	for day, name := range ruleDayNames {
+		if s == name {
+			*d = day
+			return nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("unknown rule day %q", string(text))
+	}
+	*d = RuleDay(n)
+	return nil
+}
+
+// MarshalText encodes the action by name, e.g. "on".
+func (a RuleAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText accepts action names as well as numbers.
+func (a *RuleAction) UnmarshalText(text []byte) error {
+	s := strings.ToLower(strings.TrimSpace(string(text)))
+	for _, action := range []RuleAction{RuleActionNone, RuleActionOff, RuleActionOn, RuleActionToggle} {
+		if s == action.String() {
+			*a = action
+			return nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("unknown rule action %q", string(text))
+	}
+	*a = RuleAction(f)
+	return nil
+}
+
+// ruleDeviceJSON is the reviewable form of a RuleDevice: times of day are
+// written as clock times ("19:00", or "sunrise"/"sunset" for sun relative
+// rules) and durations as Go durations ("4h0m0s").
+type ruleDeviceJSON struct {
+	DeviceID       string     `json:"device-id,omitempty"`
+	GroupID        int        `json:"group-id,omitempty"`
+	Day            RuleDay    `json:"day"`
+	Start          string     `json:"start"`
+	Duration       string     `json:"duration,omitempty"`
+	StartAction    RuleAction `json:"start-action"`
+	EndAction      RuleAction `json:"end-action"`
+	SensorDuration int        `json:"sensor-duration,omitempty"`
+	Type           int        `json:"type,omitempty"`
+	Value          int        `json:"value,omitempty"`
+	Level          int        `json:"level,omitempty"`
+	OnModeOffset   int        `json:"on-mode-offset,omitempty"`
+	OffModeOffset  int        `json:"off-mode-offset,omitempty"`
+	CountdownTime  int        `json:"countdown-time,omitempty"`
+	End            string     `json:"end,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (rd RuleDevice) MarshalJSON() ([]byte, error) {
+	v := ruleDeviceJSON{
+		DeviceID:       rd.DeviceID,
+		GroupID:        rd.GroupID,
+		Day:            rd.Day,
+		Start:          formatClock(rd.Start),
+		StartAction:    rd.StartAction,
+		EndAction:      rd.EndAction,
+		SensorDuration: rd.SensorDuration,
+		Type:           rd.Type,
+		Value:          rd.Value,
+		Level:          rd.Level,
+		OnModeOffset:   rd.OnModeOffset,
+		OffModeOffset:  rd.OffModeOffset,
+		CountdownTime:  rd.CountdownTime,
+	}
+	if rd.Duration != 0 {
+		v.Duration = rd.Duration.String()
+	}
+	if rd.End != 0 {
+		v.End = formatClock(rd.End)
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (rd *RuleDevice) UnmarshalJSON(data []byte) error {
+	var v ruleDeviceJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	result := RuleDevice{
+		DeviceID:       v.DeviceID,
+		GroupID:        v.GroupID,
+		Day:            v.Day,
+		StartAction:    v.StartAction,
+		EndAction:      v.EndAction,
+		SensorDuration: v.SensorDuration,
+		Type:           v.Type,
+		Value:          v.Value,
+		Level:          v.Level,
+		OnModeOffset:   v.OnModeOffset,
+		OffModeOffset:  v.OffModeOffset,
+		CountdownTime:  v.CountdownTime,
+	}
+	var err error
+	if result.Start, err = parseClock(v.Start); err != nil {
+		return fmt.Errorf("start: %s", err)
+	}
+	if v.End != "" {
+		if result.End, err = parseClock(v.End); err != nil {
+			return fmt.Errorf("end: %s", err)
+		}
+	}
+	if v.Duration != "" {
+		if result.Duration, err = time.ParseDuration(v.Duration); err != nil {
+			return fmt.Errorf("duration: %s", err)
+		}
+	}
+
+	*rd = result
+	return nil
+}
+
+// formatClock formats a time since midnight as HH:MM or HH:MM:SS.
+func formatClock(d time.Duration) string {
+	switch d {
+	case sunriseStart:
+		return "sunrise"
+	case sunsetStart:
+		return "sunset"
+	}
+
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	h, m, s := int(d/time.Hour), int(d%time.Hour/time.Minute), int(d%time.Minute/time.Second)
+	if s != 0 {
+		return fmt.Sprintf("%s%02d:%02d:%02d", sign, h, m, s)
+	}
+	return fmt.Sprintf("%s%02d:%02d", sign, h, m)
+}
+
+// parseClock parses a time of day written by formatClock. Range checks are
+// left to Validate so that reviewers get an error naming the rule.
+func parseClock(s string) (time.Duration, error) {
+	switch strings.ToLower(s) {
+	case "sunrise":
+		return sunriseStart, nil
+	case "sunset":
+		return sunsetStart, nil
+	}
+
+	sign := time.Duration(1)
+	clock := s
+	if strings.HasPrefix(clock, "-") {
+		sign, clock = -1, clock[1:]
+	}
+	parts := strings.Split(clock, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM[:SS]", s)
+	}
+
+	var d time.Duration
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (i > 0 && n > 59) {
+			return 0, fmt.Errorf("invalid time %q, expected HH:MM[:SS]", s)
+		}
+		d += time.Duration(n) * units[i]
+	}
+	return sign * d, nil
+}
+
+// Validate checks that the rule can be stored on a device: it must be of a
+// known type, and its device entries must use known days and actions and
+// times within a day.
+func (r *Rule) Validate() error {
+	if !ruleTypes[r.Type] {
+		return fmt.Errorf("rule %q: unknown type %q", r.Name, r.Type)
+	}
+
+	for i, rd := range r.Devices {
+		if _, ok := ruleDayNames[rd.Day]; !ok {
+			return fmt.Errorf("rule %q: device %d: unknown day %d", r.Name, i, int(rd.Day))
+		}
+		if rd.Start != sunriseStart && rd.Start != sunsetStart && (rd.Start < 0 || rd.Start >= 24*time.Hour) {
+			return fmt.Errorf("rule %q: device %d: start %s is not a time of day", r.Name, i, formatClock(rd.Start))
+		}
+		if rd.End < 0 || rd.End > 24*time.Hour {
+			return fmt.Errorf("rule %q: device %d: end %s is not a time of day", r.Name, i, formatClock(rd.End))
+		}
+		if rd.Duration < 0 || rd.Duration > 24*time.Hour {
+			return fmt.Errorf("rule %q: device %d: duration %s is not within a day", r.Name, i, rd.Duration)
+		}
+		for _, action := range []RuleAction{rd.StartAction, rd.EndAction} {
+			switch action {
+			case RuleActionNone, RuleActionOff, RuleActionOn, RuleActionToggle:
+			default:
+				return fmt.Errorf("rule %q: device %d: unknown action %s", r.Name, i, action)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseRulesJSON reads a rule set written with json.Marshal and validates
+// every rule. Rules without an id, order or dates get them as with AddRule,
+// and the notifications of a rule given a new id follow it. The result can be
+// uploaded with StoreRules.
+func ParseRulesJSON(data []byte) (*RulesDB, error) {
+	var parsed RulesDB
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("Failed to parse rules => %s", err)
+	}
+
+	db := &RulesDB{Version: parsed.Version, Location: parsed.Location}
+	ids := make(map[int]int)
+	for _, rule := range parsed.Rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		if added := db.AddRule(rule); added.ID != rule.ID {
+			ids[rule.ID] = added.ID
+		}
+	}
+	for _, n := range parsed.Notifications {
+		if id, ok := ids[n.RuleID]; ok {
+			n.RuleID = id
+		}
+		db.Notifications = append(db.Notifications, n)
+	}
+	return db, nil
+}
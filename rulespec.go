@@ -0,0 +1,175 @@
+package wemo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The app ends fixed time switch entries a minute before midnight.
+const switchEnd = 24*time.Hour - time.Minute
+
+// TimeSchedule applies an action at a time of day, e.g. turning the coffee
+// maker on at 07:00 on weekdays.
+type TimeSchedule struct {
+	Name    string
+	Days    []RuleDay
+	At      time.Duration // since midnight
+	Action  RuleAction
+	Devices []string // UDNs
+	Enabled bool
+}
+
+// Rule returns the rules database entry for the schedule.
+func (s TimeSchedule) Rule() Rule {
+	days := s.Days
+	if len(days) == 0 {
+		days = []RuleDay{DayDaily}
+	}
+
+	rule := Rule{Name: s.Name, Type: RuleSimpleSwitch, Enabled: s.Enabled}
+	for _, udn := range s.Devices {
+		for _, day := range days {
+			rule.Devices = append(rule.Devices, RuleDevice{
+				DeviceID:      udn,
+				Day:           day,
+				Start:         s.At,
+				Duration:      switchEnd - s.At,
+				StartAction:   s.Action,
+				EndAction:     RuleActionNone,
+				OnModeOffset:  -1,
+				OffModeOffset: -1,
+				CountdownTime: -1,
+				End:           switchEnd,
+			})
+		}
+	}
+	return rule
+}
+
+// TimeScheduleFromRule parses a simple switch rule that runs at a fixed time.
+// It reports false for other rules.
+func TimeScheduleFromRule(rule Rule) (TimeSchedule, bool) {
+	if rule.Type != RuleSimpleSwitch || len(rule.Devices) == 0 {
+		return TimeSchedule{}, false
+	}
+
+	s := TimeSchedule{Name: rule.Name, Enabled: rule.Enabled, At: rule.Devices[0].Start, Action: rule.Devices[0].StartAction}
+	seenDay := make(map[RuleDay]bool)
+	seenDevice := make(map[string]bool)
+	for _, rd := range rule.Devices {
+		if rd.Start < 0 || rd.Start != s.At || rd.StartAction != s.Action {
+			return TimeSchedule{}, false
+		}
+		if !seenDay[rd.Day] {
+			seenDay[rd.Day] = true
+			s.Days = append(s.Days, rd.Day)
+		}
+		if !seenDevice[rd.DeviceID] {
+			seenDevice[rd.DeviceID] = true
+			s.Devices = append(s.Devices, rd.DeviceID)
+		}
+	}
+	return s, true
+}
+
+// ruleDayAbbreviations are the short day names ParseRuleSchedule accepts.
+var ruleDayAbbreviations = map[string]RuleDay{
+	"everyday": DayDaily,
+	"mon":      DayMonday,
+	"tue":      DayTuesday,
+	"wed":      DayWednesday,
+	"thu":      DayThursday,
+	"fri":      DayFriday,
+	"sat":      DaySaturday,
+	"sun":      DaySunday,
+	"weekday":  DayWeekdays,
+	"weekend":  DayWeekends,
+}
+
+// ParseRuleSchedule parses a schedule written as days, a time or a sun event
+// with an offset, and an action, e.g. "weekdays 07:00 on",
+// "mon,wed,fri at 22:30 off" or "daily sunset-30m on", into the rule for the
+// devices udns. The rule is named after spec.
+func ParseRuleSchedule(spec string, udns ...string) (Rule, error) {
+	fields := strings.Fields(strings.ToLower(spec))
+	if len(fields) == 4 && fields[1] == "at" {
+		fields = append(fields[:1], fields[2:]...)
+	}
+	if len(fields) != 3 {
+		return Rule{}, fmt.Errorf("schedule %q: expected days, time and action, e.g. \"weekdays 07:00 on\"", spec)
+	}
+
+	var days []RuleDay
+	for _, name := range strings.Split(fields[0], ",") {
+		var day RuleDay
+		if abbreviation, ok := ruleDayAbbreviations[name]; ok {
+			day = abbreviation
+		} else if err := day.UnmarshalText([]byte(name)); err != nil || day < DayDaily || day > DayWeekends {
+			return Rule{}, fmt.Errorf("schedule %q: unknown day %q", spec, name)
+		}
+		days = append(days, day)
+	}
+
+	var action RuleAction
+	if err := action.UnmarshalText([]byte(fields[2])); err != nil || action == RuleActionNone {
+		return Rule{}, fmt.Errorf("schedule %q: unknown action %q, expected on, off or toggle", spec, fields[2])
+	}
+
+	at := fields[1]
+	for _, event := range []SunEvent{Sunrise, Sunset} {
+		if !strings.HasPrefix(at, event.String()) {
+			continue
+		}
+		var offset time.Duration
+		if rest := strings.TrimPrefix(at, event.String()); rest != "" {
+			var err error
+			if offset, err = time.ParseDuration(rest); err != nil || (rest[0] != '+' && rest[0] != '-') {
+				return Rule{}, fmt.Errorf("schedule %q: invalid offset %q, expected e.g. %s-30m", spec, rest, event)
+			}
+		}
+		return SunSchedule{Name: spec, Days: days, Event: event, Offset: offset, Action: action, Devices: udns, Enabled: true}.Rule(), nil
+	}
+
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return Rule{}, fmt.Errorf("schedule %q: invalid time %q, expected e.g. 07:00 or sunset-30m", spec, at)
+	}
+	start := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	return TimeSchedule{Name: spec, Days: days, At: start, Action: action, Devices: udns, Enabled: true}.Rule(), nil
+}
+
+// FormatRuleSchedule writes a time or sun schedule the way ParseRuleSchedule
+// reads it. It reports false for other rules.
+func FormatRuleSchedule(rule Rule) (string, bool) {
+	days := func(days []RuleDay) string {
+		names := make([]string, len(days))
+		for i, day := range days {
+			names[i] = day.String()
+		}
+		return strings.Join(names, ",")
+	}
+
+	if s, ok := SunScheduleFromRule(rule); ok {
+		at := s.Event.String()
+		if s.Offset > 0 {
+			at += "+" + formatOffset(s.Offset)
+		} else if s.Offset < 0 {
+			at += "-" + formatOffset(-s.Offset)
+		}
+		return fmt.Sprintf("%s %s %s", days(s.Days), at, s.Action), true
+	}
+	if s, ok := TimeScheduleFromRule(rule); ok {
+		return fmt.Sprintf("%s %02d:%02d %s", days(s.Days), int(s.At/time.Hour), int(s.At%time.Hour/time.Minute), s.Action), true
+	}
+	return "", false
+}
+
+// formatOffset writes d as minutes when it is whole minutes, e.g. 30m or 90m.
+func formatOffset(d time.Duration) string {
+	if d%time.Minute == 0 {
+		return strconv.Itoa(int(d/time.Minute)) + "m"
+	}
+	return d.String()
+}
@@ -0,0 +1,62 @@
+package wemo
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRuleSchedule(t *testing.T) {
+	for spec, expected := range map[string]string{
+		"weekdays 07:00 on":         "weekdays 07:00 on",
+		"Mon,Wed,Fri at 22:30 OFF":  "monday,wednesday,friday 22:30 off",
+		"daily sunset-30m on":       "daily sunset-30m on",
+		"weekend sunrise+1h toggle": "weekends sunrise+60m toggle",
+		"sunday sunset off":         "sunday sunset off",
+	} {
+		rule, err := ParseRuleSchedule(spec, "uuid:Socket-1")
+		if err != nil {
+			t.Errorf("Expected: %s to parse, got: %s", spec, err)
+			continue
+		}
+		if formatted, ok := FormatRuleSchedule(rule); !ok || formatted != expected {
+			t.Errorf("Expected: %s for %s, got: %s", expected, spec, formatted)
+		}
+	}
+
+	for _, spec := range []string{"07:00 on", "weekdays 25:00 on", "someday 07:00 on", "daily 07:00 dance", "daily sunset30m on"} {
+		if _, err := ParseRuleSchedule(spec); err == nil {
+			t.Errorf("Expected: an error for %s, got: nil", spec)
+		}
+	}
+}
+
+func TestTimeSchedule(t *testing.T) {
+	server := newRulesServer(t, Controllee, nil)
+	defer server.Close()
+
+	ctx := context.Background()
+	device := server.device()
+	rule, err := ParseRuleSchedule("weekdays 07:00 on", "uuid:Socket-1_0-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := device.UpdateRules(ctx, func(db *RulesDB) error {
+		db.AddRule(rule)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := device.FetchRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, ok := TimeScheduleFromRule(db.Rules[0])
+	if !ok || parsed.At != 7*time.Hour || parsed.Action != RuleActionOn || len(parsed.Days) != 1 || parsed.Days[0] != DayWeekdays {
+		t.Errorf("Expected: weekdays at 07:00 on, got: %+v", parsed)
+	}
+	if rd := db.Rules[0].Devices[0]; rd.End != switchEnd || rd.Duration != switchEnd-7*time.Hour {
+		t.Errorf("Expected: the entry to end at %s, got: %+v", switchEnd, rd)
+	}
+}
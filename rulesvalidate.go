@@ -0,0 +1,255 @@
+package wemo
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RulesValidationError lists everything RulesDB.Validate found wrong with a
+// rules database.
+type RulesValidationError struct {
+	Problems []string
+}
+
+func (e *RulesValidationError) Error() string {
+	return "invalid rules: " + strings.Join(e.Problems, "; ")
+}
+
+// rulesColumns are the columns written by writeRules.
+var rulesColumns = map[string][]string{
+	"RULES":         {"RuleID", "Name", "Type", "RuleOrder", "StartDate", "EndDate", "State", "Sync"},
+	"RULEDEVICES":   {"RuleID", "DeviceID", "GroupID", "DayID", "StartTime", "RuleDuration", "StartAction", "EndAction", "SensorDuration", "Type", "Value", "Level", "ZBCapabilityStart", "ZBCapabilityEnd", "OnModeOffset", "OffModeOffset", "CountdownTime", "EndTime"},
+	"TARGETDEVICES": {"RuleID", "DeviceID", "DeviceIndex"},
+}
+
+// Validate checks the database before it is uploaded, since a malformed
+// database can stop a device from running any of its rules. Besides the
+// checks of StoreRules it checks that every rule device has a device id and,
+// when udns are given, that rules only refer to those devices, e.g. the
+// devices found by discovery. All problems are reported in a single
+// *RulesValidationError. Overlapping schedules are not an error, see
+// Warnings.
+func (db *RulesDB) Validate(udns ...string) error {
+	problems := db.structureProblems()
+
+	known := make(map[string]bool, len(udns))
+	for _, udn := range udns {
+		known[udn] = true
+	}
+	for _, rule := range db.Rules {
+		for i, rd := range rule.Devices {
+			switch {
+			case rd.DeviceID == "":
+				problems = append(problems, fmt.Sprintf("rule %q: device %d has no device id", rule.Name, i))
+			case len(udns) > 0 && !known[rd.DeviceID]:
+				problems = append(problems, fmt.Sprintf("rule %q: device %s is unknown, remove it from the rule or add the device", rule.Name, rd.DeviceID))
+			}
+		}
+		for _, target := range rule.Targets {
+			if len(udns) > 0 && !known[target] {
+				problems = append(problems, fmt.Sprintf("rule %q: target %s is unknown, remove it from the rule or add the device", rule.Name, target))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &RulesValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Warnings reports enabled schedules that drive the same device at the same
+// time. Devices run overlapping rules, so these are advice rather than
+// errors.
+func (db *RulesDB) Warnings() []string {
+	return overlappingRules(db.Rules)
+}
+
+// checkStructure is run before every upload. It only rejects databases a
+// device cannot read, so rules already on a device never block later edits.
+func (db *RulesDB) checkStructure() error {
+	if problems := db.structureProblems(); len(problems) > 0 {
+		return &RulesValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// structureProblems checks that the database has the tables and columns the
+// rules are written to, that every rule is valid and has a unique id, and
+// that notifications belong to existing rules.
+func (db *RulesDB) structureProblems() []string {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if db.raw != nil {
+		err := withSQLite(db.raw, func(conn *sql.DB) error {
+			for _, p := range checkRulesSchema(conn) {
+				problem("%s", p)
+			}
+			return nil
+		})
+		if err != nil {
+			problem("unable to read the rules database => %s", err)
+		}
+	}
+
+	ids := make(map[int]string)
+	for _, rule := range db.Rules {
+		if err := rule.Validate(); err != nil {
+			problem("%s", err)
+		}
+		if other, ok := ids[rule.ID]; ok {
+			problem("rules %q and %q share id %d, give one of them a new id", other, rule.Name, rule.ID)
+		}
+		ids[rule.ID] = rule.Name
+	}
+
+	messages := make(map[int]bool)
+	for _, n := range db.Notifications {
+		if _, ok := ids[n.RuleID]; !ok {
+			problem("notification %q refers to missing rule %d, remove it or add the rule", n.Message, n.RuleID)
+		}
+		if !n.Sensor {
+			if messages[n.RuleID] {
+				problem("rule %q has more than one notification message, keep only one", ids[n.RuleID])
+			}
+			messages[n.RuleID] = true
+		}
+	}
+
+	if db.Location != nil {
+		l := db.Location
+		if l.Latitude < -90 || l.Latitude > 90 || l.Longitude < -180 || l.Longitude > 180 {
+			problem("location has invalid coordinates %f,%f", l.Latitude, l.Longitude)
+		}
+	}
+	return problems
+}
+
+// checkRulesSchema reports the tables and columns writeRules needs but the
+// database lacks.
+func checkRulesSchema(conn *sql.DB) []string {
+	var problems []string
+
+	tables := make([]string, 0, len(rulesColumns))
+	for table := range rulesColumns {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		rows, err := conn.Query("PRAGMA table_info(" + table + ")")
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to read table %s => %s", table, err))
+			continue
+		}
+		have := make(map[string]bool)
+		for rows.Next() {
+			var cid, notNull, pk int
+			var name, typ string
+			var dflt sql.NullString
+			if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err == nil {
+				have[strings.ToLower(name)] = true
+			}
+		}
+		rows.Close()
+
+		if len(have) == 0 {
+			problems = append(problems, fmt.Sprintf("table %s is missing, the database was not created by the Belkin app", table))
+			continue
+		}
+		for _, column := range rulesColumns[table] {
+			if !have[strings.ToLower(column)] {
+				problems = append(problems, fmt.Sprintf("table %s has no column %s, the firmware uses an unsupported layout", table, column))
+			}
+		}
+	}
+	return problems
+}
+
+// scheduleWindow is the time a rule device entry keeps a device switched, as
+// an offset into the week starting Monday midnight.
+type scheduleWindow struct {
+	rule  string
+	start time.Duration
+	end   time.Duration
+}
+
+const week = 7 * 24 * time.Hour
+
+// weekDays returns the days of the week (Monday = 0) a rule day stands for.
+func weekDays(day RuleDay) []int {
+	switch {
+	case day == DayAll || day == DayDaily:
+		return []int{0, 1, 2, 3, 4, 5, 6}
+	case day == DayWeekdays:
+		return []int{0, 1, 2, 3, 4}
+	case day == DayWeekends:
+		return []int{5, 6}
+	case day >= DayMonday && day <= DaySunday:
+		return []int{int(day - DayMonday)}
+	}
+	return nil
+}
+
+// overlappingRules reports enabled time interval and away mode rules that
+// switch the same device during the same time.
+func overlappingRules(rules []Rule) []string {
+	windows := make(map[string][]scheduleWindow)
+	for _, rule := range rules {
+		if !rule.Enabled || (rule.Type != RuleTimeInterval && rule.Type != RuleAwayMode) {
+			continue
+		}
+		for _, rd := range rule.Devices {
+			if rd.Duration <= 0 || rd.Start < 0 {
+				continue
+			}
+			for _, day := range weekDays(rd.Day) {
+				start := time.Duration(day)*24*time.Hour + rd.Start
+				windows[rd.DeviceID] = append(windows[rd.DeviceID], scheduleWindow{rule.Name, start, start + rd.Duration})
+			}
+		}
+	}
+
+	devices := make([]string, 0, len(windows))
+	for device := range windows {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+
+	var problems []string
+	reported := make(map[string]bool)
+	for _, device := range devices {
+		w := windows[device]
+		for i := range w {
+			for j := i + 1; j < len(w); j++ {
+				if w[i].rule == w[j].rule || !windowsOverlap(w[i], w[j]) {
+					continue
+				}
+				key := device + "\x00" + w[i].rule + "\x00" + w[j].rule
+				if reported[key] {
+					continue
+				}
+				reported[key] = true
+				problems = append(problems, fmt.Sprintf("rules %q and %q overlap on %s, move or shorten one of them", w[i].rule, w[j].rule, device))
+			}
+		}
+	}
+	return problems
+}
+
+// windowsOverlap compares two windows on the week, which wraps from Sunday
+// night to Monday morning.
+func windowsOverlap(a, b scheduleWindow) bool {
+	for _, shift := range []time.Duration{-week, 0, week} {
+		if a.start < b.end+shift && b.start+shift < a.end {
+			return true
+		}
+	}
+	return false
+}
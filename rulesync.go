@@ -0,0 +1,118 @@
+package wemo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// RuleSyncResult reports what SyncRules did for a single device.
+type RuleSyncResult struct {
+	Device  *Device
+	Changed bool
+	Err     error
+}
+
+// SyncRules makes the rules of every device match the canonical set, e.g. the
+// same evening schedule on all porch lights. Rule device entries with an empty
+// DeviceID are bound to the UDN of the device being synchronized. Devices
+// whose rules already match are not re-uploaded; on the others, notifications
+// of the replaced rules are dropped. Devices are synchronized concurrently;
+// results are returned in the order of devices.
+func SyncRules(ctx context.Context, rules []Rule, devices ...*Device) []RuleSyncResult {
+	results := make([]RuleSyncResult, len(devices))
+
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		wg.Add(1)
+		go func(i int, device *Device) {
+			defer wg.Done()
+			changed, err := device.syncRules(ctx, rules)
+			results[i] = RuleSyncResult{Device: device, Changed: changed, Err: err}
+		}(i, device)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (d *Device) syncRules(ctx context.Context, canonical []Rule) (bool, error) {
+	info, err := d.FetchDeviceInfo(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	wanted := &RulesDB{}
+	for _, rule := range canonical {
+		wanted.AddRule(bindRule(rule, info.UDN))
+	}
+
+	err = d.UpdateRules(ctx, func(db *RulesDB) error {
+		if sameRules(db.Rules, wanted.Rules) {
+			return errRulesUnchanged
+		}
+		db.Rules = wanted.Rules
+		// the notifications belonged to the replaced rules
+		db.Notifications = nil
+		return nil
+	})
+	if err == errRulesUnchanged {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// errRulesUnchanged stops UpdateRules when there is nothing to store.
+var errRulesUnchanged = errors.New("rules unchanged")
+
+// bindRule returns a copy of rule with unbound device entries pointing at udn.
+func bindRule(rule Rule, udn string) Rule {
+	devices := make([]RuleDevice, len(rule.Devices))
+	for i, rd := range rule.Devices {
+		if rd.DeviceID == "" {
+			rd.DeviceID = udn
+		}
+		devices[i] = rd
+	}
+	rule.Devices = devices
+	rule.ID = 0
+	rule.Order = 0
+	return rule
+}
+
+// sameRules compares two rule sets ignoring ids, order and the order of the
+// rules themselves.
+func sameRules(a, b []Rule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	normalize := func(rules []Rule) []Rule {
+		result := make([]Rule, len(rules))
+		for i, rule := range rules {
+			rule.ID = 0
+			rule.Order = 0
+			if len(rule.Devices) == 0 {
+				rule.Devices = nil
+			}
+			if len(rule.Targets) == 0 {
+				rule.Targets = nil
+			}
+			result[i] = rule
+		}
+		sort.SliceStable(result, func(i, j int) bool {
+			if result[i].Name != result[j].Name {
+				return result[i].Name < result[j].Name
+			}
+			return result[i].Type < result[j].Type
+		})
+		return result
+	}
+
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
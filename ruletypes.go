@@ -0,0 +1,364 @@
+package wemo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// NewCountdownRule returns a rule that applies action to the device udn once it
+// has been in the opposite state for countdown, e.g. turning a plug off ten
+// minutes after it was switched on. The rule runs all day, every day.
+func NewCountdownRule(udn string, countdown time.Duration, action RuleAction) Rule {
+	return Rule{
+		Name:    "Countdown " + action.String() + " after " + countdown.String(),
+		Type:    RuleCountdown,
+		Enabled: true,
+		Devices: []RuleDevice{{
+			DeviceID:      udn,
+			Day:           DayAll,
+			Start:         0,
+			Duration:      24 * time.Hour,
+			StartAction:   action,
+			EndAction:     RuleActionNone,
+			CountdownTime: int(countdown / time.Second),
+			End:           24 * time.Hour,
+		}},
+	}
+}
+
+// RemoveRules drops the rules for which match returns true, together with
+// their notifications, and reports how many were removed.
+func (db *RulesDB) RemoveRules(match func(*Rule) bool) int {
+	kept := db.Rules[:0]
+	removed := make(map[int]bool)
+	for i := range db.Rules {
+		if match(&db.Rules[i]) {
+			removed[db.Rules[i].ID] = true
+			continue
+		}
+		kept = append(kept, db.Rules[i])
+	}
+	db.Rules = kept
+
+	notifications := db.Notifications[:0]
+	for _, n := range db.Notifications {
+		if !removed[n.RuleID] {
+			notifications = append(notifications, n)
+		}
+	}
+	db.Notifications = notifications
+
+	return len(removed)
+}
+
+// appliesTo reports whether the rule acts on the device udn.
+func (r *Rule) appliesTo(udn string) bool {
+	for _, rd := range r.Devices {
+		if rd.DeviceID == udn {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCountdown installs a countdown rule turning the device off countdown
+// after it is turned on, replacing any countdown rule it already has. The rule
+// lives on the device, so it keeps working without this process.
+func (d *Device) SetCountdown(ctx context.Context, countdown time.Duration) error {
+	if countdown < time.Minute {
+		return errors.New("countdown must be at least a minute")
+	}
+
+	return d.updateCountdown(ctx, func(db *RulesDB, udn string) {
+		db.AddRule(NewCountdownRule(udn, countdown, RuleActionOff))
+	})
+}
+
+// ClearCountdown removes the countdown rules of the device.
+func (d *Device) ClearCountdown(ctx context.Context) error {
+	return d.updateCountdown(ctx, func(*RulesDB, string) {})
+}
+
+func (d *Device) updateCountdown(ctx context.Context, add func(*RulesDB, string)) error {
+	info, err := d.FetchDeviceInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	return d.UpdateRules(ctx, func(db *RulesDB) error {
+		db.RemoveRules(func(r *Rule) bool {
+			return r.Type == RuleCountdown && r.appliesTo(info.UDN)
+		})
+		add(db, info.UDN)
+		return nil
+	})
+}
+
+// NewLongPressRule returns the rule run when the button of the Dimmer or Light
+// Switch udn is held down: action is applied to every target device.
+func NewLongPressRule(udn string, action RuleAction, targets ...string) Rule {
+	return Rule{
+		Name:    udn + " Long Press Rule",
+		Type:    RuleLongPress,
+		Enabled: true,
+		Devices: []RuleDevice{{
+			DeviceID:       udn,
+			Day:            DayAll,
+			Start:          time.Minute,
+			Duration:       24*time.Hour - time.Minute,
+			StartAction:    action,
+			EndAction:      RuleActionNone,
+			SensorDuration: -1,
+			Type:           -1,
+			Value:          -1,
+			Level:          -1,
+			OnModeOffset:   -1,
+			OffModeOffset:  -1,
+			CountdownTime:  -1,
+			End:            24 * time.Hour,
+		}},
+		Targets: targets,
+	}
+}
+
+// longPressInfo checks that the device supports long press rules.
+func (d *Device) longPressInfo(ctx context.Context) (*DeviceInfo, error) {
+	info, err := d.FetchDeviceInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if info.DeviceType != Dimmer && info.DeviceType != LightSwitch {
+		return nil, fmt.Errorf("%s (%s) doesn't support long press rules", info.FriendlyName, info.DeviceType)
+	}
+	return info, nil
+}
+
+// LongPressRule returns the long press rule of the device, if it has one.
+func (d *Device) LongPressRule(ctx context.Context) (*Rule, error) {
+	info, err := d.longPressInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := d.FetchRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range db.Rules {
+		if db.Rules[i].Type == RuleLongPress && db.Rules[i].appliesTo(info.UDN) {
+			return &db.Rules[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// SetLongPress configures a long press on the device to apply action to the
+// target devices (by UDN), replacing its previous long press rule. Without
+// targets the long press rule is removed.
+func (d *Device) SetLongPress(ctx context.Context, action RuleAction, targets ...string) error {
+	info, err := d.longPressInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	return d.UpdateRules(ctx, func(db *RulesDB) error {
+		db.RemoveRules(func(r *Rule) bool {
+			return r.Type == RuleLongPress && r.appliesTo(info.UDN)
+		})
+		if len(targets) > 0 {
+			db.AddRule(NewLongPressRule(info.UDN, action, targets...))
+		}
+		return nil
+	})
+}
+
+// AwayMode describes an "away mode" rule: while it is active the devices are
+// switched on and off at random times within the window, so the house looks
+// occupied. A window whose End is before its Start runs past midnight.
+type AwayMode struct {
+	Name    string
+	Days    []RuleDay
+	Start   time.Duration // since midnight
+	End     time.Duration // since midnight
+	Devices []string      // UDNs
+	Enabled bool
+}
+
+// Rule returns the rules database entry for the away mode.
+func (a AwayMode) Rule() Rule {
+	days := a.Days
+	if len(days) == 0 {
+		days = []RuleDay{DayDaily}
+	}
+
+	duration := a.End - a.Start
+	if duration <= 0 {
+		duration += 24 * time.Hour
+	}
+
+	rule := Rule{Name: a.Name, Type: RuleAwayMode, Enabled: a.Enabled}
+	for _, udn := range a.Devices {
+		for _, day := range days {
+			rule.Devices = append(rule.Devices, RuleDevice{
+				DeviceID:    udn,
+				Day:         day,
+				Start:       a.Start,
+				Duration:    duration,
+				StartAction: RuleActionOn,
+				EndAction:   RuleActionOff,
+				End:         a.End,
+			})
+		}
+	}
+	return rule
+}
+
+// AwayModeFromRule parses an away mode rule. It reports false for rules of any
+// other type.
+func AwayModeFromRule(rule Rule) (AwayMode, bool) {
+	if rule.Type != RuleAwayMode {
+		return AwayMode{}, false
+	}
+
+	a := AwayMode{Name: rule.Name, Enabled: rule.Enabled}
+	seenDay := make(map[RuleDay]bool)
+	seenDevice := make(map[string]bool)
+	for _, rd := range rule.Devices {
+		a.Start = rd.Start
+		a.End = (rd.Start + rd.Duration) % (24 * time.Hour)
+		if !seenDay[rd.Day] {
+			seenDay[rd.Day] = true
+			a.Days = append(a.Days, rd.Day)
+		}
+		if !seenDevice[rd.DeviceID] {
+			seenDevice[rd.DeviceID] = true
+			a.Devices = append(a.Devices, rd.DeviceID)
+		}
+	}
+	return a, true
+}
+
+// AwayModes returns the away mode rules of the database.
+func (db *RulesDB) AwayModes() []AwayMode {
+	var modes []AwayMode
+	for _, rule := range db.Rules {
+		if a, ok := AwayModeFromRule(rule); ok {
+			modes = append(modes, a)
+		}
+	}
+	return modes
+}
+
+// SunEvent is the sun position a SunSchedule is relative to.
+type SunEvent int
+
+// Sun events
+const (
+	Sunrise SunEvent = iota
+	Sunset
+)
+
+func (e SunEvent) String() string {
+	if e == Sunset {
+		return "sunset"
+	}
+	return "sunrise"
+}
+
+// The app marks sun relative entries with these StartTime values and keeps
+// the offset from the event in OnModeOffset.
+const (
+	sunriseStart = -2 * time.Second
+	sunsetStart  = -3 * time.Second
+)
+
+// SunSchedule applies an action relative to sunrise or sunset, e.g. turning
+// the porch light on 30 minutes before sunset (Offset -30m). The device
+// computes the event from the location stored with SetLocation.
+type SunSchedule struct {
+	Name    string
+	Days    []RuleDay
+	Event   SunEvent
+	Offset  time.Duration
+	Action  RuleAction
+	Devices []string // UDNs
+	Enabled bool
+}
+
+// Rule returns the rules database entry for the schedule.
+func (s SunSchedule) Rule() Rule {
+	days := s.Days
+	if len(days) == 0 {
+		days = []RuleDay{DayDaily}
+	}
+
+	start := sunriseStart
+	if s.Event == Sunset {
+		start = sunsetStart
+	}
+
+	rule := Rule{Name: s.Name, Type: RuleSimpleSwitch, Enabled: s.Enabled}
+	for _, udn := range s.Devices {
+		for _, day := range days {
+			rule.Devices = append(rule.Devices, RuleDevice{
+				DeviceID:      udn,
+				Day:           day,
+				Start:         start,
+				StartAction:   s.Action,
+				EndAction:     RuleActionNone,
+				OnModeOffset:  int(s.Offset / time.Second),
+				OffModeOffset: -1,
+				CountdownTime: -1,
+			})
+		}
+	}
+	return rule
+}
+
+// SunScheduleFromRule parses a sun relative rule. It reports false for rules
+// that run at fixed times.
+func SunScheduleFromRule(rule Rule) (SunSchedule, bool) {
+	if len(rule.Devices) == 0 {
+		return SunSchedule{}, false
+	}
+
+	s := SunSchedule{Name: rule.Name, Enabled: rule.Enabled}
+	seenDay := make(map[RuleDay]bool)
+	seenDevice := make(map[string]bool)
+	for _, rd := range rule.Devices {
+		switch rd.Start {
+		case sunriseStart:
+			s.Event = Sunrise
+		case sunsetStart:
+			s.Event = Sunset
+		default:
+			return SunSchedule{}, false
+		}
+		s.Offset = time.Duration(rd.OnModeOffset) * time.Second
+		s.Action = rd.StartAction
+		if !seenDay[rd.Day] {
+			seenDay[rd.Day] = true
+			s.Days = append(s.Days, rd.Day)
+		}
+		if !seenDevice[rd.DeviceID] {
+			seenDevice[rd.DeviceID] = true
+			s.Devices = append(s.Devices, rd.DeviceID)
+		}
+	}
+	return s, true
+}
+
+// SetLocation stores the location the device uses to compute sunrise and
+// sunset for sun relative schedules.
+func (d *Device) SetLocation(ctx context.Context, location RuleLocation) error {
+	if location.Latitude < -90 || location.Latitude > 90 || location.Longitude < -180 || location.Longitude > 180 {
+		return fmt.Errorf("invalid coordinates %f,%f", location.Latitude, location.Longitude)
+	}
+
+	return d.UpdateRules(ctx, func(db *RulesDB) error {
+		db.Location = &location
+		return nil
+	})
+}
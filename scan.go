@@ -35,6 +35,12 @@ func (w *Wemo) SetSourcePort(sourcePort uint16) {
 	w.sourcePort = sourcePort
 }
 
+// SetSearchAddress sends the searches to addr instead of the SSDP multicast
+// address, e.g. to a responder of package wemotest on the loopback interface.
+func (w *Wemo) SetSearchAddress(addr string) {
+	w.searchAddr = addr
+}
+
 // scan the multicast
 func (w *Wemo) scan(urn string, timeout time.Duration) ([]*url.URL, error) {
 	// open a udp port for us to receive multicast messages
@@ -50,7 +56,11 @@ func (w *Wemo) scan(urn string, timeout time.Duration) ([]*url.URL, error) {
 	defer udpConn.Close()
 
 	//send the
-	mAddr, err := net.ResolveUDPAddr("udp", SSDPBROADCAST)
+	searchAddr := SSDPBROADCAST
+	if w.searchAddr != "" {
+		searchAddr = w.searchAddr
+	}
+	mAddr, err := net.ResolveUDPAddr("udp", searchAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -86,11 +96,14 @@ func (w *Wemo) scan(urn string, timeout time.Duration) ([]*url.URL, error) {
 		read := string(buffer[:n])
 		lines := strings.Split(read, "\n")
 		for _, line := range lines {
-			if strings.HasPrefix(line, LOCATION) {
-				temp := strings.TrimSpace(line[len(LOCATION):])
+			// header names are case insensitive, and a malformed answer
+			// must not hide the answers of the other devices
+			header := strings.SplitN(line, ":", 2)
+			if len(header) == 2 && strings.EqualFold(strings.TrimSpace(header[0]), "LOCATION") {
+				temp := strings.TrimSpace(header[1])
 				u, err := url.Parse(temp)
-				if err != nil {
-					return nil, err
+				if err != nil || u.Host == "" {
+					continue
 				}
 				locations[temp] = u
 			}
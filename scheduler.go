@@ -0,0 +1,302 @@
+package wemo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job is a command the Scheduler sends to a device, either repeatedly on a
+// cron Schedule or once At a given time. Timezone is an IANA zone name the
+// schedule is evaluated in; empty means local time.
+type Job struct {
+	ID       string    `json:"id"`
+	Target   string    `json:"target"`
+	Command  Command   `json:"command"`
+	Schedule string    `json:"schedule,omitempty"`
+	Timezone string    `json:"timezone,omitempty"`
+	At       time.Time `json:"at"`
+	Next     time.Time `json:"next"`
+}
+
+func (j *Job) next(after time.Time) (time.Time, error) {
+	if j.Schedule == "" {
+		if j.At.IsZero() {
+			return time.Time{}, errors.New("job has neither a schedule nor a time")
+		}
+		return j.At, nil
+	}
+
+	schedule, err := ParseSchedule(j.Schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc := time.Local
+	if j.Timezone != "" {
+		if loc, err = time.LoadLocation(j.Timezone); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	next := schedule.Next(after, loc)
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("schedule %q never matches", j.Schedule)
+	}
+	return next, nil
+}
+
+// JobStore persists the pending jobs of a Scheduler.
+type JobStore interface {
+	Load() ([]Job, error)
+	Save([]Job) error
+}
+
+// FileJobStore stores jobs as JSON in the named file.
+type FileJobStore string
+
+// Load reads the jobs, returning none when the file doesn't exist yet.
+func (f FileJobStore) Load() ([]Job, error) {
+	data, err := ioutil.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("unable to parse jobs in %s => %s", string(f), err)
+	}
+	return jobs, nil
+}
+
+// Save replaces the stored jobs.
+func (f FileJobStore) Save(jobs []Job) error {
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(string(f), data)
+}
+
+// writeFileAtomic writes data to a temporary file next to name and renames it
+// into place, so readers never see a partial file.
+func writeFileAtomic(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// Scheduler runs commands against devices at set times, for schedules the
+// device firmware can't express. Devices are resolved by Lookup when a job
+// runs; without one, targets are taken to be device hosts. Pending jobs are
+// kept in Store, if set, so they survive restarts.
+type Scheduler struct {
+	Lookup  func(target string) (*Device, error)
+	Store   JobStore
+	OnError func(Job, error)
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+	seq  int
+	wake chan struct{}
+}
+
+// NewScheduler returns a scheduler with the given store, which may be nil.
+func NewScheduler(store JobStore) *Scheduler {
+	return &Scheduler{Store: store, jobs: make(map[string]*Job), wake: make(chan struct{}, 1)}
+}
+
+// Load restores the jobs kept in the store. One-off jobs that fell due while
+// the scheduler wasn't running are run on the next tick; recurring jobs resume
+// with their next occurrence.
+func (s *Scheduler) Load() error {
+	if s.Store == nil {
+		return nil
+	}
+	jobs, err := s.Store.Load()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for i := range jobs {
+		job := jobs[i]
+		if job.Schedule != "" && job.Next.Before(now) {
+			if job.Next, err = job.next(now); err != nil {
+				return fmt.Errorf("job %s: %s", job.ID, err)
+			}
+		}
+		s.jobs[job.ID] = &job
+	}
+	s.notify()
+	return nil
+}
+
+// Add schedules a job, assigning it an ID when it has none, and returns the ID.
+func (s *Scheduler) Add(job Job) (string, error) {
+	if err := job.Command.Validate(); err != nil {
+		return "", err
+	}
+	if job.Target == "" {
+		return "", errors.New("job has no target")
+	}
+
+	next, err := job.next(time.Now())
+	if err != nil {
+		return "", err
+	}
+	job.Next = next
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.ID == "" {
+		for {
+			s.seq++
+			job.ID = fmt.Sprintf("job-%d", s.seq)
+			if _, exists := s.jobs[job.ID]; !exists {
+				break
+			}
+		}
+	}
+	s.jobs[job.ID] = &job
+	s.notify()
+
+	return job.ID, s.save()
+}
+
+// Remove cancels a job.
+func (s *Scheduler) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[id]; !ok {
+		return fmt.Errorf("no job %s", id)
+	}
+	delete(s.jobs, id)
+	s.notify()
+
+	return s.save()
+}
+
+// Jobs returns the pending jobs ordered by their next run.
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+func (s *Scheduler) list() []Job {
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Next.Equal(jobs[j].Next) {
+			return jobs[i].ID < jobs[j].ID
+		}
+		return jobs[i].Next.Before(jobs[j].Next)
+	})
+	return jobs
+}
+
+// save must be called with s.mu held.
+func (s *Scheduler) save() error {
+	if s.Store == nil {
+		return nil
+	}
+	return s.Store.Save(s.list())
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run executes jobs as they fall due until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		var next time.Time
+		for _, job := range s.jobs {
+			if next.IsZero() || job.Next.Before(next) {
+				next = job.Next
+			}
+		}
+		s.mu.Unlock()
+
+		wait := time.Hour
+		if !next.IsZero() {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+			s.runDue(ctx, time.Now())
+		}
+	}
+}
+
+// runDue runs every job due at now and reschedules or drops it.
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	var due []Job
+	for id, job := range s.jobs {
+		if job.Next.After(now) {
+			continue
+		}
+		due = append(due, *job)
+
+		if job.Schedule == "" {
+			delete(s.jobs, id)
+			continue
+		}
+		next, err := job.next(now)
+		if err != nil {
+			delete(s.jobs, id)
+			continue
+		}
+		job.Next = next
+	}
+	err := s.save()
+	s.mu.Unlock()
+
+	if err != nil && s.OnError != nil {
+		s.OnError(Job{}, fmt.Errorf("unable to save jobs => %s", err))
+	}
+
+	for _, job := range due {
+		if err := s.run(ctx, job); err != nil && s.OnError != nil {
+			s.OnError(job, err)
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, job Job) error {
+	device := &Device{Host: job.Target}
+	if s.Lookup != nil {
+		var err error
+		if device, err = s.Lookup(job.Target); err != nil {
+			return err
+		}
+	}
+	return job.Command.Run(ctx, device)
+}
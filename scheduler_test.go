@@ -0,0 +1,144 @@
+package wemo
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	tests := []struct {
+		spec     string
+		from     time.Time
+		expected time.Time
+	}{
+		{"30 7 * * mon-fri", time.Date(2020, 6, 5, 8, 0, 0, 0, berlin), time.Date(2020, 6, 8, 7, 30, 0, 0, berlin)},
+		{"*/15 * * * *", time.Date(2020, 6, 5, 8, 7, 12, 0, berlin), time.Date(2020, 6, 5, 8, 15, 0, 0, berlin)},
+		{"@daily", time.Date(2020, 12, 31, 23, 59, 0, 0, berlin), time.Date(2021, 1, 1, 0, 0, 0, 0, berlin)},
+		{"0 12 1 * sun", time.Date(2020, 6, 1, 13, 0, 0, 0, berlin), time.Date(2020, 6, 7, 12, 0, 0, 0, berlin)},
+		{"0 22 * jan,dec 7", time.Date(2020, 6, 1, 0, 0, 0, 0, berlin), time.Date(2020, 12, 6, 22, 0, 0, 0, berlin)},
+		{"0 0 30 2 *", time.Date(2020, 6, 1, 0, 0, 0, 0, berlin), time.Time{}},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseSchedule(test.spec)
+		if err != nil {
+			t.Errorf("%s: %s", test.spec, err)
+			continue
+		}
+		actual := schedule.Next(test.from, berlin)
+		if !actual.Equal(test.expected) {
+			t.Errorf("%s: Expected: %v, got: %v", test.spec, test.expected, actual)
+		}
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * * * funday", "5-1 * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("%s: Expected: an error", spec)
+		}
+	}
+}
+
+func TestSchedulerRunsAndPersistsJobs(t *testing.T) {
+	states := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		value, _ := responseValue(body, "BinaryState")
+		states <- value
+		w.Write([]byte(testMessageHeader + `<u:SetBinaryStateResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>` + value + `</BinaryState></u:SetBinaryStateResponse>` + testMessageFooter))
+	}))
+	defer server.Close()
+
+	store := FileJobStore(filepath.Join(t.TempDir(), "jobs.json"))
+	s := NewScheduler(store)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	if _, err := s.Add(Job{Target: host, Command: Command{Action: CommandOn}, At: time.Now().Add(50 * time.Millisecond)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(Job{Target: host, Command: Command{Action: CommandOff}, Schedule: "0 3 * * *", Timezone: "UTC"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a fresh scheduler picks the pending jobs up from the store
+	restored := NewScheduler(store)
+	if err := restored.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if jobs := restored.Jobs(); len(jobs) != 2 || jobs[0].Command.Action != CommandOn {
+		t.Fatalf("Expected: 2 jobs, the one-off first, got: %+v", jobs)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go restored.Run(ctx)
+
+	select {
+	case state := <-states:
+		if state != "1" {
+			t.Errorf("Expected: state 1, got: %s", state)
+		}
+	case <-ctx.Done():
+		t.Fatal("Expected: the one-off job to run")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	jobs, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Schedule != "0 3 * * *" {
+		t.Errorf("Expected: only the recurring job to be left, got: %+v", jobs)
+	}
+}
+
+func TestFileJobStoreFormat(t *testing.T) {
+	store := FileJobStore(filepath.Join(t.TempDir(), "jobs.json"))
+	data := `[{"id":"1","target":"bridge","command":{"action":"bulb","bulb_id":"94103EA2B27803ED","bulb_cmd":"dim","value":"128"},"schedule":"0 7 * * *","at":"0001-01-01T00:00:00Z","next":"2024-01-01T07:00:00Z"}]`
+	if err := ioutil.WriteFile(string(store), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Command{Action: CommandBulb, BulbID: "94103EA2B27803ED", BulbCmd: "dim", Value: "128"}
+	if len(jobs) != 1 || jobs[0].Command != expected {
+		t.Errorf("Expected: %+v, got: %+v", expected, jobs)
+	}
+}
+
+func TestRunBulbCommandHonoursContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	device := &Device{Host: strings.TrimPrefix(server.URL, "http://")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	command := Command{Action: CommandBulb, BulbID: "94103EA2B27803ED", BulbCmd: "on"}
+	if err := command.Run(ctx, device); err == nil {
+		t.Error("Expected: the deadline to cut the command short")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected: the command to end with its context, took: %s", elapsed)
+	}
+}
@@ -0,0 +1,123 @@
+package wemo
+
+import (
+	"strings"
+	"time"
+)
+
+// Schemas of the JSON documents this package hands to other programs: the
+// REST API, "wemo --json" and webhooks. Every document names its schema in
+// its "schema" field.
+//
+// Within a version fields are only ever added, so consumers must ignore
+// fields they don't know. Renaming or removing a field, or changing its
+// meaning, makes a new version, e.g. "wemo.device/v2".
+const (
+	SchemaDevice  = "wemo.device/v1"
+	SchemaState   = "wemo.state/v1"
+	SchemaInsight = "wemo.insight/v1"
+)
+
+// DeviceDoc is the SchemaDevice document of a device.
+type DeviceDoc struct {
+	Schema          string            `json:"schema"`
+	Key             string            `json:"key"`
+	Name            string            `json:"name"`
+	Host            string            `json:"host"`
+	UDN             string            `json:"udn,omitempty"`
+	Serial          string            `json:"serial,omitempty"`
+	DeviceType      string            `json:"device-type"`
+	MAC             string            `json:"mac,omitempty"`
+	FirmwareVersion string            `json:"firmware-version,omitempty"`
+	Aliases         []string          `json:"aliases,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Capabilities    []string          `json:"capabilities"`
+	Health          string            `json:"health"`
+	LastSeen        *time.Time        `json:"last-seen,omitempty"`
+	State           *StateDoc         `json:"state,omitempty"`
+}
+
+// NewDeviceDoc returns the document of a registry entry.
+func NewDeviceDoc(entry ManagedDevice) DeviceDoc {
+	doc := DeviceDoc{
+		Schema:       SchemaDevice,
+		Key:          entry.Key,
+		Name:         entry.Name,
+		Host:         entry.Host,
+		UDN:          entry.UDN,
+		Serial:       entry.Serial,
+		DeviceType:   entry.DeviceType,
+		Aliases:      entry.Aliases,
+		Labels:       entry.Labels,
+		Capabilities: []string{},
+		Health:       entry.Health.String(),
+	}
+	if c := entry.Capabilities(); c != 0 {
+		doc.Capabilities = strings.Split(c.String(), ",")
+	}
+	if entry.Info != nil {
+		doc.MAC = entry.Info.MacAddress
+		doc.FirmwareVersion = entry.Info.FirmwareVersion
+	}
+	if !entry.LastSeen.IsZero() {
+		lastSeen := entry.LastSeen
+		doc.LastSeen = &lastSeen
+	}
+	return doc
+}
+
+// StateDoc is the SchemaState document of the state of a device.
+type StateDoc struct {
+	Schema     string                  `json:"schema"`
+	Key        string                  `json:"key"`
+	Time       time.Time               `json:"time"`
+	State      int                     `json:"state"` // 0 off, 1 on, 8 standby
+	On         bool                    `json:"on"`
+	Brightness *int                    `json:"brightness,omitempty"` // dimmers, in percent
+	Bulbs      map[string]BulbSnapshot `json:"bulbs,omitempty"`      // bridges, by end device id
+}
+
+// NewStateDoc returns the document of a state read at t.
+func NewStateDoc(key string, state DeviceSnapshot, t time.Time) StateDoc {
+	doc := StateDoc{Schema: SchemaState, Key: key, Time: t, State: state.State, On: state.State != 0, Bulbs: state.Bulbs}
+	if state.Brightness > 0 {
+		brightness := state.Brightness
+		doc.Brightness = &brightness
+	}
+	return doc
+}
+
+// InsightDoc is the SchemaInsight document of an Insight reading, in watts,
+// kWh and seconds.
+type InsightDoc struct {
+	Schema     string    `json:"schema"`
+	Key        string    `json:"key"`
+	Time       time.Time `json:"time"`
+	PowerW     float64   `json:"power-w"`
+	TodayKWh   float64   `json:"today-kwh"`
+	TotalKWh   float64   `json:"total-kwh"`
+	OnFor      int       `json:"on-for"`
+	OnToday    int       `json:"on-today"`
+	OnTotal    int       `json:"on-total"`
+	Signal     float64   `json:"signal"`
+	ThresholdW float64   `json:"threshold-w"`
+}
+
+// NewInsightDoc returns the document of a reading of the device with the
+// given key.
+func NewInsightDoc(key string, reading InsightReading) InsightDoc {
+	p := reading.Params
+	return InsightDoc{
+		Schema:     SchemaInsight,
+		Key:        key,
+		Time:       reading.Time,
+		PowerW:     p.PowerW(),
+		TodayKWh:   p.TodayKWh(),
+		TotalKWh:   p.TotalKWh(),
+		OnFor:      p.OnFor,
+		OnToday:    p.OnToday,
+		OnTotal:    p.OnTotal,
+		Signal:     p.WifiStrength,
+		ThresholdW: p.PowerThreshold / 1000,
+	}
+}
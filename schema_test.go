@@ -0,0 +1,56 @@
+package wemo
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// TestSchemaFields guards the v1 documents: fields may be added, but the
+// names of existing fields must not change.
+func TestSchemaFields(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	entry := ManagedDevice{Key: "uuid:Insight-1_0-A", Name: "Heater", Host: "10.0.0.2:49153", UDN: "uuid:Insight-1_0-A", DeviceType: Insight, LastSeen: at}
+	device := NewDeviceDoc(entry)
+	state := NewStateDoc(entry.Key, DeviceSnapshot{State: 8}, at)
+	device.State = &state
+	insight := NewInsightDoc(entry.Key, InsightReading{Time: at, Params: InsightParams{CurrentPower: 61250, TodayPower: 120e6, PowerThreshold: 8000}})
+
+	for _, test := range []struct {
+		doc    interface{}
+		fields []string
+	}{
+		{device, []string{"capabilities", "device-type", "health", "host", "key", "last-seen", "name", "schema", "state", "udn"}},
+		{state, []string{"key", "on", "schema", "state", "time"}},
+		{insight, []string{"key", "on-for", "on-today", "on-total", "power-w", "schema", "signal", "threshold-w", "time", "today-kwh", "total-kwh"}},
+	} {
+		data, err := json.Marshal(test.doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		var fields []string
+		for field := range decoded {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("Expected: %v, got: %v", test.fields, fields)
+		}
+	}
+
+	if device.Schema != SchemaDevice || !reflect.DeepEqual(device.Capabilities, []string{"switch", "insight"}) {
+		t.Errorf("Unexpected device: %+v", device)
+	}
+	if state.Schema != SchemaState || !state.On {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+	if insight.Schema != SchemaInsight || insight.PowerW != 61.25 || insight.TodayKWh != 2 || insight.ThresholdW != 8 {
+		t.Errorf("Unexpected insight: %+v", insight)
+	}
+}
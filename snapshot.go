@@ -0,0 +1,253 @@
+package wemo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// BulbSnapshot is the state of a bridge bulb.
+type BulbSnapshot struct {
+	On    bool `json:"on"`
+	Level int  `json:"level"` // 0-255
+}
+
+// DeviceSnapshot is the state of a device. Bridges only have bulbs.
+type DeviceSnapshot struct {
+	State      int                     `json:"state"`
+	Brightness int                     `json:"brightness,omitempty"` // dimmers, in percent
+	Bulbs      map[string]BulbSnapshot `json:"bulbs,omitempty"`      // by end device id
+}
+
+// Snapshot is the state of a set of devices, see Manager.Snapshot. It can be
+// saved as JSON, e.g. to keep scenes.
+type Snapshot struct {
+	Taken   time.Time                 `json:"taken"`
+	Devices map[string]DeviceSnapshot `json:"devices"` // by device key
+}
+
+// Snapshot captures the state of the devices matching the selector: switch
+// states, dimmer brightness and bulbs. It returns the errors of the devices
+// that couldn't be read, which are left out of the snapshot, by device key.
+func (m *Manager) Snapshot(ctx context.Context, selector Selector) (*Snapshot, map[string]error) {
+	snapshot := &Snapshot{Taken: time.Now(), Devices: make(map[string]DeviceSnapshot)}
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	m.forEach(selector, func(entry ManagedDevice) {
+		var state DeviceSnapshot
+		err := m.serialize(ctx, entry.Key, func(device *Device) (err error) {
+			state, err = snapshotDevice(ctx, device, entry)
+			return err
+		})
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs[entry.Key] = err
+			return
+		}
+		snapshot.Devices[entry.Key] = state
+	})
+	return snapshot, errs
+}
+
+// State reads the state of a single device the way Snapshot does.
+func (m *Manager) State(ctx context.Context, key string) (DeviceSnapshot, error) {
+	entry, ok := m.Get(key)
+	if !ok {
+		return DeviceSnapshot{}, fmt.Errorf("unknown device %s", key)
+	}
+	var state DeviceSnapshot
+	err := m.serialize(ctx, key, func(device *Device) (err error) {
+		state, err = snapshotDevice(ctx, device, entry)
+		return err
+	})
+	return state, err
+}
+
+func snapshotDevice(ctx context.Context, device *Device, entry ManagedDevice) (DeviceSnapshot, error) {
+	var snapshot DeviceSnapshot
+	var err error
+
+	if !entry.Capabilities().Has(CapBulbs) {
+		if snapshot.State, err = device.FetchBinaryState(ctx); err != nil {
+			return snapshot, err
+		}
+		if entry.Capabilities().Has(CapDim) {
+			snapshot.Brightness, err = device.FetchBrightness(ctx)
+		}
+		return snapshot, err
+	}
+
+	info := entry.Info
+	if info == nil {
+		if info, err = device.FetchDeviceInfo(ctx); err != nil {
+			return snapshot, err
+		}
+	}
+	var ids []string
+	for _, end := range info.EndDevices.EndDeviceInfo {
+		ids = append(ids, end.DeviceID)
+	}
+	if len(ids) == 0 {
+		return snapshot, nil
+	}
+
+	status, err := device.FetchBulbStatus(ctx, strings.Join(ids, ","))
+	if err != nil {
+		return snapshot, err
+	}
+	snapshot.Bulbs = make(map[string]BulbSnapshot)
+	for id, value := range status {
+		bulb, err := parseBulbStatus(value)
+		if err != nil {
+			return snapshot, fmt.Errorf("bulb %s: %s", id, err)
+		}
+		snapshot.Bulbs[id] = bulb
+	}
+	return snapshot, nil
+}
+
+// parseBulbStatus parses the capability values of a bulb, which start with
+// its on/off state and its level, e.g. "1,255:0,,".
+func parseBulbStatus(value string) (BulbSnapshot, error) {
+	var bulb BulbSnapshot
+	fields := strings.Split(value, ",")
+	bulb.On = fields[0] == "1"
+	if len(fields) < 2 {
+		return bulb, nil
+	}
+	if level := strings.SplitN(fields[1], ":", 2)[0]; level != "" {
+		level, err := strconv.Atoi(level)
+		if err != nil {
+			return bulb, fmt.Errorf("Failed to parse bulb status %q", value)
+		}
+		bulb.Level = level
+	}
+	return bulb, nil
+}
+
+// Restore puts the devices of the snapshot back into their captured state. It
+// returns the errors of the devices that couldn't be restored by device key,
+// or nil when all were.
+func (m *Manager) Restore(ctx context.Context, snapshot *Snapshot) map[string]error {
+	var mu sync.Mutex
+	var errs map[string]error
+	var g errgroup.Group
+	g.SetLimit(m.parallelism())
+	for key, state := range snapshot.Devices {
+		key, state := key, state
+		g.Go(func() error {
+			err := m.restoreDevice(ctx, key, state)
+			if err != nil {
+				mu.Lock()
+				if errs == nil {
+					errs = make(map[string]error)
+				}
+				errs[key] = err
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	g.Wait()
+	return errs
+}
+
+func (m *Manager) restoreDevice(ctx context.Context, key string, state DeviceSnapshot) error {
+	entry, ok := m.Get(key)
+	if !ok {
+		return fmt.Errorf("unknown device %s", key)
+	}
+
+	if entry.Capabilities().Has(CapBulbs) {
+		return m.serialize(ctx, key, func(device *Device) error { return restoreBulbs(ctx, device, state.Bulbs) })
+	}
+	if !entry.Capabilities().Has(CapDim) || state.State == 0 || state.Brightness <= 0 {
+		return m.setBinaryState(ctx, key, state.State != 0)
+	}
+
+	err := m.serialize(ctx, key, func(device *Device) error { return device.SetBrightness(ctx, state.Brightness) })
+	if err == nil {
+		m.recordBinaryState(key, state.State, SourceCommand)
+	}
+	return err
+}
+
+func restoreBulbs(ctx context.Context, device *Device, bulbs map[string]BulbSnapshot) error {
+	for id, bulb := range bulbs {
+		if !bulb.On {
+			if err := device.SetBulb(ctx, id, "off", "", false); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := device.SetBulb(ctx, id, "on", "", false); err != nil {
+			return err
+		}
+		if err := device.SetBulb(ctx, id, "dim", strconv.Itoa(bulb.Level), false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetScene keeps a snapshot under a name, e.g. "normal" to go back to after
+// "movie". Scenes are part of the exported configuration, see Export.
+func (m *Manager) SetScene(name string, snapshot *Snapshot) error {
+	if name == "" {
+		return errors.New("scene has no name")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.scenes == nil {
+		m.scenes = make(map[string]*Snapshot)
+	}
+	m.scenes[name] = snapshot
+	return nil
+}
+
+// Scene returns the snapshot kept under name.
+func (m *Manager) Scene(name string) (*Snapshot, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	scene, ok := m.scenes[name]
+	return scene, ok
+}
+
+// RemoveScene forgets a scene, reporting whether it existed.
+func (m *Manager) RemoveScene(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.scenes[name]
+	delete(m.scenes, name)
+	return ok
+}
+
+// forEach runs fn for the devices matching the selector, on up to Parallelism
+// devices at once.
+func (m *Manager) forEach(selector Selector, fn func(ManagedDevice)) {
+	var g errgroup.Group
+	g.SetLimit(m.parallelism())
+	for _, entry := range m.Select(selector) {
+		entry := entry
+		g.Go(func() error {
+			fn(entry)
+			return nil
+		})
+	}
+	g.Wait()
+}
+
+func (m *Manager) parallelism() int {
+	if m.Parallelism <= 0 {
+		return DefaultParallelism
+	}
+	return m.Parallelism
+}
@@ -0,0 +1,66 @@
+package wemo
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSnapshotAndRestore(t *testing.T) {
+	plug := newFakeDevice(t, "uuid:Socket-1_0-A", "Plug", "A")
+	defer plug.Close()
+	dimmer := newFakeDevice(t, "uuid:Dimmer-1_0-B", "Dimmer", "B")
+	dimmer.deviceType = Dimmer
+	defer dimmer.Close()
+	bridge := newFakeDevice(t, "uuid:Bridge-1_0-C", "Bridge", "C")
+	bridge.deviceType = Bridge
+	defer bridge.Close()
+
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Plug", Host: plug.host(), UDN: plug.udn, DeviceType: Controllee})
+	m.Put(ManagedDevice{Name: "Dimmer", Host: dimmer.host(), UDN: dimmer.udn, DeviceType: Dimmer})
+	m.Put(ManagedDevice{Name: "Bridge", Host: bridge.host(), UDN: bridge.udn, DeviceType: Bridge, Info: &DeviceInfo{
+		EndDevices: EndDevices{EndDeviceInfo: []EndDeviceInfo{{DeviceID: "94103EA2B27751AB"}, {DeviceID: "94103EA2B27751AC"}}},
+	}})
+	m.SetGroup(Group{Name: "all", Members: []GroupMember{
+		{Device: plug.udn},
+		{Device: dimmer.udn},
+		{Device: bridge.udn, Bulb: "94103EA2B27751AB"},
+	}})
+
+	ctx := context.Background()
+	if err := m.GroupSetLevel(ctx, "all", 60); err != nil {
+		t.Fatal(err)
+	}
+	bridge.bulbs["94103EA2B27751AC"] = "0"
+
+	snapshot, errs := m.Snapshot(ctx, nil)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if s := snapshot.Devices[plug.udn]; s.State != 1 {
+		t.Errorf("Expected: the plug on, got: %+v", s)
+	}
+	if s := snapshot.Devices[dimmer.udn]; s.State != 1 || s.Brightness != 60 {
+		t.Errorf("Expected: the dimmer at 60, got: %+v", s)
+	}
+	bulbs := snapshot.Devices[bridge.udn].Bulbs
+	if bulbs["94103EA2B27751AB"] != (BulbSnapshot{On: true, Level: 153}) || bulbs["94103EA2B27751AC"].On {
+		t.Errorf("Expected: one bulb at 153 and one off, got: %+v", bulbs)
+	}
+
+	// movie mode, then back to normal
+	if err := m.GroupOff(ctx, "all"); err != nil {
+		t.Fatal(err)
+	}
+	if errs := m.Restore(ctx, snapshot); errs != nil {
+		t.Fatal(errs)
+	}
+	if plug.state != "1" || dimmer.state != "1" || dimmer.brightness != "60" || bridge.bulbs["94103EA2B27751AB"] != "153" || bridge.bulbs["94103EA2B27751AC"] != "0" {
+		t.Errorf("Expected: everything restored, got: %s, %s at %s, %v", plug.state, dimmer.state, dimmer.brightness, bridge.bulbs)
+	}
+
+	snapshot.Devices["uuid:nowhere"] = DeviceSnapshot{State: 1}
+	if errs := m.Restore(ctx, snapshot); errs["uuid:nowhere"] == nil {
+		t.Errorf("Expected: an unknown device, got: %v", errs)
+	}
+}
@@ -0,0 +1,146 @@
+package wemo
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultStateTTL is how long the Manager serves a cached state when
+// Manager.StateTTL is not set.
+const DefaultStateTTL = 5 * time.Second
+
+// cachedState is the last known state of a device.
+type cachedState struct {
+	binary    int
+	binaryAt  time.Time
+	insight   *InsightParams
+	insightAt time.Time
+}
+
+func (m *Manager) stateTTL() time.Duration {
+	return durationOr(m.StateTTL, DefaultStateTTL)
+}
+
+func (m *Manager) device(key string) (*Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entry, ok := m.devices[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown device %s", key)
+	}
+	return entry.Device(), nil
+}
+
+// BinaryState returns the binary state of a device, from the cache when it was
+// fetched or reported within the TTL.
+func (m *Manager) BinaryState(ctx context.Context, key string) (int, error) {
+	m.mu.RLock()
+	cached, ok := m.states[key]
+	if ok && !cached.binaryAt.IsZero() && time.Since(cached.binaryAt) < m.stateTTL() {
+		state := cached.binary
+		m.mu.RUnlock()
+		return state, nil
+	}
+	m.mu.RUnlock()
+
+	var state int
+	err := m.serialize(ctx, key, func(device *Device) (err error) {
+		state, err = device.FetchBinaryState(ctx)
+		return err
+	})
+	if err != nil {
+		return -1, err
+	}
+	m.recordBinaryState(key, state, SourcePoll)
+	return state, nil
+}
+
+// InsightParams returns the Insight parameters of a device, from the cache
+// when they were fetched within the TTL.
+func (m *Manager) InsightParams(ctx context.Context, key string) (*InsightParams, error) {
+	m.mu.RLock()
+	cached, ok := m.states[key]
+	if ok && cached.insight != nil && time.Since(cached.insightAt) < m.stateTTL() {
+		params := *cached.insight
+		m.mu.RUnlock()
+		return &params, nil
+	}
+	m.mu.RUnlock()
+
+	var params *InsightParams
+	err := m.serialize(ctx, key, func(device *Device) (err error) {
+		params, err = device.FetchInsightParams(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	state := m.cachedState(key)
+	copied := *params
+	state.insight, state.insightAt = &copied, time.Now()
+	m.mu.Unlock()
+	return params, nil
+}
+
+// UpdateBinaryState records a state the device reported by other means, e.g.
+// an event, see also HandleEvent.
+func (m *Manager) UpdateBinaryState(key string, state int) {
+	m.recordBinaryState(key, state, SourceEvent)
+}
+
+// Invalidate drops the cached state of a device, so the next read fetches it.
+func (m *Manager) Invalidate(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, key)
+}
+
+// cachedState must be called with m.mu held.
+func (m *Manager) cachedState(key string) *cachedState {
+	if m.states == nil {
+		m.states = make(map[string]*cachedState)
+	}
+	state, ok := m.states[key]
+	if !ok {
+		state = &cachedState{}
+		m.states[key] = state
+	}
+	return state
+}
+
+// PollStates refreshes the binary states that are about to expire every
+// interval until ctx is done, so reads keep being served from the cache
+// without waiting on the devices. The interval should be shorter than the TTL.
+func (m *Manager) PollStates(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, entry := range m.List() {
+			m.mu.RLock()
+			cached, ok := m.states[entry.Key]
+			fresh := ok && !cached.binaryAt.IsZero() && time.Since(cached.binaryAt)+interval < m.stateTTL()
+			m.mu.RUnlock()
+			if fresh {
+				continue
+			}
+			var state int
+			err := m.serialize(ctx, entry.Key, func(device *Device) (err error) {
+				state, err = device.FetchBinaryState(ctx)
+				return err
+			})
+			if err == nil {
+				m.recordBinaryState(entry.Key, state, SourcePoll)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
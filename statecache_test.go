@@ -0,0 +1,48 @@
+package wemo
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStateCache(t *testing.T) {
+	porch := newFakeDevice(t, "uuid:Socket-1_0-A", "Porch", "A")
+	defer porch.Close()
+
+	m := NewManager()
+	m.StateTTL = time.Hour
+	m.Put(ManagedDevice{Name: "Porch", Host: porch.host(), UDN: porch.udn})
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		state, err := m.BinaryState(ctx, porch.udn)
+		if err != nil || state != 0 {
+			t.Fatalf("Expected: 0, got: %d, %v", state, err)
+		}
+	}
+	if porch.calls["GetBinaryState"] != 1 {
+		t.Errorf("Expected: a single fetch, got: %d", porch.calls["GetBinaryState"])
+	}
+
+	// an event reports the new state
+	m.UpdateBinaryState(porch.udn, 1)
+	if state, _ := m.BinaryState(ctx, porch.udn); state != 1 || porch.calls["GetBinaryState"] != 1 {
+		t.Errorf("Expected: 1 from the cache, got: %d after %d fetches", state, porch.calls["GetBinaryState"])
+	}
+
+	m.Invalidate(porch.udn)
+	if state, _ := m.BinaryState(ctx, porch.udn); state != 0 || porch.calls["GetBinaryState"] != 2 {
+		t.Errorf("Expected: 0 fetched again, got: %d after %d fetches", state, porch.calls["GetBinaryState"])
+	}
+
+	m.StateTTL = time.Nanosecond
+	m.BinaryState(ctx, porch.udn)
+	if porch.calls["GetBinaryState"] != 3 {
+		t.Errorf("Expected: the expired state to be fetched, got: %d fetches", porch.calls["GetBinaryState"])
+	}
+
+	if _, err := m.BinaryState(ctx, "uuid:nowhere"); err == nil {
+		t.Errorf("Expected: an unknown device")
+	}
+}
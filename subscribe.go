@@ -24,6 +24,8 @@ import (
 	"time"
 
 	"context"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 //SubscriptionInfo struct
@@ -116,6 +118,11 @@ func (d *Device) ManageSubscription(listenerAddress string, timeout int, subscri
 
 			// Resubscribe
 			_, err = d.ReSubscribe(id, address, timeout)
+			var renewErr error
+			if err != 200 {
+				renewErr = fmt.Errorf("%s", statusMessage("Resubscription", d.Host, err))
+			}
+			metrics().SubscriptionRenewed(d.Host, renewErr)
 			if err != 200 {
 
 				// Failed to resubscribe so try unsubscribe, it is likely to fail but don't care.
@@ -261,7 +268,11 @@ func statusMessage(action, host string, statusCode int) string {
 	}
 }
 
-func emitEvent(r *http.Request, cs chan SubscriptionEvent) error {
+func emitEvent(r *http.Request, cs chan SubscriptionEvent) (err error) {
+	_, span := startSpan(r.Context(), "wemo event", trace.SpanKindServer,
+		AttrDevice.String(r.RemoteAddr), AttrSID.String(r.Header.Get("Sid")))
+	defer func() { endSpan(span, err) }()
+
 	body, err := ioutil.ReadAll(r.Body)
 
 	if err == nil {
@@ -0,0 +1,196 @@
+package wemo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Rate is the price of energy during a window of the day. Windows whose End is
+// before their Start wrap past midnight (e.g. 22:00-06:00). Days restricts the
+// rate to the given weekdays; an empty Days applies every day.
+type Rate struct {
+	Name  string
+	Start time.Duration // offset from midnight
+	End   time.Duration // offset from midnight
+	Days  []time.Weekday
+	Price float64 // per kWh
+}
+
+func (r Rate) applies(t time.Time) bool {
+	if len(r.Days) > 0 {
+		found := false
+		for _, day := range r.Days {
+			if day == t.Weekday() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	offset := sinceMidnight(t)
+	if r.Start <= r.End {
+		return offset >= r.Start && offset < r.End
+	}
+	return offset >= r.Start || offset < r.End
+}
+
+// Tariff describes a time-of-use electricity plan. The first matching rate
+// wins; DefaultPrice applies when no rate matches.
+type Tariff struct {
+	Currency     string
+	Location     *time.Location // nil uses time.Local
+	DefaultPrice float64        // per kWh
+	Rates        []Rate
+}
+
+// Validate checks that rate windows lie within a day and prices are sane.
+func (t *Tariff) Validate() error {
+	if t.DefaultPrice < 0 {
+		return errors.New("tariff default price is negative")
+	}
+	for _, r := range t.Rates {
+		if r.Start < 0 || r.Start >= 24*time.Hour || r.End < 0 || r.End > 24*time.Hour {
+			return fmt.Errorf("rate %q has a window outside of the day", r.Name)
+		}
+		if r.Start == r.End {
+			return fmt.Errorf("rate %q has an empty window", r.Name)
+		}
+		if r.Price < 0 {
+			return fmt.Errorf("rate %q has a negative price", r.Name)
+		}
+	}
+	return nil
+}
+
+func (t *Tariff) location() *time.Location {
+	if t.Location == nil {
+		return time.Local
+	}
+	return t.Location
+}
+
+// RateAt returns the name and price of the rate in effect at ts. The name is
+// empty when the default price applies.
+func (t *Tariff) RateAt(ts time.Time) (string, float64) {
+	i := t.rateAt(ts)
+	if i < 0 {
+		return "", t.DefaultPrice
+	}
+	return t.Rates[i].Name, t.Rates[i].Price
+}
+
+// rateAt returns the index of the rate in effect at ts, or -1 when the
+// default price applies.
+func (t *Tariff) rateAt(ts time.Time) int {
+	ts = ts.In(t.location())
+	for i, r := range t.Rates {
+		if r.applies(ts) {
+			return i
+		}
+	}
+	return -1
+}
+
+// nextChange returns the first instant after ts at which the rate in effect
+// may change: a rate boundary or midnight. Boundaries are wall clock times,
+// so they stay put on days the clocks change.
+func (t *Tariff) nextChange(ts time.Time) time.Time {
+	ts = ts.In(t.location())
+	y, m, d := ts.Date()
+	next := time.Date(y, m, d+1, 0, 0, 0, 0, ts.Location())
+	for _, r := range t.Rates {
+		for _, offset := range []time.Duration{r.Start, r.End} {
+			b := time.Date(y, m, d, 0, 0, 0, int(offset), ts.Location())
+			if b.After(ts) && b.Before(next) {
+				next = b
+			}
+		}
+	}
+	return next
+}
+
+// RateCost is the share of a CostSummary billed at a single rate.
+type RateCost struct {
+	Rate  string
+	Price float64
+	KWh   float64
+	Cost  float64
+}
+
+// CostSummary is the cost of the energy used over a period.
+type CostSummary struct {
+	Start    time.Time
+	End      time.Time
+	Currency string
+	KWh      float64
+	Cost     float64
+	Rates    []RateCost
+}
+
+// Cost prices the energy drawn between from and to according to the tariff,
+// integrating the power reported by readings and splitting it at every rate
+// boundary.
+func (t *Tariff) Cost(readings []InsightReading, from, to time.Time) CostSummary {
+	summary := CostSummary{Start: from, End: to, Currency: t.Currency}
+	byRate := make(map[int]*RateCost) // by index into Rates, -1 for the default
+
+	sorted := sortReadings(readings)
+	for i := 1; i < len(sorted); i++ {
+		prev, cur := sorted[i-1], sorted[i]
+		if cur.Time.Sub(prev.Time) > maxReadingGap || !cur.Time.After(prev.Time) {
+			continue
+		}
+
+		a, b := prev.Time, cur.Time
+		if a.Before(from) {
+			a = from
+		}
+		if b.After(to) {
+			b = to
+		}
+
+		for a.Before(b) {
+			end := t.nextChange(a)
+			if end.After(b) {
+				end = b
+			}
+
+			rate := t.rateAt(a)
+			name, price := "", t.DefaultPrice
+			if rate >= 0 {
+				name, price = t.Rates[rate].Name, t.Rates[rate].Price
+			}
+			kWh := energyBetween(prev, cur, a, end)
+			rc, ok := byRate[rate]
+			if !ok {
+				rc = &RateCost{Rate: name, Price: price}
+				byRate[rate] = rc
+			}
+			rc.KWh += kWh
+			rc.Cost += kWh * price
+			summary.KWh += kWh
+			summary.Cost += kWh * price
+
+			a = end
+		}
+	}
+
+	for i := -1; i < len(t.Rates); i++ {
+		if rc, ok := byRate[i]; ok {
+			summary.Rates = append(summary.Rates, *rc)
+		}
+	}
+	sort.SliceStable(summary.Rates, func(i, j int) bool { return summary.Rates[i].Rate < summary.Rates[j].Rate })
+
+	return summary
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+}
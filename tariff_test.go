@@ -0,0 +1,100 @@
+package wemo
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTariffCost(t *testing.T) {
+	tariff := &Tariff{
+		Currency:     "EUR",
+		Location:     time.UTC,
+		DefaultPrice: 0.30,
+		Rates: []Rate{
+			{Name: "off-peak", Start: 22 * time.Hour, End: 6 * time.Hour, Price: 0.10},
+		},
+	}
+	if err := tariff.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1 kW from 21:30 to 22:30, sampled every five minutes.
+	start := time.Date(2020, 6, 1, 21, 30, 0, 0, time.UTC)
+	var readings []InsightReading
+	for i := 0; i <= 12; i++ {
+		readings = append(readings, reading(start.Add(time.Duration(i)*5*time.Minute), 1000000))
+	}
+
+	summary := tariff.Cost(readings, start, start.Add(time.Hour))
+	if math.Abs(summary.KWh-1) > 1e-9 {
+		t.Errorf("Expected: 1 kWh, got: %v", summary.KWh)
+	}
+	if math.Abs(summary.Cost-0.20) > 1e-9 {
+		t.Errorf("Expected: 0.20 EUR, got: %v", summary.Cost)
+	}
+	if len(summary.Rates) != 2 || summary.Rates[0].Rate != "" || summary.Rates[1].Rate != "off-peak" {
+		t.Errorf("Expected: default and off-peak rates, got: %+v", summary.Rates)
+	}
+
+	// clipping to the requested period
+	summary = tariff.Cost(readings, start.Add(30*time.Minute), start.Add(2*time.Hour))
+	if math.Abs(summary.Cost-0.05) > 1e-9 {
+		t.Errorf("Expected: 0.05 EUR, got: %v", summary.Cost)
+	}
+}
+
+func TestTariffUnnamedRate(t *testing.T) {
+	tariff := &Tariff{
+		Location:     time.UTC,
+		DefaultPrice: 0.30,
+		Rates:        []Rate{{Start: 0, End: 6 * time.Hour, Price: 0.10}},
+	}
+
+	// 1 kW from 05:30 to 06:30
+	start := time.Date(2020, 6, 1, 5, 30, 0, 0, time.UTC)
+	var readings []InsightReading
+	for i := 0; i <= 12; i++ {
+		readings = append(readings, reading(start.Add(time.Duration(i)*5*time.Minute), 1000000))
+	}
+
+	summary := tariff.Cost(readings, start, start.Add(time.Hour))
+	if len(summary.Rates) != 2 || summary.Rates[0].Price != 0.30 || summary.Rates[1].Price != 0.10 {
+		t.Errorf("Expected: the default apart from the unnamed rate, got: %+v", summary.Rates)
+	}
+	if math.Abs(summary.Cost-0.20) > 1e-9 {
+		t.Errorf("Expected: 0.20, got: %v", summary.Cost)
+	}
+}
+
+func TestTariffDaylightSaving(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	tariff := &Tariff{
+		Location:     berlin,
+		DefaultPrice: 0.30,
+		Rates:        []Rate{{Name: "peak", Start: 7 * time.Hour, End: 9 * time.Hour, Price: 0.50}},
+	}
+
+	// the clocks go forward at 02:00 on 31 March 2024
+	for _, day := range []int{31, 27} {
+		ts := time.Date(2024, time.March, day, 0, 30, 0, 0, berlin)
+		if next := tariff.nextChange(ts); next.Hour() != 7 || next.Minute() != 0 {
+			t.Errorf("Expected: the peak to start at 07:00 on %d March, got: %s", day, next)
+		}
+	}
+	// and back at 03:00 on 27 October 2024
+	ts := time.Date(2024, time.October, 27, 8, 0, 0, 0, berlin)
+	if next := tariff.nextChange(ts); next.Hour() != 9 || next.Minute() != 0 {
+		t.Errorf("Expected: the peak to end at 09:00, got: %s", next)
+	}
+}
+
+func TestTariffValidate(t *testing.T) {
+	tariff := &Tariff{Rates: []Rate{{Name: "bad", Start: 25 * time.Hour, End: time.Hour}}}
+	if err := tariff.Validate(); err == nil {
+		t.Error("Expected: an error for a window outside of the day")
+	}
+}
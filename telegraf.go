@@ -0,0 +1,112 @@
+package wemo
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TelegrafSchemaVersion is the version of the TelegrafRecord fields, sent as
+// schema_version in every record. It changes only when fields are renamed or
+// removed; new fields may be added within a version.
+//
+// Version 1 has the tags key, name, host, type and label_<name> for each
+// registry label, and the fields up (0 or 1), state, and for Insights
+// power_w, today_kwh, total_kwh, on_for_s, on_today_s, on_total_s and signal.
+// Time is in Unix seconds.
+const TelegrafSchemaVersion = 1
+
+// TelegrafRecord is the state and the Insight readings of a device in a flat
+// JSON layout for Telegraf's json input format. A Telegraf exec input running
+// "wemo telegraf" reads them with
+//
+//	[[inputs.exec]]
+//	  commands = ["wemo telegraf --store /etc/wemo/devices.json"]
+//	  data_format = "json"
+//	  name_override = "wemo"
+//	  tag_keys = ["key", "name", "host", "type", "label_*"]
+//	  json_time_key = "time"
+//	  json_time_format = "unix"
+type TelegrafRecord struct {
+	SchemaVersion int               `json:"schema_version"`
+	Time          int64             `json:"time"`
+	Key           string            `json:"key"`
+	Name          string            `json:"name"`
+	Host          string            `json:"host"`
+	Type          string            `json:"type"`
+	Labels        map[string]string `json:"-"` // flattened to label_<name>
+	Up            int               `json:"up"`
+	State         *int              `json:"state,omitempty"`
+
+	PowerW   *float64 `json:"power_w,omitempty"`
+	TodayKWh *float64 `json:"today_kwh,omitempty"`
+	TotalKWh *float64 `json:"total_kwh,omitempty"`
+	OnFor    *int     `json:"on_for_s,omitempty"`
+	OnToday  *int     `json:"on_today_s,omitempty"`
+	OnTotal  *int     `json:"on_total_s,omitempty"`
+	Signal   *float64 `json:"signal,omitempty"`
+}
+
+// MarshalJSON flattens the labels into the record.
+func (r TelegrafRecord) MarshalJSON() ([]byte, error) {
+	type plain TelegrafRecord
+	data, err := json.Marshal(plain(r))
+	if err != nil || len(r.Labels) == 0 {
+		return data, err
+	}
+	record := make(map[string]interface{})
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	for name, value := range r.Labels {
+		record["label_"+name] = value
+	}
+	return json.Marshal(record)
+}
+
+// TelegrafRecords reads the devices matching the selector. Devices that don't
+// answer are reported with up 0.
+func (m *Manager) TelegrafRecords(ctx context.Context, selector Selector) []TelegrafRecord {
+	now := time.Now().Unix()
+	var mu sync.Mutex
+	var records []TelegrafRecord
+	m.forEach(selector, func(entry ManagedDevice) {
+		record := TelegrafRecord{
+			SchemaVersion: TelegrafSchemaVersion,
+			Time:          now,
+			Key:           entry.Key,
+			Name:          entry.Name,
+			Host:          entry.Host,
+			Type:          entry.DeviceType,
+			Labels:        entry.Labels,
+		}
+		if state, err := m.BinaryState(ctx, entry.Key); err == nil {
+			record.Up = 1
+			record.State = &state
+		}
+		if record.Up == 1 && entry.Capabilities().Has(CapInsight) {
+			if params, err := m.InsightParams(ctx, entry.Key); err == nil {
+				power, today, total := params.PowerW(), params.TodayKWh(), params.TotalKWh()
+				record.PowerW, record.TodayKWh, record.TotalKWh = &power, &today, &total
+				record.OnFor, record.OnToday, record.OnTotal = &params.OnFor, &params.OnToday, &params.OnTotal
+				record.Signal = &params.WifiStrength
+			}
+		}
+		mu.Lock()
+		records = append(records, record)
+		mu.Unlock()
+	})
+	sort.Slice(records, func(i, j int) bool { return records[i].Key < records[j].Key })
+	return records
+}
+
+// WriteTelegraf writes the records as a JSON array.
+func WriteTelegraf(w io.Writer, records []TelegrafRecord) error {
+	if records == nil {
+		records = []TelegrafRecord{}
+	}
+	return json.NewEncoder(w).Encode(records)
+}
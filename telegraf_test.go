@@ -0,0 +1,41 @@
+package wemo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestTelegrafRecords(t *testing.T) {
+	plug := newFakeDevice(t, "uuid:Socket-1_0-A", "Plug", "A")
+	defer plug.Close()
+
+	m := NewManager()
+	m.Put(ManagedDevice{Name: "Plug", Host: plug.host(), UDN: plug.udn, DeviceType: Controllee})
+	m.Put(ManagedDevice{Name: "Gone", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-B", DeviceType: Controllee})
+	m.SetLabel(plug.udn, "room", "kitchen")
+
+	records := m.TelegrafRecords(context.Background(), nil)
+	var buf bytes.Buffer
+	if err := WriteTelegraf(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 {
+		t.Fatalf("Expected: 2 records, got: %s", buf.String())
+	}
+	plugRecord, gone := decoded[0], decoded[1]
+	if plugRecord["schema_version"] != float64(TelegrafSchemaVersion) || plugRecord["label_room"] != "kitchen" || plugRecord["up"] != float64(1) || plugRecord["state"] != float64(0) {
+		t.Errorf("Unexpected record: %v", plugRecord)
+	}
+	if _, ok := plugRecord["power_w"]; ok {
+		t.Errorf("Expected: no Insight fields for a switch, got: %v", plugRecord)
+	}
+	if _, ok := gone["state"]; ok || gone["up"] != float64(0) {
+		t.Errorf("Unexpected record: %v", gone)
+	}
+}
@@ -0,0 +1,53 @@
+package wemo
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// SyncTime sets the clock and time zone of the device, which it needs to run
+// its rules at the right local time. The device only knows a UTC offset and
+// whether DST applies, so it is given the standard offset of loc and whether
+// loc observes DST and is currently in it. The Belkin app does this during
+// setup; the device keeps its clock in sync over NTP afterwards.
+func (d *Device) SyncTime(ctx context.Context, now time.Time, loc *time.Location) error {
+	if loc == nil {
+		loc = time.Local
+	}
+	standard, dstSupported, dst := timeZoneOf(now, loc)
+
+	b2i := func(b bool) string {
+		if b {
+			return "1"
+		}
+		return "0"
+	}
+	_, err := d.action(ctx, "timesync", "TimeSync",
+		actionArgument{"UTC", strconv.FormatInt(now.Unix(), 10)},
+		actionArgument{"TimeZone", strconv.FormatFloat(standard.Hours(), 'f', 2, 64)},
+		actionArgument{"dst", b2i(dst)},
+		actionArgument{"DstSupported", b2i(dstSupported)},
+	)
+	return err
+}
+
+// timeZoneOf returns the standard UTC offset of loc, whether it observes DST
+// and whether DST is in effect at now.
+func timeZoneOf(now time.Time, loc *time.Location) (standard time.Duration, dstSupported, dst bool) {
+	offset := func(t time.Time) time.Duration {
+		_, seconds := t.In(loc).Zone()
+		return time.Duration(seconds) * time.Second
+	}
+
+	year := now.In(loc).Year()
+	january := offset(time.Date(year, time.January, 1, 12, 0, 0, 0, time.UTC))
+	july := offset(time.Date(year, time.July, 1, 12, 0, 0, 0, time.UTC))
+
+	// DST moves the clock forward, in either hemisphere
+	standard = january
+	if july < january {
+		standard = july
+	}
+	return standard, january != july, offset(now) != standard
+}
@@ -0,0 +1,55 @@
+package wemo
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	sydney, err := time.LoadLocation("Australia/Sydney")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	var sent map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		sent = make(map[string]string)
+		for _, name := range []string{"UTC", "TimeZone", "dst", "DstSupported"} {
+			sent[name], _ = responseValue(body, name)
+		}
+		w.Write([]byte(testMessageHeader + `<u:TimeSyncResponse xmlns:u="urn:Belkin:service:timesync:1"></u:TimeSyncResponse>` + testMessageFooter))
+	}))
+	defer server.Close()
+	device := &Device{Host: strings.TrimPrefix(server.URL, "http://")}
+
+	tests := []struct {
+		now      time.Time
+		loc      *time.Location
+		expected map[string]string
+	}{
+		{time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC), newYork, map[string]string{"UTC": "1593604800", "TimeZone": "-5.00", "dst": "1", "DstSupported": "1"}},
+		{time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), newYork, map[string]string{"UTC": "1577880000", "TimeZone": "-5.00", "dst": "0", "DstSupported": "1"}},
+		{time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), sydney, map[string]string{"UTC": "1577880000", "TimeZone": "10.00", "dst": "1", "DstSupported": "1"}},
+		{time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), time.UTC, map[string]string{"UTC": "1577880000", "TimeZone": "0.00", "dst": "0", "DstSupported": "0"}},
+	}
+	for _, test := range tests {
+		if err := device.SyncTime(context.Background(), test.now, test.loc); err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range test.expected {
+			if sent[name] != value {
+				t.Errorf("%s %s: Expected: %s=%s, got: %s", test.loc, test.now, name, value, sent[name])
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package wemo
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Calls to devices, discovery and received events are traced with
+// OpenTelemetry through the global tracer provider, see otel.SetTracerProvider.
+// Without one the spans cost next to nothing.
+
+// Span attributes
+const (
+	AttrDevice     = attribute.Key("wemo.device") // host of the device
+	AttrService    = attribute.Key("wemo.service")
+	AttrAction     = attribute.Key("wemo.action")
+	AttrStatusCode = attribute.Key("http.status_code")
+	AttrFound      = attribute.Key("wemo.devices.found")
+	AttrSID        = attribute.Key("wemo.sid") // subscription of an event
+)
+
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/randohm/go.wemo")
+}
+
+func startSpan(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// endSpan records err, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
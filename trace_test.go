@@ -0,0 +1,49 @@
+package wemo
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestActionSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	plug := newFakeDevice(t, "uuid:Socket-1_0-A", "Plug", "A")
+	defer plug.Close()
+	device := &Device{Host: plug.host()}
+
+	ctx := context.Background()
+	if _, err := device.FetchBinaryState(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Device{Host: "127.0.0.1:1"}).FetchBinaryState(ctx); err == nil {
+		t.Fatal("Expected: an error")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected: 2 spans, got: %d", len(spans))
+	}
+	if spans[0].Name() != "wemo basicevent#GetBinaryState" || spans[0].Status().Code == codes.Error {
+		t.Errorf("Unexpected span: %s %v", spans[0].Name(), spans[0].Status())
+	}
+	attrs := make(map[string]string)
+	for _, attr := range spans[0].Attributes() {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if attrs["wemo.device"] != plug.host() || attrs["wemo.action"] != "GetBinaryState" || attrs["http.status_code"] != "200" {
+		t.Errorf("Unexpected attributes: %v", attrs)
+	}
+	if spans[1].Status().Code != codes.Error {
+		t.Errorf("Expected: the failed call to be an error, got: %v", spans[1].Status())
+	}
+}
@@ -0,0 +1,268 @@
+// Package wemoapi serves the devices of a wemo.Manager as a JSON REST API, so
+// clients in any language can drive them:
+//
+//	GET /devices                           list the devices
+//	GET /devices/{device}                  a device and its state
+//	GET /devices/{device}/state            the state
+//	PUT /devices/{device}/state            {"on": true} or {"level": 40}
+//	GET /devices/{device}/insight          Insight readings
+//	PUT /devices/{device}/bulbs/{bulb}     {"on": true} or {"level": 40}
+//	GET /telegraf?selector=room=kitchen    states for Telegraf, see wemo.TelegrafRecord
+//	GET /ws                                state changes over a WebSocket
+//	GET /events                            state changes as server-sent events
+//	POST /hook                             a command such as "turn porch on"
+//
+// Devices, states and Insight readings are the documents of wemo.SchemaDevice,
+// wemo.SchemaState and wemo.SchemaInsight. A device is named by its key or by
+// an alias. Errors are returned as {"error": "..."}.
+//
+// /hook is for services that can only POST to a URL, e.g. IFTTT. The command
+// is sent as ?command=, as a form or JSON "command" field, or as a plain text
+// body, and is one of "turn <device> on", "turn off <device>", "toggle
+// <device>" or "set <device> to <level>%".
+package wemoapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/randohm/go.wemo"
+)
+
+// Handler is an http.Handler for the REST API.
+type Handler struct {
+	Manager *wemo.Manager
+
+	// Token, if set, has to be sent as "Authorization: Bearer <token>". Browsers
+	// can't set headers on WebSockets and event sources, and webhook services
+	// often can't either, so /ws, /events and /hook also take it as ?token=.
+	Token string
+
+	// CheckOrigin decides whether a WebSocket may be opened from a page of
+	// another origin. By default only pages of the same host may.
+	CheckOrigin func(r *http.Request) bool
+
+	// Timeout bounds the device calls of a request, defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+// NewHandler returns a handler for the devices of m.
+func NewHandler(m *wemo.Manager, token string) *Handler {
+	return &Handler{Manager: m, Token: token}
+}
+
+// SetState is the body of a PUT to a state. Level takes precedence over On.
+type SetState struct {
+	On    *bool `json:"on,omitempty"`
+	Level *int  `json:"level,omitempty"` // percent
+}
+
+// httpError is an error with the status code it is reported with.
+type httpError struct {
+	code int
+	err  error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func errorf(code int, format string, args ...interface{}) error {
+	return &httpError{code, fmt.Errorf(format, args...)}
+}
+
+func (h *Handler) authorized(r *http.Request) bool {
+	if h.Token == "" {
+		return true
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if given == "" && (r.URL.Path == "/ws" || r.URL.Path == "/events" || r.URL.Path == "/hook") {
+		given = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(h.Token)) == 1
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="wemo"`)
+		writeError(w, errorf(http.StatusUnauthorized, "missing or wrong token"))
+		return
+	}
+
+	switch r.URL.Path {
+	case "/ws":
+		h.serveWebSocket(w, r)
+		return
+	case "/events":
+		h.serveEvents(w, r)
+		return
+	}
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	result, err := h.route(ctx, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) route(ctx context.Context, r *http.Request) (interface{}, error) {
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if path[0] == "hook" && len(path) == 1 {
+		return h.hook(ctx, r)
+	}
+	if path[0] == "telegraf" && len(path) == 1 && r.Method == http.MethodGet {
+		selector, err := wemo.ParseSelector(r.URL.Query().Get("selector"))
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "%s", err)
+		}
+		records := h.Manager.TelegrafRecords(ctx, selector)
+		if records == nil {
+			records = []wemo.TelegrafRecord{}
+		}
+		return records, nil
+	}
+	if path[0] != "devices" {
+		return nil, errorf(http.StatusNotFound, "no resource %s", r.URL.Path)
+	}
+	if len(path) == 1 {
+		if r.Method != http.MethodGet {
+			return nil, errorf(http.StatusMethodNotAllowed, "%s is not allowed", r.Method)
+		}
+		devices := []wemo.DeviceDoc{}
+		for _, entry := range h.Manager.List() {
+			devices = append(devices, wemo.NewDeviceDoc(entry))
+		}
+		return devices, nil
+	}
+
+	entry, err := h.device(path[1])
+	if err != nil {
+		return nil, err
+	}
+	resource := strings.Join(path[2:], "/")
+	switch {
+	case resource == "" && r.Method == http.MethodGet:
+		device := wemo.NewDeviceDoc(entry)
+		if state, err := h.state(ctx, entry.Key); err == nil {
+			device.State = &state
+		}
+		return device, nil
+
+	case resource == "state" && r.Method == http.MethodGet:
+		return h.state(ctx, entry.Key)
+
+	case resource == "state" && r.Method == http.MethodPut:
+		var set SetState
+		if err := decode(r, &set); err != nil {
+			return nil, err
+		}
+		switch {
+		case set.Level != nil:
+			err = h.Manager.SetLevel(ctx, entry.Key, *set.Level)
+		case set.On != nil:
+			err = h.Manager.SetBinaryState(ctx, entry.Key, *set.On)
+		default:
+			return nil, errorf(http.StatusBadRequest, "expected on or level")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return h.state(ctx, entry.Key)
+
+	case resource == "insight" && r.Method == http.MethodGet:
+		if !entry.Capabilities().Has(wemo.CapInsight) {
+			return nil, &wemo.UnsupportedError{Device: entry.Name, Needs: wemo.CapInsight}
+		}
+		params, err := h.Manager.InsightParams(ctx, entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		return wemo.NewInsightDoc(entry.Key, wemo.InsightReading{Host: entry.Host, Time: time.Now(), Params: *params}), nil
+
+	case len(path) == 4 && path[2] == "bulbs" && r.Method == http.MethodPut:
+		var set SetState
+		if err := decode(r, &set); err != nil {
+			return nil, err
+		}
+		level := 0
+		switch {
+		case set.Level != nil:
+			level = *set.Level
+		case set.On != nil && *set.On:
+			level = 100
+		case set.On == nil:
+			return nil, errorf(http.StatusBadRequest, "expected on or level")
+		}
+		if err := h.Manager.SetBulbLevel(ctx, entry.Key, path[3], level); err != nil {
+			return nil, err
+		}
+		return h.state(ctx, entry.Key)
+	}
+
+	return nil, errorf(http.StatusNotFound, "no resource %s %s", r.Method, r.URL.Path)
+}
+
+// device finds a device by its key or an alias, see Manager.Find.
+func (h *Handler) device(name string) (wemo.ManagedDevice, error) {
+	entry, err := h.Manager.Find(name)
+	switch {
+	case errors.Is(err, wemo.ErrUnknownDevice):
+		return entry, errorf(http.StatusNotFound, "%s", err)
+	case err != nil:
+		return entry, errorf(http.StatusBadRequest, "%s", err)
+	}
+	return entry, nil
+}
+
+func (h *Handler) state(ctx context.Context, key string) (wemo.StateDoc, error) {
+	state, err := h.Manager.State(ctx, key)
+	if err != nil {
+		return wemo.StateDoc{}, err
+	}
+	return wemo.NewStateDoc(key, state, time.Now()), nil
+}
+
+func decode(r *http.Request, set *SetState) error {
+	if err := json.NewDecoder(r.Body).Decode(set); err != nil {
+		return errorf(http.StatusBadRequest, "Failed to parse request => %s", err)
+	}
+	if set.Level != nil && (*set.Level < 0 || *set.Level > 100) {
+		return errorf(http.StatusBadRequest, "level %d is out of bounds 0-100", *set.Level)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusBadGateway // the device failed
+	var herr *httpError
+	var unsupported *wemo.UnsupportedError
+	switch {
+	case errors.As(err, &herr):
+		code = herr.code
+	case errors.As(err, &unsupported):
+		code = http.StatusUnprocessableEntity
+	case errors.Is(err, context.DeadlineExceeded):
+		code = http.StatusGatewayTimeout
+	}
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,97 @@
+package wemoapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+const envelope = `<?xml version="1.0" encoding="utf-8"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>%s</s:Body></s:Envelope>`
+
+// newSocket returns a fake switch, which keeps its binary state.
+func newSocket() *httptest.Server {
+	var mu sync.Mutex
+	state := "0"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.Contains(string(body), "<u:SetBinaryState "):
+			state = "1"
+			if strings.Contains(string(body), "<BinaryState>0</BinaryState>") {
+				state = "0"
+			}
+			fmt.Fprintf(w, envelope, `<u:SetBinaryStateResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>`+state+`</BinaryState></u:SetBinaryStateResponse>`)
+		case strings.Contains(string(body), "<u:GetBinaryState "):
+			fmt.Fprintf(w, envelope, `<u:GetBinaryStateResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>`+state+`</BinaryState></u:GetBinaryStateResponse>`)
+		}
+	}))
+}
+
+func TestHandler(t *testing.T) {
+	socket := newSocket()
+	defer socket.Close()
+
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Porch", Host: strings.TrimPrefix(socket.URL, "http://"), UDN: "uuid:Socket-1_0-A", DeviceType: wemo.Controllee})
+	m.SetAlias("uuid:Socket-1_0-A", "porch")
+
+	server := httptest.NewServer(NewHandler(m, "secret"))
+	defer server.Close()
+
+	do := func(method, path, body, token string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	if code, _ := do("GET", "/devices", "", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Expected: %d, got: %d", http.StatusUnauthorized, code)
+	}
+
+	code, body := do("GET", "/devices", "", "secret")
+	var devices []wemo.DeviceDoc
+	if err := json.Unmarshal([]byte(body), &devices); err != nil || code != http.StatusOK {
+		t.Fatalf("Unexpected response %d: %s", code, body)
+	}
+	if len(devices) != 1 || devices[0].Schema != wemo.SchemaDevice || devices[0].Name != "Porch" || devices[0].Capabilities[0] != "switch" {
+		t.Errorf("Unexpected devices: %+v", devices)
+	}
+
+	code, body = do("PUT", "/devices/porch/state", `{"on": true}`, "secret")
+	if code != http.StatusOK || !strings.Contains(body, `"schema":"wemo.state/v1"`) || !strings.Contains(body, `"state":1`) {
+		t.Errorf("Unexpected response %d: %s", code, body)
+	}
+
+	code, body = do("GET", "/devices/uuid:Socket-1_0-A/state", "", "secret")
+	if code != http.StatusOK || !strings.Contains(body, `"state":1`) {
+		t.Errorf("Unexpected response %d: %s", code, body)
+	}
+
+	if code, body = do("PUT", "/devices/porch/state", `{"level": 140}`, "secret"); code != http.StatusBadRequest {
+		t.Errorf("Unexpected response %d: %s", code, body)
+	}
+	if code, body = do("GET", "/devices/porch/insight", "", "secret"); code != http.StatusUnprocessableEntity {
+		t.Errorf("Unexpected response %d: %s", code, body)
+	}
+	if code, body = do("GET", "/devices/garage", "", "secret"); code != http.StatusNotFound || !strings.Contains(body, `"error"`) {
+		t.Errorf("Unexpected response %d: %s", code, body)
+	}
+}
@@ -0,0 +1,119 @@
+package wemoapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hookCommand is a command understood by /hook.
+type hookCommand struct {
+	device string
+	action string // on, off, toggle or level
+	level  int
+}
+
+var (
+	turnRE   = regexp.MustCompile(`^(?:turn|switch) (?:(on|off) (.+)|(.+) (on|off))$`)
+	toggleRE = regexp.MustCompile(`^toggle (.+)$`)
+	levelRE  = regexp.MustCompile(`^(?:set|dim) (.+?)(?: level)?(?: to)? (\d+) ?%?$`)
+)
+
+// parseHook parses a command such as "turn porch on", "turn off the porch",
+// "toggle porch" or "set porch to 40%".
+func parseHook(text string) (hookCommand, error) {
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	text = strings.TrimRight(text, ".!")
+	unquote := func(device string) string {
+		device = strings.TrimPrefix(device, "the ")
+		return strings.Trim(device, `"'`)
+	}
+
+	if m := turnRE.FindStringSubmatch(text); m != nil {
+		if m[1] != "" {
+			return hookCommand{device: unquote(m[2]), action: m[1]}, nil
+		}
+		return hookCommand{device: unquote(m[3]), action: m[4]}, nil
+	}
+	if m := toggleRE.FindStringSubmatch(text); m != nil {
+		return hookCommand{device: unquote(m[1]), action: "toggle"}, nil
+	}
+	if m := levelRE.FindStringSubmatch(text); m != nil {
+		level, err := strconv.Atoi(m[2])
+		if err != nil || level > 100 {
+			return hookCommand{}, errorf(http.StatusBadRequest, "level %s is out of bounds 0-100", m[2])
+		}
+		return hookCommand{device: unquote(m[1]), action: "level", level: level}, nil
+	}
+	return hookCommand{}, errorf(http.StatusBadRequest, "unknown command %q, expected e.g. \"turn porch on\", \"toggle porch\" or \"set porch to 40%%\"", text)
+}
+
+// hookText returns the command of a /hook request: the "command" query or
+// form value, the "command" field of a JSON body, or a plain text body.
+func hookText(r *http.Request) (string, error) {
+	if text := r.URL.Query().Get("command"); text != "" {
+		return text, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		var hook struct {
+			Command string `json:"command"`
+		}
+		if err := json.Unmarshal(body, &hook); err != nil {
+			return "", errorf(http.StatusBadRequest, "Failed to parse request => %s", err)
+		}
+		return hook.Command, nil
+	case "application/x-www-form-urlencoded":
+		r.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+		r.ParseForm()
+		return r.PostForm.Get("command"), nil
+	}
+	return string(body), nil
+}
+
+// hook runs a command sent to /hook and returns the new state of the device.
+func (h *Handler) hook(ctx context.Context, r *http.Request) (interface{}, error) {
+	if r.Method != http.MethodPost {
+		return nil, errorf(http.StatusMethodNotAllowed, "%s is not allowed", r.Method)
+	}
+	text, err := hookText(r)
+	if err != nil {
+		return nil, err
+	}
+	command, err := parseHook(text)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := h.device(command.device)
+	if err != nil {
+		return nil, err
+	}
+
+	switch command.action {
+	case "on", "off":
+		err = h.Manager.SetBinaryState(ctx, entry.Key, command.action == "on")
+	case "toggle":
+		var state int
+		if state, err = h.Manager.BinaryState(ctx, entry.Key); err == nil {
+			err = h.Manager.SetBinaryState(ctx, entry.Key, state == 0)
+		}
+	case "level":
+		err = h.Manager.SetLevel(ctx, entry.Key, command.level)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return h.state(ctx, entry.Key)
+}
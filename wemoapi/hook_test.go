@@ -0,0 +1,69 @@
+package wemoapi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestParseHook(t *testing.T) {
+	for text, expected := range map[string]hookCommand{
+		"turn porch on":             {device: "porch", action: "on"},
+		"Turn off the Porch Light.": {device: "porch light", action: "off"},
+		"switch garden lights off":  {device: "garden lights", action: "off"},
+		"toggle porch":              {device: "porch", action: "toggle"},
+		"set hall to 40%":           {device: "hall", action: "level", level: 40},
+		"dim hall level to 5":       {device: "hall", action: "level", level: 5},
+	} {
+		command, err := parseHook(text)
+		if err != nil || command != expected {
+			t.Errorf("Expected %q: %+v, got: %+v, %v", text, expected, command, err)
+		}
+	}
+	for _, text := range []string{"", "turn porch", "set hall to 140%", "open the door"} {
+		if _, err := parseHook(text); err == nil {
+			t.Errorf("Expected: an error for %q", text)
+		}
+	}
+}
+
+func TestHook(t *testing.T) {
+	socket := newSocket()
+	defer socket.Close()
+
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Porch Light", Host: strings.TrimPrefix(socket.URL, "http://"), UDN: "uuid:Socket-1_0-A", DeviceType: wemo.Controllee})
+	server := httptest.NewServer(NewHandler(m, "secret"))
+	defer server.Close()
+
+	post := func(query, contentType, body string) (int, string) {
+		resp, err := http.Post(server.URL+"/hook?"+query, contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	if code, _ := post("command=turn+porch+light+on", "", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected: %d without a token, got: %d", http.StatusUnauthorized, code)
+	}
+	code, body := post("token=secret&"+url.Values{"command": {"turn the porch light on"}}.Encode(), "", "")
+	if code != http.StatusOK || !strings.Contains(body, `"state":1`) {
+		t.Errorf("Unexpected response %d: %s", code, body)
+	}
+	code, body = post("token=secret", "application/json", `{"command": "toggle porch light"}`)
+	if code != http.StatusOK || !strings.Contains(body, `"state":0`) {
+		t.Errorf("Unexpected response %d: %s", code, body)
+	}
+	code, body = post("token=secret", "text/plain", "turn the garage on")
+	if code != http.StatusNotFound {
+		t.Errorf("Unexpected response %d: %s", code, body)
+	}
+}
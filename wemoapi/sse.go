@@ -0,0 +1,75 @@
+package wemoapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const ssePingInterval = 30 * time.Second
+
+// serveEvents streams the state changes of the manager as server-sent
+// events of type "state", with the event number as id. A client reconnecting
+// with Last-Event-ID, or ?last-event-id=, first gets the events it missed;
+// when those are no longer known it gets a "reset" event, after which it
+// should reload the state.
+func (h *Handler) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, errorf(http.StatusInternalServerError, "streaming is not supported"))
+		return
+	}
+
+	// subscribe before reading the history, so no event falls in between
+	events, cancel := h.Manager.Subscribe(64)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // for nginx
+	w.WriteHeader(http.StatusOK)
+
+	var last uint64
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last-event-id")
+	}
+	if lastID != "" {
+		if seq, err := strconv.ParseUint(lastID, 10, 64); err == nil {
+			missed, complete := h.Manager.EventsSince(seq)
+			if !complete {
+				fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+			}
+			for _, event := range missed {
+				writeEvent(w, "state", event.Seq, event)
+				last = event.Seq
+			}
+		}
+	}
+	flusher.Flush()
+
+	ping := time.NewTicker(ssePingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			if event.Seq <= last {
+				continue // replayed
+			}
+			writeEvent(w, "state", event.Seq, event)
+			flusher.Flush()
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, eventType string, id uint64, v interface{}) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, eventType, data)
+}
@@ -0,0 +1,50 @@
+package wemoapi
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestEvents(t *testing.T) {
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Porch", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-A", DeviceType: wemo.Controllee})
+	m.UpdateBinaryState("uuid:Socket-1_0-A", 0) // 1
+	m.UpdateBinaryState("uuid:Socket-1_0-A", 1) // 2
+	m.UpdateBinaryState("uuid:Socket-1_0-A", 0) // 3
+
+	server := httptest.NewServer(NewHandler(m, "secret"))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/events?token=secret", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Unexpected content type: %s", resp.Header.Get("Content-Type"))
+	}
+
+	m.UpdateBinaryState("uuid:Socket-1_0-A", 1) // 4, live
+
+	var ids []string
+	lines := bufio.NewScanner(resp.Body)
+	for len(ids) < 3 && lines.Scan() {
+		line := lines.Text()
+		if strings.HasPrefix(line, "id: ") {
+			ids = append(ids, strings.TrimPrefix(line, "id: "))
+		}
+		if strings.HasPrefix(line, "event: ") && line != "event: state" {
+			t.Errorf("Unexpected event: %s", line)
+		}
+	}
+	if strings.Join(ids, ",") != "2,3,4" {
+		t.Errorf("Expected: events 2,3,4, got: %s", ids)
+	}
+}
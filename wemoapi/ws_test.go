@@ -0,0 +1,55 @@
+package wemoapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/randohm/go.wemo"
+)
+
+func TestWebSocket(t *testing.T) {
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Porch", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-A", DeviceType: wemo.Controllee})
+
+	server := httptest.NewServer(NewHandler(m, "secret"))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected: the connection to be refused without a token")
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?token=secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the subscription is made after the handshake, so keep changing the
+	// state until an event arrives
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for state := 1; ; state = 1 - state {
+			m.UpdateBinaryState("uuid:Socket-1_0-A", state)
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var event wemo.StateChanged
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Key != "uuid:Socket-1_0-A" || event.Name != "Porch" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+}
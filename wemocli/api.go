@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/randohm/go.wemo/wemoapi"
+	"github.com/urfave/cli"
+)
+
+var apiCommand = cli.Command{
+	Name:        "api",
+	Usage:       "serve a JSON REST API for the devices",
+	Description: "serve the devices on /devices, their state changes on /ws and /events, and webhook commands on /hook, see the wemoapi package for the resources",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "listen", Value: ":8080", Usage: "address to serve the API on"},
+		cli.StringFlag{Name: "store", Value: "", Usage: "device inventory file, scanned when empty"},
+		cli.StringFlag{Name: "token", Value: "", Usage: "bearer token clients have to send, defaults to $WEMO_API_TOKEN"},
+	},
+	Action: apiAction,
+}
+
+func apiAction(c *cli.Context) {
+	m, err := openManager(c.String("store"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	token := c.String("token")
+	if token == "" {
+		token = os.Getenv("WEMO_API_TOKEN")
+	}
+	if token == "" {
+		log.Print("serving the API without a token, anyone on the network can switch the devices")
+	}
+
+	handler := wemoapi.NewHandler(m, token)
+	http.Handle("/devices", handler)
+	http.Handle("/devices/", handler)
+	http.Handle("/ws", handler)
+	http.Handle("/events", handler)
+	http.Handle("/telegraf", handler)
+	http.Handle("/hook", handler)
+	log.Printf("serving %d devices on %s", len(m.List()), c.String("listen"))
+	log.Fatal(http.ListenAndServe(c.String("listen"), nil))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/randohm/go.wemo"
+	"github.com/urfave/cli"
+)
+
+var bulbColorFlags = []cli.Flag{
+	cli.StringFlag{Name: "host", Value: "", Usage: "bridge host and ip or name, defaults to --host of bulb"},
+	cli.DurationFlag{Name: "transition", Usage: "how long to fade, e.g. 2s"},
+	cli.BoolFlag{Name: "group", Usage: "the id is of a group of bulbs"},
+}
+
+var bulbCTCommand = cli.Command{
+	Name:        "ct",
+	Usage:       "set the color temperature of a bulb",
+	ArgsUsage:   "<id> <kelvin>",
+	Description: "bulb ct 94103EF6BF42867F 2700 --transition 2s",
+	Flags:       bulbColorFlags,
+	Action:      bulbCTAction,
+}
+
+func bulbCTAction(c *cli.Context) {
+	if c.NArg() != 2 {
+		log.Fatal("expected the id of the bulb and the color temperature in kelvin")
+	}
+	kelvin, err := strconv.Atoi(c.Args()[1])
+	if err != nil {
+		log.Fatalf("unable to parse color temperature %q, expected kelvin e.g. 2700", c.Args()[1])
+	}
+	bridge, ctx, cancel := bulbBridge(c)
+	defer cancel()
+	if err := bridge.SetBulbColorTemperature(ctx, c.Args()[0], kelvin, c.Duration("transition"), c.Bool("group")); err != nil {
+		log.Fatal(err)
+	}
+	if jsonOutput(c) {
+		printState(bridge.Host)
+	}
+}
+
+var bulbColorCommand = cli.Command{
+	Name:        "color",
+	Usage:       "set the color of a bulb",
+	ArgsUsage:   "<id> <#rrggbb>",
+	Description: "bulb color 94103EF6BF42867F '#ff8800'",
+	Flags:       bulbColorFlags,
+	Action:      bulbColorAction,
+}
+
+func bulbColorAction(c *cli.Context) {
+	if c.NArg() != 2 {
+		log.Fatal("expected the id of the bulb and the color")
+	}
+	color, err := wemo.ParseColor(c.Args()[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	bridge, ctx, cancel := bulbBridge(c)
+	defer cancel()
+	if err := bridge.SetBulbColor(ctx, c.Args()[0], color, c.Duration("transition"), c.Bool("group")); err != nil {
+		log.Fatal(err)
+	}
+	if jsonOutput(c) {
+		printState(bridge.Host)
+	}
+}
+
+// bulbBridge returns the bridge given by --host of the subcommand or of bulb,
+// and the context to command it in.
+func bulbBridge(c *cli.Context) (*wemo.Device, context.Context, context.CancelFunc) {
+	host := c.String("host")
+	if host == "" {
+		host = c.GlobalString("host")
+	}
+	host, err := resolveHost(host)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), userConfig.timeout())
+	return &wemo.Device{Host: host}, ctx, cancel
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/randohm/go.wemo"
+	"github.com/urfave/cli"
+)
+
+var completionCommand = cli.Command{
+	Name:      "completion",
+	Usage:     "print the shell completion script",
+	ArgsUsage: "bash|zsh|fish",
+	Description: "print a script completing commands, flags and device names, taken from the configuration file " +
+		"and the devices \"wemo discover\" last found. To install it:\n\n" +
+		"   bash: source <(wemo completion bash)\n" +
+		"   zsh:  source <(wemo completion zsh)\n" +
+		"   fish: wemo completion fish | source",
+	Action: completionAction,
+}
+
+func completionAction(c *cli.Context) {
+	script, ok := completionScripts[c.Args().First()]
+	if !ok {
+		log.Fatal("expected the shell, one of bash, zsh or fish")
+	}
+	fmt.Print(strings.Replace(script, "$PROG", c.App.Name, -1))
+}
+
+// completionScripts ask the command itself for the candidates, with the
+// --generate-bash-completion flag of cli.
+var completionScripts = map[string]string{
+	"bash": `_$PROG_complete() {
+  local cur="${COMP_WORDS[COMP_CWORD]}" IFS=$'\n'
+  local -a args=("${COMP_WORDS[@]:1:COMP_CWORD-1}")
+  [[ "$cur" == -* ]] && args+=("$cur")
+  COMPREPLY=($(compgen -W "$($PROG "${args[@]}" --generate-bash-completion 2>/dev/null)" -- "$cur"))
+  COMPREPLY=("${COMPREPLY[@]// /\\ }")
+}
+complete -o default -F _$PROG_complete $PROG
+`,
+	"zsh": `#compdef $PROG
+
+_$PROG_complete() {
+  local -a args opts
+  args=("${words[@]:1:CURRENT-2}")
+  [[ "${words[CURRENT]}" == -* ]] && args+=("${words[CURRENT]}")
+  opts=("${(@f)$(_CLI_ZSH_AUTOCOMPLETE_HACK=1 $PROG "${args[@]}" --generate-bash-completion 2>/dev/null)}")
+  _describe 'values' opts
+}
+
+compdef _$PROG_complete $PROG
+`,
+	"fish": `function __$PROG_complete
+  set -l args (commandline -opc)[2..-1]
+  set -l cur (commandline -ct)
+  string match -q -- '-*' $cur; and set -a args $cur
+  $PROG $args --generate-bash-completion 2>/dev/null
+end
+
+complete -c $PROG -f -a '(__$PROG_complete)'
+`,
+}
+
+// completeDevices completes the flags of a command, or the names and aliases
+// of the device it takes. Like cli.DefaultCompleteWithFlags, it looks at
+// os.Args for a flag being completed.
+func completeDevices(c *cli.Context) {
+	if args := os.Args; len(args) > 2 && strings.HasPrefix(args[len(args)-2], "-") {
+		cli.DefaultCompleteWithFlags(&c.Command)(c)
+		return
+	}
+	if c.NArg() > 0 {
+		return
+	}
+	for _, name := range deviceNames() {
+		fmt.Fprintln(c.App.Writer, name)
+	}
+}
+
+// deviceNames returns the names and aliases of the devices in the
+// configuration file and the discovery cache.
+func deviceNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	add := func(name string) {
+		if name != "" && !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, device := range userConfig.Devices {
+		add(device.Name)
+		for _, alias := range device.Aliases {
+			add(alias)
+		}
+	}
+	if m := openCache(); m != nil {
+		for _, entry := range m.List() {
+			add(entry.Name)
+			for _, alias := range entry.Aliases {
+				add(alias)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cacheFile is where "wemo discover" keeps the devices it found, or empty when
+// the system has no cache directory.
+func cacheFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "wemo", "devices.json")
+}
+
+// openCache returns a manager with the devices of the discovery cache, or nil
+// when there is none.
+func openCache() *wemo.Manager {
+	file := cacheFile()
+	if file == "" {
+		return nil
+	}
+	m := wemo.NewManager()
+	m.Store = wemo.FileDeviceStore(file)
+	if err := m.Load(); err != nil || len(m.List()) == 0 {
+		return nil
+	}
+	return m
+}
+
+// saveCache adds entries to the discovery cache, replacing those of the same
+// devices.
+func saveCache(entries []wemo.ManagedDevice) error {
+	file := cacheFile()
+	if file == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	m := wemo.NewManager()
+	m.Store = wemo.FileDeviceStore(file)
+	if err := m.Load(); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := m.Put(entry); err != nil {
+			return err
+		}
+	}
+	return m.Save()
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestDeviceNames(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	defer func(c cliConfig) { userConfig = c }(userConfig)
+	userConfig = cliConfig{Devices: []configDevice{{Name: "Porch Light", Host: "192.168.1.8:49153", Aliases: []string{"porch"}}}}
+
+	if err := saveCache([]wemo.ManagedDevice{{Name: "Kettle", Host: "192.168.1.9:49153", Serial: "A", Aliases: []string{"tea"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveCache([]wemo.ManagedDevice{{Name: "porch light", Host: "192.168.1.8:49153", Serial: "B"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"Kettle", "Porch Light", "porch", "tea"}
+	if names := deviceNames(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected: %v, got: %v", expected, names)
+	}
+}
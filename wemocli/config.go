@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+// cliConfig is the configuration file of the command line, by default
+// ~/.config/wemo/config.yaml:
+//
+//	interface: eth0
+//	discovery-timeout: 3s
+//	timeout: 5s
+//	output: json
+//	history: /var/lib/wemo/insight.jsonl
+//	home: /etc/wemo/home.yaml
+//	devices:
+//	  - name: Porch Light
+//	    host: 192.168.1.8:49153
+//	    aliases: [porch]
+type cliConfig struct {
+	Interface        string         `json:"interface"`         // for discovery
+	DiscoveryTimeout duration       `json:"discovery-timeout"` // how long to wait for devices to answer
+	Timeout          duration       `json:"timeout"`           // for device calls, defaults to 10 seconds
+	Output           string         `json:"output"`            // text or json
+	History          string         `json:"history"`           // Insight history to export
+	Home             string         `json:"home"`              // groups, see wemo.HomeConfig
+	Devices          []configDevice `json:"devices"`
+
+	file string // where it was read from
+}
+
+// configDevice is a device known without discovery.
+type configDevice struct {
+	Name    string   `json:"name"`
+	Host    string   `json:"host"`
+	Aliases []string `json:"aliases"`
+}
+
+// userConfig is the configuration loaded before a command runs.
+var userConfig cliConfig
+
+var configFlag = cli.StringFlag{Name: "config", Value: "", Usage: "configuration file, defaults to $WEMO_CONFIG or ~/.config/wemo/config.yaml"}
+
+// loadConfig reads the configuration file given by --config, if any. A
+// missing default file is no error.
+func loadConfig(c *cli.Context) error {
+	file := c.GlobalString("config")
+	explicit := file != ""
+	if file == "" {
+		file = os.Getenv("WEMO_CONFIG")
+		explicit = file != ""
+	}
+	if file == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil
+		}
+		file = filepath.Join(dir, "wemo", "config.yaml")
+	}
+
+	userConfig = cliConfig{}
+	if err := readConfig(file, &userConfig); err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return nil
+		}
+		return err
+	}
+	switch userConfig.Output {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("%s: unknown output %q, expected text or json", file, userConfig.Output)
+	}
+	userConfig.file = file
+	return nil
+}
+
+// readConfig reads a configuration written as YAML or JSON into v, with the
+// field names of its JSON. Unknown fields are errors, to catch typos.
+func readConfig(file string, v interface{}) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var generic interface{}
+		if err := yaml.Unmarshal(data, &generic); err != nil {
+			return fmt.Errorf("Failed to parse %s => %s", file, err)
+		}
+		if data, err = json.Marshal(generic); err != nil {
+			return fmt.Errorf("Failed to parse %s => %s", file, err)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("Failed to parse %s => %s", file, err)
+	}
+	return nil
+}
+
+// lookup returns the host of the device with the given name or alias.
+func (c *cliConfig) lookup(name string) (string, bool) {
+	for _, device := range c.Devices {
+		for _, n := range append([]string{device.Name}, device.Aliases...) {
+			if strings.EqualFold(n, name) {
+				return device.Host, true
+			}
+		}
+	}
+	return "", false
+}
+
+// timeout is the timeout of device calls.
+func (c *cliConfig) timeout() time.Duration {
+	return durationOr(time.Duration(c.Timeout), 10*time.Second)
+}
+
+// deviceHost returns the host of the device a command is for, given by the
+// first argument or --host, see resolveHost.
+func deviceHost(c *cli.Context) (string, error) {
+	if c.NArg() > 0 {
+		return resolveHost(c.Args()[0])
+	}
+	return resolveHost(c.String("host"))
+}
+
+// resolveHost returns the host of a device given by host:port, by a name or
+// alias of the configuration file, or by a name, alias or key of the devices
+// "wemo discover" last found.
+func resolveHost(name string) (string, error) {
+	if _, port, err := net.SplitHostPort(name); err == nil && port != "" {
+		return name, nil
+	}
+	if host, ok := userConfig.lookup(name); ok {
+		return host, nil
+	}
+	if m := openCache(); m != nil {
+		entries, err := m.Resolve(name)
+		if err != nil {
+			return "", err
+		}
+		switch len(entries) {
+		case 0:
+		case 1:
+			return entries[0].Host, nil
+		default:
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name)
+			}
+			return "", fmt.Errorf("%s matches %d devices: %s", name, len(entries), strings.Join(names, ", "))
+		}
+	}
+	return "", fmt.Errorf("unknown device %s, give its host:port, run wemo discover or add it to %s", name, stringOr(userConfig.file, "a configuration file"))
+}
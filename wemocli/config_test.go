@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestResolveHost(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	defer func(c cliConfig) { userConfig = c }(userConfig)
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	ioutil.WriteFile(file, []byte(`
+timeout: 3s
+output: json
+devices:
+  - name: Porch Light
+    host: 192.168.1.8:49153
+    aliases: [porch]
+`), 0600)
+	userConfig = cliConfig{}
+	if err := readConfig(file, &userConfig); err != nil {
+		t.Fatal(err)
+	}
+	if userConfig.timeout() != 3*time.Second || userConfig.Output != "json" {
+		t.Errorf("Unexpected config: %+v", userConfig)
+	}
+
+	saveCache([]wemo.ManagedDevice{
+		{Name: "Kettle", Host: "192.168.1.9:49153", Serial: "A", Aliases: []string{"tea"}},
+		{Name: "Kitchen Lamp", Host: "192.168.1.10:49153", Serial: "B"},
+		{Name: "Porch Light", Host: "192.168.1.99:49153", Serial: "C"},
+	})
+
+	for name, expected := range map[string]string{
+		"porch":             "192.168.1.8:49153", // the configuration comes first
+		"PORCH LIGHT":       "192.168.1.8:49153",
+		"tea":               "192.168.1.9:49153",
+		"kitchen lamp":      "192.168.1.10:49153",
+		"10.0.1.2:49128":    "10.0.1.2:49128",
+		"192.168.1.8:49153": "192.168.1.8:49153",
+	} {
+		host, err := resolveHost(name)
+		if err != nil || host != expected {
+			t.Errorf("Expected: %s for %s, got: %s (%v)", expected, name, host, err)
+		}
+	}
+	if _, err := resolveHost("k*"); err == nil {
+		t.Error("Expected: an error for an ambiguous name, got: nil")
+	}
+	if _, err := resolveHost("garage"); err == nil {
+		t.Error("Expected: an error for an unknown device, got: nil")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/randohm/go.wemo"
+	"github.com/urfave/cli"
+)
+
+var countdownFlags = []cli.Flag{
+	cli.DurationFlag{Name: "for", Usage: "switch back after this long, e.g. 10m, waiting until then; on --for 0 removes a countdown rule"},
+	cli.BoolFlag{Name: "rule", Usage: "with on --for, install a countdown rule on the device instead of waiting"},
+	cli.DurationFlag{Name: "after", Usage: "switch after this long, e.g. 30s, waiting until then"},
+}
+
+const countdownHelp = "--for and --after wait in this command. With on --for --rule the device gets a countdown rule instead, " +
+	"which turns it off that long after every time it is turned on, also by the app or its button, and replaces a " +
+	"countdown set up in the app; it stays until on --for 0 removes it"
+
+// waitAfter waits for --after, if given, and reports whether the wait was
+// interrupted.
+func waitAfter(c *cli.Context) bool {
+	after := c.Duration("after")
+	if after <= 0 {
+		return false
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Printf("Switching %s at %s\n", c.Command.Name, time.Now().Add(after).Format("15:04:05"))
+	select {
+	case <-ctx.Done():
+		return true
+	case <-time.After(after):
+		return false
+	}
+}
+
+// switchFor switches the device at host and back after countdown, with a
+// timer of this process. The returned message tells how it went.
+func switchFor(host string, on bool, countdown time.Duration) (string, error) {
+	device := &wemo.Device{Host: host}
+	back := stateText(!on)
+	wait, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	turn := device.TurnOnFor
+	if !on {
+		turn = device.TurnOffFor
+	}
+	done, err := turn(wait, countdown)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Switching %s at %s, keep this command running\n", back, time.Now().Add(countdown).Format("15:04:05"))
+	if err := <-done; err != nil {
+		if err == context.Canceled {
+			return fmt.Sprintf("Interrupted, the device stays %s", stateText(on)), nil
+		}
+		return "", err
+	}
+	return fmt.Sprintf("Device is %s", back), nil
+}
+
+// switchOnWithRule installs a countdown rule turning the device at host off
+// countdown after it is turned on, and turns it on.
+func switchOnWithRule(ctx context.Context, host string, countdown time.Duration) (string, error) {
+	device := &wemo.Device{Host: host}
+	if err := device.SetCountdown(ctx, countdown); err != nil {
+		return "", err
+	}
+	if err := device.SetBinaryState(ctx, true); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("The device switches off after %s, now and every time it is switched on until on --for 0", countdown), nil
+}
+
+func stateText(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// clearCountdown removes the countdown rules of the device at host.
+func clearCountdown(ctx context.Context, host string) error {
+	return (&wemo.Device{Host: host}).ClearCountdown(ctx)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSwitchFor(t *testing.T) {
+	binaryStateRE := regexp.MustCompile(`<BinaryState>(\d)</BinaryState>`)
+	states := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var state string
+		if matches := binaryStateRE.FindSubmatch(body); matches != nil {
+			state = string(matches[1])
+		}
+		states <- state
+		w.Write([]byte(`<s:Envelope><s:Body><u:SetBinaryStateResponse><BinaryState>` + state + `</BinaryState></u:SetBinaryStateResponse></s:Body></s:Envelope>`))
+	}))
+	defer server.Close()
+
+	message, err := switchFor(server.Listener.Addr().String(), false, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message != "Device is on" {
+		t.Errorf("Expected: Device is on, got: %s", message)
+	}
+	if off, on := <-states, <-states; off != "0" || on != "1" {
+		t.Errorf("Expected: off then on, got: %s then %s", off, on)
+	}
+
+	if _, err := switchOnWithRule(context.Background(), "127.0.0.1:1", time.Hour); exitCode(err) != exitUnreachable {
+		t.Errorf("Expected: an unreachable device, got: %v", err)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/brutella/hap"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/randohm/go.wemo"
+	"github.com/randohm/go.wemo/wemoapi"
+	"github.com/randohm/go.wemo/wemographite"
+	"github.com/randohm/go.wemo/wemohomekit"
+	"github.com/randohm/go.wemo/wemoinflux"
+	"github.com/randohm/go.wemo/wemomqtt"
+	"github.com/randohm/go.wemo/wemorelay"
+	"github.com/randohm/go.wemo/wemowebhook"
+	"github.com/urfave/cli"
+)
+
+var daemonCommand = cli.Command{
+	Name:  "daemon",
+	Usage: "run discovery, device events, the REST API and the MQTT bridge",
+	Description: "serve the API on --listen together with /healthz, which answers while the process runs, " +
+		"and /readyz, which answers once devices are known, their events are subscribed to and the MQTT broker is connected. " +
+		"Under systemd with Type=notify the daemon reports readiness and keeps the watchdog happy",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "listen", Value: ":8080", Usage: "address to serve the API and health checks on"},
+		cli.StringFlag{Name: "store", Value: "", Usage: "device inventory file, scanned when empty"},
+		cli.StringFlag{Name: "token", Value: "", Usage: "bearer token clients have to send, defaults to $WEMO_API_TOKEN"},
+		cli.StringFlag{Name: "events", Value: ":6767", Usage: "address to receive device events on"},
+		cli.StringFlag{Name: "callback", Value: "", Usage: "host:port the devices send events to, defaults to this host's address on the events port"},
+		cli.StringFlag{Name: "mqtt", Value: "", Usage: "MQTT broker, e.g. tcp://localhost:1883, no bridge when empty"},
+		cli.StringFlag{Name: "mqtt-prefix", Value: "wemo", Usage: "first level of the MQTT topics"},
+		cli.StringFlag{Name: "mqtt-layout", Value: "wemo", Usage: "MQTT topic layout, wemo or zigbee2mqtt"},
+		cli.BoolFlag{Name: "homeassistant", Usage: "publish Home Assistant MQTT discovery configs"},
+		cli.DurationFlag{Name: "rediscover", Value: 10 * time.Minute, Usage: "how often to scan for moved and new devices"},
+		cli.DurationFlag{Name: "health", Value: time.Minute, Usage: "how often to check that devices respond"},
+		cli.StringFlag{Name: "history", Value: "", Usage: "file to record Insight readings in, for \"wemo insight export\""},
+	},
+	Action: daemonAction,
+}
+
+// daemon tracks what the readiness check depends on.
+type daemon struct {
+	manager *wemo.Manager
+	events  *wemo.EventListener
+	mqtt    mqtt.Client // nil without a broker
+}
+
+// ready returns why the daemon isn't ready, or nil.
+func (d *daemon) ready() error {
+	switch {
+	case len(d.manager.List()) == 0:
+		return errors.New("no devices")
+	case d.events.Subscribed() == 0:
+		return errors.New("not subscribed to any device events")
+	case d.mqtt != nil && !d.mqtt.IsConnected():
+		return errors.New("not connected to the MQTT broker")
+	}
+	return nil
+}
+
+func (d *daemon) healthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+func (d *daemon) readyz(w http.ResponseWriter, r *http.Request) {
+	if err := d.ready(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ready")
+}
+
+// daemonConfig is what the daemon runs, from the flags of "wemo daemon" or
+// the configuration file of "wemo serve".
+type daemonConfig struct {
+	Store      string   `json:"store"`
+	Home       string   `json:"home"` // a wemo.HomeConfig to import
+	Rediscover duration `json:"rediscover"`
+	Health     duration `json:"health"`
+
+	API struct {
+		Listen string `json:"listen"`
+		Token  string `json:"token"`
+	} `json:"api"`
+
+	Events struct {
+		Listen   string `json:"listen"`
+		Callback string `json:"callback"`
+	} `json:"events"`
+
+	MQTT     *mqttConfig            `json:"mqtt"`
+	Webhooks []wemowebhook.Endpoint `json:"webhooks"`
+	Influx   *influxConfig          `json:"influx"`
+	Graphite *graphiteConfig        `json:"graphite"`
+	Relay    *relayConfig           `json:"relay"`
+	HomeKit  *homekitConfig         `json:"homekit"`
+
+	History struct {
+		File     string   `json:"file"`     // see wemo.InsightHistory
+		Interval duration `json:"interval"` // defaults to a minute
+	} `json:"history"`
+}
+
+type mqttConfig struct {
+	Broker        string `json:"broker"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	Prefix        string `json:"prefix"`
+	Layout        string `json:"layout"`
+	HomeAssistant bool   `json:"homeassistant"`
+}
+
+type influxConfig struct {
+	URL      string   `json:"url"`
+	Database string   `json:"database"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Org      string   `json:"org"`
+	Bucket   string   `json:"bucket"`
+	Token    string   `json:"token"`
+	Labels   []string `json:"labels"`
+}
+
+type graphiteConfig struct {
+	Address  string `json:"address"`
+	Template string `json:"template"`
+}
+
+type relayConfig struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+}
+
+type homekitConfig struct {
+	Name   string `json:"name"`   // of the bridge, defaults to WeMo
+	Pin    string `json:"pin"`    // 8 digit setup code
+	Store  string `json:"store"`  // directory of the pairings, defaults to homekit
+	Listen string `json:"listen"` // defaults to a random port
+}
+
+// duration is a time.Duration written as "10m".
+type duration time.Duration
+
+func (d *duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	*d = duration(parsed)
+	return err
+}
+
+func daemonAction(c *cli.Context) {
+	var config daemonConfig
+	config.Store = c.String("store")
+	config.Rediscover = duration(c.Duration("rediscover"))
+	config.Health = duration(c.Duration("health"))
+	config.History.File = c.String("history")
+	config.API.Listen = c.String("listen")
+	config.API.Token = c.String("token")
+	config.Events.Listen = c.String("events")
+	config.Events.Callback = c.String("callback")
+	if broker := c.String("mqtt"); broker != "" {
+		config.MQTT = &mqttConfig{Broker: broker, Prefix: c.String("mqtt-prefix"), Layout: c.String("mqtt-layout"), HomeAssistant: c.Bool("homeassistant")}
+	}
+
+	if err := runDaemon(config); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runDaemon runs until it gets SIGINT or SIGTERM.
+func runDaemon(config daemonConfig) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m, err := openManager(config.Store)
+	if err != nil {
+		return err
+	}
+	if config.Home != "" {
+		data, err := ioutil.ReadFile(config.Home)
+		if err != nil {
+			return err
+		}
+		home, err := wemo.ParseHomeConfig(data)
+		if err != nil {
+			return err
+		}
+		if err := m.Import(home); err != nil {
+			return err
+		}
+	}
+
+	token := config.API.Token
+	if token == "" {
+		token = os.Getenv("WEMO_API_TOKEN")
+	}
+	if token == "" {
+		log.Print("serving the API without a token, anyone on the network can switch the devices")
+	}
+
+	eventsListener, err := net.Listen("tcp", stringOr(config.Events.Listen, ":6767"))
+	if err != nil {
+		return err
+	}
+	callback := config.Events.Callback
+	if callback == "" {
+		if callback, err = callbackAddress(m, eventsListener.Addr()); err != nil {
+			return err
+		}
+	}
+	d := &daemon{manager: m, events: &wemo.EventListener{Manager: m, Callback: callback, Logger: log.Printf}}
+
+	bridgeDone := make(chan struct{})
+	if config.MQTT != nil {
+		layout, err := wemomqtt.ParseLayout(config.MQTT.Layout)
+		if err != nil {
+			return err
+		}
+		bridge := &wemomqtt.Bridge{Manager: m, Prefix: config.MQTT.Prefix, Layout: layout, HomeAssistant: config.MQTT.HomeAssistant, Logger: log.Printf}
+		opts := mqtt.NewClientOptions().AddBroker(config.MQTT.Broker).SetClientID(fmt.Sprintf("wemo-%d", os.Getpid()))
+		opts.SetUsername(config.MQTT.Username)
+		opts.SetPassword(config.MQTT.Password)
+		bridge.Configure(opts)
+		d.mqtt = mqtt.NewClient(opts)
+		bridge.Client = d.mqtt
+		if token := d.mqtt.Connect(); token.Wait() && token.Error() != nil {
+			return fmt.Errorf("unable to connect to %s => %s", config.MQTT.Broker, token.Error())
+		}
+		go func() {
+			bridge.Run(ctx)
+			close(bridgeDone)
+		}()
+	} else {
+		close(bridgeDone)
+	}
+
+	if len(config.Webhooks) > 0 {
+		notifier := &wemowebhook.Notifier{Manager: m, Endpoints: config.Webhooks, OnError: func(endpoint wemowebhook.Endpoint, event wemowebhook.Event, err error) {
+			log.Printf("webhook %s: %s", endpoint.URL, err)
+		}}
+		go notifier.Run(ctx)
+	}
+	if i := config.Influx; i != nil {
+		sink := &wemoinflux.Sink{Manager: m, URL: i.URL, Database: i.Database, Username: i.Username, Password: i.Password, Org: i.Org, Bucket: i.Bucket, Token: i.Token, Labels: i.Labels}
+		go sink.Run(ctx, func(err error) { log.Print(err) })
+	}
+	if g := config.Graphite; g != nil {
+		sink := &wemographite.Sink{Manager: m, Address: g.Address, Template: g.Template}
+		go sink.Run(ctx, func(err error) { log.Print(err) })
+	}
+	if r := config.Relay; r != nil {
+		relay := &wemorelay.Client{Manager: m, URL: r.URL, Token: r.Token, Logger: log.Printf}
+		go relay.Run(ctx)
+	}
+	if h := config.HomeKit; h != nil {
+		bridge := &wemohomekit.Bridge{Manager: m, Logger: log.Printf}
+		server, err := bridge.NewServer(ctx, hap.NewFsStore(stringOr(h.Store, "homekit")), stringOr(h.Name, "WeMo"), h.Pin)
+		if err != nil {
+			return fmt.Errorf("unable to set up HomeKit => %s", err)
+		}
+		server.Addr = h.Listen
+		go bridge.Run(ctx)
+		go func() {
+			if err := server.ListenAndServe(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("homekit: %s", err)
+			}
+		}()
+	}
+	if h := config.History; h.File != "" {
+		go recordInsight(ctx, m, wemo.InsightHistory(h.File), durationOr(time.Duration(h.Interval), time.Minute))
+	}
+
+	eventsMux := http.NewServeMux()
+	eventsMux.Handle("/listener", d.events)
+	eventsServer := &http.Server{Handler: eventsMux}
+	go eventsServer.Serve(eventsListener)
+	go d.events.Run(ctx)
+
+	go m.Rediscover(ctx, durationOr(time.Duration(config.Rediscover), 10*time.Minute), func(change wemo.HostChange) {
+		log.Printf("%s moved from %s to %s", change.Device.Name, change.OldHost, change.Device.Host)
+	})
+	go m.MonitorHealth(ctx, durationOr(time.Duration(config.Health), time.Minute), func(change wemo.HealthChange) {
+		log.Printf("%s is %s", change.Device.Name, change.To)
+	})
+
+	handler := wemoapi.NewHandler(m, token)
+	mux := http.NewServeMux()
+	for _, path := range []string{"/devices", "/devices/", "/ws", "/events", "/telegraf", "/hook"} {
+		mux.Handle(path, handler)
+	}
+	mux.HandleFunc("/healthz", d.healthz)
+	mux.HandleFunc("/readyz", d.readyz)
+	server := &http.Server{Addr: stringOr(config.API.Listen, ":8080"), Handler: mux}
+	apiListener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+	go server.Serve(apiListener)
+	log.Printf("serving %d devices on %s, receiving events on %s", len(m.List()), server.Addr, callback)
+
+	if err := sdNotify("READY=1"); err != nil {
+		log.Printf("unable to notify systemd => %s", err)
+	}
+	var watchdog <-chan time.Time
+	if interval := sdWatchdog(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		watchdog = ticker.C
+	}
+
+	for done := false; !done; {
+		select {
+		case <-ctx.Done():
+			done = true
+		case <-watchdog:
+			sdNotify("WATCHDOG=1")
+		}
+	}
+
+	log.Print("shutting down")
+	sdNotify("STOPPING=1")
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(shutdown)
+	eventsServer.Shutdown(shutdown)
+	<-bridgeDone // announced offline
+	if d.mqtt != nil {
+		d.mqtt.Disconnect(250)
+	}
+	return nil
+}
+
+func stringOr(s, fallback string) string {
+	if s != "" {
+		return s
+	}
+	return fallback
+}
+
+func durationOr(d, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return fallback
+}
+
+// callbackAddress returns the address of this host on the network of the
+// devices, with the port of the event listener.
+func callbackAddress(m *wemo.Manager, listener net.Addr) (string, error) {
+	port := listener.(*net.TCPAddr).Port
+	for _, entry := range m.List() {
+		conn, err := net.Dial("udp", entry.Host)
+		if err != nil {
+			continue
+		}
+		host := conn.LocalAddr().(*net.UDPAddr).IP.String()
+		conn.Close()
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		return fmt.Sprintf("%s:%d", host, port), nil
+	}
+	return "", errors.New("unable to find the address devices reach this host at, use --callback")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/randohm/go.wemo"
+	"github.com/urfave/cli"
+)
+
+var debugFlag = cli.BoolFlag{Name: "debug, vv", Usage: "print the SOAP requests and responses, with passwords and keys redacted, to stderr"}
+
+// setupDebug installs the hook printing the SOAP exchanges for --debug.
+func setupDebug(c *cli.Context) {
+	if c.GlobalBool("debug") {
+		wemo.SetActionHook(exchangePrinter(os.Stderr))
+	}
+}
+
+// exchangePrinter returns a hook printing every exchange to w, one at a time
+// for commands talking to several devices at once.
+func exchangePrinter(w io.Writer) func(wemo.ActionExchange) {
+	var mu sync.Mutex
+	return func(e wemo.ActionExchange) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, ">>> %s %s#%s\n%s\n", e.Host, e.Service, e.Action, wemo.RedactSecrets(e.Request))
+		if e.StatusCode == 0 {
+			fmt.Fprintf(w, "<<< %s (%s)\n\n", e.Err, e.Duration.Round(time.Millisecond))
+			return
+		}
+		fmt.Fprintf(w, "<<< %d (%s)\n%s\n\n", e.StatusCode, e.Duration.Round(time.Millisecond), wemo.RedactSecrets(e.Response))
+	}
+}
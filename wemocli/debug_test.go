@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestExchangePrinter(t *testing.T) {
+	var b bytes.Buffer
+	print := exchangePrinter(&b)
+	print(wemo.ActionExchange{Host: "10.22.22.1:49152", Service: "WiFiSetup", Action: "ConnectHomeNetwork",
+		Request: []byte("<ssid>home</ssid><password>s3cret</password>"), StatusCode: 200, Response: []byte("<PairingStatus>Connecting</PairingStatus>"), Duration: 12 * time.Millisecond})
+	print(wemo.ActionExchange{Host: "10.0.0.9:49153", Service: "basicevent", Action: "GetBinaryState", Err: errors.New("connection refused")})
+
+	expected := ">>> 10.22.22.1:49152 WiFiSetup#ConnectHomeNetwork\n<ssid>home</ssid><password>REDACTED</password>\n" +
+		"<<< 200 (12ms)\n<PairingStatus>Connecting</PairingStatus>\n\n" +
+		">>> 10.0.0.9:49153 basicevent#GetBinaryState\n\n<<< connection refused (0s)\n\n"
+	if b.String() != expected {
+		t.Errorf("Expected: %q, got: %q", expected, b.String())
+	}
+	if strings.Contains(b.String(), "s3cret") {
+		t.Error("Expected: the password to be redacted")
+	}
+}
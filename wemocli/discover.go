@@ -5,38 +5,131 @@ import (
 	"fmt"
 	"log"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/gecgooden/go.wemo"
+	"github.com/randohm/go.wemo"
 	"github.com/urfave/cli"
 )
 
 var discoverCommand = cli.Command{
 	Name:        "discover",
 	Usage:       "find devices in the local network",
-	Description: "search for devices in the local network",
+	Description: "search for devices in the local network, all types or those given by --type: " + strings.Join(deviceTypeNames(), ", "),
 	Flags: []cli.Flag{
-		cli.StringFlag{Name: "interface", Value: "en0", Usage: "search by interface"}, //, ""},
-		cli.StringFlag{Name: "ip", Value: "", Usage: "discovery wemo by ip"},          //,""},
-		cli.IntFlag{Name: "timeout", Value: 2, Usage: "timeout"},                      //, ""},
+		cli.StringFlag{Name: "iface, interface", Value: "", Usage: "search on this interface, e.g. eth0, instead of all"},
+		cli.StringFlag{Name: "ip", Value: "", Usage: "search from this address"},
+		cli.StringFlag{Name: "timeout", Value: "2s", Usage: "how long to wait for devices to answer, e.g. 5s"},
+		cli.StringSliceFlag{Name: "type", Usage: "only find devices of this type, may be repeated"},
+		cli.BoolFlag{Name: "json", Usage: "print a wemo.DeviceDoc per device, as --json before the command"},
 	},
 	Action: commandAction,
 }
 
-func commandAction(c *cli.Context) {
-	timeout := c.Int("timeout")
-	iface := c.String("interface")
+// deviceTypes are the device types --type of discover takes.
+var deviceTypes = map[string]string{
+	"switch":      wemo.Controllee,
+	"insight":     wemo.Insight,
+	"dimmer":      wemo.Dimmer,
+	"lightswitch": wemo.LightSwitch,
+	"bridge":      wemo.Bridge,
+	"light":       wemo.Light,
+	"sensor":      wemo.Sensor,
+	"netcam":      wemo.NetCam,
+}
+
+func deviceTypeNames() []string {
+	var names []string
+	for name := range deviceTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
 
-	api, err := wemo.NewByInterface(iface)
+// parseTimeout parses a duration, or a number of seconds as --timeout used
+// to take.
+func parseTimeout(s string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(s); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	timeout, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse timeout %q, expected e.g. 5s", s)
+	}
+	return timeout, nil
+}
+
+// typeOf reports whether entry is a device of one of the types urns.
+func typeOf(entry wemo.ManagedDevice, urns []string) bool {
+	for _, urn := range urns {
+		if entry.DeviceType == urn {
+			return true
+		}
+	}
+	return false
+}
+
+func commandAction(c *cli.Context) {
+	timeout, err := parseTimeout(c.String("timeout"))
 	if err != nil {
 		log.Fatal(err)
 	}
+	if !c.IsSet("timeout") && userConfig.DiscoveryTimeout > 0 {
+		timeout = time.Duration(userConfig.DiscoveryTimeout)
+	}
+	iface := c.String("iface")
+	if !c.IsSet("iface") && userConfig.Interface != "" {
+		iface = userConfig.Interface
+	}
+	var urns []string
+	for _, name := range c.StringSlice("type") {
+		urn, ok := deviceTypes[strings.ToLower(name)]
+		if !ok {
+			log.Fatalf("unknown device type %s, expected one of %s", name, strings.Join(deviceTypeNames(), ", "))
+		}
+		urns = append(urns, urn)
+	}
 
-	devices, err := api.DiscoverAll(time.Duration(timeout) * time.Second)
+	api := wemo.NewByIP(c.String("ip"))
+	if iface != "" {
+		if api, err = wemo.NewByInterface(iface); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	devices, err := api.DiscoverTypes(timeout, urns...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	m := wemo.NewManager()
+	entries := []wemo.ManagedDevice{}
+	for _, device := range devices {
+		entry, err := m.Add(context.Background(), device)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(urns) > 0 && !typeOf(entry, urns) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := saveCache(entries); err != nil {
+		log.Printf("unable to cache devices => %s", err)
+	}
+
+	if c.Bool("json") || jsonOutput(c) {
+		docs := []wemo.DeviceDoc{}
+		for _, entry := range entries {
+			docs = append(docs, wemo.NewDeviceDoc(entry))
+		}
+		sort.Slice(docs, func(i, j int) bool { return docs[i].Name < docs[j].Name })
+		printJSON(docs)
+		return
+	}
+
 	format := "%-22s %-22s %-34s %-16s %-16s\n"
 	fmt.Printf(format,
 		"Host",
@@ -54,12 +147,8 @@ func commandAction(c *cli.Context) {
 	)
 
 	deviceInfos := wemo.DeviceInfos{}
-	for _, device := range devices {
-		deviceInfo, err := device.FetchDeviceInfo(context.Background())
-		if err != nil {
-			log.Fatal(err)
-		}
-		deviceInfos = append(deviceInfos, deviceInfo)
+	for _, entry := range entries {
+		deviceInfos = append(deviceInfos, entry.Info)
 	}
 
 	sort.Sort(deviceInfos)
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"os"
+
+	"github.com/randohm/go.wemo"
+)
+
+// Exit codes of the control commands, so scripts can tell a device that is
+// away from one that refused the action.
+const (
+	exitOK          = 0
+	exitError       = 1 // usage, configuration and any other error
+	exitUnreachable = 2 // the device did not answer
+	exitFault       = 3 // the device answered with a SOAP fault or an HTTP error
+)
+
+// exitCode returns the exit code for err.
+func exitCode(err error) int {
+	var actionErr *wemo.ActionError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &actionErr):
+		return exitFault
+	case errors.As(err, &netErr), errors.Is(err, context.DeadlineExceeded):
+		return exitUnreachable
+	}
+	return exitError
+}
+
+// exit logs err and exits with its exit code.
+func exit(err error) {
+	log.Print(err)
+	os.Exit(exitCode(err))
+}
+
+const exitCodesHelp = "the device is given by host:port, name or alias, and several devices by a comma separated list of them " +
+	"and patterns, e.g. \"porch,garden*,tv-plug\", which are run at once. Exits with 0 on success, 2 when a device is unreachable " +
+	"and 3 when it answers with a fault, and with several devices with the highest of these"
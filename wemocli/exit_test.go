@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestExitCode(t *testing.T) {
+	fault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`<s:Envelope><s:Body><s:Fault><detail><UPnPError><errorCode>501</errorCode><errorDescription>Action Failed</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`))
+	}))
+	defer fault.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := listener.Addr().String()
+	listener.Close()
+
+	device := &wemo.Device{Host: fault.Listener.Addr().String()}
+	if err := device.SetBinaryState(context.Background(), true); exitCode(err) != exitFault {
+		t.Errorf("Expected: %d, got: %d (%v)", exitFault, exitCode(err), err)
+	}
+	device = &wemo.Device{Host: unreachable}
+	if err := device.SetBinaryState(context.Background(), true); exitCode(err) != exitUnreachable {
+		t.Errorf("Expected: %d, got: %d (%v)", exitUnreachable, exitCode(err), err)
+	}
+	if code := exitCode(errors.New("unknown device porch")); code != exitError {
+		t.Errorf("Expected: %d, got: %d", exitError, code)
+	}
+	if code := exitCode(nil); code != exitOK {
+		t.Errorf("Expected: %d, got: %d", exitOK, code)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/randohm/go.wemo"
+	"github.com/urfave/cli"
+)
+
+var insightExportCommand = cli.Command{
+	Name:      "export",
+	Usage:     "dump the recorded Insight readings of a device for spreadsheets",
+	ArgsUsage: "<device>",
+	Description: "export the readings \"wemo watch --history\" or \"wemo daemon --history\" recorded, as they were " +
+		"taken or rolled up by --period. Times are RFC 3339 or dates, e.g. --from 2020-06-01 --to 2020-07-01",
+	BashComplete: completeDevices,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "history", Value: "", Usage: "Insight history file, defaults to the history of the configuration file"},
+		cli.StringFlag{Name: "from", Value: "", Usage: "first time to export, defaults to the first reading"},
+		cli.StringFlag{Name: "to", Value: "", Usage: "time to export up to, defaults to now"},
+		cli.StringFlag{Name: "format", Value: "csv", Usage: "csv or json"},
+		cli.StringFlag{Name: "period", Value: "", Usage: "roll the readings up hourly, daily or weekly"},
+	},
+	Action: insightExportAction,
+}
+
+func insightExportAction(c *cli.Context) {
+	if err := insightExport(c); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func insightExport(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("expected the device")
+	}
+	history := stringOr(c.String("history"), userConfig.History)
+	if history == "" {
+		return fmt.Errorf("no history to export, record one with --history of wemo watch or wemo daemon")
+	}
+	from, err := parseTime(c.String("from"))
+	if err != nil {
+		return err
+	}
+	to, err := parseTime(c.String("to"))
+	if err != nil {
+		return err
+	}
+	format := c.String("format")
+	if jsonOutput(c) && !c.IsSet("format") {
+		format = "json"
+	}
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("unknown format %q, expected csv or json", format)
+	}
+
+	key, err := historyKey(c.Args().First())
+	if err != nil {
+		return err
+	}
+	docs, err := wemo.InsightHistory(history).Read(key, from, to)
+	if err != nil {
+		return err
+	}
+
+	if c.String("period") == "" {
+		if format == "json" {
+			printJSON(append([]wemo.InsightDoc{}, docs...))
+			return nil
+		}
+		return writeReadingsCSV(docs)
+	}
+
+	period, err := parsePeriod(c.String("period"))
+	if err != nil {
+		return err
+	}
+	readings := make([]wemo.InsightReading, len(docs))
+	for i, doc := range docs {
+		readings[i] = doc.Reading()
+	}
+	summaries := wemo.RollupEnergy(readings, period, nil)
+	if format == "json" {
+		docs := []summaryDoc{}
+		for _, s := range summaries {
+			docs = append(docs, summaryDoc{s.Start, s.End, s.Samples, int(s.Covered.Seconds()), s.KWh, s.AveragePower, s.DutyCycle, s.PeakPower, s.PeakTime})
+		}
+		printJSON(docs)
+		return nil
+	}
+	return writeSummariesCSV(summaries)
+}
+
+// summaryDoc is a wemo.EnergySummary as exported in JSON.
+type summaryDoc struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Samples   int       `json:"samples"`
+	Covered   int       `json:"covered"` // seconds
+	KWh       float64   `json:"kwh"`
+	AverageW  float64   `json:"average-w"`
+	DutyCycle float64   `json:"duty-cycle"`
+	PeakW     float64   `json:"peak-w"`
+	PeakTime  time.Time `json:"peak-time"`
+}
+
+// historyKey returns the key the readings of device are recorded with: that
+// of the device in the discovery cache, or of the device at the host it
+// resolves to.
+func historyKey(device string) (string, error) {
+	if m := openCache(); m != nil {
+		if entries, _ := m.Resolve(device); len(entries) == 1 {
+			return entries[0].Key, nil
+		}
+	}
+	host, err := resolveHost(device)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), userConfig.timeout())
+	defer cancel()
+	_, entry, err := hostEntry(ctx, host)
+	return entry.Key, err
+}
+
+// parseTime parses an RFC 3339 time or a local date. Empty is the zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse time %q, expected e.g. 2020-06-01 or 2020-06-01T10:00:00Z", s)
+	}
+	return t, nil
+}
+
+func parsePeriod(s string) (wemo.RollupPeriod, error) {
+	for _, period := range []wemo.RollupPeriod{wemo.Hourly, wemo.Daily, wemo.Weekly} {
+		if s == period.String() {
+			return period, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown period %q, expected hourly, daily or weekly", s)
+}
+
+func writeReadingsCSV(docs []wemo.InsightDoc) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"time", "power_w", "today_kwh", "total_kwh", "on_for", "on_today", "on_total", "signal", "threshold_w"})
+	for _, doc := range docs {
+		w.Write([]string{
+			doc.Time.Format(time.RFC3339),
+			formatFloat(doc.PowerW),
+			formatFloat(doc.TodayKWh),
+			formatFloat(doc.TotalKWh),
+			strconv.Itoa(doc.OnFor),
+			strconv.Itoa(doc.OnToday),
+			strconv.Itoa(doc.OnTotal),
+			formatFloat(doc.Signal),
+			formatFloat(doc.ThresholdW),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func writeSummariesCSV(summaries []wemo.EnergySummary) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"start", "end", "samples", "covered_s", "kwh", "average_w", "duty_cycle", "peak_w", "peak_time"})
+	for _, s := range summaries {
+		w.Write([]string{
+			s.Start.Format(time.RFC3339),
+			s.End.Format(time.RFC3339),
+			strconv.Itoa(s.Samples),
+			strconv.Itoa(int(s.Covered.Seconds())),
+			formatFloat(s.KWh),
+			formatFloat(s.AveragePower),
+			formatFloat(s.DutyCycle),
+			formatFloat(s.PeakPower),
+			s.PeakTime.Format(time.RFC3339),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// recordInsight appends a reading of every Insight device to history each
+// interval, until ctx is done.
+func recordInsight(ctx context.Context, m *wemo.Manager, history wemo.InsightHistory, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var docs []wemo.InsightDoc
+		for _, entry := range m.List() {
+			if !entry.Capabilities().Has(wemo.CapInsight) {
+				continue
+			}
+			params, err := m.InsightParams(ctx, entry.Key)
+			if err != nil {
+				continue
+			}
+			docs = append(docs, wemo.NewInsightDoc(entry.Key, wemo.InsightReading{Host: entry.Host, Time: time.Now(), Params: *params}))
+		}
+		if err := history.Append(docs...); err != nil {
+			log.Printf("unable to record Insight readings => %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/randohm/go.wemo"
+	"github.com/randohm/go.wemo/wemoprom"
+	"github.com/urfave/cli"
+)
+
+var exporterCommand = cli.Command{
+	Name:        "exporter",
+	Usage:       "serve device metrics for Prometheus",
+	Description: "serve the state, power and energy of all devices on /metrics",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "listen", Value: ":9117", Usage: "address to serve metrics on"},
+		cli.StringFlag{Name: "store", Value: "", Usage: "device inventory file, scanned when empty"},
+		cli.StringSliceFlag{Name: "label", Usage: "registry label to add to the metrics, e.g. room"},
+		cli.BoolFlag{Name: "signal", Usage: "read the WiFi signal of all devices"},
+	},
+	Action: exporterAction,
+}
+
+func exporterAction(c *cli.Context) {
+	m, err := openManager(c.String("store"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	collector := wemoprom.NewCollector(m, c.StringSlice("label")...)
+	collector.SignalStrength = c.Bool("signal")
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	metrics := wemoprom.NewMetrics()
+	registry.MustRegister(metrics)
+	wemo.SetMetrics(metrics)
+
+	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	log.Printf("serving metrics of %d devices on %s", len(m.List()), c.String("listen"))
+	log.Fatal(http.ListenAndServe(c.String("listen"), nil))
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/randohm/go.wemo"
+	"github.com/urfave/cli"
+)
+
+var manifestFlag = cli.StringFlag{Name: "manifest", Value: "", Usage: "URL or file of the firmware manifest, see wemo.FirmwareManifest, defaults to $WEMO_FIRMWARE_MANIFEST"}
+
+var firmwareCommand = cli.Command{
+	Name:  "firmware",
+	Usage: "check for and install firmware updates",
+	Subcommands: []cli.Command{
+		{
+			Name:         "check",
+			Usage:        "compare the firmware of devices with the manifest",
+			ArgsUsage:    "[device|devices...]",
+			Description:  "check the devices given, or all known devices",
+			BashComplete: completeDevices,
+			Flags:        []cli.Flag{manifestFlag},
+			Action:       firmwareCheckAction,
+		},
+		{
+			Name:         "update",
+			Usage:        "install the latest firmware of the manifest on a device",
+			ArgsUsage:    "<device>",
+			Description:  "asks before sending the update, unless --yes is given, and follows the download until the device starts installing",
+			BashComplete: completeDevices,
+			Flags: []cli.Flag{
+				manifestFlag,
+				cli.BoolFlag{Name: "yes, y", Usage: "don't ask for confirmation"},
+				cli.BoolFlag{Name: "force", Usage: "install the release even if the device has it already"},
+				cli.DurationFlag{Name: "wait", Value: 10 * time.Minute, Usage: "how long to follow the download, 0 to not follow it"},
+			},
+			Action: firmwareUpdateAction,
+		},
+	},
+}
+
+// firmwareRow is a line of "wemo firmware check".
+type firmwareRow struct {
+	Name    string `json:"name"`
+	Host    string `json:"host"`
+	Current string `json:"current,omitempty"`
+	Latest  string `json:"latest,omitempty"`
+	Status  string `json:"status"` // up to date, update available, unknown or unreachable
+	Error   string `json:"error,omitempty"`
+
+	code int
+}
+
+func firmwareCheckAction(c *cli.Context) {
+	manifest := loadManifest(c)
+	targets, err := commandTargets(c.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rows := make([]firmwareRow, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), userConfig.timeout())
+			defer cancel()
+			rows[i] = checkFirmware(ctx, t, manifest)
+		}(i, t)
+	}
+	wg.Wait()
+
+	if jsonOutput(c) {
+		printJSON(rows)
+	} else {
+		format := "%-20s %-36s %-36s %s\n"
+		fmt.Printf(format, "DEVICE", "CURRENT", "LATEST", "STATUS")
+		for _, row := range rows {
+			fmt.Printf(format, row.Name, stringOr(row.Current, "-"), stringOr(row.Latest, "-"), stringOr(row.Error, row.Status))
+		}
+	}
+
+	code := exitOK
+	for _, row := range rows {
+		if row.code > code {
+			code = row.code
+		}
+	}
+	os.Exit(code)
+}
+
+func checkFirmware(ctx context.Context, t target, manifest *wemo.FirmwareManifest) firmwareRow {
+	row := firmwareRow{Name: t.Name, Host: t.Host}
+	check, err := (&wemo.Device{Host: t.Host}).CheckFirmware(ctx, manifest)
+	switch {
+	case err != nil:
+		row.Status, row.Error, row.code = "unreachable", err.Error(), exitCode(err)
+	case check.Release == nil:
+		row.Current, row.Status = check.Current, "unknown"
+	case check.Available:
+		row.Current, row.Latest, row.Status = check.Current, check.Latest, "update available"
+	default:
+		row.Current, row.Latest, row.Status = check.Current, check.Latest, "up to date"
+	}
+	return row
+}
+
+func firmwareUpdateAction(c *cli.Context) {
+	if c.NArg() != 1 {
+		log.Fatal("expected the device to update")
+	}
+	manifest := loadManifest(c)
+	host, err := resolveHost(c.Args()[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	device := &wemo.Device{Host: host}
+
+	ctx, cancel := context.WithTimeout(context.Background(), userConfig.timeout())
+	defer cancel()
+	check, err := device.CheckFirmware(ctx, manifest)
+	if err != nil {
+		exit(err)
+	}
+	if check.Release == nil {
+		log.Fatalf("the manifest has no firmware for %s", check.Current)
+	}
+	if !check.Available && !c.Bool("force") {
+		fmt.Printf("%s is up to date with %s\n", c.Args()[0], check.Current)
+		return
+	}
+
+	confirm := confirmFirmware(os.Stdin, os.Stdout)
+	if c.Bool("yes") {
+		confirm = func(*wemo.DeviceInfo, *wemo.FirmwareRelease) bool { return true }
+	}
+	if err := device.UpdateFirmware(ctx, check.Release, confirm); err != nil {
+		if err == wemo.ErrNotConfirmed {
+			log.Fatal("firmware update cancelled")
+		}
+		exit(err)
+	}
+	fmt.Printf("Sent the update to %s\n", check.Latest)
+
+	wait := c.Duration("wait")
+	if wait <= 0 {
+		return
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	if err := device.WaitFirmwareUpdate(ctx, 5*time.Second, firmwareProgress(os.Stdout)); err != nil {
+		exit(err)
+	}
+	fmt.Println("The device is installing the update and reboots in a few minutes")
+}
+
+// confirmFirmware asks on out whether to install the release and reads the
+// answer from in.
+func confirmFirmware(in io.Reader, out io.Writer) func(*wemo.DeviceInfo, *wemo.FirmwareRelease) bool {
+	return func(info *wemo.DeviceInfo, release *wemo.FirmwareRelease) bool {
+		if !release.Signed {
+			fmt.Fprintln(out, "The firmware image is unsigned.")
+		}
+		if release.Notes != "" {
+			fmt.Fprintln(out, release.Notes)
+		}
+		fmt.Fprintf(out, "Update %s from %s to %s? An update can't be undone [y/N] ", info.FriendlyName, info.FirmwareVersion, release.Version)
+		answer, _ := bufio.NewReader(in).ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true
+		}
+		return false
+	}
+}
+
+// firmwareProgress prints the status of a firmware update when it changes.
+func firmwareProgress(out io.Writer) func(wemo.FirmwareStatus, error) {
+	last := ""
+	return func(status wemo.FirmwareStatus, err error) {
+		line := status.String()
+		if err != nil {
+			line = err.Error()
+		}
+		if line != last {
+			fmt.Fprintf(out, "%s %s\n", time.Now().Format("15:04:05"), line)
+			last = line
+		}
+	}
+}
+
+// loadManifest reads the manifest given by --manifest or
+// $WEMO_FIRMWARE_MANIFEST.
+func loadManifest(c *cli.Context) *wemo.FirmwareManifest {
+	location := c.String("manifest")
+	if location == "" {
+		location = os.Getenv("WEMO_FIRMWARE_MANIFEST")
+	}
+	if location == "" {
+		log.Fatal("expected the firmware manifest, give --manifest or set $WEMO_FIRMWARE_MANIFEST")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), userConfig.timeout())
+	defer cancel()
+	manifest, err := wemo.LoadFirmwareManifest(ctx, location)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return manifest
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestCheckFirmware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<root><device><deviceType>%s</deviceType><firmwareVersion>WeMo_WW_2.00.11057.PVT-OWRT-SNS</firmwareVersion></device></root>`, wemo.Controllee)
+	}))
+	defer server.Close()
+	manifest := &wemo.FirmwareManifest{Releases: []wemo.FirmwareRelease{
+		{DeviceType: wemo.Controllee, Version: "WeMo_WW_2.00.11420.PVT-OWRT-SNS", URL: "http://example.com/b.bin"},
+	}}
+
+	row := checkFirmware(context.Background(), target{Name: "porch", Host: server.Listener.Addr().String()}, manifest)
+	if row.Status != "update available" || row.Latest != "WeMo_WW_2.00.11420.PVT-OWRT-SNS" || row.code != exitOK {
+		t.Errorf("Expected: an update, got: %+v", row)
+	}
+	row = checkFirmware(context.Background(), target{Name: "porch", Host: server.Listener.Addr().String()}, &wemo.FirmwareManifest{})
+	if row.Status != "unknown" || row.Current != "WeMo_WW_2.00.11057.PVT-OWRT-SNS" {
+		t.Errorf("Expected: an unknown release, got: %+v", row)
+	}
+}
+
+func TestConfirmFirmware(t *testing.T) {
+	info := &wemo.DeviceInfo{FriendlyName: "Porch", FirmwareVersion: "WeMo_WW_2.00.11057.PVT-OWRT-SNS"}
+	release := &wemo.FirmwareRelease{Version: "WeMo_WW_2.00.11420.PVT-OWRT-SNS"}
+
+	for answer, expected := range map[string]bool{"y\n": true, "Yes\n": true, "\n": false, "no\n": false, "": false} {
+		var out bytes.Buffer
+		if confirmed := confirmFirmware(strings.NewReader(answer), &out)(info, release); confirmed != expected {
+			t.Errorf("Expected: %v for %q, got: %v", expected, answer, confirmed)
+		}
+		if !strings.Contains(out.String(), "unsigned") || !strings.Contains(out.String(), "Update Porch from WeMo_WW_2.00.11057") {
+			t.Errorf("Unexpected prompt: %s", out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	progress := firmwareProgress(&out)
+	for _, status := range []wemo.FirmwareStatus{wemo.FirmwareDownloading, wemo.FirmwareDownloading, wemo.FirmwareUpdateStarting} {
+		progress(status, nil)
+	}
+	if lines := strings.Count(out.String(), "\n"); lines != 2 {
+		t.Errorf("Expected: 2 lines of progress, got: %s", out.String())
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/randohm/go.wemo"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+var groupCommand = cli.Command{
+	Name:  "group",
+	Usage: "switch groups of devices and bulbs together",
+	Description: "groups are kept in the home file, which \"wemo daemon\" can import, or by a bridge for its bulbs. " +
+		"Members are devices of the discovery cache given by name, alias or pattern, or bridge bulbs as <bridge>/<bulb id>",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "home", Value: "", Usage: "home file of the groups, defaults to the home of the configuration file or ~/.config/wemo/home.yaml"},
+	},
+	Subcommands: []cli.Command{
+		{
+			Name:      "create",
+			Usage:     "create or replace a group",
+			ArgsUsage: "<name> <member>...",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "bridge", Value: "", Usage: "create a group the bridge keeps of the bulbs with the ids given"},
+			},
+			Action: groupCreateAction,
+		},
+		{
+			Name:   "list",
+			Usage:  "list the groups",
+			Action: groupListAction,
+		},
+		{
+			Name:      "on",
+			Usage:     "switch a group on",
+			ArgsUsage: "<name>",
+			Action:    groupLevelAction(100),
+		},
+		{
+			Name:      "off",
+			Usage:     "switch a group off",
+			ArgsUsage: "<name>",
+			Action:    groupLevelAction(0),
+		},
+		{
+			Name:      "dim",
+			Usage:     "dim a group",
+			ArgsUsage: "<name> <percent>",
+			Action:    groupLevelAction(-1),
+		},
+	},
+}
+
+// homeFile is the home file of the groups.
+func homeFile(c *cli.Context) string {
+	if file := stringOr(c.GlobalString("home"), userConfig.Home); file != "" {
+		return file
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return filepath.Join(dir, "wemo", "home.yaml")
+}
+
+// readHome reads the home file, which is empty when missing.
+func readHome(file string) (*wemo.HomeConfig, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return &wemo.HomeConfig{Version: wemo.HomeConfigVersion}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return wemo.ParseHomeConfig(data)
+}
+
+// groupManager returns the devices of the discovery cache with the groups of
+// the home file.
+func groupManager(c *cli.Context) (*wemo.Manager, error) {
+	m := openCache()
+	if m == nil {
+		return nil, fmt.Errorf("no devices known, run wemo discover first")
+	}
+	home, err := readHome(homeFile(c))
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Import(home); err != nil {
+		return nil, fmt.Errorf("%s: %s", homeFile(c), err)
+	}
+	return m, nil
+}
+
+func groupCreateAction(c *cli.Context) {
+	if c.NArg() < 2 {
+		log.Fatal("expected the name of the group and its members")
+	}
+	name, members := c.Args()[0], c.Args()[1:]
+	m, err := groupManager(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), userConfig.timeout())
+	defer cancel()
+
+	if bridge := c.String("bridge"); bridge != "" {
+		entry, err := lookupDevice(m, bridge)
+		if err != nil {
+			log.Fatal(err)
+		}
+		group, err := entry.Device().CreateBridgeGroup(ctx, name, members)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("created group %s of %s with id %s\n", group.Name, entry.Name, group.ID)
+		return
+	}
+
+	group := wemo.Group{Name: name}
+	for _, member := range members {
+		pattern, bulb := member, ""
+		if i := strings.LastIndex(member, "/"); i > 0 {
+			pattern, bulb = member[:i], member[i+1:]
+		}
+		entries, err := m.Resolve(pattern)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(entries) == 0 {
+			log.Fatalf("no device matches %s", pattern)
+		}
+		for _, entry := range entries {
+			group.Members = append(group.Members, wemo.GroupMember{Device: entry.Key, Bulb: bulb})
+		}
+	}
+	if err := m.SetGroup(group); err != nil {
+		log.Fatal(err)
+	}
+
+	file := homeFile(c)
+	home, err := readHome(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	home.Groups = m.Groups()
+	if home.Devices == nil {
+		home.Devices = []wemo.ManagedDevice{}
+	}
+	data, err := yaml.Marshal(home)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("created group %s of %d members in %s\n", name, len(group.Members), file)
+}
+
+// lookupDevice returns the single device matching pattern.
+func lookupDevice(m *wemo.Manager, pattern string) (wemo.ManagedDevice, error) {
+	entries, err := m.Resolve(pattern)
+	if err != nil {
+		return wemo.ManagedDevice{}, err
+	}
+	if len(entries) != 1 {
+		return wemo.ManagedDevice{}, fmt.Errorf("%s matches %d devices, expected one", pattern, len(entries))
+	}
+	return entries[0], nil
+}
+
+// bridgeGroup is a group of a bridge, as listed.
+type bridgeGroup struct {
+	wemo.BridgeGroup
+	Bridge string `json:"bridge"` // key of the bridge
+	host   string
+}
+
+// bridgeGroups returns the groups of all bridges that answer.
+func bridgeGroups(ctx context.Context, m *wemo.Manager) []bridgeGroup {
+	var groups []bridgeGroup
+	for _, entry := range m.List() {
+		if !entry.Capabilities().Has(wemo.CapBulbs) {
+			continue
+		}
+		found, err := entry.Device().FetchBridgeGroups(ctx, entry.UDN)
+		if err != nil {
+			log.Printf("groups of %s: %s", entry.Name, err)
+			continue
+		}
+		for _, group := range found {
+			groups = append(groups, bridgeGroup{BridgeGroup: group, Bridge: entry.Key, host: entry.Host})
+		}
+	}
+	return groups
+}
+
+func groupListAction(c *cli.Context) {
+	m, err := groupManager(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), userConfig.timeout())
+	defer cancel()
+	bridges := bridgeGroups(ctx, m)
+
+	if jsonOutput(c) {
+		printJSON(struct {
+			Groups       []wemo.Group  `json:"groups"`
+			BridgeGroups []bridgeGroup `json:"bridge-groups"`
+		}{m.Groups(), append([]bridgeGroup{}, bridges...)})
+		return
+	}
+	for _, group := range m.Groups() {
+		var members []string
+		for _, member := range group.Members {
+			name := member.Device
+			if entry, ok := m.Get(member.Device); ok {
+				name = entry.Name
+			}
+			if member.Bulb != "" {
+				name += "/" + member.Bulb
+			}
+			members = append(members, name)
+		}
+		fmt.Printf("%-20s %s\n", group.Name, strings.Join(members, ", "))
+	}
+	for _, group := range bridges {
+		bridge, _ := m.Get(group.Bridge)
+		fmt.Printf("%-20s %s (bridge %s, group %s)\n", group.Name, strings.Join(group.Bulbs, ", "), bridge.Name, group.ID)
+	}
+}
+
+// groupLevelAction sets the group to level percent, or to the level given
+// after its name for a negative level.
+func groupLevelAction(level int) func(c *cli.Context) {
+	return func(c *cli.Context) {
+		if c.NArg() < 1 {
+			log.Fatal("expected the name of the group")
+		}
+		name, level := c.Args()[0], level
+		if level < 0 {
+			var err error
+			if level, err = strconv.Atoi(strings.TrimSuffix(c.Args().Get(1), "%")); err != nil || level < 0 || level > 100 {
+				log.Fatal("expected the level in percent, 0-100")
+			}
+		}
+		m, err := groupManager(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), userConfig.timeout())
+		defer cancel()
+
+		for _, group := range m.Groups() {
+			if strings.EqualFold(group.Name, name) {
+				if err := m.GroupSetLevel(ctx, group.Name, level); err != nil {
+					log.Fatal(err)
+				}
+				return
+			}
+		}
+		for _, group := range bridgeGroups(ctx, m) {
+			if strings.EqualFold(group.Name, name) || group.ID == name {
+				if err := setBridgeGroupLevel(ctx, &wemo.Device{Host: group.host}, group.ID, level); err != nil {
+					log.Fatal(err)
+				}
+				return
+			}
+		}
+		log.Fatalf("unknown group %s", name)
+	}
+}
+
+// setBridgeGroupLevel sets a group of a bridge to level percent, the way
+// wemo.Manager.GroupSetLevel sets bulbs.
+func setBridgeGroupLevel(ctx context.Context, bridge *wemo.Device, id string, level int) error {
+	if level == 0 {
+		return bridge.SetBulb(ctx, id, "off", "", true)
+	}
+	if err := bridge.SetBulb(ctx, id, "on", "", true); err != nil {
+		return err
+	}
+	return bridge.SetBulb(ctx, id, "dim", strconv.Itoa(level*255/100), true)
+}
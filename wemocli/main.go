@@ -26,6 +26,12 @@ func main() {
 	app.Name = "wemo"
 	app.Usage = "command line interface wemo"
 	app.Version = "0.1"
+	app.EnableBashCompletion = true
+	app.Flags = []cli.Flag{jsonFlag, configFlag, debugFlag}
+	app.Before = func(c *cli.Context) error {
+		setupDebug(c)
+		return loadConfig(c)
+	}
 	app.Commands = []cli.Command{
 		discoverCommand,
 		onCommand,
@@ -35,6 +41,19 @@ func main() {
 		bulbStatusCommand,
 		insightCommand,
 		statusCommand,
+		exporterCommand,
+		apiCommand,
+		telegrafCommand,
+		daemonCommand,
+		watchCommand,
+		serveCommand,
+		completionCommand,
+		groupCommand,
+		scheduleCommand,
+		renameCommand,
+		firmwareCommand,
+		setupCommand,
+		monitorCommand,
 	}
 	app.Run(os.Args)
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/randohm/go.wemo"
+)
+
+// openManager loads the device inventory from store, or scans the network
+// when there is no store or it has no devices yet.
+func openManager(store string) (*wemo.Manager, error) {
+	m := wemo.NewManager()
+	if store != "" {
+		m.Store = wemo.FileDeviceStore(store)
+		if err := m.Load(); err != nil {
+			return nil, err
+		}
+	}
+	if len(m.List()) == 0 {
+		if _, err := m.Scan(context.Background()); err != nil {
+			return nil, err
+		}
+		if err := m.Save(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// registryManager returns a manager of the devices "wemo discover" last found
+// and those of the configuration file, which are contacted to be registered.
+// Without any, the network is scanned and the devices found are cached.
+func registryManager(ctx context.Context) (*wemo.Manager, error) {
+	m := openCache()
+	if m == nil {
+		m = wemo.NewManager()
+	}
+
+	hosts := map[string]bool{}
+	for _, entry := range m.List() {
+		hosts[entry.Host] = true
+	}
+	for _, device := range userConfig.Devices {
+		if hosts[device.Host] {
+			continue
+		}
+		entry, err := m.Add(ctx, &wemo.Device{Host: device.Host})
+		if err != nil {
+			log.Printf("unable to register %s => %s", device.Name, err)
+			continue
+		}
+		for _, alias := range append([]string{device.Name}, device.Aliases...) {
+			m.SetAlias(entry.Key, alias)
+		}
+	}
+
+	if len(m.List()) == 0 {
+		found, err := m.Scan(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := saveCache(found); err != nil {
+			log.Printf("unable to update the device cache => %s", err)
+		}
+	}
+	return m, nil
+}
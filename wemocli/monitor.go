@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/randohm/go.wemo"
+	"github.com/randohm/go.wemo/wemoprom"
+	"github.com/urfave/cli"
+)
+
+var monitorCommand = cli.Command{
+	Name:  "monitor",
+	Usage: "keep track of all known devices and serve their metrics for Prometheus",
+	Description: "serve the metrics of \"wemo exporter\" for the devices \"wemo discover\" found and those of the configuration " +
+		"file, without a configuration of its own. States are kept current from device events, or from polling with --poll, " +
+		"so scrapes are answered from what is known",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "listen", Value: ":9148", Usage: "address to serve metrics on"},
+		cli.StringFlag{Name: "events", Value: ":6767", Usage: "address to receive device events on"},
+		cli.StringFlag{Name: "callback", Value: "", Usage: "host:port the devices send events to, defaults to this host's address on the events port"},
+		cli.DurationFlag{Name: "poll", Usage: "poll the states at this interval instead of subscribing to events"},
+		cli.DurationFlag{Name: "rediscover", Value: 10 * time.Minute, Usage: "how often to look for devices that moved, 0 to not look"},
+		cli.StringSliceFlag{Name: "label", Usage: "registry label to add to the metrics, e.g. room"},
+		cli.BoolFlag{Name: "signal", Usage: "read the WiFi signal of all devices"},
+	},
+	Action: monitorAction,
+}
+
+func monitorAction(c *cli.Context) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m, err := registryManager(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	if interval := c.Duration("poll"); interval > 0 {
+		go m.PollStates(ctx, interval)
+	} else {
+		listener, err := net.Listen("tcp", c.String("events"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		callback := c.String("callback")
+		if callback == "" {
+			if callback, err = callbackAddress(m, listener.Addr()); err != nil {
+				log.Fatal(err)
+			}
+		}
+		events := &wemo.EventListener{Manager: m, Callback: callback, Logger: log.Printf}
+		eventMux := http.NewServeMux()
+		eventMux.Handle("/listener", events)
+		go http.Serve(listener, eventMux)
+		go events.Run(ctx)
+	}
+	if interval := c.Duration("rediscover"); interval > 0 {
+		go m.Rediscover(ctx, interval, func(change wemo.HostChange) {
+			log.Printf("%s moved from %s to %s", change.Device.Name, change.OldHost, change.Device.Host)
+		})
+	}
+
+	collector := wemoprom.NewCollector(m, c.StringSlice("label")...)
+	collector.SignalStrength = c.Bool("signal")
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	metrics := wemoprom.NewMetrics()
+	registry.MustRegister(metrics)
+	wemo.SetMetrics(metrics)
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{Addr: c.String("listen"), Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	log.Printf("serving metrics of %d devices on %s", len(m.List()), c.String("listen"))
+	if err := server.ListenAndServe(); err != nil && ctx.Err() == nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestRegistryManager(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	defer func(c cliConfig) { userConfig = c }(userConfig)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<root><device><deviceType>%s</deviceType><friendlyName>Porch Light</friendlyName><serialNumber>P</serialNumber><UDN>uuid:Socket-1_0-P</UDN></device></root>`, wemo.Controllee)
+	}))
+	defer server.Close()
+	userConfig = cliConfig{Devices: []configDevice{
+		{Name: "porch", Host: server.Listener.Addr().String()},
+		{Name: "kettle", Host: "192.168.1.9:49153"}, // cached, not contacted
+	}}
+	saveCache([]wemo.ManagedDevice{{Name: "Kettle", Host: "192.168.1.9:49153", Serial: "A"}})
+
+	m, err := registryManager(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.List()) != 2 {
+		t.Fatalf("Expected: 2 devices, got: %+v", m.List())
+	}
+	if entries, _ := m.Resolve("porch"); len(entries) != 1 || entries[0].Key != "uuid:Socket-1_0-P" {
+		t.Errorf("Expected: the porch light by its alias, got: %+v", entries)
+	}
+}
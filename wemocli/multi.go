@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli"
+)
+
+// target is one device of a command given several devices.
+type target struct {
+	Name string
+	Host string
+}
+
+// isMulti reports whether arg names several devices, as a comma separated
+// list or a pattern such as "garden*".
+func isMulti(arg string) bool {
+	return strings.ContainsAny(arg, ",*?[")
+}
+
+// resolveTargets returns the devices of a comma separated list of hosts,
+// names, aliases and patterns, matched against the configuration file and the
+// devices "wemo discover" last found. Each part has to match a device.
+func resolveTargets(arg string) ([]target, error) {
+	var targets []target
+	seen := map[string]bool{}
+	var matched bool
+	add := func(name, host string) {
+		matched = true
+		if !seen[host] {
+			seen[host] = true
+			targets = append(targets, target{Name: name, Host: host})
+		}
+	}
+
+	cache := openCache()
+	for _, part := range strings.Split(arg, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if _, err := path.Match(part, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q => %s", part, err)
+		}
+		if _, port, err := net.SplitHostPort(part); err == nil && port != "" {
+			add(part, part)
+			continue
+		}
+
+		matched = false
+		for _, device := range userConfig.Devices {
+			for _, name := range append([]string{device.Name}, device.Aliases...) {
+				if ok, _ := path.Match(strings.ToLower(part), strings.ToLower(name)); ok {
+					add(device.Name, device.Host)
+					break
+				}
+			}
+		}
+		if cache != nil {
+			entries, err := cache.Resolve(part)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				add(entry.Name, entry.Host)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no device matches %s", part)
+		}
+	}
+	return targets, nil
+}
+
+// commandTargets returns the devices given as arguments, each a device or
+// devices as resolveTargets takes them, or all known devices without
+// arguments.
+func commandTargets(args []string) ([]target, error) {
+	var targets []target
+	if len(args) == 0 {
+		for _, entry := range knownDevices() {
+			targets = append(targets, target{Name: entry.Name, Host: entry.Host})
+		}
+		if len(targets) == 0 {
+			return nil, fmt.Errorf("no known devices, run wemo discover or add them to %s", stringOr(userConfig.file, "a configuration file"))
+		}
+		return targets, nil
+	}
+	for _, arg := range args {
+		if isMulti(arg) {
+			more, err := resolveTargets(arg)
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, more...)
+			continue
+		}
+		host, err := resolveHost(arg)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target{Name: arg, Host: host})
+	}
+	return targets, nil
+}
+
+// powerResult is the outcome of a command on one of several devices.
+type powerResult struct {
+	Name  string `json:"name"`
+	Host  string `json:"host"`
+	State string `json:"state,omitempty"`
+	Error string `json:"error,omitempty"`
+
+	code int
+}
+
+// runPower runs action on all targets at once, see switchDevice.
+func runPower(targets []target, action string) []powerResult {
+	results := make([]powerResult, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), userConfig.timeout())
+			defer cancel()
+
+			results[i] = powerResult{Name: t.Name, Host: t.Host}
+			state, err := switchDevice(ctx, t.Host, action)
+			if err != nil {
+				results[i].Error = err.Error()
+				results[i].code = exitCode(err)
+				return
+			}
+			results[i].State = stateName(state)
+		}(i, t)
+	}
+	wg.Wait()
+	return results
+}
+
+// multiPowerAction runs action on the devices of the first argument, prints a
+// line per device and exits with the highest exit code of them.
+func multiPowerAction(c *cli.Context, action string) {
+	targets, err := resolveTargets(c.Args()[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	results := runPower(targets, action)
+
+	if jsonOutput(c) {
+		printJSON(results)
+	} else {
+		format := "%-20s %-21s %s\n"
+		fmt.Printf(format, "DEVICE", "HOST", "RESULT")
+		for _, result := range results {
+			fmt.Printf(format, result.Name, result.Host, stringOr(result.State, "error: "+result.Error))
+		}
+	}
+
+	code := exitOK
+	for _, result := range results {
+		if result.code > code {
+			code = result.code
+		}
+	}
+	os.Exit(code)
+}
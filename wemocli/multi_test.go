@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestResolveTargets(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	defer func(c cliConfig) { userConfig = c }(userConfig)
+	userConfig = cliConfig{Devices: []configDevice{{Name: "Porch Light", Host: "192.168.1.8:49153", Aliases: []string{"porch"}}}}
+
+	saveCache([]wemo.ManagedDevice{
+		{Name: "Kettle", Host: "192.168.1.9:49153", Serial: "A"},
+		{Name: "Kitchen Lamp", Host: "192.168.1.10:49153", Serial: "B"},
+		{Name: "Porch Light", Host: "192.168.1.8:49153", Serial: "C"},
+	})
+
+	targets, err := resolveTargets("porch, k*,porch light,10.0.1.2:49128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []target{
+		{Name: "Porch Light", Host: "192.168.1.8:49153"},
+		{Name: "Kettle", Host: "192.168.1.9:49153"},
+		{Name: "Kitchen Lamp", Host: "192.168.1.10:49153"},
+		{Name: "10.0.1.2:49128", Host: "10.0.1.2:49128"},
+	}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("Expected: %v, got: %v", expected, targets)
+	}
+	if _, err := resolveTargets("porch,garage"); err == nil {
+		t.Error("Expected: an error for an unknown device, got: nil")
+	}
+}
+
+func TestRunPower(t *testing.T) {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<s:Envelope><s:Body><u:SetBinaryStateResponse><BinaryState>1</BinaryState></u:SetBinaryStateResponse></s:Body></s:Envelope>`))
+	}))
+	defer device.Close()
+	fault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer fault.Close()
+
+	results := runPower([]target{
+		{Name: "porch", Host: device.Listener.Addr().String()},
+		{Name: "garden", Host: fault.Listener.Addr().String()},
+	}, "on")
+	if results[0].State != "on" || results[0].code != exitOK {
+		t.Errorf("Expected: on, got: %+v", results[0])
+	}
+	if results[1].Error == "" || results[1].code != exitFault {
+		t.Errorf("Expected: a fault, got: %+v", results[1])
+	}
+}
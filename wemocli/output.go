@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/randohm/go.wemo"
+	"github.com/urfave/cli"
+)
+
+var jsonFlag = cli.BoolFlag{Name: "json", Usage: "print the documents of the wemo schemas as JSON instead of text"}
+
+// jsonOutput reports whether --json was given or JSON is the configured
+// output.
+func jsonOutput(c *cli.Context) bool {
+	return c.GlobalBool("json") || userConfig.Output == "json"
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// hostEntry registers the device at host with a new manager, so the commands
+// that take a --host report the same keys as the registry.
+func hostEntry(ctx context.Context, host string) (*wemo.Manager, wemo.ManagedDevice, error) {
+	m := wemo.NewManager()
+	entry, err := m.Add(ctx, &wemo.Device{Host: host})
+	return m, entry, err
+}
+
+// printState prints the state of the device at host as a wemo.StateDoc.
+func printState(host string) {
+	ctx, cancel := context.WithTimeout(context.Background(), userConfig.timeout())
+	defer cancel()
+
+	m, entry, err := hostEntry(ctx, host)
+	if err != nil {
+		exit(err)
+	}
+	state, err := m.State(ctx, entry.Key)
+	if err != nil {
+		exit(err)
+	}
+	printJSON(wemo.NewStateDoc(entry.Key, state, time.Now()))
+}
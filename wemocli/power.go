@@ -1,59 +1,75 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
-	"github.com/gecgooden/go.wemo"
+	"github.com/randohm/go.wemo"
 	"github.com/urfave/cli"
 )
 
 var onCommand = cli.Command{
-	Name: "on",
-	Flags: []cli.Flag{
+	Name:         "on",
+	Description:  exitCodesHelp + ". " + countdownHelp,
+	ArgsUsage:    "[device|devices]",
+	BashComplete: completeDevices,
+	Flags: append([]cli.Flag{
 		cli.StringFlag{Name: "host", Value: "192.168.1.8:49153", Usage: "device host and ip e.g. 10.0.1.2:49128"},
-	},
+	}, countdownFlags...),
 	Action: onAction,
 }
 
 func onAction(c *cli.Context) {
-	host := c.String("host")
-	device := &wemo.Device{
-		Host: host,
-	}
-	device.On()
+	powerAction(c, "on")
 }
 
 var statusCommand = cli.Command{
-	Name: "status",
+	Name:  "status",
+	Usage: "print the state of a device, or a table of all known devices",
+	Description: "without a device, print a table of the name, model, IP, state, current power of Insights, signal " +
+		"strength and last sighting of the devices \"wemo discover\" found and those of the configuration file. " + exitCodesHelp,
+	ArgsUsage:    "[device|devices]",
+	BashComplete: completeDevices,
 	Flags: []cli.Flag{
-		cli.StringFlag{Name: "host", Value: "192.168.1.8:49153", Usage: "device host and ip e.g. 10.0.1.2:49128"},
+		cli.StringFlag{Name: "host", Value: "", Usage: "device host and ip e.g. 10.0.1.2:49128"},
+		cli.StringFlag{Name: "sort", Value: "name", Usage: "sort the table by this column: " + strings.Join(statusColumnNames(), ", ")},
+		cli.BoolFlag{Name: "reverse", Usage: "sort the table in reverse order"},
+		cli.DurationFlag{Name: "watch", Usage: "refresh the table at this interval, e.g. 5s"},
 	},
 	Action: statusAction,
 }
 
 func statusAction(c *cli.Context) {
-	host := c.String("host")
-	device := &wemo.Device{
-		Host: host,
-	}
-	if binaryState := device.GetBinaryState(); binaryState == 1 {
-		fmt.Printf("Device is on\n")
-	} else {
-		fmt.Printf("Device is off\n")
+	if c.NArg() == 0 && c.String("host") == "" {
+		statusTableAction(c)
+		return
 	}
+	powerAction(c, "status")
 }
 
 var insightCommand = cli.Command{
-	Name: "insight",
+	Name:         "insight",
+	ArgsUsage:    "[device]",
+	BashComplete: completeDevices,
 	Flags: []cli.Flag{
 		cli.StringFlag{Name: "host", Value: "192.168.1.8:49153", Usage: "device host and ip e.g. 10.0.1.2:49128"},
 	},
-	Action: insightAction,
+	Subcommands: []cli.Command{insightExportCommand},
+	Action:      insightAction,
 }
 
 func insightAction(c *cli.Context) {
-	host := c.String("host")
+	host, err := deviceHost(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if jsonOutput(c) {
+		printInsight(host)
+		return
+	}
 	device := &wemo.Device{
 		Host: host,
 	}
@@ -89,23 +105,25 @@ func insightAction(c *cli.Context) {
 }
 
 var offCommand = cli.Command{
-	Name: "off",
-	Flags: []cli.Flag{
+	Name:         "off",
+	Description:  exitCodesHelp + ". " + countdownHelp,
+	ArgsUsage:    "[device|devices]",
+	BashComplete: completeDevices,
+	Flags: append([]cli.Flag{
 		cli.StringFlag{Name: "host", Value: "", Usage: "device host and ip e.g. 10.0.1.2:49128"},
-	},
+	}, countdownFlags...),
 	Action: offAction,
 }
 
 func offAction(c *cli.Context) {
-	host := c.String("host")
-	device := &wemo.Device{
-		Host: host,
-	}
-	device.Off()
+	powerAction(c, "off")
 }
 
 var toggleCommand = cli.Command{
-	Name: "toggle",
+	Name:         "toggle",
+	Description:  exitCodesHelp,
+	ArgsUsage:    "[device|devices]",
+	BashComplete: completeDevices,
 	Flags: []cli.Flag{
 		cli.StringFlag{Name: "host", Value: "192.168.1.8:49153", Usage: "device host and ip e.g. 10.0.1.2:49128"},
 	},
@@ -113,11 +131,105 @@ var toggleCommand = cli.Command{
 }
 
 func toggleAction(c *cli.Context) {
-	host := c.String("host")
+	powerAction(c, "toggle")
+}
+
+// powerAction switches the device on, off or, for toggle, to the opposite of
+// its state, and prints the state toggle or status leave it in. Failures exit
+// with exitUnreachable or exitFault. Given several devices, e.g. "porch,garden*",
+// it runs on all of them at once, see multiPowerAction. on and off take --for
+// and --after, see switchFor and waitAfter.
+func powerAction(c *cli.Context, action string) {
+	if c.NArg() > 0 && isMulti(c.Args()[0]) {
+		if c.IsSet("for") || c.Bool("rule") {
+			log.Fatal("--for takes a single device")
+		}
+		if waitAfter(c) {
+			log.Fatal("interrupted, the devices were not switched")
+		}
+		multiPowerAction(c, action)
+		return
+	}
+	host, err := deviceHost(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if action == "status" && jsonOutput(c) {
+		printState(host)
+		return
+	}
+	if waitAfter(c) {
+		log.Fatal("interrupted, the device was not switched")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), userConfig.timeout())
+	defer cancel()
+
+	if c.Bool("rule") && (action != "on" || c.Duration("for") <= 0) {
+		log.Fatal("--rule only installs countdowns turning devices off, give it to on with --for")
+	}
+	if countdown := c.Duration("for"); countdown > 0 {
+		var message string
+		if c.Bool("rule") {
+			message, err = switchOnWithRule(ctx, host, countdown)
+		} else {
+			message, err = switchFor(host, action == "on", countdown)
+		}
+		if err != nil {
+			exit(err)
+		}
+		if jsonOutput(c) {
+			printState(host)
+		} else {
+			fmt.Println(message)
+		}
+		return
+	} else if c.IsSet("for") {
+		if err := clearCountdown(ctx, host); err != nil {
+			exit(err)
+		}
+	}
+
+	state, err := switchDevice(ctx, host, action)
+	if err != nil {
+		exit(err)
+	}
+	switch {
+	case jsonOutput(c):
+		printState(host)
+	case action == "toggle", action == "status":
+		printPower(state == 1)
+	}
+}
+
+// switchDevice runs action, one of on, off, toggle and status, on the device
+// at host and returns the binary state it leaves the device in.
+func switchDevice(ctx context.Context, host, action string) (int, error) {
 	device := &wemo.Device{
 		Host: host,
 	}
-	device.Toggle()
+	if action == "on" || action == "off" {
+		return boolState(action == "on"), device.SetBinaryState(ctx, action == "on")
+	}
+	state, err := device.FetchBinaryState(ctx)
+	if err != nil || action == "status" {
+		return state, err
+	}
+	return boolState(state == 0), device.SetBinaryState(ctx, state == 0)
+}
+
+func boolState(on bool) int {
+	if on {
+		return 1
+	}
+	return 0
+}
+
+func printPower(on bool) {
+	if on {
+		fmt.Printf("Device is on\n")
+	} else {
+		fmt.Printf("Device is off\n")
+	}
 }
 
 var bulbCommand = cli.Command{
@@ -128,11 +240,15 @@ var bulbCommand = cli.Command{
 		cli.StringFlag{Name: "host", Value: "192.168.1.25:49153", Usage: "device host and ip e.g. 10.0.1.2:49128"},
 		cli.StringFlag{Name: "id", Value: "", Usage: "device id"},
 	},
-	Action: bulbAction,
+	Subcommands: []cli.Command{bulbCTCommand, bulbColorCommand},
+	Action:      bulbAction,
 }
 
 func bulbAction(c *cli.Context) {
-	host := c.String("host")
+	host, err := resolveHost(c.String("host"))
+	if err != nil {
+		log.Fatal(err)
+	}
 	id := c.String("id")
 	args := c.Args()
 
@@ -149,10 +265,13 @@ func bulbAction(c *cli.Context) {
 		Host: host,
 	}
 
-	err := device.Bulb(id, cmd, value, false)
+	err = device.Bulb(id, cmd, value, false)
 	if err != nil {
 		log.Println(err)
 	}
+	if jsonOutput(c) {
+		printState(host)
+	}
 }
 
 var bulbStatusCommand = cli.Command{
@@ -167,8 +286,15 @@ var bulbStatusCommand = cli.Command{
 }
 
 func bulbStatusAction(c *cli.Context) {
-	host := c.String("host")
+	host, err := resolveHost(c.String("host"))
+	if err != nil {
+		log.Fatal(err)
+	}
 	id := c.String("id")
+	if jsonOutput(c) {
+		printState(host)
+		return
+	}
 
 	device := &wemo.Device{
 		Host: host,
@@ -183,3 +309,20 @@ func bulbStatusAction(c *cli.Context) {
 		fmt.Println("DeviceID:", k, "State:", v)
 	}
 }
+
+// printInsight prints the Insight readings of the device at host as a
+// wemo.InsightDoc.
+func printInsight(host string) {
+	ctx, cancel := context.WithTimeout(context.Background(), userConfig.timeout())
+	defer cancel()
+
+	m, entry, err := hostEntry(ctx, host)
+	if err != nil {
+		log.Fatal(err)
+	}
+	params, err := m.InsightParams(ctx, entry.Key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	printJSON(wemo.NewInsightDoc(entry.Key, wemo.InsightReading{Host: host, Time: time.Now(), Params: *params}))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/randohm/go.wemo"
+	"github.com/urfave/cli"
+)
+
+var renameCommand = cli.Command{
+	Name:      "rename",
+	Usage:     "change the friendly name of a device or bulb",
+	ArgsUsage: "<device> <new-name>",
+	Description: "rename the device, or with --id the bulb of that id paired with the device, a bridge. The devices " +
+		"\"wemo discover\" found are renamed as well, so the new name works right away",
+	BashComplete: completeDevices,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "id", Value: "", Usage: "end device id of a bulb of the bridge"},
+	},
+	Action: renameAction,
+}
+
+func renameAction(c *cli.Context) {
+	if c.NArg() != 2 {
+		log.Fatal("expected the device and its new name")
+	}
+	host, err := resolveHost(c.Args()[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	name := c.Args()[1]
+
+	ctx, cancel := context.WithTimeout(context.Background(), userConfig.timeout())
+	defer cancel()
+	device := &wemo.Device{Host: host}
+	if id := c.String("id"); id != "" {
+		if err := device.ChangeBulbName(ctx, id, name); err != nil {
+			exit(err)
+		}
+		return
+	}
+	if err := device.ChangeFriendlyName(ctx, name); err != nil {
+		exit(err)
+	}
+	if err := renameCached(host, name); err != nil {
+		log.Printf("unable to update the device cache => %s", err)
+	}
+}
+
+// renameCached renames the device at host in the discovery cache, if it is
+// there.
+func renameCached(host, name string) error {
+	m := openCache()
+	if m == nil {
+		return nil
+	}
+	for _, entry := range m.List() {
+		if entry.Host == host {
+			entry.Name = name
+			if _, err := m.Put(entry); err != nil {
+				return err
+			}
+			return m.Save()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestRenameCached(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	defer func(c cliConfig) { userConfig = c }(userConfig)
+	userConfig = cliConfig{}
+
+	saveCache([]wemo.ManagedDevice{{Name: "Kettle", Host: "192.168.1.9:49153", Serial: "A", Aliases: []string{"tea"}}})
+	if err := renameCached("192.168.1.9:49153", "Tea Kettle"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"tea kettle", "tea"} {
+		if host, err := resolveHost(name); err != nil || host != "192.168.1.9:49153" {
+			t.Errorf("Expected: 192.168.1.9:49153 for %s, got: %s (%v)", name, host, err)
+		}
+	}
+	if _, err := resolveHost("kettle"); err == nil {
+		t.Error("Expected: an error for the old name, got: nil")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/randohm/go.wemo"
+	"github.com/urfave/cli"
+)
+
+var scheduleCommand = cli.Command{
+	Name:  "schedule",
+	Usage: "list, add and remove the rules a device runs itself",
+	Description: "schedules are written as days, a time or sun event and an action, e.g. \"weekdays 07:00 on\", " +
+		"\"mon,wed,fri at 22:30 off\" or \"daily sunset-30m on\". They are stored in the rules of the device, " +
+		"next to those made in the Belkin app",
+	Subcommands: []cli.Command{
+		{
+			Name:         "list",
+			Usage:        "list the rules of a device",
+			ArgsUsage:    "<device>",
+			BashComplete: completeDevices,
+			Action:       scheduleListAction,
+		},
+		{
+			Name:         "add",
+			Usage:        "add a schedule to a device",
+			ArgsUsage:    "<device> <schedule>",
+			BashComplete: completeDevices,
+			Action:       scheduleAddAction,
+		},
+		{
+			Name:         "rm",
+			Usage:        "remove a rule from a device",
+			ArgsUsage:    "<device> <rule id>",
+			BashComplete: completeDevices,
+			Action:       scheduleRemoveAction,
+		},
+	},
+}
+
+// scheduleDevice returns the device given by the first argument with its UDN,
+// and the context to command it in.
+func scheduleDevice(c *cli.Context) (*wemo.Device, string, context.Context, context.CancelFunc) {
+	if c.NArg() < 1 {
+		log.Fatal("expected the device")
+	}
+	host, err := resolveHost(c.Args()[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), userConfig.timeout())
+	device := &wemo.Device{Host: host}
+	info, err := device.FetchDeviceInfo(ctx)
+	if err != nil {
+		cancel()
+		log.Fatal(err)
+	}
+	return device, info.UDN, ctx, cancel
+}
+
+func scheduleListAction(c *cli.Context) {
+	device, _, ctx, cancel := scheduleDevice(c)
+	defer cancel()
+	db, err := device.FetchRules(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if jsonOutput(c) {
+		printJSON(append([]wemo.Rule{}, db.Rules...))
+		return
+	}
+	format := "%4s  %-8s  %-36s  %s\n"
+	fmt.Printf(format, "ID", "Enabled", "Schedule", "Name")
+	for _, rule := range db.Rules {
+		schedule, ok := wemo.FormatRuleSchedule(rule)
+		if !ok {
+			schedule = rule.Type
+		}
+		enabled := "no"
+		if rule.Enabled {
+			enabled = "yes"
+		}
+		fmt.Printf(format, strconv.Itoa(rule.ID), enabled, schedule, rule.Name)
+	}
+}
+
+func scheduleAddAction(c *cli.Context) {
+	if c.NArg() < 2 {
+		log.Fatal("expected the device and the schedule, e.g. \"weekdays 07:00 on\"")
+	}
+	spec := strings.Join(c.Args()[1:], " ")
+	if _, err := wemo.ParseRuleSchedule(spec); err != nil {
+		log.Fatal(err)
+	}
+
+	device, udn, ctx, cancel := scheduleDevice(c)
+	defer cancel()
+	rule, _ := wemo.ParseRuleSchedule(spec, udn)
+	var added *wemo.Rule
+	var warnings []string
+	if err := device.UpdateRules(ctx, func(db *wemo.RulesDB) error {
+		added = db.AddRule(rule)
+		warnings = db.Warnings()
+		return nil
+	}); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("added rule %d: %s\n", added.ID, spec)
+	for _, warning := range warnings {
+		log.Printf("warning: %s", warning)
+	}
+}
+
+func scheduleRemoveAction(c *cli.Context) {
+	if c.NArg() != 2 {
+		log.Fatal("expected the device and the id of the rule")
+	}
+	id, err := strconv.Atoi(c.Args()[1])
+	if err != nil {
+		log.Fatalf("unable to parse rule id %q", c.Args()[1])
+	}
+	device, _, ctx, cancel := scheduleDevice(c)
+	defer cancel()
+	if err := device.RemoveRule(ctx, id); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("removed rule %d\n", id)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+
+	"github.com/urfave/cli"
+)
+
+var serveCommand = cli.Command{
+	Name:      "serve",
+	Usage:     "run the daemon from a configuration file",
+	ArgsUsage: "<config.yaml>",
+	Description: `run what "wemo daemon" runs, plus webhooks, InfluxDB, Graphite, a relay and a HomeKit bridge, as set up in a YAML or JSON file:
+
+   store: /var/lib/wemo/devices.json   # device inventory, scanned when missing
+   home: /etc/wemo/home.yaml           # devices, aliases, groups and scenes to import
+   rediscover: 10m
+   health: 1m
+   api: {listen: ":8080", token: secret}
+   events: {listen: ":6767", callback: "192.168.1.2:6767"}
+   mqtt: {broker: "tcp://localhost:1883", prefix: wemo, layout: zigbee2mqtt, homeassistant: true}
+   webhooks: [{url: "https://example.com/hook", secret: s3cret, events: [state]}]
+   influx: {url: "http://localhost:8086", org: home, bucket: energy, token: t0ken, labels: [room]}
+   graphite: {address: "localhost:2003", template: "home.{room}.{name}"}
+   relay: {url: "wss://relay.example.com/home", token: t0ken}
+   homekit: {name: WeMo, pin: "12344321", store: /var/lib/wemo/homekit}
+   history: {file: /var/lib/wemo/insight.jsonl, interval: 1m}
+
+Only the parts given are run; the API and the event listener always are`,
+	Action: serveAction,
+}
+
+func serveAction(c *cli.Context) {
+	if c.NArg() != 1 {
+		log.Fatal("expected the configuration file")
+	}
+	config, err := loadDaemonConfig(c.Args()[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := runDaemon(config); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// loadDaemonConfig reads a configuration written as YAML or JSON, with the
+// field names of its JSON.
+func loadDaemonConfig(file string) (daemonConfig, error) {
+	var config daemonConfig
+	err := readConfig(file, &config)
+	return config, err
+}
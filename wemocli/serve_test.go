@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDaemonConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "wemo.yaml")
+	ioutil.WriteFile(file, []byte(`
+store: devices.json
+rediscover: 5m
+api: {listen: ":9090", token: secret}
+mqtt:
+  broker: tcp://localhost:1883
+  layout: zigbee2mqtt
+webhooks:
+  - url: https://example.com/hook
+    events: [state]
+graphite: {address: "localhost:2003"}
+homekit: {pin: "12344321"}
+`), 0600)
+
+	config, err := loadDaemonConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Store != "devices.json" || time.Duration(config.Rediscover) != 5*time.Minute || config.API.Listen != ":9090" {
+		t.Errorf("Unexpected config: %+v", config)
+	}
+	if config.MQTT == nil || config.MQTT.Layout != "zigbee2mqtt" || len(config.Webhooks) != 1 || config.Graphite == nil || config.Influx != nil || config.HomeKit == nil || config.HomeKit.Pin != "12344321" {
+		t.Errorf("Unexpected config: %+v", config)
+	}
+
+	ioutil.WriteFile(file, []byte("api: {listne: \":9090\"}\n"), 0600)
+	if _, err := loadDaemonConfig(file); err == nil || !strings.Contains(err.Error(), "listne") {
+		t.Errorf("Expected: an error for the unknown field, got: %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/randohm/go.wemo"
+	"github.com/urfave/cli"
+)
+
+var setupCommand = cli.Command{
+	Name:  "setup",
+	Usage: "set up a new or reset device",
+	Description: "join the \"WeMo.*\" network of a device in setup mode with this machine, then run wemo setup. It waits for " +
+		"the device, lists the networks the device sees, asks for the password and a name, and hands the device the " +
+		"network. Once the device joined, this machine has to be back on that network to find and name the device. " +
+		"With --state an interrupted setup continues where it stopped",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "ssid", Value: "", Usage: "network to join, instead of choosing from the list"},
+		cli.StringFlag{Name: "password", Value: "", Usage: "password of the network, defaults to $WEMO_WIFI_PASSWORD or asking"},
+		cli.StringFlag{Name: "name", Value: "", Usage: "friendly name to give the device, instead of asking"},
+		cli.StringFlag{Name: "remote", Value: "", Usage: "on or off to enable or disable remote access, left as it is by default"},
+		cli.StringFlag{Name: "state", Value: "", Usage: "file to keep the progress in, to continue an interrupted setup"},
+		cli.StringFlag{Name: "setup-host", Value: wemo.SetupHost, Usage: "address of the device on its own network"},
+		cli.DurationFlag{Name: "wait", Value: 2 * time.Minute, Usage: "how long to wait for a device in setup mode"},
+	},
+	Action: setupAction,
+}
+
+func setupAction(c *cli.Context) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+
+	provisioner := &wemo.Provisioner{SetupHost: c.String("setup-host"), Name: c.String("name")}
+	if file := c.String("state"); file != "" {
+		if data, err := ioutil.ReadFile(file); err == nil {
+			if err := json.Unmarshal(data, &provisioner.State); err != nil {
+				log.Fatalf("Failed to parse %s => %s", file, err)
+			}
+			fmt.Fprintf(p.out, "Continuing the setup of %s\n", provisioner.State.Serial)
+		}
+	}
+	switch c.String("remote") {
+	case "":
+	case "on", "off":
+		remote := c.String("remote") == "on"
+		provisioner.RemoteAccess = &remote
+	default:
+		log.Fatalf("unknown --remote %s, expected on or off", c.String("remote"))
+	}
+
+	setup := wemo.NewWiFiSetup(provisioner.SetupHost)
+	if len(provisioner.State.Done) == 0 {
+		fmt.Fprintf(p.out, "Waiting for a device in setup mode at %s, join its WeMo.* network\n", provisioner.SetupHost)
+		info, err := waitForSetup(ctx, setup, c.Duration("wait"))
+		if err != nil {
+			exit(err)
+		}
+		fmt.Fprintf(p.out, "Found %s, serial %s, MAC %s, firmware %s\n", stringOr(info.SetupSSID, "a device"), info.Serial, info.MAC, stringOr(info.Firmware, "unknown"))
+	}
+
+	if setupDone(provisioner.State, wemo.StepConnect) {
+		// the device has the network already, Run only checks there is one
+		provisioner.Network = wemo.HomeNetwork{SSID: stringOr(c.String("ssid"), "home")}
+	} else {
+		network, err := chooseNetwork(ctx, p, setup, c.String("ssid"), stringOr(c.String("password"), os.Getenv("WEMO_WIFI_PASSWORD")))
+		if err != nil {
+			log.Fatal(err)
+		}
+		provisioner.Network = network
+	}
+	if provisioner.Name == "" && !setupDone(provisioner.State, wemo.StepName) {
+		provisioner.Name = p.ask("Name of the device (empty to keep its name): ", "")
+	}
+
+	provisioner.OnStep = func(step wemo.ProvisionStep) {
+		saveSetupState(c.String("state"), provisioner.State)
+		fmt.Fprintf(p.out, "%s %s\n", time.Now().Format("15:04:05"), setupStepText[step])
+	}
+	device, err := provisioner.Run(ctx)
+	saveSetupState(c.String("state"), provisioner.State)
+	if err != nil {
+		if c.String("state") != "" {
+			log.Printf("run wemo setup --state %s again to continue", c.String("state"))
+		}
+		exit(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, userConfig.timeout())
+	defer cancel()
+	if info, err := device.FetchDeviceInfo(ctx); err == nil {
+		fmt.Fprintf(p.out, "%s is set up at %s\n", info.FriendlyName, device.Host)
+		entry := wemo.ManagedDevice{Name: info.FriendlyName, Host: device.Host, UDN: info.UDN, Serial: info.SerialNumber, DeviceType: info.DeviceType, LastSeen: time.Now()}
+		if err := saveCache([]wemo.ManagedDevice{entry}); err != nil {
+			log.Printf("unable to update the device cache => %s", err)
+		}
+	} else {
+		fmt.Fprintf(p.out, "The device is set up at %s\n", device.Host)
+	}
+	if file := c.String("state"); file != "" {
+		os.Remove(file)
+	}
+}
+
+var setupStepText = map[wemo.ProvisionStep]string{
+	wemo.StepIdentify: "identifying the device",
+	wemo.StepTime:     "setting the clock",
+	wemo.StepConnect:  "sending the network",
+	wemo.StepJoin:     "waiting for the device to join the network",
+	wemo.StepClose:    "ending setup mode, switch this machine back to your network",
+	wemo.StepLocate:   "looking for the device on your network",
+	wemo.StepVerify:   "checking it is the device that was set up",
+	wemo.StepName:     "naming the device",
+	wemo.StepRemote:   "setting remote access",
+}
+
+// waitForSetup asks the device in setup mode for its identity until it
+// answers or wait passed.
+func waitForSetup(ctx context.Context, setup *wemo.WiFiSetup, wait time.Duration) (*wemo.MetaInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		attempt, cancelAttempt := context.WithTimeout(ctx, 2*time.Second)
+		info, err := setup.MetaInfo(attempt)
+		cancelAttempt()
+		if err == nil {
+			return info, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-ticker.C:
+		}
+	}
+}
+
+// chooseNetwork returns the network the device should join: ssid, or the one
+// chosen from the networks the device sees. The password is asked for when
+// not given.
+func chooseNetwork(ctx context.Context, p *prompter, setup *wemo.WiFiSetup, ssid, password string) (wemo.HomeNetwork, error) {
+	aps, err := setup.GetApList(ctx)
+	if err != nil {
+		return wemo.HomeNetwork{}, err
+	}
+	sort.SliceStable(aps, func(i, j int) bool { return aps[i].Signal > aps[j].Signal })
+
+	var ap wemo.AccessPoint
+	for ap.SSID == "" {
+		if ssid == "" {
+			fmt.Fprintln(p.out, "Networks the device sees:")
+			for i, candidate := range aps {
+				fmt.Fprintf(p.out, "%3d) %-32s channel %2d, %3d%%, %s\n", i+1, candidate.SSID, candidate.Channel, candidate.Signal, candidate.Auth)
+			}
+			ssid = p.ask("Network (number or name): ", "")
+			if ssid == "" {
+				return wemo.HomeNetwork{}, fmt.Errorf("no network chosen")
+			}
+		}
+		if n, err := strconv.Atoi(ssid); err == nil && n >= 1 && n <= len(aps) {
+			ap = aps[n-1]
+			break
+		}
+		for _, candidate := range aps {
+			if candidate.SSID == ssid {
+				ap = candidate
+				break
+			}
+		}
+		if ap.SSID == "" {
+			fmt.Fprintf(p.out, "The device doesn't see %s, it only joins 2.4 GHz networks in range\n", ssid)
+			ssid = ""
+		}
+	}
+	if ap.Signal < wemo.WeakSignal {
+		fmt.Fprintf(p.out, "The signal of %s is weak at %d%%, the device may drop off where it is\n", ap.SSID, ap.Signal)
+	}
+
+	if password == "" && ap.Auth != wemo.AuthOpen {
+		password = p.ask(fmt.Sprintf("Password of %s: ", ap.SSID), "")
+	}
+	network := ap.HomeNetwork(password)
+	return network, network.Validate()
+}
+
+func setupDone(state wemo.ProvisionState, step wemo.ProvisionStep) bool {
+	for _, done := range state.Done {
+		if done == step {
+			return true
+		}
+	}
+	return false
+}
+
+func saveSetupState(file string, state wemo.ProvisionState) {
+	if file == "" {
+		return
+	}
+	data, _ := json.Marshal(state)
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		log.Printf("unable to save the setup state => %s", err)
+	}
+}
+
+// prompter asks questions on the terminal.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask prints the question and returns the answer, or fallback when the answer
+// is empty.
+func (p *prompter) ask(question, fallback string) string {
+	fmt.Fprint(p.out, question)
+	answer, _ := p.in.ReadString('\n')
+	return stringOr(strings.TrimSpace(answer), fallback)
+}
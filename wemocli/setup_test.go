@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestChooseNetwork(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<s:Envelope><s:Body><u:GetApListResponse><ApList>Page:1/1/3$
+Neighbours|6|90|WPA2PSK/AES,
+Home|11|30|WPA2PSK/AES,
+Cafe|1|60|OPEN/NONE,
+</ApList></u:GetApListResponse></s:Body></s:Envelope>`))
+	}))
+	defer server.Close()
+	setup := wemo.NewWiFiSetup(server.Listener.Addr().String())
+
+	var out bytes.Buffer
+	p := &prompter{in: bufio.NewReader(strings.NewReader("Office\n3\nsecret123\n")), out: &out}
+	network, err := chooseNetwork(context.Background(), p, setup, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if network.SSID != "Home" || network.Password != "secret123" || network.Channel != 11 || network.Auth != wemo.AuthWPA2PSK {
+		t.Errorf("Expected: Home with the password, got: %+v", network)
+	}
+	for _, expected := range []string{"  1) Neighbours", "doesn't see Office", "signal of Home is weak"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected: %q in the output, got: %s", expected, out.String())
+		}
+	}
+
+	p = &prompter{in: bufio.NewReader(strings.NewReader("")), out: &out}
+	if network, err = chooseNetwork(context.Background(), p, setup, "Cafe", ""); err != nil || network.Auth != wemo.AuthOpen {
+		t.Errorf("Expected: the open network without asking, got: %+v, %v", network, err)
+	}
+	if _, err = chooseNetwork(context.Background(), p, setup, "Home", "short"); err == nil {
+		t.Error("Expected: an error for a short WPA password, got: nil")
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/randohm/go.wemo"
+	"github.com/urfave/cli"
+)
+
+// statusRow is a line of the table "wemo status" prints without a device.
+type statusRow struct {
+	Name     string    `json:"name"`
+	Model    string    `json:"model"`
+	Host     string    `json:"host"`
+	State    string    `json:"state"`             // off, on, standby or unreachable
+	PowerW   *float64  `json:"power-w,omitempty"` // Insights only
+	RSSI     *int      `json:"rssi,omitempty"`    // signal strength in percent
+	LastSeen time.Time `json:"last-seen"`
+}
+
+// statusColumns are the columns --sort takes.
+var statusColumns = map[string]func(a, b statusRow) bool{
+	"name":  func(a, b statusRow) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+	"model": func(a, b statusRow) bool { return a.Model < b.Model },
+	"ip":    func(a, b statusRow) bool { return compareHosts(a.Host, b.Host) },
+	"state": func(a, b statusRow) bool { return a.State < b.State },
+	"power": func(a, b statusRow) bool {
+		return a.PowerW != nil && (b.PowerW == nil || *a.PowerW > *b.PowerW)
+	},
+	"rssi": func(a, b statusRow) bool {
+		return a.RSSI != nil && (b.RSSI == nil || *a.RSSI > *b.RSSI)
+	},
+	"last-seen": func(a, b statusRow) bool { return a.LastSeen.After(b.LastSeen) },
+}
+
+func statusColumnNames() []string {
+	var names []string
+	for name := range statusColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compareHosts orders hosts by address, so 10.0.0.9 comes before 10.0.0.10.
+func compareHosts(a, b string) bool {
+	a, b = hostIP(a), hostIP(b)
+	ipA, ipB := net.ParseIP(a).To16(), net.ParseIP(b).To16()
+	if ipA == nil || ipB == nil {
+		return a < b
+	}
+	return string(ipA) < string(ipB)
+}
+
+func hostIP(host string) string {
+	if ip, _, err := net.SplitHostPort(host); err == nil {
+		return ip
+	}
+	return host
+}
+
+// statusTableAction prints the status table of all known devices, refreshed
+// at the interval of --watch, if given.
+func statusTableAction(c *cli.Context) {
+	sortBy := c.String("sort")
+	if _, ok := statusColumns[sortBy]; !ok {
+		log.Fatalf("unknown column %s, expected one of %s", sortBy, strings.Join(statusColumnNames(), ", "))
+	}
+	entries := knownDevices()
+	if len(entries) == 0 {
+		log.Fatalf("no known devices, run wemo discover or add them to %s", stringOr(userConfig.file, "a configuration file"))
+	}
+
+	interval := c.Duration("watch")
+	if interval <= 0 {
+		rows := statusRows(context.Background(), entries, sortBy, c.Bool("reverse"))
+		if jsonOutput(c) {
+			printJSON(rows)
+			return
+		}
+		printStatusTable(os.Stdout, rows, time.Now())
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		rows := statusRows(ctx, entries, sortBy, c.Bool("reverse"))
+		if jsonOutput(c) {
+			printJSON(rows)
+		} else {
+			fmt.Print("\033[H\033[2J")
+			printStatusTable(os.Stdout, rows, time.Now())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// knownDevices returns the devices "wemo discover" last found and those of
+// the configuration file it didn't find.
+func knownDevices() []wemo.ManagedDevice {
+	var entries []wemo.ManagedDevice
+	hosts := map[string]bool{}
+	if m := openCache(); m != nil {
+		for _, entry := range m.List() {
+			entries = append(entries, entry)
+			hosts[entry.Host] = true
+		}
+	}
+	for _, device := range userConfig.Devices {
+		if !hosts[device.Host] {
+			entries = append(entries, wemo.ManagedDevice{Name: device.Name, Host: device.Host, Aliases: device.Aliases})
+			hosts[device.Host] = true
+		}
+	}
+	return entries
+}
+
+// statusRows reads the devices at once and returns their rows, sorted by the
+// given column. The devices that answered are saved to the cache as seen.
+func statusRows(ctx context.Context, entries []wemo.ManagedDevice, sortBy string, reverse bool) []statusRow {
+	rows := make([]statusRow, len(entries))
+	seen := make([]wemo.ManagedDevice, len(entries))
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		wg.Add(1)
+		go func(i int, entry wemo.ManagedDevice) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, userConfig.timeout())
+			defer cancel()
+			rows[i] = statusRowOf(ctx, &entry)
+			if rows[i].State != "unreachable" {
+				seen[i] = entry
+			}
+		}(i, entry)
+	}
+	wg.Wait()
+
+	var update []wemo.ManagedDevice
+	for _, entry := range seen {
+		if entry.UDN != "" || entry.Serial != "" {
+			update = append(update, entry)
+		}
+	}
+	if len(update) > 0 {
+		if err := saveCache(update); err != nil {
+			log.Printf("unable to update the device cache => %s", err)
+		}
+	}
+
+	less := statusColumns[sortBy]
+	sort.SliceStable(rows, func(i, j int) bool {
+		if reverse {
+			return less(rows[j], rows[i])
+		}
+		return less(rows[i], rows[j])
+	})
+	return rows
+}
+
+// statusRowOf reads the state, power and signal of a device. entry is updated
+// with the time it was seen, and with its type when it wasn't known.
+func statusRowOf(ctx context.Context, entry *wemo.ManagedDevice) statusRow {
+	row := statusRow{Name: entry.Name, Host: entry.Host, State: "unreachable", LastSeen: entry.LastSeen}
+	device := entry.Device()
+	if entry.DeviceType == "" {
+		info, err := device.FetchDeviceInfo(ctx)
+		if err != nil {
+			row.Model = modelName(entry.DeviceType)
+			return row
+		}
+		entry.DeviceType = info.DeviceType
+	}
+	row.Model = modelName(entry.DeviceType)
+
+	state, err := device.FetchBinaryState(ctx)
+	if err != nil {
+		return row
+	}
+	row.State = stateName(state)
+	entry.LastSeen = time.Now()
+	row.LastSeen = entry.LastSeen
+
+	if entry.Capabilities().Has(wemo.CapInsight) {
+		if params, err := device.FetchInsightParams(ctx); err == nil {
+			power := params.PowerW()
+			row.PowerW = &power
+		}
+	}
+	if signal, err := device.SignalStrength(ctx); err == nil {
+		row.RSSI = &signal
+	}
+	return row
+}
+
+// modelName returns the name --type of discover takes for a device type, or
+// the type itself.
+func modelName(deviceType string) string {
+	for name, urn := range deviceTypes {
+		if urn == deviceType {
+			return name
+		}
+	}
+	if deviceType == "" {
+		return "-"
+	}
+	return deviceType
+}
+
+func printStatusTable(w io.Writer, rows []statusRow, now time.Time) {
+	format := "%-20s %-11s %-15s %-11s %9s %5s  %s\n"
+	fmt.Fprintf(w, format, "NAME", "MODEL", "IP", "STATE", "POWER", "RSSI", "LAST SEEN")
+	for _, row := range rows {
+		power, rssi := "-", "-"
+		if row.PowerW != nil {
+			power = fmt.Sprintf("%.1f W", *row.PowerW)
+		}
+		if row.RSSI != nil {
+			rssi = fmt.Sprintf("%d%%", *row.RSSI)
+		}
+		fmt.Fprintf(w, format, row.Name, row.Model, hostIP(row.Host), row.State, power, rssi, lastSeen(row.LastSeen, now))
+	}
+}
+
+// lastSeen formats t relative to now, e.g. "now" or "3h ago".
+func lastSeen(t, now time.Time) string {
+	since := now.Sub(t)
+	switch {
+	case t.IsZero():
+		return "never"
+	case since < time.Minute:
+		return "now"
+	case since < time.Hour:
+		return fmt.Sprintf("%dm ago", int(since.Minutes()))
+	case since < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(since.Hours()))
+	}
+	return fmt.Sprintf("%dd ago", int(since.Hours()/24))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestStatusTable(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.Header.Get("SOAPACTION"), "GetBinaryState"):
+			w.Write([]byte(`<s:Envelope><s:Body><u:GetBinaryStateResponse><BinaryState>1</BinaryState></u:GetBinaryStateResponse></s:Body></s:Envelope>`))
+		case strings.Contains(r.Header.Get("SOAPACTION"), "GetSignalStrength"):
+			w.Write([]byte(`<s:Envelope><s:Body><u:GetSignalStrengthResponse><SignalStrength>80</SignalStrength></u:GetSignalStrengthResponse></s:Body></s:Envelope>`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer device.Close()
+
+	entries := []wemo.ManagedDevice{
+		{Name: "porch", Host: device.Listener.Addr().String(), Serial: "A", DeviceType: wemo.Controllee},
+		{Name: "Garage", Host: "127.0.0.1:1", Serial: "B", DeviceType: wemo.Insight},
+	}
+	rows := statusRows(context.Background(), entries, "name", false)
+	if rows[0].Name != "Garage" || rows[0].State != "unreachable" || rows[0].Model != "insight" {
+		t.Errorf("Expected: Garage unreachable, got: %+v", rows[0])
+	}
+	if rows[1].State != "on" || rows[1].RSSI == nil || *rows[1].RSSI != 80 || rows[1].LastSeen.IsZero() {
+		t.Errorf("Expected: porch on at 80%%, got: %+v", rows[1])
+	}
+	if rows := statusRows(context.Background(), entries, "state", true); rows[0].Name != "Garage" {
+		t.Errorf("Expected: Garage first, got: %s", rows[0].Name)
+	}
+
+	var b bytes.Buffer
+	printStatusTable(&b, rows, rows[1].LastSeen.Add(3*time.Hour))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[1], "never") || !strings.HasSuffix(lines[2], "80%  3h ago") {
+		t.Errorf("Unexpected table:\n%s", b.String())
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/randohm/go.wemo"
+	"github.com/urfave/cli"
+)
+
+var telegrafCommand = cli.Command{
+	Name:        "telegraf",
+	Usage:       "print device states and Insight readings for Telegraf",
+	Description: "print a JSON array of wemo.TelegrafRecord, for Telegraf's exec input with data_format json",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "store", Value: "", Usage: "device inventory file, scanned when empty"},
+		cli.StringFlag{Name: "selector", Value: "", Usage: "label selector, e.g. room=kitchen"},
+		cli.IntFlag{Name: "timeout", Value: 10, Usage: "timeout in seconds"},
+	},
+	Action: telegrafAction,
+}
+
+func telegrafAction(c *cli.Context) {
+	selector, err := wemo.ParseSelector(c.String("selector"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	m, err := openManager(c.String("store"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.Int("timeout"))*time.Second)
+	defer cancel()
+	if err := wemo.WriteTelegraf(os.Stdout, m.TelegrafRecords(ctx, selector)); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/randohm/go.wemo"
+	"github.com/urfave/cli"
+)
+
+var watchCommand = cli.Command{
+	Name:      "watch",
+	Usage:     "print state changes and Insight readings as they happen",
+	ArgsUsage: "[device...]",
+	Description: "watch the devices given by name, alias or pattern, or all devices. States come from device events, " +
+		"or from polling with --poll. With --api the state changes are read from a running \"wemo api\" or \"wemo daemon\" " +
+		"instead, and --since replays the changes it kept. With --json every line is a wemo.StateDoc or wemo.InsightDoc",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "store", Value: "", Usage: "device inventory file, scanned when empty"},
+		cli.StringFlag{Name: "events", Value: ":6767", Usage: "address to receive device events on"},
+		cli.StringFlag{Name: "callback", Value: "", Usage: "host:port the devices send events to, defaults to this host's address on the events port"},
+		cli.DurationFlag{Name: "poll", Usage: "poll the states at this interval instead of subscribing to events"},
+		cli.DurationFlag{Name: "insight", Value: time.Minute, Usage: "how often to read Insights, 0 to not read them"},
+		cli.StringFlag{Name: "api", Value: "", Usage: "URL of a running API, e.g. http://localhost:8080"},
+		cli.StringFlag{Name: "token", Value: "", Usage: "token of the API, defaults to $WEMO_API_TOKEN"},
+		cli.DurationFlag{Name: "since", Usage: "with --api, first print the changes of this long ago the API still knows"},
+		cli.StringFlag{Name: "history", Value: "", Usage: "file to record the Insight readings in, for \"wemo insight export\""},
+	},
+	Action: watchAction,
+}
+
+func watchAction(c *cli.Context) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w := watcher{out: os.Stdout, patterns: c.Args(), json: jsonOutput(c), history: wemo.InsightHistory(c.String("history"))}
+	if api := c.String("api"); api != "" {
+		token := c.String("token")
+		if token == "" {
+			token = os.Getenv("WEMO_API_TOKEN")
+		}
+		if err := w.watchAPI(ctx, api, token, c.Duration("since")); err != nil && ctx.Err() == nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if c.Duration("since") > 0 {
+		log.Fatal("--since needs --api, only a running API keeps past changes")
+	}
+
+	m, err := openManager(c.String("store"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(w.patterns) > 0 {
+		w.keys = make(map[string]bool)
+		for _, pattern := range w.patterns {
+			entries, err := m.Resolve(pattern)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(entries) == 0 {
+				log.Fatalf("no device matches %s", pattern)
+			}
+			for _, entry := range entries {
+				w.keys[entry.Key] = true
+			}
+		}
+	}
+	events, cancel := m.Subscribe(64)
+	defer cancel()
+
+	if interval := c.Duration("poll"); interval > 0 {
+		go m.PollStates(ctx, interval)
+	} else {
+		listener, err := net.Listen("tcp", c.String("events"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		callback := c.String("callback")
+		if callback == "" {
+			if callback, err = callbackAddress(m, listener.Addr()); err != nil {
+				log.Fatal(err)
+			}
+		}
+		events := &wemo.EventListener{Manager: m, Callback: callback, Logger: log.Printf}
+		mux := http.NewServeMux()
+		mux.Handle("/listener", events)
+		go http.Serve(listener, mux)
+		go events.Run(ctx)
+	}
+
+	var insight <-chan time.Time
+	if interval := c.Duration("insight"); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		insight = ticker.C
+		w.printInsight(ctx, m)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			w.printState(event)
+		case <-insight:
+			w.printInsight(ctx, m)
+		}
+	}
+}
+
+// watcher prints the events of the devices matching patterns. With a
+// registry the patterns are resolved to keys, which also covers aliases.
+type watcher struct {
+	out      io.Writer
+	patterns []string
+	keys     map[string]bool
+	json     bool
+	history  wemo.InsightHistory // empty to not record readings
+}
+
+func (w *watcher) matches(key, name string) bool {
+	if len(w.patterns) == 0 {
+		return true
+	}
+	if w.keys != nil {
+		return w.keys[key]
+	}
+	for _, pattern := range w.patterns {
+		if pattern == key {
+			return true
+		}
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *watcher) print(doc interface{}, format string, args ...interface{}) {
+	if w.json {
+		data, _ := json.Marshal(doc)
+		fmt.Fprintln(w.out, string(data))
+		return
+	}
+	fmt.Fprintf(w.out, format+"\n", args...)
+}
+
+func (w *watcher) printState(event wemo.StateChanged) {
+	if !w.matches(event.Key, event.Name) {
+		return
+	}
+	doc := wemo.NewStateDoc(event.Key, wemo.DeviceSnapshot{State: event.State}, event.Time)
+	w.print(doc, "%s %-20s %-3s (%s)", event.Time.Format("15:04:05"), event.Name, stateName(event.State), event.Source)
+}
+
+func (w *watcher) printInsight(ctx context.Context, m *wemo.Manager) {
+	for _, entry := range m.List() {
+		if !entry.Capabilities().Has(wemo.CapInsight) || !w.matches(entry.Key, entry.Name) {
+			continue
+		}
+		params, err := m.InsightParams(ctx, entry.Key)
+		if err != nil {
+			log.Printf("insight %s: %s", entry.Name, err)
+			continue
+		}
+		doc := wemo.NewInsightDoc(entry.Key, wemo.InsightReading{Host: entry.Host, Time: time.Now(), Params: *params})
+		w.print(doc, "%s %-20s %.1f W, %.3f kWh today", doc.Time.Format("15:04:05"), entry.Name, doc.PowerW, doc.TodayKWh)
+		if w.history != "" {
+			if err := w.history.Append(doc); err != nil {
+				log.Printf("unable to record Insight readings => %s", err)
+			}
+		}
+	}
+}
+
+func stateName(state int) string {
+	switch state {
+	case 0:
+		return "off"
+	case 1:
+		return "on"
+	case 8:
+		return "standby"
+	}
+	return fmt.Sprintf("state %d", state)
+}
+
+// watchAPI prints the state changes streamed by the /events resource of an
+// API. With since, the changes the API kept from since ago are printed first.
+func (w *watcher) watchAPI(ctx context.Context, api, token string, since time.Duration) error {
+	query := url.Values{}
+	if token != "" {
+		query.Set("token", token)
+	}
+	if since > 0 {
+		query.Set("last-event-id", "0")
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(api, "/")+"/events?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status code => %d", api, resp.StatusCode)
+	}
+
+	start := time.Now().Add(-since)
+	var eventType, data string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		case line == "":
+			if eventType == "state" {
+				var event wemo.StateChanged
+				if err := json.Unmarshal([]byte(data), &event); err == nil && !event.Time.Before(start) {
+					w.printState(event)
+				}
+			}
+			eventType, data = "", ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("the API closed the event stream")
+}
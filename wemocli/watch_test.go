@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/randohm/go.wemo"
+	"github.com/randohm/go.wemo/wemoapi"
+)
+
+func TestWatchAPI(t *testing.T) {
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Porch", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-A", DeviceType: wemo.Controllee})
+	m.Put(wemo.ManagedDevice{Name: "Kitchen", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-B", DeviceType: wemo.Controllee})
+	m.UpdateBinaryState("uuid:Socket-1_0-A", 1)
+	m.UpdateBinaryState("uuid:Socket-1_0-B", 1)
+
+	server := httptest.NewServer(wemoapi.NewHandler(m, "secret"))
+	defer server.Close()
+
+	var out bytes.Buffer
+	w := watcher{out: &out, patterns: []string{"porch"}, json: true}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	w.watchAPI(ctx, server.URL, "secret", time.Hour)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected: the change of the porch, got: %q", out.String())
+	}
+	var doc wemo.StateDoc
+	if err := json.Unmarshal([]byte(lines[0]), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Schema != wemo.SchemaState || doc.Key != "uuid:Socket-1_0-A" || !doc.On {
+		t.Errorf("Unexpected document: %+v", doc)
+	}
+}
@@ -0,0 +1,284 @@
+// Package wemoemu emulates Belkin WeMo switches, so that voice assistants such
+// as the Amazon Echo, and anything else that speaks WeMo, can switch arbitrary
+// Go code. Each virtual switch answers discovery, serves its setup.xml and
+// handles the basicevent Get/SetBinaryState actions on its own port.
+package wemoemu
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Switch is a virtual WeMo switch.
+type Switch struct {
+	Name   string
+	Serial string // defaults to one derived from Name
+	Port   int    // 0 picks a free port
+
+	// Set is called when the switch is switched. The switch only changes its
+	// state when Set succeeds.
+	Set func(on bool) error
+
+	// Get, if set, reports the state instead of the last one set, e.g. for
+	// switches that also change otherwise.
+	Get func() bool
+
+	mu       sync.Mutex
+	on       bool
+	listener net.Listener
+	server   *http.Server
+}
+
+func (s *Switch) serial() string {
+	if s.Serial != "" {
+		return s.Serial
+	}
+	sum := sha1.Sum([]byte(s.Name))
+	return "EMU" + strings.ToUpper(hex.EncodeToString(sum[:]))[:11]
+}
+
+// UDN is the unique device name of the switch.
+func (s *Switch) UDN() string {
+	return "uuid:Socket-1_0-" + s.serial()
+}
+
+// State returns whether the switch is on.
+func (s *Switch) State() bool {
+	if s.Get != nil {
+		return s.Get()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.on
+}
+
+func (s *Switch) set(on bool) error {
+	if s.Set != nil {
+		if err := s.Set(on); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.on = on
+	s.mu.Unlock()
+	return nil
+}
+
+// Addr returns the address the switch serves on once started.
+func (s *Switch) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+const setupXML = `<?xml version="1.0"?>
+<root xmlns="urn:Belkin:device-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <device>
+    <deviceType>urn:Belkin:device:controllee:1</deviceType>
+    <friendlyName>%s</friendlyName>
+    <manufacturer>Belkin International Inc.</manufacturer>
+    <modelName>Socket</modelName>
+    <modelNumber>3.1415</modelNumber>
+    <modelDescription>Belkin Plugin Socket 1.0</modelDescription>
+    <UDN>%s</UDN>
+    <serialNumber>%s</serialNumber>
+    <binaryState>%d</binaryState>
+    <serviceList>
+      <service>
+        <serviceType>urn:Belkin:service:basicevent:1</serviceType>
+        <serviceId>urn:Belkin:serviceId:basicevent1</serviceId>
+        <controlURL>/upnp/control/basicevent1</controlURL>
+        <eventSubURL>/upnp/event/basicevent1</eventSubURL>
+        <SCPDURL>/eventservice.xml</SCPDURL>
+      </service>
+    </serviceList>
+  </device>
+</root>
+`
+
+const eventServiceXML = `<?xml version="1.0"?>
+<scpd xmlns="urn:Belkin:service-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <actionList>
+    <action>
+      <name>SetBinaryState</name>
+      <argumentList>
+        <argument><retval/><name>BinaryState</name><relatedStateVariable>BinaryState</relatedStateVariable><direction>in</direction></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>GetBinaryState</name>
+      <argumentList>
+        <argument><retval/><name>BinaryState</name><relatedStateVariable>BinaryState</relatedStateVariable><direction>out</direction></argument>
+      </argumentList>
+    </action>
+  </actionList>
+  <serviceStateTable>
+    <stateVariable sendEvents="yes"><name>BinaryState</name><dataType>Boolean</dataType><defaultValue>0</defaultValue></stateVariable>
+  </serviceStateTable>
+</scpd>
+`
+
+const responseEnvelope = `<?xml version="1.0" encoding="utf-8"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><u:%sResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>%d</BinaryState></u:%sResponse></s:Body></s:Envelope>`
+
+const faultEnvelope = `<?xml version="1.0" encoding="utf-8"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode><errorDescription>%s</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`
+
+var binaryStateRE = regexp.MustCompile(`<BinaryState>(\d+)</BinaryState>`)
+
+func boolState(on bool) int {
+	if on {
+		return 1
+	}
+	return 0
+}
+
+// ServeHTTP serves the setup.xml and the basicevent service of the switch.
+func (s *Switch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Server", "Unspecified, UPnP/1.0, Unspecified")
+	switch r.URL.Path {
+	case "/setup.xml":
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, setupXML, xmlEscape(s.Name), s.UDN(), s.serial(), boolState(s.State()))
+	case "/eventservice.xml":
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, eventServiceXML)
+	case "/upnp/control/basicevent1":
+		s.serveControl(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Switch) serveControl(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	action := r.Header.Get("SOAPACTION")
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	switch {
+	case strings.Contains(action, "#GetBinaryState"):
+		fmt.Fprintf(w, responseEnvelope, "GetBinaryState", boolState(s.State()), "GetBinaryState")
+	case strings.Contains(action, "#SetBinaryState"):
+		matches := binaryStateRE.FindSubmatch(body)
+		if len(matches) != 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, faultEnvelope, 402, "Invalid Args")
+			return
+		}
+		state, _ := strconv.Atoi(string(matches[1]))
+		if err := s.set(state != 0); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, faultEnvelope, 501, xmlEscape(err.Error()))
+			return
+		}
+		fmt.Fprintf(w, responseEnvelope, "SetBinaryState", boolState(s.State()), "SetBinaryState")
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, faultEnvelope, 401, "Invalid Action")
+	}
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// Emulator advertises a set of virtual switches.
+type Emulator struct {
+	Switches []*Switch
+
+	// IP is the address the switches serve on and are advertised with,
+	// defaults to the first IPv4 address of the host that isn't a loopback
+	// address. Echo devices have to reach it.
+	IP net.IP
+
+	// Logger, if set, receives errors of the SSDP responder, e.g. log.Printf.
+	Logger func(format string, args ...interface{})
+
+	mu   sync.Mutex
+	ssdp *net.UDPConn
+}
+
+// Start serves the switches and answers discovery until Close.
+func (e *Emulator) Start() error {
+	ip := e.IP
+	if ip == nil {
+		var err error
+		if ip, err = localIP(); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range e.Switches {
+		listener, err := net.Listen("tcp4", net.JoinHostPort(ip.String(), strconv.Itoa(s.Port)))
+		if err != nil {
+			e.Close()
+			return fmt.Errorf("unable to serve %s => %s", s.Name, err)
+		}
+		server := &http.Server{Handler: s}
+		s.mu.Lock()
+		s.listener, s.server = listener, server
+		s.mu.Unlock()
+		go server.Serve(listener)
+	}
+
+	group, _ := net.ResolveUDPAddr("udp4", ssdpAddr)
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		e.Close()
+		return fmt.Errorf("unable to listen for discovery => %s", err)
+	}
+	e.mu.Lock()
+	e.ssdp = conn
+	e.mu.Unlock()
+	go e.respond(conn)
+	return nil
+}
+
+// Close stops serving the switches and answering discovery.
+func (e *Emulator) Close() error {
+	e.mu.Lock()
+	if e.ssdp != nil {
+		e.ssdp.Close()
+		e.ssdp = nil
+	}
+	e.mu.Unlock()
+	for _, s := range e.Switches {
+		s.mu.Lock()
+		if s.server != nil {
+			s.server.Close()
+			s.server, s.listener = nil, nil
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+func localIP() (net.IP, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			return ipnet.IP.To4(), nil
+		}
+	}
+	return nil, errors.New("no IPv4 address to serve the switches on")
+}
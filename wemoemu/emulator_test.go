@@ -0,0 +1,74 @@
+package wemoemu
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestSwitch(t *testing.T) {
+	var calls []bool
+	sw := &Switch{Name: "Kitchen Light", Set: func(on bool) error {
+		calls = append(calls, on)
+		if len(calls) > 2 {
+			return errors.New("stuck")
+		}
+		return nil
+	}}
+	server := httptest.NewServer(sw)
+	defer server.Close()
+	device := &wemo.Device{Host: strings.TrimPrefix(server.URL, "http://")}
+
+	ctx := context.Background()
+	info, err := device.FetchDeviceInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.FriendlyName != "Kitchen Light" || info.DeviceType != wemo.Controllee || info.UDN != sw.UDN() {
+		t.Errorf("Unexpected device info: %+v", info)
+	}
+
+	if err := device.SetBinaryState(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := device.FetchBinaryState(ctx); err != nil || state != 1 {
+		t.Errorf("Expected: 1, got: %d, %v", state, err)
+	}
+	if err := device.SetBinaryState(ctx, false); err != nil || sw.State() {
+		t.Errorf("Expected: the switch off, got: %v, %v", sw.State(), err)
+	}
+
+	var aerr *wemo.ActionError
+	if err := device.SetBinaryState(ctx, true); !errors.As(err, &aerr) || sw.State() {
+		t.Errorf("Expected: a failed Set to be reported and the state kept, got: %v", err)
+	}
+}
+
+func TestResponses(t *testing.T) {
+	sw := &Switch{Name: "Fan", Serial: "FAN1"}
+	server := httptest.NewServer(sw)
+	defer server.Close()
+	sw.listener = server.Listener
+	e := &Emulator{Switches: []*Switch{sw}}
+
+	search := "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 3\r\nST: urn:Belkin:device:**\r\n\r\n"
+	responses := e.Responses(search)
+	if len(responses) != 1 {
+		t.Fatalf("Expected: 1 response, got: %q", responses)
+	}
+	location := "LOCATION: " + server.URL + "/setup.xml\r\n"
+	if !strings.Contains(responses[0], location) || !strings.Contains(responses[0], "USN: uuid:Socket-1_0-FAN1::urn:Belkin:device:controllee:1") {
+		t.Errorf("Unexpected response: %q", responses[0])
+	}
+
+	if r := e.Responses(strings.Replace(search, "urn:Belkin:device:**", "urn:schemas-upnp-org:device:MediaRenderer:1", 1)); len(r) != 0 {
+		t.Errorf("Expected: no answer to other devices, got: %q", r)
+	}
+	if r := e.Responses("NOTIFY * HTTP/1.1\r\nNT: upnp:rootdevice\r\n\r\n"); len(r) != 0 {
+		t.Errorf("Expected: no answer to notifications, got: %q", r)
+	}
+}
@@ -0,0 +1,93 @@
+package wemoemu
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const ssdpAddr = "239.255.255.250:1900"
+
+const searchResponse = "HTTP/1.1 200 OK\r\n" +
+	"CACHE-CONTROL: max-age=86400\r\n" +
+	"EXT:\r\n" +
+	"LOCATION: http://%s/setup.xml\r\n" +
+	"OPT: \"http://schemas.upnp.org/upnp/1/0/\"; ns=01\r\n" +
+	"SERVER: Unspecified, UPnP/1.0, Unspecified\r\n" +
+	"ST: %s\r\n" +
+	"USN: %s::%s\r\n" +
+	"X-User-Agent: redsonic\r\n" +
+	"\r\n"
+
+// searchTarget returns the ST header of an M-SEARCH request, and false for
+// other requests.
+func searchTarget(request string) (string, bool) {
+	lines := strings.Split(request, "\r\n")
+	if !strings.HasPrefix(lines[0], "M-SEARCH ") {
+		return "", false
+	}
+	for _, line := range lines[1:] {
+		if i := strings.IndexByte(line, ':'); i > 0 && strings.EqualFold(line[:i], "ST") {
+			return strings.TrimSpace(line[i+1:]), true
+		}
+	}
+	return "", false
+}
+
+// answers reports whether a switch answers a search for st, and with which
+// ST.
+func answers(st string) (string, bool) {
+	switch st {
+	case "ssdp:all", "urn:Belkin:device:**", "urn:Belkin:device:controllee:1":
+		return "urn:Belkin:device:controllee:1", true
+	case "upnp:rootdevice":
+		return st, true
+	}
+	return "", false
+}
+
+// Responses returns the answers of the switches to an SSDP request, none when
+// it isn't an M-SEARCH the switches answer.
+func (e *Emulator) Responses(request string) []string {
+	st, ok := searchTarget(request)
+	if !ok {
+		return nil
+	}
+	st, ok = answers(st)
+	if !ok {
+		return nil
+	}
+	var responses []string
+	for _, s := range e.Switches {
+		if addr := s.Addr(); addr != "" {
+			responses = append(responses, fmt.Sprintf(searchResponse, addr, st, s.UDN(), st))
+		}
+	}
+	return responses
+}
+
+func (e *Emulator) respond(conn *net.UDPConn) {
+	buffer := make([]byte, 2048)
+	for {
+		n, from, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			return // closed
+		}
+		for _, response := range e.Responses(string(buffer[:n])) {
+			// answer from a unicast socket, the multicast one may not send
+			reply, err := net.DialUDP("udp4", nil, from)
+			if err != nil {
+				e.printf("unable to answer %s => %s", from, err)
+				break
+			}
+			reply.Write([]byte(response))
+			reply.Close()
+		}
+	}
+}
+
+func (e *Emulator) printf(format string, args ...interface{}) {
+	if e.Logger != nil {
+		e.Logger(format, args...)
+	}
+}
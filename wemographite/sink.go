@@ -0,0 +1,236 @@
+// Package wemographite writes the states and Insight readings of a
+// wemo.Manager to Graphite in the plaintext protocol.
+//
+// The metric path of a device comes from a template, where {key}, {name},
+// {alias} and {type} stand for the device and any other {label} for the
+// registry label of that name, e.g. "home.{room}.{name}". Each device gets
+//
+//	<path>.up          1 when the device answered, else 0
+//	<path>.state       0 off, 1 on, 8 standby
+//	<path>.power_w     Insights only, like the fields below
+//	<path>.today_kwh
+//	<path>.energy_kwh
+//	<path>.on_for      seconds
+//	<path>.on_today    seconds
+//	<path>.signal
+package wemographite
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/randohm/go.wemo"
+)
+
+// Sink samples the devices of a Manager and sends the samples in batches.
+// Samples that couldn't be sent are kept and sent with the next batch, up to
+// MaxBuffered lines.
+type Sink struct {
+	Manager *wemo.Manager
+
+	// Address is the Graphite carbon receiver, e.g. localhost:2003. Network
+	// defaults to "tcp".
+	Address string
+	Network string
+
+	// Template is the metric path of a device, defaults to "wemo.{name}".
+	// Devices without a label used in the template get "unknown".
+	Template string
+
+	SampleInterval time.Duration // defaults to 10 seconds
+	FlushInterval  time.Duration // defaults to a minute
+	MaxBuffered    int           // defaults to 10000, older lines are dropped
+
+	counters *wemo.InsightCounters
+	mu       sync.Mutex
+	lines    []string
+}
+
+var placeholderRE = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// Path returns the metric path of a device.
+func (s *Sink) Path(entry wemo.ManagedDevice) string {
+	template := s.Template
+	if template == "" {
+		template = "wemo.{name}"
+	}
+	return placeholderRE.ReplaceAllStringFunc(template, func(placeholder string) string {
+		var value string
+		switch name := placeholder[1 : len(placeholder)-1]; name {
+		case "key":
+			value = entry.Key
+		case "name":
+			value = entry.Name
+		case "alias":
+			value = entry.Key
+			if len(entry.Aliases) > 0 {
+				value = entry.Aliases[0]
+			}
+		case "type":
+			value = entry.DeviceType
+			if parts := strings.Split(value, ":"); len(parts) >= 4 {
+				value = parts[3] // urn:Belkin:device:insight:1
+			}
+		default:
+			value = entry.Labels[name]
+		}
+		if value == "" {
+			return "unknown"
+		}
+		return node(value)
+	})
+}
+
+var nodeRE = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// node makes a value usable as one node of a metric path.
+func node(value string) string {
+	return strings.Trim(nodeRE.ReplaceAllString(strings.ToLower(value), "_"), "_")
+}
+
+// Sample reads all devices once and buffers their metrics. It returns how
+// many devices answered.
+func (s *Sink) Sample(ctx context.Context) int {
+	if s.counters == nil {
+		s.counters = wemo.NewInsightCounters()
+	}
+	n := 0
+	for _, entry := range s.Manager.List() {
+		path := s.Path(entry)
+		now := time.Now()
+		state, err := s.Manager.BinaryState(ctx, entry.Key)
+		if err != nil {
+			s.add(line(path+".up", 0, now))
+			continue
+		}
+		n++
+		lines := []string{line(path+".up", 1, now), line(path+".state", float64(state), now)}
+
+		if entry.Capabilities().Has(wemo.CapInsight) {
+			if params, err := s.Manager.InsightParams(ctx, entry.Key); err == nil {
+				s.counters.Update(wemo.InsightReading{Host: entry.Key, Time: now, Params: *params})
+				totals, _ := s.counters.Snapshot(entry.Key)
+				lines = append(lines,
+					line(path+".power_w", params.PowerW(), now),
+					line(path+".today_kwh", params.TodayKWh(), now),
+					line(path+".energy_kwh", totals.EnergyKWh, now),
+					line(path+".on_for", float64(params.OnFor), now),
+					line(path+".on_today", float64(params.OnToday), now),
+					line(path+".signal", params.WifiStrength, now),
+				)
+			}
+		}
+		s.add(lines...)
+	}
+	return n
+}
+
+func line(path string, value float64, t time.Time) string {
+	return fmt.Sprintf("%s %s %d", path, strconv.FormatFloat(value, 'f', -1, 64), t.Unix())
+}
+
+func (s *Sink) add(lines ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, lines...)
+	s.trim()
+}
+
+// trim drops the oldest lines beyond MaxBuffered, s.mu must be held.
+func (s *Sink) trim() {
+	max := s.MaxBuffered
+	if max <= 0 {
+		max = 10000
+	}
+	if len(s.lines) > max {
+		s.lines = s.lines[len(s.lines)-max:]
+	}
+}
+
+// Buffered returns the number of lines waiting to be sent.
+func (s *Sink) Buffered() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.lines)
+}
+
+// Flush sends the buffered lines. On failure they stay buffered.
+func (s *Sink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	lines := s.lines
+	s.lines = nil
+	s.mu.Unlock()
+	if len(lines) == 0 {
+		return nil
+	}
+
+	err := s.send(ctx, strings.Join(lines, "\n")+"\n")
+	if err != nil {
+		s.mu.Lock()
+		s.lines = append(lines, s.lines...)
+		s.trim()
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *Sink) send(ctx context.Context, body string) error {
+	network := s.Network
+	if network == "" {
+		network = "tcp"
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, s.Address)
+	if err != nil {
+		return fmt.Errorf("unable to connect to Graphite => %s", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+	}
+	if _, err := conn.Write([]byte(body)); err != nil {
+		return fmt.Errorf("unable to write to Graphite => %s", err)
+	}
+	return nil
+}
+
+// Run samples and flushes until ctx is done, then flushes once more. Send
+// errors are passed to onError, if set, and retried with the next flush.
+func (s *Sink) Run(ctx context.Context, onError func(error)) error {
+	sample := time.NewTicker(durationOr(s.SampleInterval, 10*time.Second))
+	defer sample.Stop()
+	flush := time.NewTicker(durationOr(s.FlushInterval, time.Minute))
+	defer flush.Stop()
+
+	report := func(err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			report(s.Flush(final))
+			cancel()
+			return ctx.Err()
+		case <-sample.C:
+			s.Sample(ctx)
+		case <-flush.C:
+			report(s.Flush(ctx))
+		}
+	}
+}
+
+func durationOr(d, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return fallback
+}
@@ -0,0 +1,93 @@
+package wemographite
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+const envelope = `<?xml version="1.0" encoding="utf-8"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>%s</s:Body></s:Envelope>`
+
+func TestSink(t *testing.T) {
+	insight := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.Header.Get("SOAPACTION"), "#GetInsightParams"):
+			fmt.Fprintf(w, envelope, `<u:GetInsightParamsResponse xmlns:u="urn:Belkin:service:insight:1"><InsightParams>1|1466240587|7|7|7|1209600|55|41600|600000|6000000|8000</InsightParams></u:GetInsightParamsResponse>`)
+		default:
+			fmt.Fprintf(w, envelope, `<u:GetBinaryStateResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>1</BinaryState></u:GetBinaryStateResponse>`)
+		}
+	}))
+	defer insight.Close()
+
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Deep Freezer", Host: strings.TrimPrefix(insight.URL, "http://"), UDN: "uuid:Insight-1_0-A", DeviceType: wemo.Insight})
+	m.Put(wemo.ManagedDevice{Name: "Plug", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-B", DeviceType: wemo.Controllee})
+	m.SetLabel("uuid:Insight-1_0-A", "room", "Utility Room")
+
+	sink := &Sink{Manager: m, Template: "home.{room}.{name}"}
+	if n := sink.Sample(context.Background()); n != 1 {
+		t.Fatalf("Expected: 1 device to answer, got: %d", n)
+	}
+
+	sink.Address = "127.0.0.1:1"
+	if err := sink.Flush(context.Background()); err == nil || sink.Buffered() != 9 {
+		t.Fatalf("Expected: the lines to be kept after a failed send, got: %v, %d", err, sink.Buffered())
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan []string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var lines []string
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		received <- lines
+	}()
+
+	sink.Address = listener.Addr().String()
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	lines := <-received
+	expected := map[string]string{
+		"home.utility_room.deep_freezer.up":      "1",
+		"home.utility_room.deep_freezer.state":   "1",
+		"home.utility_room.deep_freezer.power_w": "41.6",
+		"home.utility_room.deep_freezer.on_for":  "7",
+		"home.unknown.plug.up":                   "0",
+	}
+	found := 0
+	for _, l := range lines {
+		fields := strings.Fields(l)
+		if len(fields) != 3 {
+			t.Errorf("Unexpected line: %q", l)
+			continue
+		}
+		if value, ok := expected[fields[0]]; ok {
+			found++
+			if fields[1] != value {
+				t.Errorf("Expected: %s %s, got: %s", fields[0], value, l)
+			}
+		}
+	}
+	if found != len(expected) || len(lines) != 9 {
+		t.Errorf("Unexpected lines: %q", lines)
+	}
+}
@@ -0,0 +1,105 @@
+package wemogrpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Client calls the WeMo service.
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewClient returns a client using conn, e.g. a *grpc.ClientConn.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+func (c *Client) invoke(ctx context.Context, method string, input protoreflect.Name, in interface{}, output protoreflect.Name, out interface{}, opts ...grpc.CallOption) error {
+	req, err := toMessage(input, in)
+	if err != nil {
+		return err
+	}
+	resp := dynamicpb.NewMessage(messageType(output))
+	if err := c.conn.Invoke(ctx, "/"+ServiceName+"/"+method, req, resp, opts...); err != nil {
+		return err
+	}
+	return fromMessage(resp, out)
+}
+
+// ListDevices lists the devices matching a label selector, all when empty.
+func (c *Client) ListDevices(ctx context.Context, selector string, opts ...grpc.CallOption) ([]Device, error) {
+	var out listDevicesResponse
+	err := c.invoke(ctx, "ListDevices", "ListDevicesRequest", listDevicesRequest{selector}, "ListDevicesResponse", &out, opts...)
+	return out.Devices, err
+}
+
+// GetState reads the state of a device named by key or alias.
+func (c *Client) GetState(ctx context.Context, device string, opts ...grpc.CallOption) (*State, error) {
+	out := &State{}
+	if err := c.invoke(ctx, "GetState", "GetStateRequest", deviceRequest{device}, "State", out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetOn switches a device on or off.
+func (c *Client) SetOn(ctx context.Context, device string, on bool, opts ...grpc.CallOption) (*State, error) {
+	return c.setState(ctx, setStateRequest{Device: device, On: &on}, opts...)
+}
+
+// SetLevel dims a device to level percent.
+func (c *Client) SetLevel(ctx context.Context, device string, level int, opts ...grpc.CallOption) (*State, error) {
+	return c.setState(ctx, setStateRequest{Device: device, Level: &level}, opts...)
+}
+
+func (c *Client) setState(ctx context.Context, in setStateRequest, opts ...grpc.CallOption) (*State, error) {
+	out := &State{}
+	if err := c.invoke(ctx, "SetState", "SetStateRequest", in, "State", out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetInsight reads the readings of an Insight.
+func (c *Client) GetInsight(ctx context.Context, device string, opts ...grpc.CallOption) (*Insight, error) {
+	out := &Insight{}
+	if err := c.invoke(ctx, "GetInsight", "GetInsightRequest", deviceRequest{device}, "Insight", out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EventStream receives the events of StreamEvents.
+type EventStream struct {
+	stream grpc.ClientStream
+}
+
+// Recv returns the next event. It fails once ctx of StreamEvents is done.
+func (s *EventStream) Recv() (*Event, error) {
+	msg := dynamicpb.NewMessage(messageType("Event"))
+	if err := s.stream.RecvMsg(msg); err != nil {
+		return nil, err
+	}
+	event := &Event{}
+	return event, fromMessage(msg, event)
+}
+
+// StreamEvents streams state changes until ctx is done.
+func (c *Client) StreamEvents(ctx context.Context, opts ...grpc.CallOption) (*EventStream, error) {
+	desc := &serviceDesc.Streams[0]
+	stream, err := c.conn.NewStream(ctx, desc, "/"+ServiceName+"/StreamEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(dynamicpb.NewMessage(messageType("StreamEventsRequest"))); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &EventStream{stream}, nil
+}
@@ -0,0 +1,161 @@
+package wemogrpc
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ServiceName is the full name of the service in wemo.proto.
+const ServiceName = "wemo.v1.WeMo"
+
+type fieldType = descriptorpb.FieldDescriptorProto_Type
+
+const (
+	tString  = descriptorpb.FieldDescriptorProto_TYPE_STRING
+	tBool    = descriptorpb.FieldDescriptorProto_TYPE_BOOL
+	tInt32   = descriptorpb.FieldDescriptorProto_TYPE_INT32
+	tInt64   = descriptorpb.FieldDescriptorProto_TYPE_INT64
+	tUint64  = descriptorpb.FieldDescriptorProto_TYPE_UINT64
+	tDouble  = descriptorpb.FieldDescriptorProto_TYPE_DOUBLE
+	tMessage = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+)
+
+func field(name string, number int32, typ fieldType) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Type:   typ.Enum(),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+}
+
+func repeated(f *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+	f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	return f
+}
+
+func messageField(name string, number int32, typeName string) *descriptorpb.FieldDescriptorProto {
+	f := field(name, number, tMessage)
+	f.TypeName = proto.String(typeName)
+	return f
+}
+
+func oneof(f *descriptorpb.FieldDescriptorProto, index int32) *descriptorpb.FieldDescriptorProto {
+	f.OneofIndex = proto.Int32(index)
+	return f
+}
+
+func message(name string, fields ...*descriptorpb.FieldDescriptorProto) *descriptorpb.DescriptorProto {
+	return &descriptorpb.DescriptorProto{Name: proto.String(name), Field: fields}
+}
+
+func method(name, input, output string, serverStreaming bool) *descriptorpb.MethodDescriptorProto {
+	return &descriptorpb.MethodDescriptorProto{
+		Name:            proto.String(name),
+		InputType:       proto.String(".wemo.v1." + input),
+		OutputType:      proto.String(".wemo.v1." + output),
+		ServerStreaming: proto.Bool(serverStreaming),
+	}
+}
+
+// fileDescriptor is wemo.proto, built at runtime since there is no generated
+// code. TestDescriptorMatchesProto compares it with the compiled wemo.proto.
+func fileDescriptor() *descriptorpb.FileDescriptorProto {
+	device := message("Device",
+		field("key", 1, tString),
+		field("name", 2, tString),
+		field("host", 3, tString),
+		field("udn", 4, tString),
+		field("serial", 5, tString),
+		field("device_type", 6, tString),
+		repeated(field("aliases", 7, tString)),
+		repeated(messageField("labels", 8, ".wemo.v1.Device.LabelsEntry")),
+		field("capabilities", 9, tString),
+		field("health", 10, tString),
+	)
+	labels := message("LabelsEntry", field("key", 1, tString), field("value", 2, tString))
+	labels.Options = &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)}
+	device.NestedType = []*descriptorpb.DescriptorProto{labels}
+
+	setState := message("SetStateRequest",
+		field("device", 1, tString),
+		oneof(field("on", 2, tBool), 0),
+		oneof(field("level", 3, tInt32), 0),
+	)
+	setState.OneofDecl = []*descriptorpb.OneofDescriptorProto{{Name: proto.String("target")}}
+
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("wemo.proto"),
+		Package: proto.String("wemo.v1"),
+		Syntax:  proto.String("proto3"),
+		Options: &descriptorpb.FileOptions{GoPackage: proto.String("github.com/randohm/go.wemo/wemogrpc")},
+		MessageType: []*descriptorpb.DescriptorProto{
+			device,
+			message("ListDevicesRequest", field("selector", 1, tString)),
+			message("ListDevicesResponse", repeated(messageField("devices", 1, ".wemo.v1.Device"))),
+			message("GetStateRequest", field("device", 1, tString)),
+			message("Bulb",
+				field("id", 1, tString),
+				field("on", 2, tBool),
+				field("level", 3, tInt32),
+			),
+			message("State",
+				field("key", 1, tString),
+				field("state", 2, tInt32),
+				field("brightness", 3, tInt32),
+				repeated(messageField("bulbs", 4, ".wemo.v1.Bulb")),
+			),
+			setState,
+			message("StreamEventsRequest"),
+			message("Event",
+				field("seq", 1, tUint64),
+				field("key", 2, tString),
+				field("name", 3, tString),
+				field("state", 4, tInt32),
+				field("previous", 5, tInt32),
+				field("source", 6, tString),
+				field("time_unix_nano", 7, tInt64),
+				field("dropped", 8, tInt32),
+			),
+			message("GetInsightRequest", field("device", 1, tString)),
+			message("Insight",
+				field("power_w", 1, tDouble),
+				field("today_kwh", 2, tDouble),
+				field("total_kwh", 3, tDouble),
+				field("on_for", 4, tInt64),
+				field("on_today", 5, tInt64),
+				field("on_total", 6, tInt64),
+				field("signal", 7, tDouble),
+			),
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("WeMo"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("ListDevices", "ListDevicesRequest", "ListDevicesResponse", false),
+				method("GetState", "GetStateRequest", "State", false),
+				method("SetState", "SetStateRequest", "State", false),
+				method("StreamEvents", "StreamEventsRequest", "Event", true),
+				method("GetInsight", "GetInsightRequest", "Insight", false),
+			},
+		}},
+	}
+}
+
+// File is the descriptor of wemo.proto, e.g. to register it for server
+// reflection.
+var File protoreflect.FileDescriptor
+
+func init() {
+	var err error
+	File, err = protodesc.NewFile(fileDescriptor(), new(protoregistry.Files))
+	if err != nil {
+		panic("wemogrpc: invalid descriptor: " + err.Error())
+	}
+}
+
+func messageType(name protoreflect.Name) protoreflect.MessageDescriptor {
+	return File.Messages().ByName(name)
+}
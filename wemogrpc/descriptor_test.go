@@ -0,0 +1,42 @@
+package wemogrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// TestDescriptorMatchesProto keeps descriptor.go in sync with wemo.proto.
+func TestDescriptorMatchesProto(t *testing.T) {
+	compiler := protocompile.Compiler{Resolver: &protocompile.SourceResolver{}}
+	files, err := compiler.Compile(context.Background(), "wemo.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := protodesc.ToFileDescriptorProto(files[0])
+	expected.SourceCodeInfo = nil
+	for _, m := range expected.MessageType {
+		clearJSONNames(m)
+	}
+	actual := protodesc.ToFileDescriptorProto(File)
+	if !proto.Equal(expected, actual) {
+		t.Errorf("Expected: the descriptor of wemo.proto\n%s\ngot:\n%s", prototext.Format(expected), prototext.Format(actual))
+	}
+}
+
+// clearJSONNames removes the JSON names the compiler fills in, which the
+// descriptor built at runtime leaves to their defaults.
+func clearJSONNames(m *descriptorpb.DescriptorProto) {
+	for _, f := range m.Field {
+		f.JsonName = nil
+	}
+	for _, nested := range m.NestedType {
+		clearJSONNames(nested)
+	}
+}
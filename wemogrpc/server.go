@@ -0,0 +1,260 @@
+// Package wemogrpc serves the devices of a wemo.Manager as the gRPC service
+// described in wemo.proto, and has a client for it. Clients in other languages
+// generate their stubs from wemo.proto.
+package wemogrpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/randohm/go.wemo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Server implements the WeMo service over a Manager.
+type Server struct {
+	Manager *wemo.Manager
+}
+
+// NewServer returns a server for the devices of m.
+func NewServer(m *wemo.Manager) *Server {
+	return &Server{Manager: m}
+}
+
+// Register registers the service with r, e.g. a *grpc.Server.
+func (s *Server) Register(r grpc.ServiceRegistrar) {
+	r.RegisterService(&serviceDesc, s)
+}
+
+// ListDevices lists the devices matching a label selector, all when empty.
+func (s *Server) ListDevices(ctx context.Context, selector string) ([]Device, error) {
+	sel, err := wemo.ParseSelector(selector)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var devices []Device
+	for _, entry := range s.Manager.Select(sel) {
+		devices = append(devices, Device{
+			Key:          entry.Key,
+			Name:         entry.Name,
+			Host:         entry.Host,
+			UDN:          entry.UDN,
+			Serial:       entry.Serial,
+			DeviceType:   entry.DeviceType,
+			Aliases:      entry.Aliases,
+			Labels:       entry.Labels,
+			Capabilities: entry.Capabilities().String(),
+			Health:       entry.Health.String(),
+		})
+	}
+	return devices, nil
+}
+
+// GetState reads the state of a device named by key or alias.
+func (s *Server) GetState(ctx context.Context, device string) (*State, error) {
+	entry, err := s.device(device)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := s.Manager.State(ctx, entry.Key)
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	state := &State{Key: entry.Key, State: snapshot.State, Brightness: snapshot.Brightness}
+	for id, bulb := range snapshot.Bulbs {
+		state.Bulbs = append(state.Bulbs, Bulb{ID: id, On: bulb.On, Level: bulb.Level})
+	}
+	return state, nil
+}
+
+// SetState switches a device when on is set, or dims it when level is set.
+func (s *Server) SetState(ctx context.Context, device string, on *bool, level *int) (*State, error) {
+	entry, err := s.device(device)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case level != nil:
+		if *level < 0 || *level > 100 {
+			return nil, status.Errorf(codes.InvalidArgument, "level %d is out of bounds 0-100", *level)
+		}
+		err = s.Manager.SetLevel(ctx, entry.Key, *level)
+	case on != nil:
+		err = s.Manager.SetBinaryState(ctx, entry.Key, *on)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "expected on or level")
+	}
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return s.GetState(ctx, entry.Key)
+}
+
+// StreamEvents passes state changes to send until ctx is done or send fails.
+func (s *Server) StreamEvents(ctx context.Context, send func(*Event) error) error {
+	events, cancel := s.Manager.Subscribe(64)
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-events:
+			err := send(&Event{
+				Seq:          event.Seq,
+				Key:          event.Key,
+				Name:         event.Name,
+				State:        event.State,
+				Previous:     event.Previous,
+				Source:       string(event.Source),
+				TimeUnixNano: event.Time.UnixNano(),
+				Dropped:      event.Dropped,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// GetInsight reads the readings of an Insight.
+func (s *Server) GetInsight(ctx context.Context, device string) (*Insight, error) {
+	entry, err := s.device(device)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.Capabilities().Has(wemo.CapInsight) {
+		return nil, statusOf(&wemo.UnsupportedError{Device: entry.Name, Needs: wemo.CapInsight})
+	}
+	params, err := s.Manager.InsightParams(ctx, entry.Key)
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return &Insight{
+		PowerW:   params.PowerW(),
+		TodayKWh: params.TodayKWh(),
+		TotalKWh: params.TotalKWh(),
+		OnFor:    int64(params.OnFor),
+		OnToday:  int64(params.OnToday),
+		OnTotal:  int64(params.OnTotal),
+		Signal:   params.WifiStrength,
+	}, nil
+}
+
+// device finds a device by its key or an alias, see Manager.Find.
+func (s *Server) device(name string) (wemo.ManagedDevice, error) {
+	entry, err := s.Manager.Find(name)
+	switch {
+	case errors.Is(err, wemo.ErrUnknownDevice):
+		return entry, status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		return entry, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return entry, nil
+}
+
+func statusOf(err error) error {
+	var unsupported *wemo.UnsupportedError
+	switch {
+	case errors.As(err, &unsupported):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+// handler is the handler type of serviceDesc.
+type handler interface {
+	ListDevices(ctx context.Context, selector string) ([]Device, error)
+	GetState(ctx context.Context, device string) (*State, error)
+	SetState(ctx context.Context, device string, on *bool, level *int) (*State, error)
+	StreamEvents(ctx context.Context, send func(*Event) error) error
+	GetInsight(ctx context.Context, device string) (*Insight, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*handler)(nil),
+	Methods: []grpc.MethodDesc{
+		unary("ListDevices", "ListDevicesRequest", "ListDevicesResponse", func(ctx context.Context, h handler, req *dynamicpb.Message) (interface{}, error) {
+			var in listDevicesRequest
+			if err := fromMessage(req, &in); err != nil {
+				return nil, err
+			}
+			devices, err := h.ListDevices(ctx, in.Selector)
+			return listDevicesResponse{devices}, err
+		}),
+		unary("GetState", "GetStateRequest", "State", func(ctx context.Context, h handler, req *dynamicpb.Message) (interface{}, error) {
+			var in deviceRequest
+			if err := fromMessage(req, &in); err != nil {
+				return nil, err
+			}
+			return h.GetState(ctx, in.Device)
+		}),
+		unary("SetState", "SetStateRequest", "State", func(ctx context.Context, h handler, req *dynamicpb.Message) (interface{}, error) {
+			var in setStateRequest
+			if err := fromMessage(req, &in); err != nil {
+				return nil, err
+			}
+			return h.SetState(ctx, in.Device, in.On, in.Level)
+		}),
+		unary("GetInsight", "GetInsightRequest", "Insight", func(ctx context.Context, h handler, req *dynamicpb.Message) (interface{}, error) {
+			var in deviceRequest
+			if err := fromMessage(req, &in); err != nil {
+				return nil, err
+			}
+			return h.GetInsight(ctx, in.Device)
+		}),
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "StreamEvents",
+		ServerStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			if err := stream.RecvMsg(dynamicpb.NewMessage(messageType("StreamEventsRequest"))); err != nil {
+				return err
+			}
+			return srv.(handler).StreamEvents(stream.Context(), func(event *Event) error {
+				msg, err := toMessage("Event", event)
+				if err != nil {
+					return err
+				}
+				return stream.SendMsg(msg)
+			})
+		},
+	}},
+	Metadata: "wemo.proto",
+}
+
+// unary adapts fn, which takes the decoded request and returns a Go type, to
+// a method handler sending the output message.
+func unary(name string, input, output protoreflect.Name, fn func(context.Context, handler, *dynamicpb.Message) (interface{}, error)) grpc.MethodDesc {
+	call := func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+		result, err := fn(ctx, srv.(handler), req.(*dynamicpb.Message))
+		if err != nil {
+			return nil, err
+		}
+		return toMessage(output, result)
+	}
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := dynamicpb.NewMessage(messageType(input))
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv, ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + name}
+			return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv, ctx, req)
+			})
+		},
+	}
+}
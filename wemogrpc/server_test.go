@@ -0,0 +1,118 @@
+package wemogrpc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/randohm/go.wemo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const envelope = `<?xml version="1.0" encoding="utf-8"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>%s</s:Body></s:Envelope>`
+
+// newSocket returns a fake switch, which keeps its binary state.
+func newSocket() *httptest.Server {
+	var mu sync.Mutex
+	state := "0"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.Contains(string(body), "<u:SetBinaryState "):
+			state = "1"
+			if strings.Contains(string(body), "<BinaryState>0</BinaryState>") {
+				state = "0"
+			}
+			fmt.Fprintf(w, envelope, `<u:SetBinaryStateResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>`+state+`</BinaryState></u:SetBinaryStateResponse>`)
+		case strings.Contains(string(body), "<u:GetBinaryState "):
+			fmt.Fprintf(w, envelope, `<u:GetBinaryStateResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>`+state+`</BinaryState></u:GetBinaryStateResponse>`)
+		}
+	}))
+}
+
+func TestService(t *testing.T) {
+	socket := newSocket()
+	defer socket.Close()
+
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Porch", Host: strings.TrimPrefix(socket.URL, "http://"), UDN: "uuid:Socket-1_0-A", DeviceType: wemo.Controllee})
+	m.SetAlias("uuid:Socket-1_0-A", "porch")
+	m.SetLabel("uuid:Socket-1_0-A", "room", "outside")
+
+	listener := bufconn.Listen(1 << 16)
+	server := grpc.NewServer()
+	NewServer(m).Register(server)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := NewClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	devices, err := client.ListDevices(ctx, "room=outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].Name != "Porch" || devices[0].Labels["room"] != "outside" || devices[0].Aliases[0] != "porch" {
+		t.Errorf("Unexpected devices: %+v", devices)
+	}
+
+	events, err := client.StreamEvents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := client.SetOn(ctx, "porch", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Key != "uuid:Socket-1_0-A" || state.State != 1 {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+
+	// the stream may have been subscribed after the change
+	go func() {
+		for i := 0; ctx.Err() == nil; i++ {
+			m.UpdateBinaryState("uuid:Socket-1_0-A", i%2)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	event, err := events.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Key != "uuid:Socket-1_0-A" || event.Seq == 0 || event.TimeUnixNano == 0 {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+
+	if _, err := client.GetInsight(ctx, "porch"); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected: %s, got: %v", codes.FailedPrecondition, err)
+	}
+	if _, err := client.GetState(ctx, "garage"); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected: %s, got: %v", codes.NotFound, err)
+	}
+	if _, err := client.SetLevel(ctx, "porch", 140); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected: %s, got: %v", codes.InvalidArgument, err)
+	}
+}
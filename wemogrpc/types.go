@@ -0,0 +1,103 @@
+package wemogrpc
+
+import (
+	"encoding/json"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Device is a device as listed by ListDevices.
+type Device struct {
+	Key          string            `json:"key"`
+	Name         string            `json:"name"`
+	Host         string            `json:"host"`
+	UDN          string            `json:"udn"`
+	Serial       string            `json:"serial"`
+	DeviceType   string            `json:"device_type"`
+	Aliases      []string          `json:"aliases"`
+	Labels       map[string]string `json:"labels"`
+	Capabilities string            `json:"capabilities"`
+	Health       string            `json:"health"`
+}
+
+// Bulb is the state of a bulb of a bridge.
+type Bulb struct {
+	ID    string `json:"id"`
+	On    bool   `json:"on"`
+	Level int    `json:"level"` // 0-255
+}
+
+// State is the state of a device.
+type State struct {
+	Key        string `json:"key"`
+	State      int    `json:"state"`
+	Brightness int    `json:"brightness"` // dimmers, in percent
+	Bulbs      []Bulb `json:"bulbs"`      // bridges
+}
+
+// Event is a binary state change, see wemo.StateChanged.
+type Event struct {
+	Seq          uint64 `json:"seq,string"`
+	Key          string `json:"key"`
+	Name         string `json:"name"`
+	State        int    `json:"state"`
+	Previous     int    `json:"previous"`
+	Source       string `json:"source"`
+	TimeUnixNano int64  `json:"time_unix_nano,string"`
+	Dropped      int    `json:"dropped"`
+}
+
+// Insight are the readings of an Insight.
+type Insight struct {
+	PowerW   float64 `json:"power_w"`
+	TodayKWh float64 `json:"today_kwh"`
+	TotalKWh float64 `json:"total_kwh"`
+	OnFor    int64   `json:"on_for,string"`   // seconds
+	OnToday  int64   `json:"on_today,string"` // seconds
+	OnTotal  int64   `json:"on_total,string"` // seconds
+	Signal   float64 `json:"signal"`
+}
+
+type listDevicesRequest struct {
+	Selector string `json:"selector"`
+}
+
+type listDevicesResponse struct {
+	Devices []Device `json:"devices"`
+}
+
+type deviceRequest struct {
+	Device string `json:"device"`
+}
+
+type setStateRequest struct {
+	Device string `json:"device"`
+	On     *bool  `json:"on,omitempty"`
+	Level  *int   `json:"level,omitempty"`
+}
+
+// The messages have no generated Go types; they are converted from and to the
+// Go types above through their JSON mapping, which uses the field names of
+// wemo.proto.
+
+func toMessage(name protoreflect.Name, v interface{}) (*dynamicpb.Message, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamicpb.NewMessage(messageType(name))
+	if err := protojson.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func fromMessage(msg *dynamicpb.Message, v interface{}) error {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,105 @@
+package wemohomekit
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+)
+
+// Server is a HAP server for the accessories of a Bridge.
+type Server struct {
+	*hap.Server
+	Bridge *accessory.Bridge
+}
+
+// NewServer creates the brutella/hap accessories of all devices that can be
+// switched, see Start, and a HAP server publishing them behind a bridge
+// accessory named name. Pairings are kept in store, e.g. hap.NewFsStore(dir),
+// and pin is the 8 digit setup code, which hap defaults to 00102003. Run the
+// bridge and then server.ListenAndServe.
+func (b *Bridge) NewServer(ctx context.Context, store hap.Store, name, pin string) (*Server, error) {
+	bridge := accessory.NewBridge(accessory.Info{Name: name, Manufacturer: "Belkin", Model: "go.wemo"})
+	server, err := hap.NewServer(store, bridge.A, b.HAPAccessories(ctx)...)
+	if err != nil {
+		return nil, err
+	}
+	server.Pin = pin
+	return &Server{Server: server, Bridge: bridge}, nil
+}
+
+// HAPAccessories sets NewAccessory to create brutella/hap accessories, starts
+// the bridge and returns the accessories created. Remote updates switch and
+// dim the devices. Accessory ids are derived from the device keys, so HomeKit
+// keeps rooms and automations of a device across restarts.
+func (b *Bridge) HAPAccessories(ctx context.Context) []*accessory.A {
+	var accessories []*accessory.A
+	b.NewAccessory = func(a Accessory) Characteristics {
+		info := accessory.Info{Name: a.Name, SerialNumber: a.Serial, Manufacturer: "Belkin", Model: a.Model}
+		var c Characteristics
+		var acc *accessory.A
+		switch a.Kind {
+		case Lightbulb:
+			bulb := accessory.NewLightbulb(info)
+			brightness := characteristic.NewBrightness()
+			bulb.Lightbulb.AddC(brightness.C)
+			brightness.OnSetRemoteValue(func(level int) error { return b.remoteUpdate(a.Key, b.SetBrightness(ctx, a.Key, level)) })
+			bulb.Lightbulb.On.OnSetRemoteValue(func(on bool) error { return b.remoteUpdate(a.Key, b.SetOn(ctx, a.Key, on)) })
+			c, acc = hapLightbulb{bulb.Lightbulb, brightness}, bulb.A
+		case Outlet:
+			outlet := accessory.NewOutlet(info)
+			outlet.Outlet.On.OnSetRemoteValue(func(on bool) error { return b.remoteUpdate(a.Key, b.SetOn(ctx, a.Key, on)) })
+			c, acc = hapOutlet{outlet.Outlet}, outlet.A
+		default:
+			sw := accessory.NewSwitch(info)
+			sw.Switch.On.OnSetRemoteValue(func(on bool) error { return b.remoteUpdate(a.Key, b.SetOn(ctx, a.Key, on)) })
+			c, acc = hapSwitch{sw.Switch}, sw.A
+		}
+		acc.Id = accessoryID(a.Key)
+		accessories = append(accessories, acc)
+		return c
+	}
+	b.Start(ctx)
+	return accessories
+}
+
+// remoteUpdate logs a failed remote update, which hap reports to the
+// controller so the Home app shows the device as not responding.
+func (b *Bridge) remoteUpdate(key string, err error) error {
+	if err != nil && b.Logger != nil {
+		b.Logger("homekit: unable to update %s => %s", key, err)
+	}
+	return err
+}
+
+// accessoryID derives a stable accessory id from a device key. Id 1 belongs
+// to the bridge accessory.
+func accessoryID(key string) uint64 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return uint64(h.Sum32()) + 2
+}
+
+type hapSwitch struct{ *service.Switch }
+
+func (s hapSwitch) SetOn(on bool)       { s.On.SetValue(on) }
+func (s hapSwitch) SetBrightness(int)   {}
+func (s hapSwitch) SetOutletInUse(bool) {}
+
+type hapLightbulb struct {
+	*service.Lightbulb
+	brightness *characteristic.Brightness
+}
+
+func (l hapLightbulb) SetOn(on bool)           { l.On.SetValue(on) }
+func (l hapLightbulb) SetBrightness(level int) { l.brightness.SetValue(level) }
+func (l hapLightbulb) SetOutletInUse(bool)     {}
+
+type hapOutlet struct{ *service.Outlet }
+
+func (o hapOutlet) SetOn(on bool)             { o.On.SetValue(on) }
+func (o hapOutlet) SetBrightness(int)         {}
+func (o hapOutlet) SetOutletInUse(inUse bool) { o.OutletInUse.SetValue(inUse) }
@@ -0,0 +1,197 @@
+// Package wemohomekit exposes the switches, dimmers and Insights of a
+// wemo.Manager as HomeKit accessories and keeps them in sync in both
+// directions.
+//
+// With github.com/brutella/hap, NewServer creates the accessories, a switch,
+// a lightbulb with brightness or an outlet for each device, and the HAP
+// server publishing them:
+//
+//	b := &wemohomekit.Bridge{Manager: m, Logger: log.Printf}
+//	server, err := b.NewServer(ctx, hap.NewFsStore("homekit"), "WeMo", "12344321")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	go b.Run(ctx)
+//	server.ListenAndServe(ctx)
+//
+// Other HAP libraries plug in through NewAccessory.
+package wemohomekit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/randohm/go.wemo"
+)
+
+// Kind is the HomeKit service an accessory is exposed as.
+type Kind int
+
+// Accessory kinds
+const (
+	Switch    Kind = iota // on and off
+	Lightbulb             // on, off and brightness
+	Outlet                // on, off and whether something draws power
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Lightbulb:
+		return "lightbulb"
+	case Outlet:
+		return "outlet"
+	}
+	return "switch"
+}
+
+// Accessory describes a device to expose.
+type Accessory struct {
+	Key    string // device key, to pass to SetOn and SetBrightness
+	Name   string
+	Serial string
+	Model  string
+	Kind   Kind
+}
+
+// Characteristics are the values of an accessory the bridge updates when the
+// device changes. Kinds without brightness or outlet in use ignore those.
+type Characteristics interface {
+	SetOn(on bool)
+	SetBrightness(level int) // percent
+	SetOutletInUse(inUse bool)
+}
+
+// Bridge syncs the devices of a Manager with HomeKit accessories.
+type Bridge struct {
+	Manager *wemo.Manager
+
+	// NewAccessory creates the HomeKit accessory for a device and returns its
+	// characteristics. Remote updates of the accessory are passed to SetOn and
+	// SetBrightness.
+	NewAccessory func(Accessory) Characteristics
+
+	// InUseWatts is the power above which an Insight reports its outlet in
+	// use, defaults to 2 watts. InsightInterval is how often that is read,
+	// defaults to a minute.
+	InUseWatts      float64
+	InsightInterval time.Duration
+
+	// Logger, if set, receives remote updates that failed.
+	Logger func(format string, args ...interface{})
+
+	mu          sync.Mutex
+	accessories map[string]Characteristics
+}
+
+// KindOf returns the kind a device is exposed as, and false for devices that
+// can't be switched.
+func KindOf(entry wemo.ManagedDevice) (Kind, bool) {
+	c := entry.Capabilities()
+	switch {
+	case c.Has(wemo.CapDim):
+		return Lightbulb, true
+	case c.Has(wemo.CapInsight):
+		return Outlet, true
+	case c.Has(wemo.CapSwitch):
+		return Switch, true
+	}
+	return Switch, false
+}
+
+// Start creates the accessories of all devices that can be switched, and
+// returns how many it created. Call it before starting the HAP server, since
+// HomeKit bridges can't add accessories while they run.
+func (b *Bridge) Start(ctx context.Context) int {
+	b.mu.Lock()
+	if b.accessories == nil {
+		b.accessories = make(map[string]Characteristics)
+	}
+	var added []string
+	for _, entry := range b.Manager.List() {
+		kind, ok := KindOf(entry)
+		if !ok || b.accessories[entry.Key] != nil {
+			continue
+		}
+		a := Accessory{Key: entry.Key, Name: entry.Name, Serial: entry.Serial, Model: entry.DeviceType, Kind: kind}
+		b.accessories[entry.Key] = b.NewAccessory(a)
+		added = append(added, entry.Key)
+	}
+	b.mu.Unlock()
+
+	for _, key := range added {
+		if state, err := b.Manager.State(ctx, key); err == nil {
+			b.update(key, state.State, state.Brightness)
+		}
+	}
+	return len(added)
+}
+
+func (b *Bridge) characteristics(key string) Characteristics {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.accessories[key]
+}
+
+func (b *Bridge) update(key string, state, brightness int) {
+	c := b.characteristics(key)
+	if c == nil {
+		return
+	}
+	c.SetOn(state != 0)
+	if brightness > 0 {
+		c.SetBrightness(brightness)
+	}
+}
+
+// SetOn switches a device on a remote update of its accessory.
+func (b *Bridge) SetOn(ctx context.Context, key string, on bool) error {
+	return b.Manager.SetBinaryState(ctx, key, on)
+}
+
+// SetBrightness dims a device on a remote update of its accessory.
+func (b *Bridge) SetBrightness(ctx context.Context, key string, level int) error {
+	return b.Manager.SetLevel(ctx, key, level)
+}
+
+// Run passes state changes of the devices to their accessories and reads
+// whether Insights are in use, until ctx is done.
+func (b *Bridge) Run(ctx context.Context) error {
+	events, cancel := b.Manager.Subscribe(64)
+	defer cancel()
+
+	interval := b.InsightInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	b.updateInUse(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-events:
+			b.update(event.Key, event.State, 0)
+		case <-ticker.C:
+			b.updateInUse(ctx)
+		}
+	}
+}
+
+func (b *Bridge) updateInUse(ctx context.Context) {
+	threshold := b.InUseWatts
+	if threshold <= 0 {
+		threshold = 2
+	}
+	for _, entry := range b.Manager.List() {
+		c := b.characteristics(entry.Key)
+		if c == nil || !entry.Capabilities().Has(wemo.CapInsight) {
+			continue
+		}
+		if params, err := b.Manager.InsightParams(ctx, entry.Key); err == nil {
+			c.SetOutletInUse(params.PowerW() >= threshold)
+		}
+	}
+}
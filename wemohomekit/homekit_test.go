@@ -0,0 +1,146 @@
+package wemohomekit
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+	"github.com/randohm/go.wemo"
+	"github.com/randohm/go.wemo/wemotest"
+)
+
+type fakeCharacteristics struct {
+	mu sync.Mutex
+	on bool
+}
+
+func (f *fakeCharacteristics) SetOn(on bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.on = on
+}
+
+func (f *fakeCharacteristics) SetBrightness(int)   {}
+func (f *fakeCharacteristics) SetOutletInUse(bool) {}
+
+func (f *fakeCharacteristics) isOn() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.on
+}
+
+func TestBridge(t *testing.T) {
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Hall", Host: "127.0.0.1:1", UDN: "uuid:Dimmer-1_0-A", DeviceType: wemo.Dimmer})
+	m.Put(wemo.ManagedDevice{Name: "Motion", Host: "127.0.0.1:2", UDN: "uuid:Sensor-1_0-B", DeviceType: wemo.Sensor})
+
+	var accessories []Accessory
+	hall := &fakeCharacteristics{}
+	b := &Bridge{Manager: m, NewAccessory: func(a Accessory) Characteristics {
+		accessories = append(accessories, a)
+		return hall
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if n := b.Start(ctx); n != 1 || accessories[0].Kind != Lightbulb {
+		t.Fatalf("Expected: a lightbulb for the dimmer only, got: %+v", accessories)
+	}
+
+	done := make(chan error)
+	go func() { done <- b.Run(ctx) }()
+
+	for !hall.isOn() {
+		m.UpdateBinaryState("uuid:Dimmer-1_0-A", 0)
+		m.UpdateBinaryState("uuid:Dimmer-1_0-A", 1)
+		select {
+		case <-ctx.Done():
+			t.Fatal("Expected: the accessory to be switched on")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+}
+
+func TestHAPAccessories(t *testing.T) {
+	hall := &wemotest.Device{Type: wemo.Dimmer, Name: "Hall"}
+	hallDevice := wemotest.Serve(t, hall)
+
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Hall", Host: hallDevice.Host, UDN: hall.UDN(), DeviceType: wemo.Dimmer})
+	m.Put(wemo.ManagedDevice{Name: "Kettle", Host: "127.0.0.1:1", UDN: "uuid:Insight-1_0-B", DeviceType: wemo.Insight})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	b := &Bridge{Manager: m}
+	accessories := b.HAPAccessories(ctx)
+	if len(accessories) != 2 {
+		t.Fatalf("Expected: 2 accessories, got: %d", len(accessories))
+	}
+
+	var bulb, outlet *service.S
+	for _, a := range accessories {
+		for _, s := range a.Ss {
+			switch s.Type {
+			case service.TypeLightbulb:
+				bulb = s
+			case service.TypeOutlet:
+				outlet = s
+				if a.Id != accessoryID("uuid:Insight-1_0-B") {
+					t.Errorf("Expected: an id derived from the key, got: %d", a.Id)
+				}
+			}
+		}
+	}
+	if bulb == nil || outlet == nil {
+		t.Fatalf("Expected: a lightbulb and an outlet, got: %+v", accessories)
+	}
+
+	// a write from the Home app switches and dims the dimmer
+	request := httptest.NewRequest("PUT", "/characteristics", nil)
+	for _, c := range bulb.Cs {
+		switch c.Type {
+		case characteristic.TypeOn:
+			if _, code := c.SetValueRequest(true, request); code != 0 {
+				t.Errorf("Expected: the dimmer switched on, got: %d", code)
+			}
+		case characteristic.TypeBrightness:
+			if _, code := c.SetValueRequest(40, request); code != 0 {
+				t.Errorf("Expected: the dimmer dimmed, got: %d", code)
+			}
+		}
+	}
+	if hall.State() != 1 || hall.Brightness() != 40 {
+		t.Errorf("Expected: the dimmer on at 40%%, got: %d at %d", hall.State(), hall.Brightness())
+	}
+
+	// the Insight doesn't answer, which is reported to the controller
+	for _, c := range outlet.Cs {
+		if c.Type == characteristic.TypeOn {
+			if _, code := c.SetValueRequest(true, request); code == 0 {
+				t.Error("Expected: the failed write to be reported")
+			}
+		}
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Porch", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-A", DeviceType: wemo.Controllee})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	server, err := (&Bridge{Manager: m}).NewServer(ctx, hap.NewMemStore(), "WeMo", "12344321")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Pin != "12344321" || server.Bridge.Id != 1 {
+		t.Errorf("Expected: the bridge with the pin, got: %s, %d", server.Pin, server.Bridge.Id)
+	}
+}
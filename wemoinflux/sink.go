@@ -0,0 +1,270 @@
+// Package wemoinflux writes the Insight readings of a wemo.Manager to InfluxDB
+// in line protocol, over the v1 or the v2 write API.
+package wemoinflux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/randohm/go.wemo"
+)
+
+// Sink samples the Insights of a Manager and writes the samples in batches.
+// Samples that couldn't be written are kept and written with the next batch,
+// up to MaxBuffered samples.
+type Sink struct {
+	Manager *wemo.Manager
+
+	// URL is the InfluxDB server, e.g. http://localhost:8086.
+	URL string
+
+	// Database and RetentionPolicy, with Username and Password if the server
+	// needs them, select the v1 API. Org, Bucket and Token select the v2 API,
+	// which is used when Bucket is set.
+	Database        string
+	RetentionPolicy string
+	Username        string
+	Password        string
+	Org             string
+	Bucket          string
+	Token           string
+
+	// Measurement defaults to "wemo_insight".
+	Measurement string
+
+	// Labels are the registry labels, see Manager.SetLabel, added as tags,
+	// e.g. "room". Devices without a label don't get the tag.
+	Labels []string
+
+	SampleInterval time.Duration // defaults to 10 seconds
+	FlushInterval  time.Duration // defaults to a minute
+	BatchSize      int           // samples that trigger a flush, defaults to 500
+	MaxBuffered    int           // defaults to 10000, older samples are dropped
+
+	Client *http.Client // defaults to http.DefaultClient
+
+	counters *wemo.InsightCounters
+	mu       sync.Mutex
+	lines    []string
+}
+
+// Sample reads all Insights once and buffers their readings. It returns how
+// many samples it took.
+func (s *Sink) Sample(ctx context.Context) int {
+	if s.counters == nil {
+		s.counters = wemo.NewInsightCounters()
+	}
+	n := 0
+	for _, entry := range s.Manager.List() {
+		if !entry.Capabilities().Has(wemo.CapInsight) {
+			continue
+		}
+		params, err := s.Manager.InsightParams(ctx, entry.Key)
+		if err != nil {
+			continue
+		}
+		now := time.Now()
+		s.counters.Update(wemo.InsightReading{Host: entry.Key, Time: now, Params: *params})
+		totals, _ := s.counters.Snapshot(entry.Key)
+		s.add(s.line(entry, params, totals, now))
+		n++
+	}
+	return n
+}
+
+func (s *Sink) add(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, line)
+	s.trim()
+}
+
+// trim drops the oldest samples beyond MaxBuffered, s.mu must be held.
+func (s *Sink) trim() {
+	max := s.MaxBuffered
+	if max <= 0 {
+		max = 10000
+	}
+	if len(s.lines) > max {
+		s.lines = s.lines[len(s.lines)-max:]
+	}
+}
+
+// Buffered returns the number of samples waiting to be written.
+func (s *Sink) Buffered() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.lines)
+}
+
+func (s *Sink) line(entry wemo.ManagedDevice, params *wemo.InsightParams, totals wemo.CounterSnapshot, t time.Time) string {
+	measurement := s.Measurement
+	if measurement == "" {
+		measurement = "wemo_insight"
+	}
+
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(measurement))
+	tags := map[string]string{"key": entry.Key, "name": entry.Name}
+	for _, label := range s.Labels {
+		tags[label] = entry.Labels[label]
+	}
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names) // as recommended for write performance
+	for _, name := range names {
+		if tags[name] == "" {
+			continue
+		}
+		fmt.Fprintf(&b, ",%s=%s", tagEscaper.Replace(name), tagEscaper.Replace(tags[name]))
+	}
+
+	fmt.Fprintf(&b, " power_w=%s,today_kwh=%s,energy_kwh=%s,on_for=%di,on_today=%di,signal=%s %d",
+		formatFloat(params.PowerW()),
+		formatFloat(params.TodayKWh()),
+		formatFloat(totals.EnergyKWh),
+		params.OnFor, params.OnToday,
+		formatFloat(params.WifiStrength),
+		t.UnixNano())
+	return b.String()
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Flush writes the buffered samples. On failure they stay buffered.
+func (s *Sink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	lines := s.lines
+	s.lines = nil
+	s.mu.Unlock()
+	if len(lines) == 0 {
+		return nil
+	}
+
+	err := s.write(ctx, strings.Join(lines, "\n")+"\n")
+	if err != nil {
+		s.mu.Lock()
+		s.lines = append(lines, s.lines...)
+		s.trim()
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *Sink) writeURL() (string, error) {
+	if s.URL == "" {
+		return "", errors.New("no InfluxDB URL")
+	}
+	query := url.Values{"precision": {"ns"}}
+	path := "/write"
+	switch {
+	case s.Bucket != "":
+		path = "/api/v2/write"
+		query.Set("org", s.Org)
+		query.Set("bucket", s.Bucket)
+	case s.Database != "":
+		query.Set("db", s.Database)
+		if s.RetentionPolicy != "" {
+			query.Set("rp", s.RetentionPolicy)
+		}
+	default:
+		return "", errors.New("neither a database nor a bucket to write to")
+	}
+	return strings.TrimSuffix(s.URL, "/") + path + "?" + query.Encode(), nil
+}
+
+func (s *Sink) write(ctx context.Context, body string) error {
+	uri, err := s.writeURL()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, uri, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	switch {
+	case s.Bucket != "" && s.Token != "":
+		req.Header.Set("Authorization", "Token "+s.Token)
+	case s.Username != "":
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to write to InfluxDB => %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("InfluxDB returned status code %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// Run samples and flushes until ctx is done, then flushes once more. Write
+// errors are passed to onError, if set, and retried with the next flush.
+func (s *Sink) Run(ctx context.Context, onError func(error)) error {
+	sample := time.NewTicker(durationOr(s.SampleInterval, 10*time.Second))
+	defer sample.Stop()
+	flush := time.NewTicker(durationOr(s.FlushInterval, time.Minute))
+	defer flush.Stop()
+	batch := s.BatchSize
+	if batch <= 0 {
+		batch = 500
+	}
+
+	report := func(err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			report(s.Flush(final))
+			cancel()
+			return ctx.Err()
+		case <-sample.C:
+			s.Sample(ctx)
+			if s.Buffered() >= batch {
+				report(s.Flush(ctx))
+			}
+		case <-flush.C:
+			report(s.Flush(ctx))
+		}
+	}
+}
+
+func durationOr(d, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return fallback
+}
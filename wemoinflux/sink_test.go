@@ -0,0 +1,63 @@
+package wemoinflux
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+const envelope = `<?xml version="1.0" encoding="utf-8"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>%s</s:Body></s:Envelope>`
+
+func TestSink(t *testing.T) {
+	insight := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, envelope, `<u:GetInsightParamsResponse xmlns:u="urn:Belkin:service:insight:1"><InsightParams>1|1466240587|7|7|7|1209600|55|41600|600000|6000000|8000</InsightParams></u:GetInsightParamsResponse>`)
+	}))
+	defer insight.Close()
+
+	var written []string
+	fail := true
+	influx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/write" || r.URL.Query().Get("bucket") != "energy" || r.Header.Get("Authorization") != "Token secret" {
+			t.Errorf("Unexpected request: %s %v", r.URL, r.Header)
+		}
+		if fail {
+			fail = false
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		written = append(written, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+	}))
+	defer influx.Close()
+
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Deep Freezer", Host: strings.TrimPrefix(insight.URL, "http://"), UDN: "uuid:Insight-1_0-A", DeviceType: wemo.Insight})
+	m.Put(wemo.ManagedDevice{Name: "Plug", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-B", DeviceType: wemo.Controllee})
+	m.SetLabel("uuid:Insight-1_0-A", "room", "kitchen")
+
+	sink := &Sink{Manager: m, URL: influx.URL, Org: "home", Bucket: "energy", Token: "secret", Labels: []string{"room", "floor"}}
+	ctx := context.Background()
+	if n := sink.Sample(ctx); n != 1 {
+		t.Fatalf("Expected: 1 sample, got: %d", n)
+	}
+	if err := sink.Flush(ctx); err == nil || sink.Buffered() != 1 {
+		t.Fatalf("Expected: the sample to be kept after a failed write, got: %v, %d", err, sink.Buffered())
+	}
+	if err := sink.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(written) != 1 {
+		t.Fatalf("Expected: 1 line, got: %q", written)
+	}
+	expected := `wemo_insight,key=uuid:Insight-1_0-A,name=Deep\ Freezer,room=kitchen power_w=41.6,today_kwh=0.01,energy_kwh=0.1,on_for=7i,on_today=7i,signal=55 `
+	if !strings.HasPrefix(written[0], expected) {
+		t.Errorf("Expected: %s, got: %s", expected, written[0])
+	}
+}
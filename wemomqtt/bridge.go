@@ -0,0 +1,284 @@
+// Package wemomqtt bridges the devices of a wemo.Manager to MQTT: states and
+// Insight readings are published, and commands are taken from command topics.
+//
+// With the default prefix a device with the alias "porch" uses
+//
+//	wemo/porch/state    ON or OFF, retained
+//	wemo/porch/insight  Insight readings as JSON
+//	wemo/porch/set      ON or OFF to switch the device
+//	wemo/porch/toggle   any payload toggles the device
+//	wemo/porch/dim      0-100 to dim the device
+//	wemo/status         online or offline, retained and set as last will
+//
+// With HomeAssistant set, the devices also show up in Home Assistant through
+// MQTT discovery.
+//
+// LayoutZigbee2MQTT switches to the topics of zigbee2mqtt instead, see
+// Layout.
+package wemomqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/randohm/go.wemo"
+)
+
+// Client is the part of mqtt.Client the bridge uses.
+type Client interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token
+	Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token
+}
+
+// Bridge connects a Manager to an MQTT broker.
+type Bridge struct {
+	Manager *wemo.Manager
+	Client  Client
+
+	// Prefix is the first level of all topics, defaults to "wemo".
+	Prefix string
+
+	// Layout selects the topic scheme, defaults to LayoutWemo.
+	Layout Layout
+
+	// DeviceTopic names the topic level of a device, defaults to its first
+	// alias, or its key when it has none. With LayoutZigbee2MQTT it defaults
+	// to the friendly name of the device.
+	DeviceTopic func(wemo.ManagedDevice) string
+
+	// InsightInterval is how often Insight readings are published, defaults to
+	// a minute.
+	InsightInterval time.Duration
+
+	// HomeAssistant publishes Home Assistant discovery configs on connecting,
+	// see PublishDiscovery. DiscoveryPrefix defaults to "homeassistant". It
+	// is only supported with LayoutWemo.
+	HomeAssistant   bool
+	DiscoveryPrefix string
+
+	// Logger, if set, receives failed commands and subscriptions, e.g.
+	// log.Printf.
+	Logger func(format string, args ...interface{})
+
+	mu     sync.Mutex
+	fields map[string]map[string]interface{} // zigbee2mqtt state by device key
+}
+
+// Insight is the payload of an insight topic.
+type Insight struct {
+	PowerW   float64 `json:"power-w"`
+	TodayKWh float64 `json:"today-kwh"`
+	TotalKWh float64 `json:"total-kwh"`
+	OnFor    int     `json:"on-for"`   // seconds
+	OnToday  int     `json:"on-today"` // seconds
+	Signal   float64 `json:"signal"`
+}
+
+func (b *Bridge) prefix() string {
+	if b.Prefix == "" {
+		return "wemo"
+	}
+	return b.Prefix
+}
+
+func (b *Bridge) topic(entry wemo.ManagedDevice, name string) string {
+	device := entry.Key
+	switch {
+	case b.DeviceTopic != nil:
+		device = b.DeviceTopic(entry)
+	case b.Layout == LayoutZigbee2MQTT:
+		device = entry.Name
+	case len(entry.Aliases) > 0:
+		device = entry.Aliases[0]
+	}
+	return b.prefix() + "/" + device + "/" + name
+}
+
+// StatusTopic is the availability topic of the bridge.
+func (b *Bridge) StatusTopic() string {
+	if b.Layout == LayoutZigbee2MQTT {
+		return b.prefix() + "/bridge/state"
+	}
+	return b.prefix() + "/status"
+}
+
+func (b *Bridge) printf(format string, args ...interface{}) {
+	if b.Logger != nil {
+		b.Logger(format, args...)
+	}
+}
+
+// Configure sets the last will of the bridge and makes opts reconnect and
+// resubscribe after losing the connection. Call it before creating the client.
+func (b *Bridge) Configure(opts *mqtt.ClientOptions) {
+	opts.SetWill(b.StatusTopic(), "offline", 1, true)
+	opts.SetAutoReconnect(true)
+	opts.SetOnConnectHandler(func(client mqtt.Client) { b.OnConnect(client) })
+}
+
+// OnConnect announces the bridge and subscribes to the command topics. Configure
+// installs it as the connect handler, so it runs again after reconnecting.
+func (b *Bridge) OnConnect(client Client) {
+	client.Publish(b.StatusTopic(), 1, true, "online")
+	commands := []string{"set", "toggle", "dim"}
+	if b.Layout == LayoutZigbee2MQTT {
+		commands = []string{"set"}
+	}
+	for _, command := range commands {
+		command := command
+		topic := b.prefix() + "/+/" + command
+		token := client.Subscribe(topic, 1, func(_ mqtt.Client, msg mqtt.Message) {
+			b.handle(command, msg.Topic(), string(msg.Payload()))
+		})
+		if token.Wait() && token.Error() != nil {
+			b.printf("unable to subscribe to %s => %s", topic, token.Error())
+		}
+	}
+	if b.HomeAssistant && b.Layout != LayoutZigbee2MQTT {
+		b.PublishDiscovery(client)
+		b.subscribeHomeAssistant(client)
+	}
+}
+
+// resolve finds the device a command topic is for.
+func (b *Bridge) resolve(topic string) (wemo.ManagedDevice, error) {
+	levels := strings.Split(topic, "/")
+	if len(levels) < 3 {
+		return wemo.ManagedDevice{}, fmt.Errorf("unexpected topic %s", topic)
+	}
+	device := levels[len(levels)-2]
+	for _, entry := range b.Manager.List() {
+		if strings.HasSuffix(b.topic(entry, ""), "/"+device+"/") {
+			return entry, nil
+		}
+	}
+	return wemo.ManagedDevice{}, fmt.Errorf("unknown device %s", device)
+}
+
+func (b *Bridge) handle(command, topic, payload string) {
+	entry, err := b.resolve(topic)
+	if err != nil {
+		b.printf("%s", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	payload = strings.TrimSpace(payload)
+	switch {
+	case b.Layout == LayoutZigbee2MQTT:
+		err = b.handleZigbee2MQTT(ctx, entry, payload)
+	case command == "set":
+		switch strings.ToUpper(payload) {
+		case "ON", "1":
+			err = b.Manager.SetBinaryState(ctx, entry.Key, true)
+		case "OFF", "0":
+			err = b.Manager.SetBinaryState(ctx, entry.Key, false)
+		default:
+			err = fmt.Errorf("unknown state %q", payload)
+		}
+	case command == "toggle":
+		var state int
+		if state, err = b.Manager.BinaryState(ctx, entry.Key); err == nil {
+			err = b.Manager.SetBinaryState(ctx, entry.Key, state == 0)
+		}
+	case command == "dim":
+		var level int
+		if level, err = strconv.Atoi(payload); err == nil {
+			err = b.Manager.SetLevel(ctx, entry.Key, level)
+		}
+	}
+	if err != nil {
+		b.printf("%s %s: %s", command, entry.Name, err)
+	}
+}
+
+// Run publishes state changes and Insight readings until ctx is done, and then
+// announces the bridge offline.
+func (b *Bridge) Run(ctx context.Context) error {
+	events, cancel := b.Manager.Subscribe(64)
+	defer cancel()
+
+	interval := b.InsightInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// publish the current states, later ones follow from the events
+	for _, entry := range b.Manager.List() {
+		state, err := b.Manager.BinaryState(ctx, entry.Key)
+		if err == nil {
+			b.publishState(entry, state)
+		}
+		b.publishAvailability(entry, err == nil)
+	}
+	b.publishInsight(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			for _, entry := range b.Manager.List() {
+				b.publishAvailability(entry, false)
+			}
+			token := b.Client.Publish(b.StatusTopic(), 1, true, "offline")
+			token.WaitTimeout(time.Second)
+			return ctx.Err()
+		case event := <-events:
+			if entry, ok := b.Manager.Get(event.Key); ok {
+				b.publishState(entry, event.State)
+			}
+		case <-ticker.C:
+			b.publishInsight(ctx)
+		}
+	}
+}
+
+func (b *Bridge) publishState(entry wemo.ManagedDevice, state int) {
+	if b.Layout == LayoutZigbee2MQTT {
+		b.publishZigbee2MQTT(entry, map[string]interface{}{"state": onOff(state)})
+		return
+	}
+	payload := "OFF"
+	if state != 0 {
+		payload = "ON"
+	}
+	b.Client.Publish(b.topic(entry, "state"), 1, true, payload)
+}
+
+func (b *Bridge) publishInsight(ctx context.Context) {
+	for _, entry := range b.Manager.List() {
+		if !entry.Capabilities().Has(wemo.CapInsight) {
+			continue
+		}
+		params, err := b.Manager.InsightParams(ctx, entry.Key)
+		if err != nil {
+			b.printf("insight %s: %s", entry.Name, err)
+			continue
+		}
+		if b.Layout == LayoutZigbee2MQTT {
+			b.publishZigbee2MQTT(entry, map[string]interface{}{
+				"power":        params.PowerW(),
+				"energy":       params.TotalKWh(),
+				"energy_today": params.TodayKWh(),
+			})
+			continue
+		}
+		payload, _ := json.Marshal(Insight{
+			PowerW:   params.PowerW(),
+			TodayKWh: params.TodayKWh(),
+			TotalKWh: params.TotalKWh(),
+			OnFor:    params.OnFor,
+			OnToday:  params.OnToday,
+			Signal:   params.WifiStrength,
+		})
+		b.Client.Publish(b.topic(entry, "insight"), 0, false, payload)
+	}
+}
@@ -0,0 +1,223 @@
+package wemomqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/randohm/go.wemo"
+)
+
+const envelope = `<?xml version="1.0" encoding="utf-8"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>%s</s:Body></s:Envelope>`
+
+type token struct{ mqtt.Token }
+
+func (token) Wait() bool                     { return true }
+func (token) WaitTimeout(time.Duration) bool { return true }
+func (token) Error() error                   { return nil }
+
+type message struct {
+	mqtt.Message
+	topic, payload string
+}
+
+func (m message) Topic() string   { return m.topic }
+func (m message) Payload() []byte { return []byte(m.payload) }
+
+// fakeClient records publications and keeps subscriptions to deliver messages.
+type fakeClient struct {
+	mu        sync.Mutex
+	published map[string]string
+	handlers  map[string]mqtt.MessageHandler
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{published: make(map[string]string), handlers: make(map[string]mqtt.MessageHandler)}
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch p := payload.(type) {
+	case string:
+		c.published[topic] = p
+	case []byte:
+		c.published[topic] = string(p)
+	}
+	return token{}
+}
+
+func (c *fakeClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[topic] = callback
+	return token{}
+}
+
+func (c *fakeClient) get(topic string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.published[topic]
+}
+
+func (c *fakeClient) deliver(filter, topic, payload string) {
+	c.mu.Lock()
+	handler := c.handlers[filter]
+	c.mu.Unlock()
+	handler(nil, message{topic: topic, payload: payload})
+}
+
+// newSwitch returns a fake switch that is off.
+func newSwitch() *httptest.Server {
+	var mu sync.Mutex
+	state := "0"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.Contains(string(body), "<u:SetBinaryState "):
+			state = "1"
+			if strings.Contains(string(body), "<BinaryState>0</BinaryState>") {
+				state = "0"
+			}
+			fmt.Fprintf(w, envelope, `<u:SetBinaryStateResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>`+state+`</BinaryState></u:SetBinaryStateResponse>`)
+		case strings.Contains(string(body), "<u:GetBinaryState "):
+			fmt.Fprintf(w, envelope, `<u:GetBinaryStateResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>`+state+`</BinaryState></u:GetBinaryStateResponse>`)
+		}
+	}))
+}
+
+func TestBridge(t *testing.T) {
+	device := newSwitch()
+	defer device.Close()
+
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Porch", Host: strings.TrimPrefix(device.URL, "http://"), UDN: "uuid:Socket-1_0-A", DeviceType: wemo.Controllee})
+	if err := m.SetAlias("uuid:Socket-1_0-A", "porch"); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newFakeClient()
+	b := &Bridge{Manager: m, Client: client}
+	b.OnConnect(client)
+	if got := client.get("wemo/status"); got != "online" {
+		t.Errorf("Expected: online, got: %s", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- b.Run(ctx) }()
+
+	waitFor := func(topic, expected string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for client.get(topic) != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %s: %s, got: %s", topic, expected, client.get(topic))
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitFor("wemo/porch/state", "OFF")
+
+	client.deliver("wemo/+/set", "wemo/porch/set", "ON")
+	waitFor("wemo/porch/state", "ON")
+
+	client.deliver("wemo/+/toggle", "wemo/porch/toggle", "")
+	waitFor("wemo/porch/state", "OFF")
+
+	cancel()
+	<-done
+	if got := client.get("wemo/status"); got != "offline" {
+		t.Errorf("Expected: offline, got: %s", got)
+	}
+}
+
+func TestZigbee2MQTTLayout(t *testing.T) {
+	device := newSwitch()
+	defer device.Close()
+
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Porch", Host: strings.TrimPrefix(device.URL, "http://"), UDN: "uuid:Socket-1_0-A", DeviceType: wemo.Controllee})
+
+	client := newFakeClient()
+	b := &Bridge{Manager: m, Client: client, Layout: LayoutZigbee2MQTT}
+	b.OnConnect(client)
+	if got := client.get("wemo/bridge/state"); got != "online" {
+		t.Errorf("Expected: online, got: %s", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- b.Run(ctx) }()
+
+	waitFor := func(topic, expected string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for client.get(topic) != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %s: %s, got: %s", topic, expected, client.get(topic))
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitFor("wemo/Porch", `{"state":"OFF"}`)
+	waitFor("wemo/Porch/availability", "online")
+
+	client.deliver("wemo/+/set", "wemo/Porch/set", `{"state":"ON"}`)
+	waitFor("wemo/Porch", `{"state":"ON"}`)
+
+	client.deliver("wemo/+/set", "wemo/Porch/set", "TOGGLE")
+	waitFor("wemo/Porch", `{"state":"OFF"}`)
+
+	cancel()
+	<-done
+	if got := client.get("wemo/Porch/availability"); got != "offline" {
+		t.Errorf("Expected: offline, got: %s", got)
+	}
+}
+
+func TestPublishDiscovery(t *testing.T) {
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Freezer", Host: "127.0.0.1:1", UDN: "uuid:Insight-1_0-A", DeviceType: wemo.Insight})
+	m.Put(wemo.ManagedDevice{Name: "Hall", Host: "127.0.0.1:2", UDN: "uuid:Dimmer-1_0-B", DeviceType: wemo.Dimmer})
+
+	client := newFakeClient()
+	b := &Bridge{Manager: m, Client: client, HomeAssistant: true}
+	b.OnConnect(client)
+
+	var sw map[string]interface{}
+	if err := json.Unmarshal([]byte(client.get("homeassistant/switch/wemo_uuid_Insight-1_0-A/config")), &sw); err != nil {
+		t.Fatal(err)
+	}
+	if sw["command_topic"] != "wemo/uuid:Insight-1_0-A/set" || sw["availability_topic"] != "wemo/status" {
+		t.Errorf("Unexpected switch config: %v", sw)
+	}
+	if got := client.get("homeassistant/sensor/wemo_uuid_Insight-1_0-A_power/config"); !strings.Contains(got, `"unit_of_measurement":"W"`) {
+		t.Errorf("Unexpected power sensor config: %s", got)
+	}
+
+	var light map[string]interface{}
+	if err := json.Unmarshal([]byte(client.get("homeassistant/light/wemo_uuid_Dimmer-1_0-B/config")), &light); err != nil {
+		t.Fatal(err)
+	}
+	if light["brightness_command_topic"] != "wemo/uuid:Dimmer-1_0-B/dim" {
+		t.Errorf("Unexpected light config: %v", light)
+	}
+	if got := client.get("homeassistant/switch/wemo_uuid_Dimmer-1_0-B/config"); got != "" {
+		t.Errorf("Expected no switch for a dimmer, got: %s", got)
+	}
+
+	if _, ok := client.handlers["homeassistant/status"]; !ok {
+		t.Error("Expected a subscription to the Home Assistant status")
+	}
+}
@@ -0,0 +1,149 @@
+package wemomqtt
+
+import (
+	"encoding/json"
+	"regexp"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/randohm/go.wemo"
+)
+
+// haDevice groups the entities of a device in Home Assistant.
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+}
+
+// haEntity is a Home Assistant MQTT discovery config. Only the fields of the
+// switch, light, sensor and binary_sensor components the bridge uses are
+// present.
+type haEntity struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	Device            haDevice `json:"device"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	StateTopic        string   `json:"state_topic"`
+	CommandTopic      string   `json:"command_topic,omitempty"`
+
+	// light
+	BrightnessCommandTopic string `json:"brightness_command_topic,omitempty"`
+	BrightnessScale        int    `json:"brightness_scale,omitempty"`
+	OnCommandType          string `json:"on_command_type,omitempty"`
+
+	// sensor
+	ValueTemplate     string `json:"value_template,omitempty"`
+	UnitOfMeasurement string `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string `json:"device_class,omitempty"`
+	StateClass        string `json:"state_class,omitempty"`
+
+	// binary_sensor
+	PayloadOn  string `json:"payload_on,omitempty"`
+	PayloadOff string `json:"payload_off,omitempty"`
+}
+
+func (b *Bridge) discoveryPrefix() string {
+	if b.DiscoveryPrefix == "" {
+		return "homeassistant"
+	}
+	return b.DiscoveryPrefix
+}
+
+var objectIDRE = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// discovery returns the discovery configs of a device by their topic.
+func (b *Bridge) discovery(entry wemo.ManagedDevice) map[string]haEntity {
+	id := objectIDRE.ReplaceAllString(entry.Key, "_")
+	device := haDevice{
+		Identifiers:  []string{entry.Key},
+		Name:         entry.Name,
+		Manufacturer: "Belkin",
+		Model:        entry.DeviceType,
+	}
+	if entry.Info != nil {
+		device.SWVersion = entry.Info.FirmwareVersion
+	}
+	entity := func(name, suffix string) haEntity {
+		return haEntity{
+			Name:              name,
+			UniqueID:          "wemo_" + id + suffix,
+			Device:            device,
+			AvailabilityTopic: b.StatusTopic(),
+			StateTopic:        b.topic(entry, "state"),
+		}
+	}
+	topic := func(component, suffix string) string {
+		return b.discoveryPrefix() + "/" + component + "/wemo_" + id + suffix + "/config"
+	}
+
+	configs := make(map[string]haEntity)
+	c := entry.Capabilities()
+	switch {
+	case c.Has(wemo.CapDim):
+		light := entity(entry.Name, "")
+		light.CommandTopic = b.topic(entry, "set")
+		light.BrightnessCommandTopic = b.topic(entry, "dim")
+		light.BrightnessScale = 100
+		light.OnCommandType = "brightness"
+		configs[topic("light", "")] = light
+	case c.Has(wemo.CapSwitch):
+		sw := entity(entry.Name, "")
+		sw.CommandTopic = b.topic(entry, "set")
+		configs[topic("switch", "")] = sw
+	case c.Has(wemo.CapSensor):
+		motion := entity(entry.Name, "")
+		motion.DeviceClass = "motion"
+		motion.PayloadOn, motion.PayloadOff = "ON", "OFF"
+		configs[topic("binary_sensor", "")] = motion
+	}
+
+	if c.Has(wemo.CapInsight) {
+		insight := b.topic(entry, "insight")
+		sensor := func(name, suffix, template, unit, class, stateClass string) {
+			s := entity(entry.Name+" "+name, suffix)
+			s.StateTopic = insight
+			s.ValueTemplate = template
+			s.UnitOfMeasurement = unit
+			s.DeviceClass = class
+			s.StateClass = stateClass
+			configs[topic("sensor", suffix)] = s
+		}
+		sensor("power", "_power", "{{ value_json['power-w'] }}", "W", "power", "measurement")
+		sensor("energy today", "_today", "{{ value_json['today-kwh'] }}", "kWh", "energy", "total_increasing")
+		sensor("energy", "_energy", "{{ value_json['total-kwh'] }}", "kWh", "energy", "total_increasing")
+		sensor("signal", "_signal", "{{ value_json['signal'] }}", "", "", "measurement")
+	}
+	return configs
+}
+
+// PublishDiscovery publishes retained Home Assistant discovery configs for all
+// devices: a switch, a light for dimmers or a binary sensor for motion
+// sensors, and power and energy sensors for Insights.
+func (b *Bridge) PublishDiscovery(client Client) {
+	for _, entry := range b.Manager.List() {
+		for topic, config := range b.discovery(entry) {
+			payload, err := json.Marshal(config)
+			if err != nil {
+				continue
+			}
+			client.Publish(topic, 1, true, payload)
+		}
+	}
+}
+
+// subscribeHomeAssistant republishes the discovery configs when Home Assistant
+// comes online, so they survive a restart of Home Assistant without retained
+// messages.
+func (b *Bridge) subscribeHomeAssistant(client Client) {
+	topic := b.discoveryPrefix() + "/status"
+	token := client.Subscribe(topic, 1, func(_ mqtt.Client, msg mqtt.Message) {
+		if string(msg.Payload()) == "online" {
+			b.PublishDiscovery(client)
+		}
+	})
+	if token.Wait() && token.Error() != nil {
+		b.printf("unable to subscribe to %s => %s", topic, token.Error())
+	}
+}
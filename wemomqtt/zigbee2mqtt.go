@@ -0,0 +1,124 @@
+package wemomqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/randohm/go.wemo"
+)
+
+// Layout is a topic scheme of the bridge.
+type Layout string
+
+// Layouts
+const (
+	// LayoutWemo is the scheme described in the package documentation.
+	LayoutWemo Layout = "wemo"
+
+	// LayoutZigbee2MQTT follows zigbee2mqtt, so dashboards and automations
+	// written for it work with WeMo devices as well. A device with the
+	// friendly name "Porch" uses
+	//
+	//	wemo/Porch               {"state":"ON"} with "power", "energy" and
+	//	                         "energy_today" for Insights, retained
+	//	wemo/Porch/set           {"state":"ON"}, "OFF", "TOGGLE", or
+	//	                         {"brightness":0-254} for dimmers
+	//	wemo/Porch/availability  online or offline, retained
+	//	wemo/bridge/state        online or offline, retained and set as last will
+	LayoutZigbee2MQTT Layout = "zigbee2mqtt"
+)
+
+// ParseLayout parses the name of a layout, the empty string being LayoutWemo.
+func ParseLayout(s string) (Layout, error) {
+	switch Layout(s) {
+	case "", LayoutWemo:
+		return LayoutWemo, nil
+	case LayoutZigbee2MQTT:
+		return LayoutZigbee2MQTT, nil
+	}
+	return "", fmt.Errorf("unknown topic layout %q", s)
+}
+
+func onOff(state int) string {
+	if state != 0 {
+		return "ON"
+	}
+	return "OFF"
+}
+
+// publishZigbee2MQTT merges fields into the last published state of the
+// device and publishes it, as zigbee2mqtt keeps all values of a device in a
+// single message.
+func (b *Bridge) publishZigbee2MQTT(entry wemo.ManagedDevice, fields map[string]interface{}) {
+	b.mu.Lock()
+	if b.fields == nil {
+		b.fields = make(map[string]map[string]interface{})
+	}
+	state := b.fields[entry.Key]
+	if state == nil {
+		state = make(map[string]interface{})
+		b.fields[entry.Key] = state
+	}
+	for name, value := range fields {
+		state[name] = value
+	}
+	payload, _ := json.Marshal(state)
+	b.mu.Unlock()
+
+	b.Client.Publish(strings.TrimSuffix(b.topic(entry, ""), "/"), 1, true, payload)
+}
+
+func (b *Bridge) publishAvailability(entry wemo.ManagedDevice, online bool) {
+	if b.Layout != LayoutZigbee2MQTT {
+		return
+	}
+	payload := "offline"
+	if online {
+		payload = "online"
+	}
+	b.Client.Publish(b.topic(entry, "availability"), 1, true, payload)
+}
+
+// zigbee2mqttSet is the payload of a set topic.
+type zigbee2mqttSet struct {
+	State      string `json:"state"`
+	Brightness *int   `json:"brightness"` // 0-254
+}
+
+func (b *Bridge) handleZigbee2MQTT(ctx context.Context, entry wemo.ManagedDevice, payload string) error {
+	var set zigbee2mqttSet
+	if strings.HasPrefix(payload, "{") {
+		if err := json.Unmarshal([]byte(payload), &set); err != nil {
+			return fmt.Errorf("Failed to parse %s => %s", payload, err)
+		}
+	} else {
+		set.State = payload
+	}
+
+	if set.Brightness != nil {
+		if *set.Brightness < 0 || *set.Brightness > 254 {
+			return fmt.Errorf("brightness %d is out of bounds 0-254", *set.Brightness)
+		}
+		if err := b.Manager.SetLevel(ctx, entry.Key, (*set.Brightness*100+127)/254); err != nil {
+			return err
+		}
+		b.publishZigbee2MQTT(entry, map[string]interface{}{"brightness": *set.Brightness})
+		return nil
+	}
+
+	switch strings.ToUpper(set.State) {
+	case "ON":
+		return b.Manager.SetBinaryState(ctx, entry.Key, true)
+	case "OFF":
+		return b.Manager.SetBinaryState(ctx, entry.Key, false)
+	case "TOGGLE":
+		state, err := b.Manager.BinaryState(ctx, entry.Key)
+		if err != nil {
+			return err
+		}
+		return b.Manager.SetBinaryState(ctx, entry.Key, state == 0)
+	}
+	return fmt.Errorf("unknown state %q", set.State)
+}
@@ -0,0 +1,159 @@
+// Package wemoprom exports the devices of a wemo.Manager as Prometheus
+// metrics.
+package wemoprom
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/randohm/go.wemo"
+)
+
+// Collector is a prometheus.Collector reading the devices of a Manager on every
+// scrape. States and Insight parameters go through the manager's cache, so
+// frequent scrapes don't hammer the devices.
+type Collector struct {
+	Manager *wemo.Manager
+
+	// Labels are the registry labels, see Manager.SetLabel, added to every
+	// device metric, e.g. "room". Devices without a label get an empty value.
+	Labels []string
+
+	// SignalStrength reads the WiFi signal of devices that aren't Insights,
+	// which costs an extra call per device and scrape.
+	SignalStrength bool
+
+	// Timeout bounds a scrape, defaults to 10 seconds.
+	Timeout time.Duration
+
+	counters *wemo.InsightCounters
+	errors   *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+
+	up, state, power, today, energy, signal *prometheus.Desc
+}
+
+// NewCollector returns a collector for the devices of m, labelled with the
+// given registry labels.
+func NewCollector(m *wemo.Manager, labels ...string) *Collector {
+	names := append([]string{"key", "name", "type"}, labels...)
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(name, help, names, nil)
+	}
+	return &Collector{
+		Manager:  m,
+		Labels:   labels,
+		counters: wemo.NewInsightCounters(),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wemo_request_errors_total",
+			Help: "Failed requests to devices.",
+		}, []string{"key", "operation"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "wemo_request_duration_seconds",
+			Help:    "Duration of requests to devices.",
+			Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"operation"}),
+		up:     desc("wemo_up", "Whether the device answered the last scrape."),
+		state:  desc("wemo_binary_state", "Binary state of the device, 0 off, 1 on, 8 standby."),
+		power:  desc("wemo_insight_power_watts", "Current power draw."),
+		today:  desc("wemo_insight_today_energy_kwh", "Energy used today."),
+		energy: desc("wemo_insight_energy_kwh_total", "Energy used, carried over device resets."),
+		signal: desc("wemo_signal_strength", "WiFi signal strength."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{c.up, c.state, c.power, c.today, c.energy, c.signal} {
+		ch <- desc
+	}
+	c.errors.Describe(ch)
+	c.latency.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, entry := range c.Manager.List() {
+		wg.Add(1)
+		go func(entry wemo.ManagedDevice) {
+			defer wg.Done()
+			c.collect(ctx, ch, entry)
+		}(entry)
+	}
+	wg.Wait()
+
+	c.errors.Collect(ch)
+	c.latency.Collect(ch)
+}
+
+func (c *Collector) collect(ctx context.Context, ch chan<- prometheus.Metric, entry wemo.ManagedDevice) {
+	labels := []string{entry.Key, entry.Name, entry.DeviceType}
+	for _, name := range c.Labels {
+		labels = append(labels, entry.Labels[name])
+	}
+	gauge := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+	}
+
+	var state int
+	err := c.observe(entry.Key, "GetBinaryState", func() (err error) {
+		state, err = c.Manager.BinaryState(ctx, entry.Key)
+		return err
+	})
+	if err != nil {
+		gauge(c.up, 0)
+		return
+	}
+	gauge(c.up, 1)
+	gauge(c.state, float64(state))
+
+	if entry.Capabilities().Has(wemo.CapInsight) {
+		var params *wemo.InsightParams
+		err := c.observe(entry.Key, "GetInsightParams", func() (err error) {
+			params, err = c.Manager.InsightParams(ctx, entry.Key)
+			return err
+		})
+		if err != nil {
+			return
+		}
+		c.counters.Update(wemo.InsightReading{Host: entry.Key, Time: time.Now(), Params: *params})
+		totals, _ := c.counters.Snapshot(entry.Key)
+
+		gauge(c.power, params.PowerW())
+		gauge(c.today, params.TodayKWh())
+		gauge(c.signal, params.WifiStrength)
+		ch <- prometheus.MustNewConstMetric(c.energy, prometheus.CounterValue, totals.EnergyKWh, labels...)
+		return
+	}
+
+	if c.SignalStrength {
+		var signal int
+		err := c.observe(entry.Key, "GetSignalStrength", func() (err error) {
+			signal, err = entry.Device().SignalStrength(ctx)
+			return err
+		})
+		if err == nil {
+			gauge(c.signal, float64(signal))
+		}
+	}
+}
+
+func (c *Collector) observe(key, operation string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	c.latency.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		c.errors.WithLabelValues(key, operation).Inc()
+	}
+	return err
+}
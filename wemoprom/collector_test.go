@@ -0,0 +1,59 @@
+package wemoprom
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/randohm/go.wemo"
+)
+
+const envelope = `<?xml version="1.0" encoding="utf-8"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>%s</s:Body></s:Envelope>`
+
+func TestCollector(t *testing.T) {
+	insight := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case strings.Contains(string(body), "<u:GetBinaryState "):
+			fmt.Fprintf(w, envelope, `<u:GetBinaryStateResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>1</BinaryState></u:GetBinaryStateResponse>`)
+		case strings.Contains(string(body), "<u:GetInsightParams "):
+			fmt.Fprintf(w, envelope, `<u:GetInsightParamsResponse xmlns:u="urn:Belkin:service:insight:1"><InsightParams>1|1466240587|7|7|7|1209600|55|41600|600000|6000000|8000</InsightParams></u:GetInsightParamsResponse>`)
+		}
+	}))
+	defer insight.Close()
+
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Freezer", Host: strings.TrimPrefix(insight.URL, "http://"), UDN: "uuid:Insight-1_0-A", DeviceType: wemo.Insight})
+	m.Put(wemo.ManagedDevice{Name: "Gone", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-B", DeviceType: wemo.Controllee})
+	m.SetLabel("uuid:Insight-1_0-A", "room", "kitchen")
+
+	collector := NewCollector(m, "room")
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+
+	expected := `
+# HELP wemo_binary_state Binary state of the device, 0 off, 1 on, 8 standby.
+# TYPE wemo_binary_state gauge
+wemo_binary_state{key="uuid:Insight-1_0-A",name="Freezer",room="kitchen",type="urn:Belkin:device:insight:1"} 1
+# HELP wemo_insight_power_watts Current power draw.
+# TYPE wemo_insight_power_watts gauge
+wemo_insight_power_watts{key="uuid:Insight-1_0-A",name="Freezer",room="kitchen",type="urn:Belkin:device:insight:1"} 41.6
+# HELP wemo_up Whether the device answered the last scrape.
+# TYPE wemo_up gauge
+wemo_up{key="uuid:Insight-1_0-A",name="Freezer",room="kitchen",type="urn:Belkin:device:insight:1"} 1
+wemo_up{key="uuid:Socket-1_0-B",name="Gone",room="",type="urn:Belkin:device:controllee:1"} 0
+# HELP wemo_request_errors_total Failed requests to devices.
+# TYPE wemo_request_errors_total counter
+wemo_request_errors_total{key="uuid:Socket-1_0-B",operation="GetBinaryState"} 1
+`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"wemo_binary_state", "wemo_insight_power_watts", "wemo_up", "wemo_request_errors_total")
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,110 @@
+package wemoprom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/randohm/go.wemo"
+)
+
+// Metrics exports the internal metrics of the wemo package, see
+// wemo.SetMetrics. Register it with a registry and install it:
+//
+//	metrics := wemoprom.NewMetrics()
+//	registry.MustRegister(metrics)
+//	wemo.SetMetrics(metrics)
+type Metrics struct {
+	requests       *prometheus.CounterVec
+	requestErrors  *prometheus.CounterVec
+	requestLatency *prometheus.HistogramVec
+	retries        prometheus.Counter
+	renewals       *prometheus.CounterVec
+	scans          *prometheus.CounterVec
+	scanFound      *prometheus.GaugeVec
+}
+
+var _ wemo.Metrics = (*Metrics)(nil)
+
+// NewMetrics returns unregistered metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wemo_client_requests_total",
+			Help: "SOAP actions sent.",
+		}, []string{"service", "action"}),
+		requestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wemo_client_request_errors_total",
+			Help: "SOAP actions that failed.",
+		}, []string{"service", "action"}),
+		requestLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "wemo_client_request_duration_seconds",
+			Help:    "Duration of SOAP actions.",
+			Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"service"}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "wemo_client_retries_total",
+			Help: "Calls retried at the new address of a device.",
+		}),
+		renewals: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wemo_subscription_renewals_total",
+			Help: "Renewals of event subscriptions by result.",
+		}, []string{"result"}),
+		scans: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wemo_discovery_scans_total",
+			Help: "SSDP scans by device type.",
+		}, []string{"urn"}),
+		scanFound: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "wemo_discovery_found",
+			Help: "Devices found by the last SSDP scan by device type.",
+		}, []string{"urn"}),
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.requests, m.requestErrors, m.requestLatency, m.retries, m.renewals, m.scans, m.scanFound}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// Request implements wemo.Metrics.
+func (m *Metrics) Request(service, action string, duration time.Duration, err error) {
+	m.requests.WithLabelValues(service, action).Inc()
+	if err != nil {
+		m.requestErrors.WithLabelValues(service, action).Inc()
+	}
+	m.requestLatency.WithLabelValues(service).Observe(duration.Seconds())
+}
+
+// Retry implements wemo.Metrics.
+func (m *Metrics) Retry(key string) {
+	m.retries.Inc()
+}
+
+// SubscriptionRenewed implements wemo.Metrics.
+func (m *Metrics) SubscriptionRenewed(host string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "failed"
+	}
+	m.renewals.WithLabelValues(result).Inc()
+}
+
+// DiscoveryScan implements wemo.Metrics.
+func (m *Metrics) DiscoveryScan(urn string, found int, duration time.Duration, err error) {
+	m.scans.WithLabelValues(urn).Inc()
+	if err == nil {
+		m.scanFound.WithLabelValues(urn).Set(float64(found))
+	}
+}
@@ -0,0 +1,278 @@
+// Package wemorelay lets a relay the user runs outside the home, e.g. on a
+// VPS, control the devices of a wemo.Manager. The relay client connects out
+// to the relay over a WebSocket, or to an MQTT broker, so no port has to be
+// opened at home. It runs the Requests it receives against the Manager,
+// answers each with a Message, and forwards state changes as event Messages.
+//
+// Over MQTT requests are taken from <prefix>/request, and responses and events
+// are published to <prefix>/response and <prefix>/event.
+package wemorelay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gorilla/websocket"
+	"github.com/randohm/go.wemo"
+	"github.com/randohm/go.wemo/wemomqtt"
+)
+
+// Request actions
+const (
+	ActionList   = "list"   // list the devices
+	ActionState  = "state"  // read the state of Device
+	ActionOn     = "on"     // switch Device on
+	ActionOff    = "off"    // switch Device off
+	ActionToggle = "toggle" // toggle Device
+	ActionLevel  = "level"  // dim Device to Level
+)
+
+// Request is a command sent by the relay. Device is a key or an alias.
+type Request struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	Device string `json:"device,omitempty"`
+	Level  *int   `json:"level,omitempty"` // percent
+}
+
+// Message types
+const (
+	MessageResponse = "response"
+	MessageEvent    = "event"
+)
+
+// Message is sent to the relay: the response to the request with the same
+// ID, or an event with the new state of a device.
+type Message struct {
+	Type    string           `json:"type"`
+	ID      string           `json:"id,omitempty"`
+	Error   string           `json:"error,omitempty"`
+	Devices []wemo.DeviceDoc `json:"devices,omitempty"`
+	State   *wemo.StateDoc   `json:"state,omitempty"`
+}
+
+// Client connects a Manager to a relay.
+type Client struct {
+	Manager *wemo.Manager
+
+	// URL is the WebSocket endpoint of the relay, e.g.
+	// wss://relay.example.com/home. Token is sent as a bearer token.
+	URL   string
+	Token string
+
+	// Timeout limits each request, defaults to 10 seconds.
+	Timeout time.Duration
+
+	// MaxBackoff is the longest wait between reconnects, defaults to a
+	// minute.
+	MaxBackoff time.Duration
+
+	Dialer *websocket.Dialer // defaults to websocket.DefaultDialer
+
+	// Logger, if set, receives connection errors, e.g. log.Printf.
+	Logger func(format string, args ...interface{})
+}
+
+func (c *Client) printf(format string, args ...interface{}) {
+	if c.Logger != nil {
+		c.Logger(format, args...)
+	}
+}
+
+// Execute runs a request against the manager.
+func (c *Client) Execute(ctx context.Context, req Request) Message {
+	ctx, cancel := context.WithTimeout(ctx, durationOr(c.Timeout, 10*time.Second))
+	defer cancel()
+
+	response := Message{Type: MessageResponse, ID: req.ID}
+	if req.Action == ActionList {
+		response.Devices = []wemo.DeviceDoc{}
+		for _, entry := range c.Manager.List() {
+			response.Devices = append(response.Devices, wemo.NewDeviceDoc(entry))
+		}
+		return response
+	}
+
+	state, err := c.execute(ctx, req)
+	if err != nil {
+		response.Error = err.Error()
+		return response
+	}
+	response.State = &state
+	return response
+}
+
+func (c *Client) execute(ctx context.Context, req Request) (wemo.StateDoc, error) {
+	entry, err := c.Manager.Find(req.Device)
+	if err != nil {
+		return wemo.StateDoc{}, err
+	}
+
+	switch req.Action {
+	case ActionState:
+	case ActionOn, ActionOff:
+		err = c.Manager.SetBinaryState(ctx, entry.Key, req.Action == ActionOn)
+	case ActionToggle:
+		var state int
+		if state, err = c.Manager.BinaryState(ctx, entry.Key); err == nil {
+			err = c.Manager.SetBinaryState(ctx, entry.Key, state == 0)
+		}
+	case ActionLevel:
+		if req.Level == nil || *req.Level < 0 || *req.Level > 100 {
+			return wemo.StateDoc{}, errors.New("level request without a level of 0-100")
+		}
+		err = c.Manager.SetLevel(ctx, entry.Key, *req.Level)
+	default:
+		return wemo.StateDoc{}, fmt.Errorf("unknown action %q", req.Action)
+	}
+	if err != nil {
+		return wemo.StateDoc{}, err
+	}
+
+	state, err := c.Manager.State(ctx, entry.Key)
+	if err != nil {
+		return wemo.StateDoc{}, err
+	}
+	return wemo.NewStateDoc(entry.Key, state, time.Now()), nil
+}
+
+// event returns the event message of a state change.
+func event(changed wemo.StateChanged) Message {
+	state := wemo.NewStateDoc(changed.Key, wemo.DeviceSnapshot{State: changed.State}, changed.Time)
+	return Message{Type: MessageEvent, State: &state}
+}
+
+// Run keeps a WebSocket connection to the relay until ctx is done,
+// reconnecting with exponential backoff when it is lost.
+func (c *Client) Run(ctx context.Context) error {
+	if c.URL == "" {
+		return errors.New("no relay URL")
+	}
+	dialer := c.Dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	header := http.Header{}
+	if c.Token != "" {
+		header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	backoff := time.Second
+	for {
+		conn, _, err := dialer.DialContext(ctx, c.URL, header)
+		if err == nil {
+			backoff = time.Second
+			err = c.serve(ctx, conn)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.printf("relay connection to %s lost => %s", c.URL, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > durationOr(c.MaxBackoff, time.Minute) {
+			backoff = durationOr(c.MaxBackoff, time.Minute)
+		}
+	}
+}
+
+const writeTimeout = 10 * time.Second
+
+// serve answers requests on one connection until it breaks or ctx is done.
+func (c *Client) serve(ctx context.Context, conn *websocket.Conn) error {
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex // a connection has one writer at a time
+	write := func(message Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return conn.WriteJSON(message)
+	}
+
+	events, unsubscribe := c.Manager.Subscribe(64)
+	defer unsubscribe()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				conn.Close() // ends the read loop
+				return
+			case changed := <-events:
+				if err := write(event(changed)); err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		var req Request
+		if err := conn.ReadJSON(&req); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		go func() {
+			if err := write(c.Execute(ctx, req)); err != nil {
+				conn.Close()
+			}
+		}()
+	}
+}
+
+// RunMQTT answers requests taken from <prefix>/request of a connected MQTT
+// client and publishes state changes until ctx is done.
+func (c *Client) RunMQTT(ctx context.Context, client wemomqtt.Client, prefix string) error {
+	publish := func(topic string, message Message) {
+		payload, _ := json.Marshal(message)
+		token := client.Publish(prefix+"/"+topic, 1, false, payload)
+		if token.WaitTimeout(writeTimeout) && token.Error() != nil {
+			c.printf("unable to publish to %s/%s => %s", prefix, topic, token.Error())
+		}
+	}
+
+	token := client.Subscribe(prefix+"/request", 1, func(_ mqtt.Client, msg mqtt.Message) {
+		var req Request
+		if err := json.Unmarshal(msg.Payload(), &req); err != nil {
+			publish("response", Message{Type: MessageResponse, Error: fmt.Sprintf("Failed to parse request => %s", err)})
+			return
+		}
+		go publish("response", c.Execute(ctx, req))
+	})
+	if token.Wait() && token.Error() != nil {
+		return fmt.Errorf("unable to subscribe to %s/request => %s", prefix, token.Error())
+	}
+
+	events, unsubscribe := c.Manager.Subscribe(64)
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case changed := <-events:
+			publish("event", event(changed))
+		}
+	}
+}
+
+func durationOr(d, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return fallback
+}
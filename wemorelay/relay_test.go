@@ -0,0 +1,82 @@
+package wemorelay
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/randohm/go.wemo"
+)
+
+const envelope = `<?xml version="1.0" encoding="utf-8"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>%s</s:Body></s:Envelope>`
+
+func TestClient(t *testing.T) {
+	state := "0"
+	plug := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(body), "<u:SetBinaryState ") {
+			state = "1"
+		}
+		fmt.Fprintf(w, envelope, `<u:GetBinaryStateResponse xmlns:u="urn:Belkin:service:basicevent:1"><BinaryState>`+state+`</BinaryState></u:GetBinaryStateResponse>`)
+	}))
+	defer plug.Close()
+
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Porch", Host: strings.TrimPrefix(plug.URL, "http://"), UDN: "uuid:Socket-1_0-A", DeviceType: wemo.Controllee})
+	m.SetAlias("uuid:Socket-1_0-A", "porch")
+
+	messages := make(chan Message, 10)
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(Request{ID: "1", Action: ActionOn, Device: "porch"})
+		conn.WriteJSON(Request{ID: "2", Action: ActionLevel, Device: "porch"})
+		for {
+			var message Message
+			if err := conn.ReadJSON(&message); err != nil {
+				return
+			}
+			messages <- message
+		}
+	}))
+	defer relay.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &Client{Manager: m, URL: "ws" + strings.TrimPrefix(relay.URL, "http"), Token: "secret"}
+	go client.Run(ctx)
+
+	responses := make(map[string]Message)
+	events := 0
+	for len(responses) < 2 || events == 0 {
+		select {
+		case message := <-messages:
+			if message.Type == MessageEvent {
+				events++
+			} else {
+				responses[message.ID] = message
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected: 2 responses and an event, got: %v, %d events", responses, events)
+		}
+	}
+	if on := responses["1"]; on.Error != "" || on.State == nil || !on.State.On {
+		t.Errorf("Unexpected response: %+v", on)
+	}
+	if level := responses["2"]; level.Error == "" {
+		t.Errorf("Expected: an error for a level request without a level, got: %+v", level)
+	}
+}
@@ -0,0 +1,268 @@
+package wemotest
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Bulb is an end device paired with a fake bridge.
+type Bulb struct {
+	ID           string
+	Name         string
+	On           bool
+	Level        int               // 0-255
+	Values       map[string]string // other capabilities set, e.g. 10300 for the color, by capability id
+	Capabilities string            // defaults to those of a dimmable bulb, 10006,10008,30008,30009,3000A
+	Model        string            // model code, defaults to MZ100
+	Unreachable  bool              // the bridge lost the bulb, e.g. switched off at the wall
+}
+
+// Group is a group of bulbs a fake bridge keeps.
+type Group struct {
+	ID    string
+	Name  string
+	Bulbs []string // ids of the bulbs
+}
+
+const bulbCapabilities = "10006,10008,30008,30009,3000A"
+
+// AddBulb pairs a bulb, switched off at full level, with a bridge.
+func (d *Device) AddBulb(id, name string) {
+	d.AddEndDevice(Bulb{ID: id, Name: name, Level: 255})
+}
+
+// AddEndDevice pairs the end device with a bridge.
+func (d *Device) AddEndDevice(bulb Bulb) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	bulb.Values = copyValues(bulb.Values)
+	d.bulbs = append(d.bulbs, &bulb)
+}
+
+// AddGroup groups paired bulbs as the app does. Grouped bulbs are listed
+// with their group only, like real bridges list them.
+func (d *Device) AddGroup(id, name string, bulbs ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.groups = append(d.groups, &Group{ID: id, Name: name, Bulbs: bulbs})
+}
+
+// Bulb returns a copy of the paired bulb with the given id.
+func (d *Device) Bulb(id string) (Bulb, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if bulb := d.bulb(id); bulb != nil {
+		copied := *bulb
+		copied.Values = copyValues(bulb.Values)
+		return copied, true
+	}
+	return Bulb{}, false
+}
+
+// UpdateBulb changes the paired bulb with the given id, e.g. to make it
+// unreachable, and reports whether it is paired.
+func (d *Device) UpdateBulb(id string, update func(*Bulb)) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if bulb := d.bulb(id); bulb != nil {
+		update(bulb)
+		return true
+	}
+	return false
+}
+
+func (d *Device) bulb(id string) *Bulb {
+	for _, bulb := range d.bulbs {
+		if bulb.ID == id {
+			return bulb
+		}
+	}
+	return nil
+}
+
+func (d *Device) group(id string) *Group {
+	for _, group := range d.groups {
+		if group.ID == id {
+			return group
+		}
+	}
+	return nil
+}
+
+func (d *Device) grouped(id string) bool {
+	for _, group := range d.groups {
+		for _, bulb := range group.Bulbs {
+			if bulb == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func copyValues(values map[string]string) map[string]string {
+	copied := make(map[string]string)
+	for k, v := range values {
+		copied[k] = v
+	}
+	return copied
+}
+
+// status returns the capability values of the bulb, e.g. "1,255:0,,,", or
+// nothing when the bridge can't reach it.
+func (b *Bulb) status() string {
+	if b.Unreachable {
+		return ""
+	}
+	on := "0"
+	if b.On {
+		on = "1"
+	}
+	return fmt.Sprintf("%s,%d:0,,,", on, b.Level)
+}
+
+// set sets a capability of the bulb to value.
+func (b *Bulb) set(capability, value string) error {
+	switch capability {
+	case "10006":
+		b.On = value == "1"
+	case "10008":
+		level, err := strconv.Atoi(strings.SplitN(value, ":", 2)[0])
+		if err != nil || level < 0 || level > 255 {
+			return fmt.Errorf("invalid level %q", value)
+		}
+		b.Level = level
+	default:
+		b.Values[capability] = value
+	}
+	return nil
+}
+
+// embedded returns the XML document doc escaped as the text of an element,
+// the way bridges return their lists: with a declaration of its own, and with
+// the names in it escaped once more.
+func embedded(doc string) string {
+	return html.EscapeString(`<?xml version="1.0" encoding="utf-8"?>` + doc)
+}
+
+// unembedded returns an XML document sent as the text of an element. Clients
+// differ in how often they escape it, so it's unescaped until it is XML.
+func unembedded(text string) string {
+	for i := 0; i < 3 && !strings.Contains(text, "<"); i++ {
+		text = html.UnescapeString(text)
+	}
+	return text
+}
+
+func (b *Bulb) deviceInfo(index int) string {
+	return fmt.Sprintf("<DeviceInfo><DeviceIndex>%d</DeviceIndex><DeviceID>%s</DeviceID><FriendlyName>%s</FriendlyName>"+
+		"<IconVersion>1</IconVersion><FirmwareVersion>83</FirmwareVersion><CapabilityIDs>%s</CapabilityIDs><CurrentState>%s</CurrentState>"+
+		"<Manufacturer>MRVL</Manufacturer><ModelCode>%s</ModelCode><productName>Lighting</productName><WeMoCertified>YES</WeMoCertified></DeviceInfo>",
+		index, html.EscapeString(b.ID), html.EscapeString(b.Name), stringOr(b.Capabilities, bulbCapabilities), b.status(), stringOr(b.Model, "MZ100"))
+}
+
+func (d *Device) handleBridge(action, body string) (string, int) {
+	switch action {
+	case "GetEndDevices":
+		var b strings.Builder
+		b.WriteString("<DeviceLists><DeviceList><DeviceListType>Paired</DeviceListType><DeviceInfos>")
+		for i, bulb := range d.bulbs {
+			if !d.grouped(bulb.ID) {
+				b.WriteString(bulb.deviceInfo(i))
+			}
+		}
+		b.WriteString("</DeviceInfos><GroupInfos>")
+		for _, group := range d.groups {
+			fmt.Fprintf(&b, "<GroupInfo><GroupID>%s</GroupID><GroupName>%s</GroupName><GroupCapabilityIDs>10006,10008</GroupCapabilityIDs><DeviceInfos>",
+				html.EscapeString(group.ID), html.EscapeString(group.Name))
+			for _, id := range group.Bulbs {
+				for i, bulb := range d.bulbs {
+					if bulb.ID == id {
+						b.WriteString(bulb.deviceInfo(i))
+					}
+				}
+			}
+			b.WriteString("</DeviceInfos></GroupInfo>")
+		}
+		b.WriteString("</GroupInfos></DeviceList></DeviceLists>")
+		return "<DeviceLists>" + embedded(b.String()) + "</DeviceLists>", 0
+
+	case "GetDeviceStatus":
+		var b strings.Builder
+		b.WriteString("<DeviceStatusList>")
+		for _, id := range strings.Split(argument(body, "DeviceIDs"), ",") {
+			id = strings.TrimSpace(id)
+			isGroup := "NO"
+			bulb := d.bulb(id)
+			if group := d.group(id); group != nil && len(group.Bulbs) > 0 {
+				isGroup, bulb = "YES", d.bulb(group.Bulbs[0])
+			}
+			if bulb == nil {
+				continue
+			}
+			available := "YES"
+			if bulb.Unreachable {
+				available = "NO"
+			}
+			fmt.Fprintf(&b, `<DeviceStatus><IsGroupAction>%s</IsGroupAction><DeviceID available="%s">%s</DeviceID><CapabilityID>%s</CapabilityID><CapabilityValue>%s</CapabilityValue></DeviceStatus>`,
+				isGroup, available, html.EscapeString(id), stringOr(bulb.Capabilities, bulbCapabilities), bulb.status())
+		}
+		b.WriteString("</DeviceStatusList>")
+		return "<DeviceStatusList>" + embedded(b.String()) + "</DeviceStatusList>", 0
+
+	case "SetDeviceStatus":
+		var failed []string
+		for _, status := range strings.SplitAfter(unembedded(argument(body, "DeviceStatusList")), "</DeviceStatus>") {
+			id := argument(status, "DeviceID")
+			if id == "" {
+				continue
+			}
+			bulbs := []string{id}
+			if argument(status, "IsGroupAction") == "YES" {
+				group := d.group(id)
+				if group == nil {
+					failed = append(failed, id)
+					continue
+				}
+				bulbs = group.Bulbs
+			}
+			for _, id := range bulbs {
+				bulb := d.bulb(id)
+				if bulb == nil || bulb.Unreachable {
+					failed = append(failed, id)
+					continue
+				}
+				if err := bulb.set(argument(status, "CapabilityID"), argument(status, "CapabilityValue")); err != nil {
+					return "", 402
+				}
+			}
+		}
+		return "<ErrorDeviceIDs>" + html.EscapeString(strings.Join(failed, ",")) + "</ErrorDeviceIDs>", 0
+
+	case "CreateGroup":
+		request := unembedded(argument(body, "ReqCreateGroup"))
+		id, name := argument(request, "GroupID"), argument(request, "GroupName")
+		if id == "" || name == "" {
+			return "", 402
+		}
+		bulbs := strings.Split(argument(request, "DeviceIDList"), ",")
+		for _, id := range bulbs {
+			if d.bulb(id) == nil {
+				return "", 402
+			}
+		}
+		d.groups = append(d.groups, &Group{ID: id, Name: name, Bulbs: bulbs})
+		return "<CreateGroupResult>" + embedded("<CreateGroupResult><GroupID>"+html.EscapeString(id)+"</GroupID><Status>1</Status></CreateGroupResult>") + "</CreateGroupResult>", 0
+
+	case "SetDeviceName":
+		bulb := d.bulb(argument(body, "DeviceID"))
+		if bulb == nil {
+			return "", 402
+		}
+		bulb.Name = argument(body, "FriendlyName")
+		return "", 0
+	}
+	return "", 401
+}
@@ -0,0 +1,98 @@
+package wemotest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestBridge(t *testing.T) {
+	fake := &Device{Type: wemo.Bridge, Name: "Bridge"}
+	fake.AddBulb("94103EA2B27803ED", "Lamp")
+	fake.AddBulb("94103EA2B278030A", "Kitchen & Hall")
+	fake.AddEndDevice(Bulb{ID: "94103EA2B2780B7C", Name: "Porch", Level: 255, Unreachable: true})
+	device := Serve(t, fake)
+	ctx := context.Background()
+
+	info, err := device.FetchDeviceInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bulbs := info.EndDevices.EndDeviceInfo
+	if len(bulbs) != 3 || bulbs[1].FriendlyName != "Kitchen & Hall" || bulbs[2].CurrentState != "" {
+		t.Errorf("Unexpected bulbs: %+v", info.EndDevices)
+	}
+
+	if err := device.SetBulb(ctx, "94103EA2B27803ED", "on", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := device.SetBulb(ctx, "94103EA2B27803ED", "dim", "128", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := device.Bulb("94103EA2B278030A", "on", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if bulb, _ := fake.Bulb("94103EA2B27803ED"); !bulb.On || bulb.Level != 128 {
+		t.Errorf("Expected: the lamp on at 128, got: %+v", bulb)
+	}
+	if bulb, _ := fake.Bulb("94103EA2B278030A"); !bulb.On {
+		t.Errorf("Expected: the kitchen on with the legacy message, got: %+v", bulb)
+	}
+
+	status, err := device.FetchBulbStatus(ctx, "94103EA2B27803ED,94103EA2B278030A,94103EA2B2780B7C")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"94103EA2B27803ED": "1,128:0,,,", "94103EA2B278030A": "1,255:0,,,", "94103EA2B2780B7C": ""}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("Expected: %v, got: %v", expected, status)
+	}
+
+	if err := device.ChangeBulbName(ctx, "94103EA2B278030A", "Kitchen"); err != nil {
+		t.Fatal(err)
+	}
+	if bulb, _ := fake.Bulb("94103EA2B278030A"); bulb.Name != "Kitchen" {
+		t.Errorf("Expected: Kitchen, got: %s", bulb.Name)
+	}
+}
+
+func TestBridgeGroups(t *testing.T) {
+	fake := &Device{Type: wemo.Bridge, Name: "Bridge"}
+	fake.AddBulb("A", "Left")
+	fake.AddBulb("B", "Right")
+	fake.AddBulb("C", "Desk")
+	fake.AddGroup("1500000000", "Living Room", "A", "B")
+	device := Serve(t, fake)
+	ctx := context.Background()
+
+	groups, err := device.FetchBridgeGroups(ctx, fake.UDN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []wemo.BridgeGroup{{ID: "1500000000", Name: "Living Room", Bulbs: []string{"A", "B"}}}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Expected: %+v, got: %+v", expected, groups)
+	}
+	if info, err := device.FetchDeviceInfo(ctx); err != nil || len(info.EndDevices.EndDeviceInfo) != 1 {
+		t.Errorf("Expected: only the ungrouped bulb listed, got: %+v, %v", info, err)
+	}
+
+	if err := device.SetBulb(ctx, "1500000000", "on", "", true); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"A", "B"} {
+		if bulb, _ := fake.Bulb(id); !bulb.On {
+			t.Errorf("Expected: %s on with its group, got: %+v", id, bulb)
+		}
+	}
+
+	group, err := device.CreateBridgeGroup(ctx, "Study", []string{"C"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups, _ := device.FetchBridgeGroups(ctx, fake.UDN()); len(groups) != 2 || groups[1].ID != group.ID {
+		t.Errorf("Expected: the created group, got: %+v", groups)
+	}
+}
@@ -0,0 +1,210 @@
+package wemotest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+// Interaction is an HTTP exchange with a device as kept in a cassette. The
+// WiFi passwords and keys in the bodies are redacted, see wemo.RedactSecrets.
+type Interaction struct {
+	Method       string `json:"method"`
+	URL          string `json:"url"`
+	SOAPAction   string `json:"soap-action,omitempty"`
+	RequestBody  string `json:"request-body,omitempty"`
+	StatusCode   int    `json:"status-code"`
+	ContentType  string `json:"content-type,omitempty"`
+	ResponseBody string `json:"response-body"`
+}
+
+// Cassette is a fixture file of the exchanges with real devices, written by a
+// Recorder and played back by a Player.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// LoadCassette reads a cassette file.
+func LoadCassette(file string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s => %s", file, err)
+	}
+	return &cassette, nil
+}
+
+// Save writes the cassette to file.
+func (c *Cassette) Save(file string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// Recorder is an http.RoundTripper recording the exchanges it passes to Next,
+// http.DefaultTransport when nil. Install it with wemo.SetTransport.
+type Recorder struct {
+	Next http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	next := r.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Method:       req.Method,
+		URL:          req.URL.String(),
+		SOAPAction:   req.Header.Get("SOAPACTION"),
+		RequestBody:  string(wemo.RedactSecrets(body)),
+		StatusCode:   resp.StatusCode,
+		ContentType:  resp.Header.Get("Content-Type"),
+		ResponseBody: string(wemo.RedactSecrets(data)),
+	})
+	return resp, nil
+}
+
+// Cassette returns the exchanges recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+// Player is an http.RoundTripper answering requests from a cassette instead
+// of the network. A request is answered by the first interaction not played
+// yet with the same method, URL, SOAP action and body, so repeated requests
+// get the answers in the recorded order. Install it with wemo.SetTransport.
+type Player struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	played   []bool
+}
+
+// NewPlayer returns a Player of the cassette.
+func NewPlayer(cassette *Cassette) *Player {
+	return &Player{cassette: cassette, played: make([]bool, len(cassette.Interactions))}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (p *Player) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	body = wemo.RedactSecrets(body)
+	soapAction := req.Header.Get("SOAPACTION")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, interaction := range p.cassette.Interactions {
+		if p.played[i] || interaction.Method != req.Method || interaction.URL != req.URL.String() ||
+			interaction.SOAPAction != soapAction || interaction.RequestBody != string(body) {
+			continue
+		}
+		p.played[i] = true
+		header := make(http.Header)
+		if interaction.ContentType != "" {
+			header.Set("Content-Type", interaction.ContentType)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.StatusCode, http.StatusText(interaction.StatusCode)),
+			StatusCode:    interaction.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(interaction.ResponseBody)),
+			ContentLength: int64(len(interaction.ResponseBody)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded exchange for %s %s %s", req.Method, req.URL, soapAction)
+}
+
+// Unplayed returns the interactions of the cassette not played yet.
+func (p *Player) Unplayed() []Interaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var unplayed []Interaction
+	for i, interaction := range p.cassette.Interactions {
+		if !p.played[i] {
+			unplayed = append(unplayed, interaction)
+		}
+	}
+	return unplayed
+}
+
+// UseCassette installs a transport for the rest of the test: with
+// $WEMO_RECORD set a Recorder talking to the real devices, which writes the
+// cassette file when the test ends, else a Player of the file. Tests using it
+// change the transport of the whole package and must not run in parallel.
+// The legacy methods without a context don't go through the transport.
+func UseCassette(t testing.TB, file string) {
+	t.Helper()
+	if os.Getenv("WEMO_RECORD") != "" {
+		recorder := &Recorder{}
+		wemo.SetTransport(recorder)
+		t.Cleanup(func() {
+			wemo.SetTransport(nil)
+			if err := recorder.Cassette().Save(file); err != nil {
+				t.Errorf("unable to save cassette => %s", err)
+			}
+		})
+		return
+	}
+
+	cassette, err := LoadCassette(file)
+	if err != nil {
+		t.Fatalf("unable to load cassette, record it with WEMO_RECORD=1 => %s", err)
+	}
+	wemo.SetTransport(NewPlayer(cassette))
+	t.Cleanup(func() { wemo.SetTransport(nil) })
+}
+
+// readBody reads a request or response body and replaces it with a copy.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
@@ -0,0 +1,79 @@
+package wemotest
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestCassette(t *testing.T) {
+	fake := &Device{Type: wemo.Insight, Name: "Kettle"}
+	device := Serve(t, fake)
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "kettle.json")
+
+	recorder := &Recorder{}
+	wemo.SetTransport(recorder)
+	defer wemo.SetTransport(nil)
+	if err := device.SetBinaryState(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	fake.SetState(0)
+	if _, err := device.FetchBinaryState(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := device.FetchDeviceInfo(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Cassette().Save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	// the played back device answers the same, also with the fake gone
+	fake.SetState(1)
+	cassette, err := LoadCassette(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := NewPlayer(cassette)
+	wemo.SetTransport(player)
+	if err := device.SetBinaryState(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := device.FetchBinaryState(ctx); err != nil || state != 0 {
+		t.Errorf("Expected: the recorded state 0, got: %d, %v", state, err)
+	}
+	if info, err := device.FetchDeviceInfo(ctx); err != nil || info.FriendlyName != "Kettle" {
+		t.Errorf("Expected: Kettle, got: %+v, %v", info, err)
+	}
+	if unplayed := player.Unplayed(); len(unplayed) != 0 {
+		t.Errorf("Expected: all played, got: %+v", unplayed)
+	}
+	if _, err := device.FetchBinaryState(ctx); err == nil || !strings.Contains(err.Error(), "no recorded exchange") {
+		t.Errorf("Expected: no recorded exchange, got: %v", err)
+	}
+	if len(fake.Actions()) != 2 {
+		t.Errorf("Expected: the fake called only while recording, got: %v", fake.Actions())
+	}
+}
+
+func TestRecorderRedactsSecrets(t *testing.T) {
+	device := Serve(t, &Device{Name: "Socket"})
+	recorder := &Recorder{}
+	client := &http.Client{Transport: recorder}
+
+	body := `<u:ConnectHomeNetwork xmlns:u="urn:Belkin:service:WiFiSetup:1"><ssid>home</ssid><password>s3cret</password></u:ConnectHomeNetwork>`
+	resp, err := client.Post("http://"+device.Host+"/upnp/control/WiFiSetup1", "text/xml", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	interactions := recorder.Cassette().Interactions
+	if len(interactions) != 1 || strings.Contains(interactions[0].RequestBody, "s3cret") {
+		t.Errorf("Expected: the password redacted, got: %+v", interactions)
+	}
+}
@@ -0,0 +1,91 @@
+package wemotest
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// misbehavior is how a device fails to answer an action in time.
+type misbehavior struct {
+	delay time.Duration
+	hang  bool
+	drop  bool
+}
+
+// Slow makes the device answer the action, e.g. "SetBinaryState", or the
+// setup.xml with "setup.xml", only after delay, as devices on a weak signal
+// do; 0 clears it.
+func (d *Device) Slow(action string, delay time.Duration) {
+	d.setMisbehavior(action, func(m *misbehavior) { m.delay = delay })
+}
+
+// Hang makes the device never answer the action, holding the connection until
+// the client gives up or the server closes its connections. Serve closes them
+// when the test ends; close them with CloseClientConnections before closing a
+// server of your own.
+func (d *Device) Hang(action string) {
+	d.setMisbehavior(action, func(m *misbehavior) { m.hang = true })
+}
+
+// Drop makes the device close the connection halfway through its answer to
+// the action, as devices rebooting or losing their network do.
+func (d *Device) Drop(action string) {
+	d.setMisbehavior(action, func(m *misbehavior) { m.drop = true })
+}
+
+// Recover makes the device answer the action normally again, undoing Slow,
+// Hang and Drop.
+func (d *Device) Recover(action string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.misbehave, action)
+}
+
+func (d *Device) setMisbehavior(action string, set func(*misbehavior)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.misbehave == nil {
+		d.misbehave = make(map[string]misbehavior)
+	}
+	m := d.misbehave[action]
+	set(&m)
+	d.misbehave[action] = m
+}
+
+// answer writes the answer to the action, misbehaving as set up.
+func (d *Device) answer(w http.ResponseWriter, r *http.Request, action string, status int, contentType, body string) {
+	d.mu.Lock()
+	m := d.misbehave[action]
+	d.mu.Unlock()
+
+	if m.hang {
+		<-r.Context().Done()
+		return
+	}
+	if m.delay > 0 {
+		timer := time.NewTimer(m.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if m.drop {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			conn, _, err := hijacker.Hijack()
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s",
+				status, http.StatusText(status), contentType, len(body), body[:len(body)/2])
+			conn.Close()
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	fmt.Fprint(w, body)
+}
@@ -0,0 +1,115 @@
+package wemotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestSlowDevice(t *testing.T) {
+	fake := &Device{Name: "Socket"}
+	device := Serve(t, fake)
+	fake.Slow("GetBinaryState", 300*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := device.FetchBinaryState(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected: %s, got: %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("Expected: to give up at the deadline, got: after %s", elapsed)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := device.FetchBinaryState(ctx); err != nil {
+		t.Errorf("Expected: the slow answer within the deadline, got: %v", err)
+	}
+}
+
+func TestHangingDevice(t *testing.T) {
+	fake := &Device{Name: "Socket"}
+	device := Serve(t, fake)
+	fake.Hang("SetBinaryState")
+	fake.Hang("setup.xml")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := device.SetBinaryState(ctx, true); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected: %s, got: %v", context.Canceled, err)
+	}
+
+	// without a deadline of the caller the timeouts of the package apply
+	done := make(chan error, 1)
+	go func() {
+		_, err := device.FetchDeviceInfo(context.Background())
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected: an error for a hanging device, got: nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected: FetchDeviceInfo to time out, got: still waiting")
+	}
+
+	fake.Recover("SetBinaryState")
+	if err := device.SetBinaryState(context.Background(), true); err != nil || fake.State() != 1 {
+		t.Errorf("Expected: the device on after recovering, got: %v", err)
+	}
+}
+
+func TestDroppedAnswer(t *testing.T) {
+	fake := &Device{Type: wemo.Insight, Name: "Kettle"}
+	device := Serve(t, fake)
+	fake.Drop("GetInsightParams")
+
+	var aerr *wemo.ActionError
+	if _, err := device.FetchInsightParams(context.Background()); err == nil || errors.As(err, &aerr) {
+		t.Errorf("Expected: a read error, got: %v", err)
+	}
+	fake.Recover("GetInsightParams")
+	if _, err := device.FetchInsightParams(context.Background()); err != nil {
+		t.Errorf("Expected: the params after recovering, got: %v", err)
+	}
+}
+
+func TestManagerRetriesAtNewHost(t *testing.T) {
+	old := &Device{Name: "Porch"}
+	oldDevice := Serve(t, old)
+	moved := &Device{Name: "Porch"}
+	movedDevice := Serve(t, moved)
+	old.Slow("SetBinaryState", 300*time.Millisecond)
+	old.Drop("SetBinaryState")
+
+	m := wemo.NewManager()
+	entry, err := m.Put(wemo.ManagedDevice{Name: "Porch", Host: oldDevice.Host, UDN: old.UDN()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rediscovery finds the device elsewhere while the call is under way
+	time.AfterFunc(50*time.Millisecond, func() {
+		m.Put(wemo.ManagedDevice{Name: "Porch", Host: movedDevice.Host, UDN: old.UDN()})
+	})
+	if err := m.SetBinaryState(context.Background(), entry.Key, true); err != nil || moved.State() != 1 {
+		t.Errorf("Expected: a retry at the new host, got: %v, state %d", err, moved.State())
+	}
+
+	// no retry once the caller gave up
+	old.Hang("SetBinaryState")
+	m.Put(wemo.ManagedDevice{Name: "Porch", Host: oldDevice.Host, UDN: old.UDN()})
+	time.AfterFunc(50*time.Millisecond, func() {
+		m.Put(wemo.ManagedDevice{Name: "Porch", Host: movedDevice.Host, UDN: old.UDN()})
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	actions := len(moved.Actions())
+	if err := m.SetBinaryState(ctx, entry.Key, false); !errors.Is(err, context.DeadlineExceeded) || len(moved.Actions()) != actions {
+		t.Errorf("Expected: %s without a retry, got: %v", context.DeadlineExceeded, err)
+	}
+}
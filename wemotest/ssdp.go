@@ -0,0 +1,129 @@
+package wemotest
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// SSDPResponder answers the M-SEARCH requests of discovery on a UDP port of
+// the loopback interface, so discovery is testable without a network. Point
+// a wemo.Wemo at it with SetSearchAddress(responder.Addr()).
+type SSDPResponder struct {
+	conn *net.UDPConn
+
+	mu       sync.Mutex
+	answers  []ssdpAnswer
+	searches []string
+}
+
+type ssdpAnswer struct {
+	st       string
+	datagram string
+}
+
+// StartSSDP starts a responder, which stops when the test ends. It answers
+// nothing until told what to with Answer or AnswerRaw.
+func StartSSDP(t testing.TB) *SSDPResponder {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("unable to listen for SSDP searches => %s", err)
+	}
+	r := &SSDPResponder{conn: conn}
+	t.Cleanup(func() { conn.Close() })
+	go r.serve()
+	return r
+}
+
+// Addr returns the address the responder receives searches on.
+func (r *SSDPResponder) Addr() string {
+	return r.conn.LocalAddr().String()
+}
+
+// Answer answers searches for st, a device type URN or "" for all searches,
+// the way a device at location does, e.g. http://127.0.0.1:49153/setup.xml.
+// Answering twice duplicates the answer, as devices do on several interfaces.
+func (r *SSDPResponder) Answer(st, location string) {
+	r.AnswerRaw(st, SSDPResponse(st, location))
+}
+
+// AnswerDevice answers searches for the type of d with the address it is
+// served at by Serve, given by the Host of the wemo.Device Serve returned.
+func (r *SSDPResponder) AnswerDevice(d *Device, host string) {
+	r.Answer(d.deviceType(), "http://"+host+"/setup.xml")
+	r.Answer("urn:Belkin:service:basicevent:1", "http://"+host+"/setup.xml")
+}
+
+// AnswerRaw answers searches for st, or all searches for "", with a crafted
+// datagram, e.g. one with malformed headers.
+func (r *SSDPResponder) AnswerRaw(st, datagram string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.answers = append(r.answers, ssdpAnswer{st: st, datagram: datagram})
+}
+
+// Searches returns the search targets of the searches received, in order.
+func (r *SSDPResponder) Searches() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.searches...)
+}
+
+// SSDPResponse returns the answer of a device at location to a search for st.
+func SSDPResponse(st, location string) string {
+	return "HTTP/1.1 200 OK\r\n" +
+		"CACHE-CONTROL: max-age=86400\r\n" +
+		"DATE: Sat, 17 Oct 2026 10:00:00 GMT\r\n" +
+		"EXT:\r\n" +
+		"LOCATION: " + location + "\r\n" +
+		"OPT: \"http://schemas.upnp.org/upnp/1/0/\"; ns=01\r\n" +
+		"01-NLS: 5f0ee7ec-1dd2-11b2-8b1d-a1bd8e43a5c1\r\n" +
+		"SERVER: Unspecified, UPnP/1.0, Unspecified\r\n" +
+		"X-User-Agent: redsonic\r\n" +
+		"ST: " + st + "\r\n" +
+		"USN: uuid:Socket-1_0-FAKE::" + st + "\r\n\r\n"
+}
+
+func (r *SSDPResponder) serve() {
+	buffer := make([]byte, 2048)
+	for {
+		n, from, err := r.conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+		st, ok := searchTarget(string(buffer[:n]))
+		if !ok {
+			continue
+		}
+
+		r.mu.Lock()
+		r.searches = append(r.searches, st)
+		var datagrams []string
+		for _, answer := range r.answers {
+			if answer.st == "" || answer.st == st || st == "ssdp:all" {
+				datagrams = append(datagrams, answer.datagram)
+			}
+		}
+		r.mu.Unlock()
+		for _, datagram := range datagrams {
+			r.conn.WriteToUDP([]byte(datagram), from)
+		}
+	}
+}
+
+// searchTarget returns the ST header of an M-SEARCH request.
+func searchTarget(request string) (string, bool) {
+	lines := strings.Split(request, "\r\n")
+	if !strings.HasPrefix(lines[0], "M-SEARCH ") {
+		return "", false
+	}
+	for _, line := range lines[1:] {
+		header := strings.SplitN(line, ":", 2)
+		if len(header) == 2 && strings.EqualFold(strings.TrimSpace(header[0]), "ST") {
+			return strings.TrimSpace(header[1]), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,42 @@
+package wemotest
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestSSDPResponder(t *testing.T) {
+	fake := &Device{Name: "Socket"}
+	socket := Serve(t, fake)
+	insight := Serve(t, &Device{Type: wemo.Insight, Name: "Kettle"})
+	responder := StartSSDP(t)
+	responder.AnswerDevice(fake, socket.Host)
+	responder.Answer(wemo.Controllee, "http://"+socket.Host+"/setup.xml")
+	responder.AnswerRaw(wemo.Insight, "HTTP/1.1 200 OK\r\nlocation:http://"+insight.Host+"/setup.xml\r\nST: "+wemo.Insight+"\r\n\r\n")
+	responder.AnswerRaw(wemo.Insight, "HTTP/1.1 200 OK\r\nLOCATION: http://%zz/setup.xml\r\n\r\n")
+	responder.AnswerRaw("", "HTTP/1.1 200 OK\r\nLOCATION: http://127.0.0.1:80/description.xml\r\n\r\n")
+	responder.AnswerRaw("", "garbage")
+
+	w := wemo.NewByIP("127.0.0.1")
+	w.SetSearchAddress(responder.Addr())
+	devices, err := w.DiscoverTypes(200*time.Millisecond, wemo.Controllee, wemo.Insight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hosts []string
+	for _, device := range devices {
+		hosts = append(hosts, device.Host)
+	}
+	sort.Strings(hosts)
+	expected := []string{socket.Host, insight.Host}
+	sort.Strings(expected)
+	if len(hosts) != 2 || hosts[0] != expected[0] || hosts[1] != expected[1] {
+		t.Errorf("Expected: %v, got: %v", expected, hosts)
+	}
+	if searches := responder.Searches(); len(searches) != 2 || searches[0] != wemo.Controllee || searches[1] != wemo.Insight {
+		t.Errorf("Unexpected searches: %v", searches)
+	}
+}
@@ -0,0 +1,345 @@
+// Package wemotest provides a fake WeMo device for tests of code using the
+// wemo package. A Device answers the setup.xml and the basicevent, insight and
+// bridge services the way devices do, from state the test sets and inspects:
+//
+//	fake := &wemotest.Device{Type: wemo.Insight, Name: "Kettle"}
+//	device := wemotest.Serve(t, fake)
+//	fake.SetInsight(wemo.InsightParams{CurrentPower: 1200000})
+//	... code under test talking to device ...
+//	if fake.State() != 1 { t.Error("Expected: the kettle on") }
+package wemotest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+// Device is a fake device, served with Serve or as an http.Handler. The
+// fields describe it and must not change once it is served; its state is
+// read and changed with the methods, also while it is served.
+type Device struct {
+	Type     string // device type, defaults to wemo.Controllee
+	Name     string // friendly name
+	Serial   string // defaults to one derived from Name
+	MAC      string // defaults to one derived from Serial
+	Firmware string // defaults to a current release
+
+	mu         sync.Mutex
+	renamed    string
+	state      int
+	brightness int
+	insight    wemo.InsightParams
+	signal     int
+	bulbs      []*Bulb
+	groups     []*Group
+	faults     map[string]int
+	misbehave  map[string]misbehavior
+	actions    []string
+}
+
+// Serve serves the device until the test ends and returns a wemo.Device
+// talking to it.
+func Serve(t testing.TB, d *Device) *wemo.Device {
+	server := httptest.NewServer(d)
+	t.Cleanup(server.Close)
+	t.Cleanup(server.CloseClientConnections) // ends hanging answers first
+	return &wemo.Device{Host: strings.TrimPrefix(server.URL, "http://")}
+}
+
+func (d *Device) deviceType() string {
+	if d.Type != "" {
+		return d.Type
+	}
+	return wemo.Controllee
+}
+
+func (d *Device) serial() string {
+	if d.Serial != "" {
+		return d.Serial
+	}
+	sum := sha1.Sum([]byte(d.Name))
+	return "FAKE" + strings.ToUpper(hex.EncodeToString(sum[:]))[:10]
+}
+
+func (d *Device) mac() string {
+	if d.MAC != "" {
+		return d.MAC
+	}
+	sum := sha1.Sum([]byte(d.serial()))
+	return "94103E" + strings.ToUpper(hex.EncodeToString(sum[:3]))
+}
+
+// UDN is the unique device name of the device.
+func (d *Device) UDN() string {
+	kind := "Socket"
+	switch d.deviceType() {
+	case wemo.Insight:
+		kind = "Insight"
+	case wemo.Dimmer:
+		kind = "Dimmer"
+	case wemo.LightSwitch:
+		kind = "Lightswitch"
+	case wemo.Bridge:
+		kind = "Bridge"
+	case wemo.Sensor:
+		kind = "Sensor"
+	}
+	return "uuid:" + kind + "-1_0-" + d.serial()
+}
+
+// FriendlyName returns the name of the device, as changed by
+// ChangeFriendlyName.
+func (d *Device) FriendlyName() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.renamed != "" {
+		return d.renamed
+	}
+	return d.Name
+}
+
+// State returns the binary state: 0 off, 1 on, 8 standby for Insights.
+func (d *Device) State() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state
+}
+
+// SetState sets the binary state, e.g. as if the button was pressed.
+func (d *Device) SetState(state int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.state = state
+}
+
+// Brightness returns the brightness of a Dimmer in percent.
+func (d *Device) Brightness() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.brightness
+}
+
+// SetBrightness sets the brightness of a Dimmer in percent.
+func (d *Device) SetBrightness(level int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.brightness = level
+}
+
+// SetInsight sets the readings an Insight reports.
+func (d *Device) SetInsight(params wemo.InsightParams) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.insight = params
+}
+
+// SetSignal sets the WiFi signal strength in percent.
+func (d *Device) SetSignal(signal int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.signal = signal
+}
+
+// Fail makes the device answer the action, e.g. "SetBinaryState", with the
+// UPnP error code, as devices do for actions they can't run; 0 clears it.
+func (d *Device) Fail(action string, code int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.faults == nil {
+		d.faults = make(map[string]int)
+	}
+	if code == 0 {
+		delete(d.faults, action)
+		return
+	}
+	d.faults[action] = code
+}
+
+// Actions returns the actions the device was sent, in order, as
+// service#action, e.g. "basicevent#SetBinaryState".
+func (d *Device) Actions() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.actions...)
+}
+
+const setupXML = `<?xml version="1.0"?>
+<root xmlns="urn:Belkin:device-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <device>
+    <deviceType>%s</deviceType>
+    <friendlyName>%s</friendlyName>
+    <manufacturer>Belkin International Inc.</manufacturer>
+    <modelName>%s</modelName>
+    <UDN>%s</UDN>
+    <serialNumber>%s</serialNumber>
+    <macAddress>%s</macAddress>
+    <firmwareVersion>%s</firmwareVersion>
+    <binaryState>%d</binaryState>
+  </device>
+</root>
+`
+
+const envelope = `<?xml version="1.0" encoding="utf-8"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><u:%sResponse xmlns:u="urn:Belkin:service:%s:1">%s</u:%sResponse></s:Body></s:Envelope>`
+
+const faultEnvelope = `<?xml version="1.0" encoding="utf-8"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode><errorDescription>%s</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`
+
+var faultDescriptions = map[int]string{401: "Invalid Action", 402: "Invalid Args", 501: "Action Failed"}
+
+var controlPathRE = regexp.MustCompile(`^/upnp/control/(\w+)1$`)
+
+// ServeHTTP serves the setup.xml and the services of the device.
+func (d *Device) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Server", "Unspecified, UPnP/1.0, Unspecified")
+	if r.URL.Path == "/setup.xml" {
+		info := fmt.Sprintf(setupXML, d.deviceType(), html.EscapeString(d.FriendlyName()), d.modelName(),
+			d.UDN(), d.serial(), d.mac(), stringOr(d.Firmware, "WeMo_WW_2.00.11420.PVT-OWRT-SNS"), d.State())
+		d.answer(w, r, "setup.xml", http.StatusOK, "text/xml", info)
+		return
+	}
+	matches := controlPathRE.FindStringSubmatch(r.URL.Path)
+	if matches == nil || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	service := matches[1]
+	action := strings.Trim(r.Header.Get("SOAPACTION"), `"`)
+	action = action[strings.LastIndex(action, "#")+1:]
+
+	d.mu.Lock()
+	d.actions = append(d.actions, service+"#"+action)
+	code := d.faults[action]
+	var result string
+	if code == 0 {
+		result, code = d.handle(service, action, string(body))
+	}
+	d.mu.Unlock()
+
+	contentType := `text/xml; charset="utf-8"`
+	if code != 0 {
+		d.answer(w, r, action, http.StatusInternalServerError, contentType,
+			fmt.Sprintf(faultEnvelope, code, stringOr(faultDescriptions[code], "Error")))
+		return
+	}
+	d.answer(w, r, action, http.StatusOK, contentType, fmt.Sprintf(envelope, action, service, result, action))
+}
+
+func (d *Device) modelName() string {
+	switch d.deviceType() {
+	case wemo.Insight:
+		return "Insight"
+	case wemo.Dimmer:
+		return "Dimmer"
+	case wemo.LightSwitch:
+		return "LightSwitch"
+	case wemo.Bridge:
+		return "Bridge"
+	case wemo.Sensor:
+		return "Sensor"
+	}
+	return "Socket"
+}
+
+// handle runs an action with d.mu held and returns the elements of the
+// response, or a UPnP error code.
+func (d *Device) handle(service, action, body string) (string, int) {
+	switch service + "#" + action {
+	case "basicevent#GetBinaryState":
+		if d.deviceType() == wemo.Dimmer {
+			return fmt.Sprintf("<BinaryState>%d</BinaryState><brightness>%d</brightness>", d.state, d.brightness), 0
+		}
+		return fmt.Sprintf("<BinaryState>%d</BinaryState>", d.state), 0
+	case "basicevent#SetBinaryState":
+		state, err := strconv.Atoi(argument(body, "BinaryState"))
+		if err != nil {
+			return "", 402
+		}
+		if level := argument(body, "brightness"); level != "" && d.deviceType() == wemo.Dimmer {
+			if d.brightness, err = strconv.Atoi(level); err != nil {
+				return "", 402
+			}
+		}
+		d.state = state
+		return fmt.Sprintf("<BinaryState>%d</BinaryState>", state), 0
+	case "basicevent#GetFriendlyName":
+		return "<FriendlyName>" + html.EscapeString(stringOr(d.renamed, d.Name)) + "</FriendlyName>", 0
+	case "basicevent#ChangeFriendlyName":
+		name := argument(body, "FriendlyName")
+		if name == "" {
+			return "", 402
+		}
+		d.renamed = name
+		return "<FriendlyName>" + html.EscapeString(name) + "</FriendlyName>", 0
+	case "basicevent#GetSignalStrength":
+		return fmt.Sprintf("<SignalStrength>%d</SignalStrength>", d.signal), 0
+	case "basicevent#GetMacAddr":
+		return "<MacAddr>" + d.mac() + "</MacAddr><SerialNo>" + d.serial() + "</SerialNo>", 0
+	}
+
+	if service == "insight" && d.deviceType() == wemo.Insight {
+		return d.handleInsight(action)
+	}
+	if service == "bridge" && d.deviceType() == wemo.Bridge {
+		return d.handleBridge(action, body)
+	}
+	return "", 401
+}
+
+func (d *Device) handleInsight(action string) (string, int) {
+	p := d.insight
+	switch action {
+	case "GetInsightParams":
+		// state|last change|on for|on today|on total|period|signal|current mW|today mW|total mW|threshold mW
+		return fmt.Sprintf("<InsightParams>%d|0|%d|%d|%d|1209600|%s|%s|%s|%s|%s</InsightParams>",
+			d.state, p.OnFor, p.OnToday, p.OnTotal, formatFloat(p.WifiStrength), formatFloat(p.CurrentPower),
+			formatFloat(p.TodayPower), formatFloat(p.TotalPower), formatFloat(p.PowerThreshold)), 0
+	case "GetPower":
+		return "<InstantPower>" + formatFloat(p.CurrentPower) + "</InstantPower>", 0
+	case "GetTodayKWH":
+		return "<TodayKWH>" + formatFloat(p.TodayPower/60000/1000) + "</TodayKWH>", 0
+	case "GetPowerThreshold":
+		return "<PowerThreshold>" + formatFloat(p.PowerThreshold) + "</PowerThreshold>", 0
+	case "GetONFor":
+		return fmt.Sprintf("<ONFor>%d</ONFor>", p.OnFor), 0
+	case "GetTodayONTime":
+		return fmt.Sprintf("<TodayONTime>%d</TodayONTime>", p.OnToday), 0
+	}
+	return "", 401
+}
+
+// argument returns the unescaped text of the named element of a request.
+func argument(body, name string) string {
+	re := regexp.MustCompile(`<` + regexp.QuoteMeta(name) + `(?:\s[^>]*)?>([^<]*)</` + regexp.QuoteMeta(name) + `>`)
+	matches := re.FindStringSubmatch(body)
+	if matches == nil {
+		return ""
+	}
+	return html.UnescapeString(matches[1])
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func stringOr(s, fallback string) string {
+	if s != "" {
+		return s
+	}
+	return fallback
+}
@@ -0,0 +1,80 @@
+package wemotest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestDevice(t *testing.T) {
+	fake := &Device{Type: wemo.Dimmer, Name: "Hall & Stairs"}
+	device := Serve(t, fake)
+	ctx := context.Background()
+
+	info, err := device.FetchDeviceInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.FriendlyName != "Hall & Stairs" || info.DeviceType != wemo.Dimmer || info.UDN != fake.UDN() || info.SerialNumber == "" {
+		t.Errorf("Unexpected device info: %+v", info)
+	}
+
+	if err := device.SetBinaryState(ctx, true); err != nil || fake.State() != 1 {
+		t.Errorf("Expected: the dimmer on, got: %d, %v", fake.State(), err)
+	}
+	if err := device.SetBrightness(ctx, 40); err != nil || fake.Brightness() != 40 {
+		t.Errorf("Expected: 40, got: %d, %v", fake.Brightness(), err)
+	}
+	fake.SetState(0)
+	if state, err := device.FetchBinaryState(ctx); err != nil || state != 0 {
+		t.Errorf("Expected: 0, got: %d, %v", state, err)
+	}
+
+	if err := device.ChangeFriendlyName(ctx, "Hall"); err != nil || fake.FriendlyName() != "Hall" {
+		t.Errorf("Expected: Hall, got: %s, %v", fake.FriendlyName(), err)
+	}
+	fake.SetSignal(72)
+	if signal, err := device.SignalStrength(ctx); err != nil || signal != 72 {
+		t.Errorf("Expected: 72, got: %d, %v", signal, err)
+	}
+
+	fake.Fail("SetBinaryState", 501)
+	var aerr *wemo.ActionError
+	if err := device.SetBinaryState(ctx, true); !errors.As(err, &aerr) || aerr.Code != 501 || fake.State() != 0 {
+		t.Errorf("Expected: fault 501 and the state kept, got: %v", err)
+	}
+	fake.Fail("SetBinaryState", 0)
+	if err := device.SetBinaryState(ctx, true); err != nil {
+		t.Errorf("Expected: the fault cleared, got: %v", err)
+	}
+	if _, err := device.GetPower(ctx); !errors.As(err, &aerr) || aerr.Code != 401 {
+		t.Errorf("Expected: an invalid action for a Dimmer, got: %v", err)
+	}
+
+	expected := []string{"basicevent#SetBinaryState", "basicevent#SetBinaryState"}
+	if actions := fake.Actions(); len(actions) < 2 || !reflect.DeepEqual(actions[:2], expected) {
+		t.Errorf("Expected: %v first, got: %v", expected, actions)
+	}
+}
+
+func TestInsight(t *testing.T) {
+	fake := &Device{Type: wemo.Insight, Name: "Kettle"}
+	device := Serve(t, fake)
+	ctx := context.Background()
+
+	fake.SetState(1)
+	fake.SetInsight(wemo.InsightParams{OnFor: 90, OnTotal: 3600, WifiStrength: 80, CurrentPower: 1200000, TodayPower: 3600000, TotalPower: 7200000, PowerThreshold: 8000})
+	params, err := device.FetchInsightParams(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.OnFor != 90 || params.OnTotal != 3600 || params.CurrentPower != 1200000 || params.TotalPower != 7200000 || params.PowerThreshold != 8000 {
+		t.Errorf("Unexpected Insight params: %+v", params)
+	}
+	if power, err := device.GetPower(ctx); err != nil || power != 1200000 {
+		t.Errorf("Expected: 1200000, got: %v, %v", power, err)
+	}
+}
@@ -0,0 +1,291 @@
+// Package wemowebhook posts the state changes, power threshold crossings and
+// health changes of the devices of a wemo.Manager to webhooks.
+//
+// Every request is a JSON Event, signed with the secret of its endpoint: the
+// X-Wemo-Signature header is "sha256=" and the hex HMAC-SHA256 of the body.
+// Events follow the schema SchemaEvent; see the wemo package for how schemas
+// evolve.
+package wemowebhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/randohm/go.wemo"
+)
+
+// Event types
+const (
+	EventState  = "state"  // the binary state changed
+	EventPower  = "power"  // an Insight crossed its power threshold
+	EventHealth = "health" // a device went up or down
+)
+
+// SchemaEvent is the schema of Event.
+const SchemaEvent = "wemo.webhook-event/v1"
+
+// Event is the body of a webhook request.
+type Event struct {
+	Schema string    `json:"schema"`
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Key    string    `json:"key"`
+	Name   string    `json:"name"`
+
+	// state
+	State    *int   `json:"state,omitempty"`
+	Previous *int   `json:"previous,omitempty"`
+	Source   string `json:"source,omitempty"`
+
+	// power
+	PowerW     *float64 `json:"power-w,omitempty"`
+	ThresholdW *float64 `json:"threshold-w,omitempty"`
+	Above      *bool    `json:"above,omitempty"`
+
+	Insight *wemo.InsightDoc `json:"insight,omitempty"`
+
+	// health
+	Health string `json:"health,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Endpoint is a webhook URL.
+type Endpoint struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events,omitempty"` // event types to send, all when empty
+}
+
+func (e *Endpoint) wants(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, t := range e.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the X-Wemo-Signature of body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notifier watches a Manager and posts events to its endpoints. Failed
+// deliveries are retried with exponential backoff; each endpoint has its own
+// queue, so a slow endpoint doesn't hold up the others.
+type Notifier struct {
+	Manager   *wemo.Manager
+	Endpoints []Endpoint
+
+	// PowerThresholdW overrides the standby threshold configured on each
+	// Insight, in watts. PowerInterval is how often Insights are read,
+	// defaults to 30 seconds. Health events are only sent while someone runs
+	// Manager.MonitorHealth.
+	PowerThresholdW float64
+	PowerInterval   time.Duration
+
+	// MaxAttempts defaults to 5 and Backoff, the delay before the first retry
+	// which doubles with each further one, to a second.
+	MaxAttempts int
+	Backoff     time.Duration
+
+	Client *http.Client // defaults to a client with a 10 second timeout
+
+	// OnError, if set, is called for deliveries given up on.
+	OnError func(Endpoint, Event, error)
+
+	delivery uint64
+	mu       sync.Mutex
+	above    map[string]bool
+}
+
+// Run watches the manager until ctx is done.
+func (n *Notifier) Run(ctx context.Context) error {
+	queues := make([]chan Event, len(n.Endpoints))
+	var wg sync.WaitGroup
+	for i := range n.Endpoints {
+		queues[i] = make(chan Event, 100)
+		wg.Add(1)
+		go func(endpoint Endpoint, queue <-chan Event) {
+			defer wg.Done()
+			for event := range queue {
+				if err := n.Deliver(ctx, endpoint, event); err != nil && n.OnError != nil && ctx.Err() == nil {
+					n.OnError(endpoint, event, err)
+				}
+			}
+		}(n.Endpoints[i], queues[i])
+	}
+	defer wg.Wait()
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+	}()
+
+	send := func(event Event) {
+		for i := range n.Endpoints {
+			if !n.Endpoints[i].wants(event.Type) {
+				continue
+			}
+			select {
+			case queues[i] <- event:
+			default:
+				if n.OnError != nil {
+					n.OnError(n.Endpoints[i], event, fmt.Errorf("queue of %s is full", n.Endpoints[i].URL))
+				}
+			}
+		}
+	}
+
+	events, cancel := n.Manager.Subscribe(64)
+	defer cancel()
+	health, cancelHealth := n.Manager.SubscribeHealth(64)
+	defer cancelHealth()
+	power := time.NewTicker(durationOr(n.PowerInterval, 30*time.Second))
+	defer power.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case changed := <-events:
+			state, previous := changed.State, changed.Previous
+			send(Event{Type: EventState, Time: changed.Time, Key: changed.Key, Name: changed.Name, State: &state, Previous: &previous, Source: string(changed.Source)})
+		case <-power.C:
+			for _, event := range n.checkPower(ctx) {
+				send(event)
+			}
+		case change := <-health:
+			if change.From == wemo.HealthUnknown && change.To == wemo.HealthUp {
+				continue // first check
+			}
+			event := Event{Type: EventHealth, Time: time.Now(), Key: change.Device.Key, Name: change.Device.Name, Health: change.To.String()}
+			if change.Err != nil {
+				event.Error = change.Err.Error()
+			}
+			send(event)
+		}
+	}
+}
+
+// checkPower reads the Insights and returns an event for each one that
+// crossed its threshold since the last check.
+func (n *Notifier) checkPower(ctx context.Context) []Event {
+	var events []Event
+	for _, entry := range n.Manager.List() {
+		if !entry.Capabilities().Has(wemo.CapInsight) {
+			continue
+		}
+		params, err := n.Manager.InsightParams(ctx, entry.Key)
+		if err != nil {
+			continue
+		}
+		power := params.PowerW()
+		threshold := params.PowerThreshold / 1000
+		if n.PowerThresholdW > 0 {
+			threshold = n.PowerThresholdW
+		}
+		above := power > threshold
+
+		n.mu.Lock()
+		if n.above == nil {
+			n.above = make(map[string]bool)
+		}
+		was, known := n.above[entry.Key]
+		n.above[entry.Key] = above
+		n.mu.Unlock()
+
+		if known && was != above {
+			now := time.Now()
+			insight := wemo.NewInsightDoc(entry.Key, wemo.InsightReading{Host: entry.Host, Time: now, Params: *params})
+			events = append(events, Event{Type: EventPower, Time: now, Key: entry.Key, Name: entry.Name, PowerW: &power, ThresholdW: &threshold, Above: &above, Insight: &insight})
+		}
+	}
+	return events
+}
+
+// Deliver posts an event to an endpoint, retrying on network errors, 429 and
+// 5xx responses.
+func (n *Notifier) Deliver(ctx context.Context, endpoint Endpoint, event Event) error {
+	if event.Schema == "" {
+		event.Schema = SchemaEvent
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	id := strconv.FormatUint(atomic.AddUint64(&n.delivery, 1), 10)
+
+	attempts := n.MaxAttempts
+	if attempts <= 0 {
+		attempts = 5
+	}
+	backoff := durationOr(n.Backoff, time.Second)
+	for attempt := 1; ; attempt++ {
+		retry, err := n.post(ctx, endpoint, event.Type, id, body)
+		if err == nil || !retry || attempt == attempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, endpoint Endpoint, eventType, id string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Wemo-Event", eventType)
+	req.Header.Set("X-Wemo-Delivery", id) // the same for all attempts
+	if endpoint.Secret != "" {
+		req.Header.Set("X-Wemo-Signature", Sign(endpoint.Secret, body))
+	}
+
+	client := n.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("unable to post to %s => %s", endpoint.URL, err)
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode/100 == 2:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5:
+		return true, fmt.Errorf("%s returned status code => %d", endpoint.URL, resp.StatusCode)
+	}
+	return false, fmt.Errorf("%s returned status code => %d", endpoint.URL, resp.StatusCode)
+}
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+func durationOr(d, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return fallback
+}
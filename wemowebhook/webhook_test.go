@@ -0,0 +1,141 @@
+package wemowebhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/randohm/go.wemo"
+)
+
+func TestDeliver(t *testing.T) {
+	var mu sync.Mutex
+	var received []Event
+	var deliveries []string
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if got := r.Header.Get("X-Wemo-Signature"); got != Sign("secret", body) {
+			t.Errorf("Unexpected signature: %s", got)
+		}
+		deliveries = append(deliveries, r.Header.Get("X-Wemo-Delivery"))
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Error(err)
+		}
+		received = append(received, event)
+	}))
+	defer server.Close()
+
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Porch", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-A", DeviceType: wemo.Controllee})
+
+	n := &Notifier{
+		Manager:   m,
+		Endpoints: []Endpoint{{URL: server.URL, Secret: "secret", Events: []string{EventState}}},
+		Backoff:   time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- n.Run(ctx) }()
+
+	for {
+		m.UpdateBinaryState("uuid:Socket-1_0-A", 1)
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		m.UpdateBinaryState("uuid:Socket-1_0-A", 0)
+		select {
+		case <-ctx.Done():
+			t.Fatal("Expected: an event to be delivered")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	event := received[0]
+	if event.Schema != SchemaEvent || event.Type != EventState || event.Key != "uuid:Socket-1_0-A" || event.State == nil {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+	if deliveries[0] != "1" {
+		t.Errorf("Expected: the retry to keep the delivery id 1, got: %s", deliveries[0])
+	}
+}
+
+func TestNotifierHealth(t *testing.T) {
+	received := make(chan Event, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Error(err)
+		}
+		received <- event
+	}))
+	defer server.Close()
+
+	m := wemo.NewManager()
+	m.Put(wemo.ManagedDevice{Name: "Porch", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-A", DeviceType: wemo.Controllee})
+
+	n := &Notifier{Manager: m, Endpoints: []Endpoint{{URL: server.URL, Events: []string{EventHealth}}}}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- n.Run(ctx) }()
+
+	// the notifier doesn't check health itself, it reports the checks of
+	// whoever runs them
+	for {
+		m.CheckHealth(ctx)
+		select {
+		case event := <-received:
+			if event.Type != EventHealth || event.Key != "uuid:Socket-1_0-A" || event.Health != "down" || event.Error == "" {
+				t.Errorf("Unexpected event: %+v", event)
+			}
+			cancel()
+			<-done
+			return
+		case <-ctx.Done():
+			t.Fatal("Expected: a health event to be delivered")
+		case <-time.After(10 * time.Millisecond):
+			// checked before the notifier subscribed, start over
+			m.Remove("uuid:Socket-1_0-A")
+			m.Put(wemo.ManagedDevice{Name: "Porch", Host: "127.0.0.1:1", UDN: "uuid:Socket-1_0-A", DeviceType: wemo.Controllee})
+		}
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	n := &Notifier{Backoff: time.Millisecond}
+	if err := n.Deliver(context.Background(), Endpoint{URL: server.URL}, Event{Type: EventHealth}); err == nil {
+		t.Error("Expected: an error")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected: no retries on 400, got: %d attempts", attempts)
+	}
+}
@@ -0,0 +1,50 @@
+package wemo
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+)
+
+// EncryptWiFiPassword encrypts a WiFi password the way ConnectHomeNetwork
+// expects it. This is what the Belkin app computes with
+//
+//	openssl enc -aes-128-cbc -md md5 -S <salt> -iv <iv> -pass pass:<keydata> -a
+//
+// where keydata is the first half of the MAC address, the serial number and
+// the second half of the MAC, the salt its first 8 and the iv its first 16
+// characters. The base64 encoded result is followed by its length and the
+// length of the password, each as two hex digits.
+func EncryptWiFiPassword(password, mac, serial string) (string, error) {
+	if len(mac) != 12 {
+		return "", fmt.Errorf("invalid MAC address %q", mac)
+	}
+	keydata := mac[:6] + serial + mac[6:]
+	if len(keydata) < 16 {
+		return "", fmt.Errorf("invalid serial number %q", serial)
+	}
+	salt, iv := keydata[:8], keydata[:16]
+
+	// EVP_BytesToKey with MD5 and a single iteration; the first digest is
+	// all of the key for AES-128
+	key := md5.Sum([]byte(keydata + salt))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return "", err
+	}
+	plaintext := pkcs7Pad([]byte(password), aes.BlockSize)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, []byte(iv)).CryptBlocks(ciphertext, plaintext)
+
+	encoded := base64.StdEncoding.EncodeToString(ciphertext)
+	return fmt.Sprintf("%s%02x%02x", encoded, len(encoded), len(password)), nil
+}
+
+func pkcs7Pad(data []byte, size int) []byte {
+	n := size - len(data)%size
+	return append(data, bytes.Repeat([]byte{byte(n)}, n)...)
+}
@@ -0,0 +1,547 @@
+package wemo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SetupHost is where a device in setup mode answers on its own access point,
+// the "WeMo.Switch.XXX" network it opens when it is new or was reset.
+const SetupHost = "10.22.22.1:49152"
+
+// WiFiAuth is the authentication mode of a WiFi network.
+type WiFiAuth string
+
+// Authentication modes the firmware supports. There is no WPA3: devices only
+// join WPA3 networks running in WPA2 transition mode, as WPA2PSK.
+const (
+	AuthOpen    WiFiAuth = "OPEN"
+	AuthWEP     WiFiAuth = "WEP"
+	AuthWPAPSK  WiFiAuth = "WPAPSK"
+	AuthWPA2PSK WiFiAuth = "WPA2PSK"
+)
+
+// WiFiEncrypt is the encryption of a WiFi network.
+type WiFiEncrypt string
+
+// Encryption modes the firmware supports
+const (
+	EncryptNone    WiFiEncrypt = "NONE"
+	EncryptWEP     WiFiEncrypt = "WEP"
+	EncryptAES     WiFiEncrypt = "AES"
+	EncryptTKIP    WiFiEncrypt = "TKIP"
+	EncryptTKIPAES WiFiEncrypt = "TKIPAES"
+)
+
+// AccessPoint is a WiFi network seen by a device in setup mode.
+type AccessPoint struct {
+	SSID    string
+	Channel int
+	Signal  int // percent
+	Auth    WiFiAuth
+	Encrypt WiFiEncrypt
+}
+
+// HomeNetwork is the network a device should join.
+type HomeNetwork struct {
+	SSID     string
+	Password string
+	Auth     WiFiAuth
+	Encrypt  WiFiEncrypt
+	Channel  int
+}
+
+// Validate rejects settings the firmware can't join with, which it would
+// otherwise only report as a failure to join after a while.
+func (n HomeNetwork) Validate() error {
+	if n.SSID == "" {
+		return errors.New("no SSID given")
+	}
+	if len(n.SSID) > 32 {
+		return fmt.Errorf("SSID %q is longer than 32 bytes", n.SSID)
+	}
+	if n.Channel < 0 || n.Channel > 14 {
+		return fmt.Errorf("channel %d is not a 2.4 GHz channel, the device can't use 5 GHz networks", n.Channel)
+	}
+
+	switch n.Auth {
+	case AuthOpen:
+		if n.Encrypt != EncryptNone {
+			return fmt.Errorf("open networks use encryption %s, not %s", EncryptNone, n.Encrypt)
+		}
+		if n.Password != "" {
+			return errors.New("open networks have no password")
+		}
+	case AuthWEP:
+		if n.Encrypt != EncryptWEP {
+			return fmt.Errorf("WEP networks use encryption %s, not %s", EncryptWEP, n.Encrypt)
+		}
+		switch len(n.Password) {
+		case 5, 13:
+		case 10, 26:
+			if !isHex(n.Password) {
+				return errors.New("WEP keys of 10 or 26 characters must be hex digits")
+			}
+		default:
+			return errors.New("WEP keys are 5 or 13 characters, or 10 or 26 hex digits")
+		}
+	case AuthWPAPSK, AuthWPA2PSK:
+		switch n.Encrypt {
+		case EncryptAES, EncryptTKIP, EncryptTKIPAES:
+		default:
+			return fmt.Errorf("%s networks use encryption %s, %s or %s, not %s", n.Auth, EncryptAES, EncryptTKIP, EncryptTKIPAES, n.Encrypt)
+		}
+		if len(n.Password) < 8 || len(n.Password) > 64 {
+			return errors.New("WPA passwords are 8 to 63 characters, or 64 hex digits")
+		}
+		if len(n.Password) == 64 && !isHex(n.Password) {
+			return errors.New("WPA keys of 64 characters must be hex digits")
+		}
+	default:
+		if strings.Contains(string(n.Auth), "WPA3") || strings.Contains(string(n.Auth), "SAE") {
+			return fmt.Errorf("the device doesn't support %s, enable WPA2/WPA3 transition mode and use %s", n.Auth, AuthWPA2PSK)
+		}
+		return fmt.Errorf("unknown authentication mode %q", n.Auth)
+	}
+	return nil
+}
+
+// isHex reports whether s consists of hex digits only.
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// HomeNetwork returns the settings to join the access point with password.
+func (ap AccessPoint) HomeNetwork(password string) HomeNetwork {
+	return HomeNetwork{SSID: ap.SSID, Password: password, Auth: ap.Auth, Encrypt: ap.Encrypt, Channel: ap.Channel}
+}
+
+// WiFiSetup wraps the WiFiSetup service, used to move a device in setup mode
+// onto the home network. The machine running it must be connected to the
+// device's access point. The setup steps are GetApList, Device.SyncTime,
+// ConnectHomeNetwork, WaitForNetwork and FinishSetup.
+type WiFiSetup struct {
+	Device *Device
+	Name   string // if set, FinishSetup renames the device
+}
+
+// NewWiFiSetup returns the setup service of the device at host, typically
+// SetupHost.
+func NewWiFiSetup(host string) *WiFiSetup {
+	return &WiFiSetup{Device: &Device{Host: host}}
+}
+
+// GetApList returns the networks the device can see.
+func (s *WiFiSetup) GetApList(ctx context.Context) ([]AccessPoint, error) {
+	response, err := s.Device.action(ctx, "WiFiSetup", "GetApList")
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := responseValue(response, "ApList")
+	if err != nil {
+		return nil, err
+	}
+	return parseApList(value)
+}
+
+// parseApList parses the ApList value: a "Page:1/1/3$" header followed by one
+// "ssid|channel|signal|auth/encrypt," line per network.
+func parseApList(value string) ([]AccessPoint, error) {
+	if i := strings.Index(value, "$"); i >= 0 {
+		value = value[i+1:]
+	}
+
+	var aps []AccessPoint
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSuffix(strings.TrimSpace(line), ",")
+		if line == "" {
+			continue
+		}
+
+		// SSIDs may contain "|", the other fields can't
+		fields := strings.Split(line, "|")
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("Failed to parse access point %q", line)
+		}
+		n := len(fields)
+		ap := AccessPoint{SSID: strings.Join(fields[:n-3], "|")}
+
+		var err error
+		if ap.Channel, err = strconv.Atoi(fields[n-3]); err != nil {
+			return nil, fmt.Errorf("Failed to parse channel of access point %q:\n\t%s", line, err)
+		}
+		if ap.Signal, err = strconv.Atoi(fields[n-2]); err != nil {
+			return nil, fmt.Errorf("Failed to parse signal of access point %q:\n\t%s", line, err)
+		}
+		security := strings.SplitN(fields[n-1], "/", 2)
+		ap.Auth = WiFiAuth(security[0])
+		if len(security) == 2 {
+			ap.Encrypt = WiFiEncrypt(security[1])
+		}
+
+		aps = append(aps, ap)
+	}
+	return aps, nil
+}
+
+// MetaInfo identifies a device in setup mode.
+type MetaInfo struct {
+	MAC       string
+	Serial    string
+	Firmware  string
+	SetupSSID string // the device's access point
+}
+
+// MetaInfo returns the identity of the device, which is also the key to
+// encrypt the WiFi password with.
+func (s *WiFiSetup) MetaInfo(ctx context.Context) (*MetaInfo, error) {
+	response, err := s.Device.action(ctx, "metainfo", "GetMetaInfo")
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := responseValue(response, "MetaInfo")
+	if err != nil {
+		return nil, err
+	}
+
+	// MAC|serial|SKU|firmware|access point|product
+	fields := strings.Split(value, "|")
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("Failed to parse MetaInfo %q", value)
+	}
+	info := &MetaInfo{MAC: fields[0], Serial: fields[1]}
+	if len(fields) > 4 {
+		info.Firmware, info.SetupSSID = fields[3], fields[4]
+	}
+	return info, nil
+}
+
+// ConnectHomeNetwork asks the device to join the network, after checking the
+// settings with Validate. The password is encrypted with EncryptWiFiPassword
+// using the device's MetaInfo. The device answers right away and joins in the
+// background; it drops its access point once it has joined.
+func (s *WiFiSetup) ConnectHomeNetwork(ctx context.Context, network HomeNetwork) error {
+	if err := network.Validate(); err != nil {
+		return err
+	}
+
+	password := network.Password
+	if password != "" {
+		info, err := s.MetaInfo(ctx)
+		if err != nil {
+			return err
+		}
+		if password, err = EncryptWiFiPassword(password, info.MAC, info.Serial); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.Device.action(ctx, "WiFiSetup", "ConnectHomeNetwork",
+		actionArgument{"ssid", network.SSID},
+		actionArgument{"auth", string(network.Auth)},
+		actionArgument{"password", password},
+		actionArgument{"encrypt", string(network.Encrypt)},
+		actionArgument{"channel", strconv.Itoa(network.Channel)},
+	)
+	return err
+}
+
+// NetworkStatus is how far a device in setup mode got joining the home
+// network.
+type NetworkStatus int
+
+// Network states reported by GetNetworkStatus
+const (
+	NetworkConnecting NetworkStatus = 0
+	NetworkConnected  NetworkStatus = 1
+	NetworkFailed     NetworkStatus = 2 // usually a wrong password
+	NetworkNoInternet NetworkStatus = 3 // joined, but the cloud is unreachable
+)
+
+func (s NetworkStatus) String() string {
+	switch s {
+	case NetworkConnecting:
+		return "connecting"
+	case NetworkConnected:
+		return "connected"
+	case NetworkFailed:
+		return "failed"
+	case NetworkNoInternet:
+		return "connected without internet"
+	}
+	return "status(" + strconv.Itoa(int(s)) + ")"
+}
+
+// Joined reports whether the device is on the home network.
+func (s NetworkStatus) Joined() bool {
+	return s == NetworkConnected || s == NetworkNoInternet
+}
+
+// GetNetworkStatus returns the state of joining the home network.
+func (s *WiFiSetup) GetNetworkStatus(ctx context.Context) (NetworkStatus, error) {
+	response, err := s.Device.action(ctx, "WiFiSetup", "GetNetworkStatus")
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := responseValue(response, "NetworkStatus")
+	if err != nil {
+		return 0, err
+	}
+	status, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse NetworkStatus %q:\n\t%s", value, err)
+	}
+	return NetworkStatus(status), nil
+}
+
+// WaitForNetwork polls GetNetworkStatus every interval until the device has
+// joined the home network, joining failed or ctx is done; use a context with
+// a timeout to bound the wait. Every poll is reported to progress, if set,
+// with the error of the request when it failed: the device may briefly be
+// unreachable while it switches networks, so failed requests don't end the
+// wait.
+func (s *WiFiSetup) WaitForNetwork(ctx context.Context, interval time.Duration, progress func(NetworkStatus, error)) (NetworkStatus, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status, err := s.GetNetworkStatus(ctx)
+		if progress != nil {
+			progress(status, err)
+		}
+		if err == nil {
+			if status.Joined() {
+				return status, nil
+			}
+			if status == NetworkFailed {
+				return status, errors.New("device failed to join the network, check the password")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// CloseSetup ends setup mode once the device has joined the home network; the
+// device then shuts down its access point.
+func (s *WiFiSetup) CloseSetup(ctx context.Context) error {
+	_, err := s.Device.action(ctx, "WiFiSetup", "CloseSetup")
+	return err
+}
+
+// DiscoverFunc finds the devices on the local network.
+type DiscoverFunc func(ctx context.Context) ([]*Device, error)
+
+// discoverAll is the DiscoverFunc used when none is given. It searches for
+// every device type with DiscoverTypes, splitting a budget of 5 seconds, or
+// less when ctx expires sooner, between the searches, and returns when ctx is
+// done.
+func discoverAll(ctx context.Context) ([]*Device, error) {
+	_, span := startSpan(ctx, "wemo DiscoverAll", trace.SpanKindInternal)
+	budget := 5 * time.Second
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < budget {
+		budget = time.Until(deadline)
+	}
+	if err := ctx.Err(); err != nil || budget <= 0 {
+		if err == nil {
+			err = context.DeadlineExceeded
+		}
+		endSpan(span, err)
+		return nil, err
+	}
+
+	type result struct {
+		devices []*Device
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		devices, err := (&Wemo{}).DiscoverTypes(budget / time.Duration(len(deviceTypes)))
+		done <- result{devices, err}
+	}()
+
+	var devices []*Device
+	var err error
+	select {
+	case r := <-done:
+		devices, err = r.devices, r.err
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	span.SetAttributes(AttrFound.Int(len(devices)))
+	endSpan(span, err)
+	return devices, err
+}
+
+// WaitForDevice discovers devices every interval until one with the given
+// serial number answers, and returns it. This is how a provisioned device is
+// found on the home network, where it got a new address. discover defaults to
+// SSDP discovery of all device types.
+func WaitForDevice(ctx context.Context, serial string, interval time.Duration, discover DiscoverFunc) (*Device, error) {
+	if discover == nil {
+		discover = discoverAll
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		devices, err := discover(ctx)
+		if err == nil {
+			for _, device := range devices {
+				info, err := device.FetchDeviceInfo(ctx)
+				if err == nil && info.SerialNumber == serial {
+					return device, nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("device %s didn't show up on the network => %s", serial, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// IdentityError reports a device that isn't the device that was set up.
+type IdentityError struct {
+	Host     string
+	Field    string // serial or MAC
+	Expected string
+	Actual   string
+}
+
+func (e *IdentityError) Error() string {
+	return fmt.Sprintf("device at %s has %s %s, expected %s", e.Host, e.Field, e.Actual, e.Expected)
+}
+
+// VerifyIdentity checks that the device has the serial and MAC address read
+// during setup, see WiFiSetup.MetaInfo. An empty mac isn't checked. Errors
+// other than failing to reach the device are *IdentityError.
+func (d *Device) VerifyIdentity(ctx context.Context, serial, mac string) error {
+	info, err := d.FetchDeviceInfo(ctx)
+	if err != nil {
+		return err
+	}
+	if info.SerialNumber != serial {
+		return &IdentityError{Host: d.Host, Field: "serial", Expected: serial, Actual: info.SerialNumber}
+	}
+	if mac != "" && normalizeMAC(info.MacAddress) != normalizeMAC(mac) {
+		return &IdentityError{Host: d.Host, Field: "MAC", Expected: mac, Actual: info.MacAddress}
+	}
+	return nil
+}
+
+func normalizeMAC(mac string) string {
+	return strings.ToUpper(strings.NewReplacer(":", "", "-", "").Replace(mac))
+}
+
+// FinishSetup closes setup mode and waits for the device to appear on the home
+// network, returning it with its new address, and gives it s.Name. Call it
+// once WaitForNetwork reports the device joined; the machine running it must
+// be back on the home network by then.
+func (s *WiFiSetup) FinishSetup(ctx context.Context, serial string, discover DiscoverFunc) (*Device, error) {
+	if err := s.CloseSetup(ctx); err != nil {
+		return nil, err
+	}
+
+	device, err := WaitForDevice(ctx, serial, time.Second, discover)
+	if err != nil {
+		return nil, err
+	}
+	if s.Name != "" {
+		if err := device.ChangeFriendlyName(ctx, s.Name); err != nil {
+			return device, fmt.Errorf("unable to name %s => %s", device.Host, err)
+		}
+	}
+	return device, nil
+}
+
+// WeakSignal is the signal strength, in percent, below which devices tend to
+// drop off the network.
+const WeakSignal = 40
+
+// SetupDiagnostics describes how well a device receives a network, see
+// Diagnose.
+type SetupDiagnostics struct {
+	SSID    string
+	Found   bool // the device sees the network at all
+	Signal  int  // percent, of the strongest access point with the SSID
+	Channel int
+	Weak    bool   // Signal is below WeakSignal
+	Router  string // GetRouterInformation, empty when unsupported
+}
+
+// Diagnose scans for the network the device is about to join, so a setup tool
+// can warn when the device would be out of range where it is placed.
+func (s *WiFiSetup) Diagnose(ctx context.Context, ssid string) (*SetupDiagnostics, error) {
+	aps, err := s.GetApList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostics := &SetupDiagnostics{SSID: ssid}
+	for _, ap := range aps {
+		if ap.SSID == ssid && (!diagnostics.Found || ap.Signal > diagnostics.Signal) {
+			diagnostics.Found = true
+			diagnostics.Signal = ap.Signal
+			diagnostics.Channel = ap.Channel
+		}
+	}
+	diagnostics.Weak = diagnostics.Signal < WeakSignal
+
+	// older firmware doesn't know the action
+	diagnostics.Router, _ = s.RouterInformation(ctx)
+
+	return diagnostics, nil
+}
+
+// RouterInformation returns what the device knows about the router it is
+// configured for. The format of the value differs between firmware releases,
+// so it is returned as is.
+func (s *WiFiSetup) RouterInformation(ctx context.Context) (string, error) {
+	response, err := s.Device.action(ctx, "WiFiSetup", "GetRouterInformation")
+	if err != nil {
+		return "", err
+	}
+	return responseValue(response, "RouterInformation")
+}
+
+// SignalStrength returns the strength, in percent, at which the device
+// receives its network.
+func (d *Device) SignalStrength(ctx context.Context) (int, error) {
+	response, err := d.action(ctx, "basicevent", "GetSignalStrength")
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := responseValue(response, "SignalStrength")
+	if err != nil {
+		return 0, err
+	}
+	signal, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse SignalStrength %q:\n\t%s", value, err)
+	}
+	return signal, nil
+}
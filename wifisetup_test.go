@@ -0,0 +1,286 @@
+package wemo
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testApList = `Page:1/1/3$
+Home|6|100|WPA2PSK/AES,
+Guest|network|11|40|OPEN/NONE,
+Neighbour|1|12|WPAPSK/TKIPAES,
+`
+
+// setupServer fakes the WiFiSetup service of a device in setup mode.
+type setupServer struct {
+	*httptest.Server
+	connected map[string]string
+	statuses  []string // returned by GetNetworkStatus in turn
+	closed    bool
+	calls     map[string]int
+}
+
+func newSetupServer(t *testing.T) *setupServer {
+	s := &setupServer{calls: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if action := strings.TrimPrefix(r.Header.Get("SOAPACTION"), `"`); action != "" {
+			s.calls[action[strings.Index(action, "#")+1:len(action)-1]]++
+		}
+		switch {
+		case strings.Contains(string(body), "<u:TimeSync "):
+			fmt.Fprint(w, testMessageHeader+`<u:TimeSyncResponse xmlns:u="urn:Belkin:service:timesync:1"></u:TimeSyncResponse>`+testMessageFooter)
+		case strings.Contains(string(body), "<u:GetApList "):
+			fmt.Fprint(w, testMessageHeader+`<u:GetApListResponse xmlns:u="urn:Belkin:service:WiFiSetup:1"><ApList>`+testApList+`</ApList></u:GetApListResponse>`+testMessageFooter)
+		case strings.Contains(string(body), "<u:GetMetaInfo "):
+			fmt.Fprint(w, testMessageHeader+`<u:GetMetaInfoResponse xmlns:u="urn:Belkin:service:metainfo:1"><MetaInfo>EC1A5974B1EC|221248K0102C92|Plugin Device|WeMo_WW_2.00.11057.PVT-OWRT-SNS|WeMo.Switch.C92|Socket</MetaInfo></u:GetMetaInfoResponse>`+testMessageFooter)
+		case strings.Contains(string(body), "<u:ConnectHomeNetwork "):
+			s.connected = make(map[string]string)
+			for _, name := range []string{"ssid", "auth", "password", "encrypt", "channel"} {
+				s.connected[name], _ = responseValue(body, name)
+			}
+			fmt.Fprint(w, testMessageHeader+`<u:ConnectHomeNetworkResponse xmlns:u="urn:Belkin:service:WiFiSetup:1"><PairingStatus>Connecting</PairingStatus></u:ConnectHomeNetworkResponse>`+testMessageFooter)
+		case strings.Contains(string(body), "<u:GetNetworkStatus "):
+			status := "0"
+			if len(s.statuses) > 0 {
+				status, s.statuses = s.statuses[0], s.statuses[1:]
+			}
+			if status == "" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, testMessageHeader+`<u:GetNetworkStatusResponse xmlns:u="urn:Belkin:service:WiFiSetup:1"><NetworkStatus>`+status+`</NetworkStatus></u:GetNetworkStatusResponse>`+testMessageFooter)
+		case strings.Contains(string(body), "<u:GetSignalStrength "):
+			fmt.Fprint(w, testMessageHeader+`<u:GetSignalStrengthResponse xmlns:u="urn:Belkin:service:basicevent:1"><SignalStrength>87</SignalStrength></u:GetSignalStrengthResponse>`+testMessageFooter)
+		case strings.Contains(string(body), "<u:CloseSetup "):
+			s.closed = true
+			fmt.Fprint(w, testMessageHeader+`<u:CloseSetupResponse xmlns:u="urn:Belkin:service:WiFiSetup:1"><status>success</status></u:CloseSetupResponse>`+testMessageFooter)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	return s
+}
+
+func (s *setupServer) setup() *WiFiSetup {
+	return NewWiFiSetup(strings.TrimPrefix(s.URL, "http://"))
+}
+
+func TestWiFiSetup(t *testing.T) {
+	server := newSetupServer(t)
+	defer server.Close()
+
+	ctx := context.Background()
+	setup := server.setup()
+	aps, err := setup.GetApList(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []AccessPoint{
+		{SSID: "Home", Channel: 6, Signal: 100, Auth: "WPA2PSK", Encrypt: "AES"},
+		{SSID: "Guest|network", Channel: 11, Signal: 40, Auth: "OPEN", Encrypt: "NONE"},
+		{SSID: "Neighbour", Channel: 1, Signal: 12, Auth: "WPAPSK", Encrypt: "TKIPAES"},
+	}
+	if len(aps) != len(expected) {
+		t.Fatalf("Expected: %d access points, got: %+v", len(expected), aps)
+	}
+	for i := range expected {
+		if aps[i] != expected[i] {
+			t.Errorf("Expected: %+v, got: %+v", expected[i], aps[i])
+		}
+	}
+
+	if err := setup.ConnectHomeNetwork(ctx, aps[0].HomeNetwork("secret12")); err != nil {
+		t.Fatal(err)
+	}
+	if server.connected["ssid"] != "Home" || server.connected["auth"] != "WPA2PSK" || server.connected["channel"] != "6" {
+		t.Errorf("Expected: Home/WPA2PSK on channel 6, got: %v", server.connected)
+	}
+	if server.connected["password"] != "/rZyLPqtD5Fre6TNyThIJA==1808" {
+		t.Errorf("Expected: the encrypted password, got: %s", server.connected["password"])
+	}
+
+	if _, err := parseApList("Page:1/1/1$\nbroken,"); err == nil {
+		t.Error("Expected: an error parsing a broken access point")
+	}
+}
+
+func TestEncryptWiFiPassword(t *testing.T) {
+	// printf secret | openssl enc -aes-128-cbc -md md5 -S 4543314135393232 \
+	//   -iv 4543314135393232313234384b303130 -pass pass:EC1A59221248K0102C9274B1EC -a
+	encrypted, err := EncryptWiFiPassword("secret", "EC1A5974B1EC", "221248K0102C92")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Q+6BLfBvPwMtpdLkQ/U3NQ==1806"; encrypted != expected {
+		t.Errorf("Expected: %s, got: %s", expected, encrypted)
+	}
+
+	if _, err := EncryptWiFiPassword("secret", "EC1A59", "221248K0102C92"); err == nil {
+		t.Error("Expected: an error for a short MAC address")
+	}
+}
+
+func TestWaitForNetwork(t *testing.T) {
+	server := newSetupServer(t)
+	defer server.Close()
+	server.statuses = []string{"0", "", "0", "1"}
+
+	var seen []string
+	progress := func(status NetworkStatus, err error) {
+		if err != nil {
+			seen = append(seen, "error")
+			return
+		}
+		seen = append(seen, status.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	status, err := server.setup().WaitForNetwork(ctx, time.Millisecond, progress)
+	if err != nil || status != NetworkConnected {
+		t.Fatalf("Expected: connected, got: %s, %v", status, err)
+	}
+	if strings.Join(seen, ",") != "connecting,error,connecting,connected" {
+		t.Errorf("Expected: every poll reported, got: %v", seen)
+	}
+
+	server.statuses = []string{"0", "2"}
+	if status, err := server.setup().WaitForNetwork(ctx, time.Millisecond, nil); err == nil || status != NetworkFailed {
+		t.Errorf("Expected: failed, got: %s, %v", status, err)
+	}
+}
+
+func TestFinishSetup(t *testing.T) {
+	server := newSetupServer(t)
+	defer server.Close()
+
+	name := ""
+	lan := func(serial string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			if strings.Contains(string(body), "<u:ChangeFriendlyName ") {
+				name, _ = responseValue(body, "FriendlyName")
+				fmt.Fprint(w, testMessageHeader+`<u:ChangeFriendlyNameResponse xmlns:u="urn:Belkin:service:basicevent:1"></u:ChangeFriendlyNameResponse>`+testMessageFooter)
+				return
+			}
+			fmt.Fprintf(w, `<root><device><deviceType>%s</deviceType><serialNumber>%s</serialNumber></device></root>`, Controllee, serial)
+		}))
+	}
+	other := lan("221248K0100001")
+	defer other.Close()
+	provisioned := lan("221248K0102C92")
+	defer provisioned.Close()
+
+	scans := 0
+	discover := func(context.Context) ([]*Device, error) {
+		scans++
+		devices := []*Device{{Host: strings.TrimPrefix(other.URL, "http://")}}
+		if scans > 1 {
+			devices = append(devices, &Device{Host: strings.TrimPrefix(provisioned.URL, "http://")})
+		}
+		return devices, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	setup := server.setup()
+	setup.Name = "Porch & Patio"
+	device, err := setup.FinishSetup(ctx, "221248K0102C92", discover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Porch & Patio" {
+		t.Errorf("Expected: the device to be named, got: %q", name)
+	}
+	if !server.closed || device.Host != strings.TrimPrefix(provisioned.URL, "http://") {
+		t.Errorf("Expected: setup closed and the device at %s, got: %v and %s", provisioned.URL, server.closed, device.Host)
+	}
+}
+
+func TestHomeNetworkValidate(t *testing.T) {
+	valid := []HomeNetwork{
+		{SSID: "Home", Password: "secret12", Auth: AuthWPA2PSK, Encrypt: EncryptAES, Channel: 6},
+		{SSID: "Home", Password: "secret12", Auth: AuthWPAPSK, Encrypt: EncryptTKIPAES},
+		{SSID: "Cafe", Auth: AuthOpen, Encrypt: EncryptNone, Channel: 11},
+		{SSID: "Old", Password: "0123456789", Auth: AuthWEP, Encrypt: EncryptWEP},
+		{SSID: "Home", Password: strings.Repeat("0123456789abcDEF", 4), Auth: AuthWPA2PSK, Encrypt: EncryptAES},
+	}
+	for _, network := range valid {
+		if err := network.Validate(); err != nil {
+			t.Errorf("%+v: Expected: valid, got: %s", network, err)
+		}
+	}
+
+	invalid := []HomeNetwork{
+		{Password: "secret12", Auth: AuthWPA2PSK, Encrypt: EncryptAES},
+		{SSID: "Home", Password: "short", Auth: AuthWPA2PSK, Encrypt: EncryptAES},
+		{SSID: "Home", Password: "secret12", Auth: AuthWPA2PSK, Encrypt: EncryptNone},
+		{SSID: "Home", Password: "secret12", Auth: "WPA3SAE", Encrypt: EncryptAES},
+		{SSID: "Home", Password: "secret12", Auth: AuthWPA2PSK, Encrypt: EncryptAES, Channel: 36},
+		{SSID: "Cafe", Password: "secret12", Auth: AuthOpen, Encrypt: EncryptNone},
+		{SSID: "Old", Password: "0123", Auth: AuthWEP, Encrypt: EncryptWEP},
+		{SSID: "Old", Password: "012345678g", Auth: AuthWEP, Encrypt: EncryptWEP},
+		{SSID: "Home", Password: strings.Repeat("secret12", 8), Auth: AuthWPA2PSK, Encrypt: EncryptAES},
+	}
+	for _, network := range invalid {
+		if err := network.Validate(); err == nil {
+			t.Errorf("%+v: Expected: an error", network)
+		}
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	server := newSetupServer(t)
+	defer server.Close()
+
+	ctx := context.Background()
+	setup := server.setup()
+	diagnostics, err := setup.Diagnose(ctx, "Neighbour")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diagnostics.Found || diagnostics.Signal != 12 || diagnostics.Channel != 1 || !diagnostics.Weak || diagnostics.Router != "" {
+		t.Errorf("Expected: a weak signal on channel 1, got: %+v", diagnostics)
+	}
+
+	diagnostics, err = setup.Diagnose(ctx, "Home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diagnostics.Found || diagnostics.Weak {
+		t.Errorf("Expected: a strong signal, got: %+v", diagnostics)
+	}
+
+	if diagnostics, _ = setup.Diagnose(ctx, "Elsewhere"); diagnostics.Found || !diagnostics.Weak {
+		t.Errorf("Expected: no signal, got: %+v", diagnostics)
+	}
+
+	signal, err := setup.Device.SignalStrength(ctx)
+	if err != nil || signal != 87 {
+		t.Errorf("Expected: 87, got: %d, %v", signal, err)
+	}
+}
+
+func TestDiscoverAllHonoursContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	discoverAll(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected: discovery within the deadline, took: %s", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := discoverAll(ctx); err != context.Canceled {
+		t.Errorf("Expected: %s, got: %v", context.Canceled, err)
+	}
+}